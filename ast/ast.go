@@ -61,7 +61,7 @@ func (bs *BlockStatement) String() string {
 }
 
 type LetStatement struct {
-	Token token.Token // token.Let
+	Token token.Token // token.Let or token.CONST
 	Name  *Identifier
 	Value Expression
 }
@@ -71,11 +71,16 @@ func (ls *LetStatement) TokenLiteral() string {
 	return ls.Token.Literal
 }
 
+// `const name = value;`で宣言された束縛は再宣言、再代入不可
+func (ls *LetStatement) IsConst() bool {
+	return ls.Token.Type == token.CONST
+}
+
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String())
+	out.WriteString(declarationString(ls.Name))
 	out.WriteString(" = ")
 
 	if ls.Value != nil {
@@ -90,6 +95,13 @@ func (ls *LetStatement) String() string {
 type Identifier struct {
 	Token token.Token // 'ident' token
 	Value string
+	// 型注釈(let、関数の引数のみ、無ければnil)
+	Type TypeExpression
+	// resolverが静的に解決した束縛の位置(Depth個外側の環境の、Slot番目の変数)
+	// Resolvedがfalseの場合、評価時に名前で探す
+	Resolved bool
+	Depth    int
+	Slot     int
 }
 
 // NOTE: let文は値を返さないが、後で値を返すidentifierも作るのでexpressionにする
@@ -126,6 +138,27 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+type ThrowStatement struct {
+	Token token.Token // 'throw' token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ts.TokenLiteral() + " ")
+
+	if ts.Value != nil {
+		out.WriteString(ts.Value.String())
+	}
+
+	out.WriteString(";")
+
+	return out.String()
+}
+
 type ExpressionStatement struct {
 	Token      token.Token // 式の最初のtoken
 	Expression Expression
@@ -161,6 +194,14 @@ func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
 func (b *Boolean) String() string       { return b.Token.Literal }
 
+type Null struct {
+	Token token.Token
+}
+
+func (n *Null) expressionNode()      {}
+func (n *Null) TokenLiteral() string { return n.Token.Literal }
+func (n *Null) String() string       { return n.Token.Literal }
+
 type PrefixExpression struct {
 	Token    token.Token // i.e: '!', '-'
 	Operator string
@@ -224,10 +265,49 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// `try { ... } catch (e) { ... } finally { ... }`
+// (catch, finallyはどちらか一方を省略可能)
+type TryExpression struct {
+	Token     token.Token // 'try' token
+	Block     *BlockStatement
+	Parameter *Identifier // catchで捕捉したエラーを束縛する変数
+	Catch     *BlockStatement
+	Finally   *BlockStatement
+	// catchの本体で宣言される変数(resolverが設定)
+	CatchScope *Scope
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+
+	if te.Catch != nil {
+		out.WriteString(" catch (")
+		out.WriteString(te.Parameter.String())
+		out.WriteString(") ")
+		out.WriteString(te.Catch.String())
+	}
+
+	if te.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(te.Finally.String())
+	}
+
+	return out.String()
+}
+
 type FunctionLiteral struct {
 	Token      token.Token // 'fn' token
 	Parameters []*Identifier
 	Body       *BlockStatement
+	// 戻り値の型注釈(無ければnil)
+	ReturnType TypeExpression
+	// 引数と本体で宣言される変数(resolverが設定)
+	Scope *Scope
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
@@ -237,13 +317,16 @@ func (fl *FunctionLiteral) String() string {
 
 	params := []string{}
 	for _, p := range fl.Parameters {
-		params = append(params, p.String())
+		params = append(params, declarationString(p))
 	}
 
 	out.WriteString(fl.TokenLiteral())
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") ")
+	if fl.ReturnType != nil {
+		out.WriteString("-> " + fl.ReturnType.String() + " ")
+	}
 	out.WriteString(fl.Body.String())
 
 	return out.String()
@@ -253,6 +336,8 @@ type CallExpression struct {
 	Token     token.Token // '(' token
 	Function  Expression  // Identifier or FunctionLiteral
 	Arguments []Expression
+	// 関数本体の末尾位置にある呼び出し(末尾呼び出し最適化の対象)
+	Tail bool
 }
 
 func (ce *CallExpression) expressionNode()      {}
@@ -305,9 +390,10 @@ func (al *ArrayLiteral) String() string {
 }
 
 type IndexExpression struct {
-	Token token.Token // '['
-	Left  Expression
-	Index Expression
+	Token    token.Token // '[' or '?['
+	Left     Expression
+	Index    Expression
+	Optional bool // `left?[index]` (leftがnullならnullを返す)
 }
 
 func (ie *IndexExpression) expressionNode()      {}
@@ -317,7 +403,7 @@ func (ie *IndexExpression) String() string {
 
 	out.WriteString("(")
 	out.WriteString(ie.Left.String())
-	out.WriteString("[")
+	out.WriteString(ie.TokenLiteral())
 	out.WriteString(ie.Index.String())
 	out.WriteString("]")
 	out.WriteString(")")
@@ -325,9 +411,25 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+// メンバーの連鎖(`a.b`, `a?.b`, `a[i]`, `a?[i]`, `a(x)`)の要素か
+// NOTE: `?.`, `?[`の左辺がnullの場合、連鎖の残り(`a?.b.c`の`.c`)も評価しない
+func IsChainElement(exp Expression) bool {
+	switch exp := exp.(type) {
+	case *InfixExpression:
+		return exp.Operator == "." || exp.Operator == "?."
+	case *IndexExpression, *CallExpression:
+		return true
+	default:
+		return false
+	}
+}
+
 type HashLiteral struct {
 	Token token.Token // '{' token
 	Pairs map[Expression]Expression
+	// NOTE: スプレッド(`{...h, "k": v}`)は後に書かれたものが優先されるため、
+	// Pairsとは別にソース上の順序でkeyを保持する(スプレッドはPairsには含まない)
+	Keys []Expression
 }
 
 func (hl *HashLiteral) expressionNode()      {}
@@ -336,8 +438,12 @@ func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+": "+value.String())
+	for _, key := range hl.Keys {
+		if spread, ok := key.(*SpreadExpression); ok {
+			pairs = append(pairs, spread.String())
+			continue
+		}
+		pairs = append(pairs, key.String()+": "+hl.Pairs[key].String())
 	}
 
 	out.WriteString("{")
@@ -347,9 +453,23 @@ func (hl *HashLiteral) String() string {
 	return out.String()
 }
 
+// `...arr`, `...hash` (配列/ハッシュリテラル、関数呼び出しの引数でのみ使用可能)
+type SpreadExpression struct {
+	Token token.Token // '...' token
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode()      {}
+func (se *SpreadExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadExpression) String() string {
+	return se.TokenLiteral() + se.Value.String()
+}
+
 type NameSpaceLiteral struct {
 	Token token.Token // 'namespace' token
 	Body  *BlockStatement
+	// 本体で宣言される変数(resolverが設定)
+	Scope *Scope
 }
 
 func (ns *NameSpaceLiteral) expressionNode()      {}
@@ -362,3 +482,23 @@ func (ns *NameSpaceLiteral) String() string {
 
 	return out.String()
 }
+
+type AssignExpression struct {
+	Token  token.Token // '=' token
+	Target Expression  // IndexExpression or InfixExpression(".")
+	Value  Expression
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ae.Target.String())
+	out.WriteString(" = ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
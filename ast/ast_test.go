@@ -2,6 +2,7 @@ package ast
 
 import (
 	"../token"
+	"strings"
 	"testing"
 )
 
@@ -26,3 +27,59 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. got=%q", program.String())
 	}
 }
+
+func TestWalk(t *testing.T) {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+	}
+
+	// let f = fn(x) { x + y }; f(z);
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let"},
+				Name:  ident("f"),
+				Value: &FunctionLiteral{
+					Parameters: []*Identifier{ident("x")},
+					Body: &BlockStatement{Statements: []Statement{
+						&ExpressionStatement{Expression: &InfixExpression{
+							Left: ident("x"), Operator: "+", Right: ident("y"),
+						}},
+					}},
+				},
+			},
+			&ExpressionStatement{Expression: &CallExpression{
+				Function:  ident("f"),
+				Arguments: []Expression{ident("z")},
+			}},
+		},
+	}
+
+	names := []string{}
+	Walk(program, func(node Node) bool {
+		if ident, ok := node.(*Identifier); ok {
+			names = append(names, ident.Value)
+		}
+		return true
+	})
+	expected := "f x x y f z"
+	if strings.Join(names, " ") != expected {
+		t.Errorf("wrong order of visited identifiers. want=%q, got=%q",
+			expected, strings.Join(names, " "))
+	}
+
+	// 関数リテラルの中は訪問しない
+	names = []string{}
+	Walk(program, func(node Node) bool {
+		if ident, ok := node.(*Identifier); ok {
+			names = append(names, ident.Value)
+		}
+		_, isFunction := node.(*FunctionLiteral)
+		return !isFunction
+	})
+	expected = "f f z"
+	if strings.Join(names, " ") != expected {
+		t.Errorf("wrong order of visited identifiers. want=%q, got=%q",
+			expected, strings.Join(names, " "))
+	}
+}
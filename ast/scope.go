@@ -0,0 +1,22 @@
+package ast
+
+// 関数、namespace、catchの本体で宣言される変数
+// 評価時には、環境のスロット(Namesと同じ順の配列)に束縛される
+type Scope struct {
+	Names []string
+	Slots map[string]int
+}
+
+func NewScope() *Scope {
+	return &Scope{Slots: make(map[string]int)}
+}
+
+// nameを宣言する(既に宣言されていれば何もしない)
+func (s *Scope) Declare(name string) int {
+	if slot, ok := s.Slots[name]; ok {
+		return slot
+	}
+	s.Slots[name] = len(s.Names)
+	s.Names = append(s.Names, name)
+	return s.Slots[name]
+}
@@ -0,0 +1,96 @@
+package ast
+
+import (
+	"../token"
+	"bytes"
+	"strings"
+)
+
+// 型注釈(`let n: int = 1;`, `fn(x: int) -> int { x }`)
+// NOTE: 評価時には無視され、型検査(typechecker)でのみ使われる
+type TypeExpression interface {
+	Node
+	typeNode()
+}
+
+// `int`, `array[int]`, `hash[string, int]`
+type NamedType struct {
+	Token     token.Token // 型名のtoken
+	Name      string
+	Arguments []TypeExpression
+}
+
+func (nt *NamedType) typeNode()            {}
+func (nt *NamedType) TokenLiteral() string { return nt.Token.Literal }
+func (nt *NamedType) String() string {
+	if len(nt.Arguments) == 0 {
+		return nt.Name
+	}
+	return nt.Name + "[" + joinTypes(nt.Arguments) + "]"
+}
+
+// `fn(int, ...any) -> int`
+type FunctionType struct {
+	Token      token.Token // 'fn' token
+	Parameters []TypeExpression
+	// 残りの引数全ての型(`...any`、無ければnil)
+	Variadic TypeExpression
+	// 省略した場合はnil
+	Return TypeExpression
+}
+
+func (ft *FunctionType) typeNode()            {}
+func (ft *FunctionType) TokenLiteral() string { return ft.Token.Literal }
+func (ft *FunctionType) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range ft.Parameters {
+		params = append(params, p.String())
+	}
+	if ft.Variadic != nil {
+		params = append(params, "..."+ft.Variadic.String())
+	}
+
+	out.WriteString("fn(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(")")
+	if ft.Return != nil {
+		out.WriteString(" -> ")
+		out.WriteString(ft.Return.String())
+	}
+
+	return out.String()
+}
+
+// `string | array`
+type UnionType struct {
+	Token token.Token // 最初の型のtoken
+	Types []TypeExpression
+}
+
+func (ut *UnionType) typeNode()            {}
+func (ut *UnionType) TokenLiteral() string { return ut.Token.Literal }
+func (ut *UnionType) String() string {
+	types := []string{}
+	for _, t := range ut.Types {
+		types = append(types, t.String())
+	}
+	return strings.Join(types, " | ")
+}
+
+func joinTypes(types []TypeExpression) string {
+	strs := []string{}
+	for _, t := range types {
+		strs = append(strs, t.String())
+	}
+	return strings.Join(strs, ", ")
+}
+
+// 型注釈付きの変数名(`x: int`)
+func declarationString(ident *Identifier) string {
+	if ident.Type == nil {
+		return ident.String()
+	}
+	return ident.String() + ": " + ident.Type.String()
+}
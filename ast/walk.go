@@ -0,0 +1,89 @@
+package ast
+
+// nodeとその子孫をソース上の順に訪問する
+// fがfalseを返した場合、そのnodeの子は訪問しない
+func Walk(node Node, f func(Node) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, stmt := range node.Statements {
+			Walk(stmt, f)
+		}
+	case *BlockStatement:
+		for _, stmt := range node.Statements {
+			Walk(stmt, f)
+		}
+	case *LetStatement:
+		Walk(node.Name, f)
+		walkExpression(node.Value, f)
+	case *ReturnStatement:
+		walkExpression(node.ReturnValue, f)
+	case *ThrowStatement:
+		walkExpression(node.Value, f)
+	case *ExpressionStatement:
+		walkExpression(node.Expression, f)
+	case *PrefixExpression:
+		walkExpression(node.Right, f)
+	case *InfixExpression:
+		walkExpression(node.Left, f)
+		walkExpression(node.Right, f)
+	case *IfExpression:
+		walkExpression(node.Condition, f)
+		walkBlock(node.Consequence, f)
+		walkBlock(node.Alternative, f)
+	case *TryExpression:
+		walkBlock(node.Block, f)
+		if node.Catch != nil {
+			Walk(node.Parameter, f)
+			walkBlock(node.Catch, f)
+		}
+		walkBlock(node.Finally, f)
+	case *FunctionLiteral:
+		for _, param := range node.Parameters {
+			Walk(param, f)
+		}
+		walkBlock(node.Body, f)
+	case *CallExpression:
+		walkExpression(node.Function, f)
+		for _, arg := range node.Arguments {
+			walkExpression(arg, f)
+		}
+	case *ArrayLiteral:
+		for _, el := range node.Elements {
+			walkExpression(el, f)
+		}
+	case *IndexExpression:
+		walkExpression(node.Left, f)
+		walkExpression(node.Index, f)
+	case *HashLiteral:
+		for _, key := range node.Keys {
+			walkExpression(key, f)
+			if _, ok := key.(*SpreadExpression); !ok {
+				walkExpression(node.Pairs[key], f)
+			}
+		}
+	case *SpreadExpression:
+		walkExpression(node.Value, f)
+	case *NameSpaceLiteral:
+		walkBlock(node.Body, f)
+	case *AssignExpression:
+		walkExpression(node.Target, f)
+		walkExpression(node.Value, f)
+	}
+}
+
+// NOTE: nilのポインタを持つinterfaceはnilと等しくならないため、型ごとにnilを調べる
+func walkExpression(exp Expression, f func(Node) bool) {
+	if exp != nil {
+		Walk(exp, f)
+	}
+}
+
+func walkBlock(block *BlockStatement, f func(Node) bool) {
+	if block != nil {
+		Walk(block, f)
+	}
+}
@@ -0,0 +1,271 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// バイトコード(命令列)
+// 各命令は1byteのOpcodeと、それに続くオペランド(ビッグエンディアン)からなる
+type Instructions []byte
+
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n",
+			len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota // 定数プールの値をpush
+	OpPop
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpInfix  // 二項演算子(オペランドはInfixOperatorsの添字)
+	OpPrefix // 前置演算子(オペランドはPrefixOperatorsの添字)
+
+	OpJump
+	OpJumpNotTruthy // 条件をpopし、falthyならジャンプ
+	// 左辺で式の値が決まる場合は左辺を残してジャンプ、それ以外は左辺をpop
+	// (オペランドはShortCutOperatorsの添字とジャンプ先)
+	// (`?.`, `?[`は続く命令で左辺を使うためpopしない)
+	OpJumpShortCut
+	OpJumpNotNameSpace // スタックトップがnamespaceでなければジャンプ(popしない)
+
+	// namespaceをpopし、その環境で右辺を評価する(オペランドは名前とNameSpaceMode)
+	OpEnterNameSpace
+	OpLeaveNameSpace
+
+	OpGetName // 環境から名前で参照(見つからなければ組み込み関数)
+	OpDefine
+	OpDefineConst
+	OpCheckConst // constで宣言済みならエラー
+	OpGetLocal   // スタック上の局所変数
+	OpSetLocal
+	OpGetCell // クロージャから参照される局所変数
+	OpSetCell
+	OpGetFree // クロージャが捕捉した変数
+
+	OpNameFunction // スタックトップの関数に名前が無ければ名前を付ける
+
+	OpClosure
+	OpNameSpace // namespaceリテラルの本体を評価
+
+	OpCall
+	OpTailCall
+	OpCallSpread // 引数を配列で受け取る(オペランドは末尾呼び出しなら1)
+	OpReturnValue
+	OpHalt // 値を返さずに終了(最後の文がletの場合)
+
+	OpArray
+	OpArrayAppend
+	OpArrayExtend // スプレッド
+	OpHash
+	OpHashKey // ハッシュのkeyとして使えるか確認
+	OpHashSet
+	OpHashMerge // スプレッド
+	OpIndex
+	OpSetIndex
+	OpSetField
+
+	OpThrow
+	OpSetupCatch
+	OpSetupFinally
+	OpPopHandler
+	OpBeginFinally // エラー、returnが無い状態でfinallyを評価
+	OpEndFinally   // finallyの評価前のエラー、returnを再開
+	OpPushScope    // catchの変数を束縛する環境
+	OpPopScope
+)
+
+type Definition struct {
+	Name          string
+	OperandWidths []int // 各オペランドのbyte数
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+	OpTrue:     {"OpTrue", []int{}},
+	OpFalse:    {"OpFalse", []int{}},
+	OpNull:     {"OpNull", []int{}},
+
+	OpInfix:  {"OpInfix", []int{1}},
+	OpPrefix: {"OpPrefix", []int{1}},
+
+	OpJump:             {"OpJump", []int{2}},
+	OpJumpNotTruthy:    {"OpJumpNotTruthy", []int{2}},
+	OpJumpShortCut:     {"OpJumpShortCut", []int{1, 2}},
+	OpJumpNotNameSpace: {"OpJumpNotNameSpace", []int{2}},
+
+	OpEnterNameSpace: {"OpEnterNameSpace", []int{2, 1}},
+	OpLeaveNameSpace: {"OpLeaveNameSpace", []int{}},
+
+	OpGetName:     {"OpGetName", []int{2}},
+	OpDefine:      {"OpDefine", []int{2}},
+	OpDefineConst: {"OpDefineConst", []int{2}},
+	OpCheckConst:  {"OpCheckConst", []int{2}},
+	OpGetLocal:    {"OpGetLocal", []int{2}},
+	OpSetLocal:    {"OpSetLocal", []int{2}},
+	OpGetCell:     {"OpGetCell", []int{2}},
+	OpSetCell:     {"OpSetCell", []int{2}},
+	OpGetFree:     {"OpGetFree", []int{2}},
+
+	OpNameFunction: {"OpNameFunction", []int{2}},
+
+	OpClosure:   {"OpClosure", []int{2}},
+	OpNameSpace: {"OpNameSpace", []int{2}},
+
+	OpCall:        {"OpCall", []int{1}},
+	OpTailCall:    {"OpTailCall", []int{1}},
+	OpCallSpread:  {"OpCallSpread", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpHalt:        {"OpHalt", []int{}},
+
+	OpArray:       {"OpArray", []int{2}},
+	OpArrayAppend: {"OpArrayAppend", []int{}},
+	OpArrayExtend: {"OpArrayExtend", []int{}},
+	OpHash:        {"OpHash", []int{}},
+	OpHashKey:     {"OpHashKey", []int{}},
+	OpHashSet:     {"OpHashSet", []int{}},
+	OpHashMerge:   {"OpHashMerge", []int{}},
+	OpIndex:       {"OpIndex", []int{}},
+	OpSetIndex:    {"OpSetIndex", []int{}},
+	OpSetField:    {"OpSetField", []int{2}},
+
+	OpThrow:        {"OpThrow", []int{}},
+	OpSetupCatch:   {"OpSetupCatch", []int{2}},
+	OpSetupFinally: {"OpSetupFinally", []int{2}},
+	OpPopHandler:   {"OpPopHandler", []int{}},
+	OpBeginFinally: {"OpBeginFinally", []int{}},
+	OpEndFinally:   {"OpEndFinally", []int{}},
+	OpPushScope:    {"OpPushScope", []int{}},
+	OpPopScope:     {"OpPopScope", []int{}},
+}
+
+// OpInfix, OpPrefix, OpJumpShortCutのオペランドが表す演算子
+var (
+	InfixOperators    = []string{"+", "-", "*", "/", "<", ">", "<=", ">=", "==", "!=", ".", "?."}
+	PrefixOperators   = []string{"!", "-"}
+	ShortCutOperators = []string{"&&", "||", "??", "?.", "?["}
+)
+
+// 演算子の添字(見つからなければ-1)
+func OperatorIndex(operators []string, operator string) int {
+	for i, op := range operators {
+		if op == operator {
+			return i
+		}
+	}
+	return -1
+}
+
+// OpEnterNameSpaceの2番目のオペランド
+const (
+	NameSpaceAccess = iota // `ns.x` (エラーにnamespace名を付ける)
+	NameSpaceAssign        // `ns.arr[i] = v`の左辺
+)
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
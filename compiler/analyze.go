@@ -0,0 +1,244 @@
+package compiler
+
+import (
+	"../ast"
+)
+
+// 関数リテラルの局所変数をスタックに置けるかどうかの解析結果
+type functionInfo struct {
+	// 局所変数を(評価器と同様)Environmentに束縛する
+	dynamic bool
+	// 局所変数(引数とトップレベルのlet)の宣言順
+	locals []string
+	// 内側の関数から参照される局所変数
+	captured map[string]bool
+}
+
+// NOTE: 評価器では関数呼び出しごとにEnvironmentを作り、変数を名前で探す
+// 以下の条件を満たす関数は、局所変数をスタック上に置いても評価結果が変わらない
+//   - self(), outer()を使わない、namespaceリテラルを含まない (環境ごと参照される)
+//   - letは本体のトップレベルにのみある (ifの中のletは束縛されないことがある)
+//   - catchが無い (catchの変数は内側の環境に束縛される)
+//   - 局所変数は束縛された後にのみ参照される
+//     (束縛前に参照すると外側の変数が見えるため。`let f = fn() { f() }`のfは例外)
+//   - constを含む変数の再宣言が無い
+//   - 内側の関数も上記を満たす
+//
+// 満たさない関数は評価器と同様、実行時に環境から名前で変数を探す
+func analyze(node ast.Node) map[*ast.FunctionLiteral]*functionInfo {
+	a := &analyzer{infos: make(map[*ast.FunctionLiteral]*functionInfo)}
+	a.walkNode(node, &analyzeScope{})
+	return a.infos
+}
+
+type analyzer struct {
+	infos map[*ast.FunctionLiteral]*functionInfo
+	// `ns.x`の右辺の中(右辺の関数リテラルはnsの環境で作られる)
+	dotDepth int
+}
+
+type analyzeScope struct {
+	info  *functionInfo // トップレベル、namespaceの本体はnil
+	outer *analyzeScope
+	// 局所変数が最初に束縛される文の位置(引数は-1)
+	firstLet map[string]int
+	// 解析中の文の位置
+	stmt int
+	// 解析中の`let f = fn...`のf
+	letFunction string
+}
+
+func (a *analyzer) walkNode(node ast.Node, scope *analyzeScope) {
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, stmt := range node.Statements {
+			a.walkStatement(stmt, scope, false)
+		}
+	case ast.Statement:
+		a.walkStatement(node, scope, false)
+	case ast.Expression:
+		a.walkExpression(node, scope)
+	}
+}
+
+func (a *analyzer) walkFunction(lit *ast.FunctionLiteral, outer *analyzeScope) {
+	info := &functionInfo{captured: make(map[string]bool)}
+	a.infos[lit] = info
+	if a.dotDepth > 0 {
+		info.dynamic = true
+	}
+
+	scope := &analyzeScope{info: info, outer: outer, firstLet: make(map[string]int)}
+
+	declared := make(map[string]int)
+	for _, param := range lit.Parameters {
+		declared[param.Value]++
+		if declared[param.Value] > 1 {
+			info.dynamic = true
+		}
+		scope.firstLet[param.Value] = -1
+		info.locals = append(info.locals, param.Value)
+	}
+
+	consts := make(map[string]bool)
+	for i, stmt := range lit.Body.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok {
+			continue
+		}
+
+		name := let.Name.Value
+		declared[name]++
+		if let.IsConst() {
+			consts[name] = true
+		}
+		if _, ok := scope.firstLet[name]; !ok {
+			scope.firstLet[name] = i
+			info.locals = append(info.locals, name)
+		}
+	}
+	for name := range consts {
+		if declared[name] > 1 {
+			info.dynamic = true
+		}
+	}
+
+	for i, stmt := range lit.Body.Statements {
+		scope.stmt = i
+		a.walkStatement(stmt, scope, true)
+	}
+
+	// 外側の関数の局所変数は、内側の関数から名前で参照できるよう環境に束縛する
+	if info.dynamic {
+		markDynamic(outer)
+	}
+}
+
+func markDynamic(scope *analyzeScope) {
+	for s := scope; s != nil; s = s.outer {
+		if s.info != nil {
+			s.info.dynamic = true
+		}
+	}
+}
+
+func (a *analyzer) walkStatement(stmt ast.Statement, scope *analyzeScope, topLevel bool) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		if !topLevel && scope.info != nil {
+			scope.info.dynamic = true
+		}
+
+		if _, ok := stmt.Value.(*ast.FunctionLiteral); ok && topLevel {
+			scope.letFunction = stmt.Name.Value
+			a.walkExpression(stmt.Value, scope)
+			scope.letFunction = ""
+			return
+		}
+		a.walkExpression(stmt.Value, scope)
+	case *ast.ReturnStatement:
+		a.walkExpression(stmt.ReturnValue, scope)
+	case *ast.ThrowStatement:
+		a.walkExpression(stmt.Value, scope)
+	case *ast.ExpressionStatement:
+		a.walkExpression(stmt.Expression, scope)
+	case *ast.BlockStatement:
+		a.walkBlock(stmt, scope)
+	}
+}
+
+func (a *analyzer) walkBlock(block *ast.BlockStatement, scope *analyzeScope) {
+	if block == nil {
+		return
+	}
+
+	for _, stmt := range block.Statements {
+		a.walkStatement(stmt, scope, false)
+	}
+}
+
+func (a *analyzer) walkExpression(exp ast.Expression, scope *analyzeScope) {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		a.resolve(exp.Value, scope)
+	case *ast.PrefixExpression:
+		a.walkExpression(exp.Right, scope)
+	case *ast.InfixExpression:
+		a.walkExpression(exp.Left, scope)
+		if exp.Operator == "." || exp.Operator == "?." {
+			a.dotDepth++
+			a.walkExpression(exp.Right, scope)
+			a.dotDepth--
+			return
+		}
+		a.walkExpression(exp.Right, scope)
+	case *ast.IfExpression:
+		a.walkExpression(exp.Condition, scope)
+		a.walkBlock(exp.Consequence, scope)
+		a.walkBlock(exp.Alternative, scope)
+	case *ast.TryExpression:
+		a.walkBlock(exp.Block, scope)
+		if exp.Catch != nil {
+			if scope.info != nil {
+				scope.info.dynamic = true
+			}
+			a.walkBlock(exp.Catch, scope)
+		}
+		a.walkBlock(exp.Finally, scope)
+	case *ast.FunctionLiteral:
+		a.walkFunction(exp, scope)
+	case *ast.CallExpression:
+		a.walkExpression(exp.Function, scope)
+		for _, arg := range exp.Arguments {
+			a.walkExpression(arg, scope)
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range exp.Elements {
+			a.walkExpression(el, scope)
+		}
+	case *ast.IndexExpression:
+		a.walkExpression(exp.Left, scope)
+		a.walkExpression(exp.Index, scope)
+	case *ast.HashLiteral:
+		for _, key := range exp.Keys {
+			a.walkExpression(key, scope)
+			if value, ok := exp.Pairs[key]; ok {
+				a.walkExpression(value, scope)
+			}
+		}
+	case *ast.SpreadExpression:
+		a.walkExpression(exp.Value, scope)
+	case *ast.NameSpaceLiteral:
+		markDynamic(scope)
+		a.walkBlock(exp.Body, &analyzeScope{outer: scope})
+	case *ast.AssignExpression:
+		a.walkExpression(exp.Value, scope)
+		a.walkExpression(exp.Target, scope)
+	}
+}
+
+func (a *analyzer) resolve(name string, scope *analyzeScope) {
+	for s := scope; s != nil; s = s.outer {
+		// トップレベル、namespaceの本体の変数は名前で参照
+		if s.info == nil {
+			break
+		}
+
+		pos, ok := s.firstLet[name]
+		if !ok {
+			continue
+		}
+
+		if !(pos < s.stmt || (pos == s.stmt && s.letFunction == name)) {
+			s.info.dynamic = true
+		}
+		if s != scope {
+			s.info.captured[name] = true
+		}
+		return
+	}
+
+	if name == "self" || name == "outer" {
+		markDynamic(scope)
+	}
+}
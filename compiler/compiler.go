@@ -0,0 +1,794 @@
+package compiler
+
+import (
+	"../ast"
+	"../code"
+	"../object"
+	"../token"
+	"fmt"
+)
+
+// NOTE: 評価器(evaluator)と同じ結果になるようASTをバイトコードにコンパイルする
+// 実行はvmパッケージで行う
+
+type Bytecode struct {
+	Main      *object.CompiledFunction // トップレベル
+	Constants []object.Object
+}
+
+type CompilationScope struct {
+	instructions code.Instructions
+	statements   []object.SourceRange
+	calls        []object.SourceRange
+}
+
+type Compiler struct {
+	constants []object.Object
+	// 変数名の定数プール上の位置(同じ名前は1つにまとめる)
+	names map[string]int
+
+	symbolTable *SymbolTable
+	scopes      []CompilationScope
+	infos       map[*ast.FunctionLiteral]*functionInfo
+
+	// コンパイルした関数(最後に定数プールを設定する)
+	functions []*object.CompiledFunction
+}
+
+func New() *Compiler {
+	return &Compiler{
+		names:       make(map[string]int),
+		symbolTable: NewDynamicSymbolTable(nil),
+		scopes:      []CompilationScope{{}},
+	}
+}
+
+// nodeをトップレベルとしてコンパイル
+// (最後の式文の値を返す。最後の文がletなら値を返さない)
+func (c *Compiler) Compile(node ast.Node) error {
+	c.infos = analyze(node)
+
+	switch node := node.(type) {
+	case *ast.Program:
+		if err := c.compileProgram(node.Statements); err != nil {
+			return err
+		}
+	case ast.Statement:
+		if err := c.compileProgram([]ast.Statement{node}); err != nil {
+			return err
+		}
+	case ast.Expression:
+		if err := c.compileExpression(node); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+	default:
+		return fmt.Errorf("cannot compile %T", node)
+	}
+
+	return nil
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	scope := c.scopes[len(c.scopes)-1]
+	main := &object.CompiledFunction{
+		Instructions: scope.instructions,
+		Dynamic:      true,
+		Statements:   scope.statements,
+		Calls:        scope.calls,
+	}
+
+	for _, fn := range append(c.functions, main) {
+		fn.Constants = c.constants
+	}
+
+	return &Bytecode{Main: main, Constants: c.constants}
+}
+
+func (c *Compiler) compileProgram(stmts []ast.Statement) error {
+	for i, stmt := range stmts {
+		if err := c.compileStatement(stmt); err != nil {
+			return err
+		}
+
+		if _, ok := stmt.(*ast.ExpressionStatement); !ok {
+			continue
+		}
+		if i == len(stmts)-1 {
+			c.emit(code.OpReturnValue)
+			return nil
+		}
+		c.emit(code.OpPop)
+	}
+
+	c.emit(code.OpHalt)
+	return nil
+}
+
+// ブロックを、最後の式文の値を1つスタックに残すようコンパイル
+// (空のブロック、最後の文が式文でないブロックはnull)
+func (c *Compiler) compileBlock(block *ast.BlockStatement) error {
+	if block == nil {
+		c.emit(code.OpNull)
+		return nil
+	}
+
+	stmts := block.Statements
+	for i, stmt := range stmts {
+		if err := c.compileStatement(stmt); err != nil {
+			return err
+		}
+
+		if _, ok := stmt.(*ast.ExpressionStatement); ok && i < len(stmts)-1 {
+			c.emit(code.OpPop)
+		}
+	}
+
+	if len(stmts) == 0 {
+		c.emit(code.OpNull)
+		return nil
+	}
+	if _, ok := stmts[len(stmts)-1].(*ast.ExpressionStatement); !ok {
+		c.emit(code.OpNull)
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileStatement(stmt ast.Statement) error {
+	// エラーの位置は、その命令を含む最も内側の文の位置
+	scope := &c.scopes[len(c.scopes)-1]
+	tok := statementToken(stmt)
+	idx := len(scope.statements)
+	scope.statements = append(scope.statements, object.SourceRange{
+		Start:  len(scope.instructions),
+		Line:   tok.Line,
+		Column: tok.Column,
+	})
+
+	var err error
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStatement:
+		err = c.compileExpression(stmt.Expression)
+	case *ast.LetStatement:
+		err = c.compileLetStatement(stmt)
+	case *ast.ReturnStatement:
+		err = c.compileExpression(stmt.ReturnValue)
+		c.emit(code.OpReturnValue)
+	case *ast.ThrowStatement:
+		err = c.compileExpression(stmt.Value)
+		c.emit(code.OpThrow)
+	case *ast.BlockStatement:
+		// NOTE: 値を残さないよう捨てる
+		err = c.compileBlock(stmt)
+		c.emit(code.OpPop)
+	default:
+		err = fmt.Errorf("cannot compile statement %T", stmt)
+	}
+
+	scope = &c.scopes[len(c.scopes)-1]
+	scope.statements[idx].End = len(scope.instructions)
+	return err
+}
+
+func (c *Compiler) compileLetStatement(stmt *ast.LetStatement) error {
+	name := stmt.Name.Value
+	nameIdx := c.nameConstant(name)
+
+	if c.symbolTable.IsDynamic() {
+		c.emit(code.OpCheckConst, nameIdx)
+		if err := c.compileExpression(stmt.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpNameFunction, nameIdx)
+
+		if stmt.IsConst() {
+			c.emit(code.OpDefineConst, nameIdx)
+		} else {
+			c.emit(code.OpDefine, nameIdx)
+		}
+		return nil
+	}
+
+	// NOTE: 静的なスコープの局所変数は、関数の入口で全て定義済み
+	symbol, ok := c.symbolTable.store[name]
+	if !ok {
+		return fmt.Errorf("local variable not defined: %s", name)
+	}
+
+	if err := c.compileExpression(stmt.Value); err != nil {
+		return err
+	}
+	c.emit(code.OpNameFunction, nameIdx)
+
+	switch symbol.Scope {
+	case LocalScope:
+		c.emit(code.OpSetLocal, symbol.Index)
+	case CellScope:
+		c.emit(code.OpSetCell, symbol.Index)
+	default:
+		return fmt.Errorf("cannot assign to %s variable: %s", symbol.Scope, name)
+	}
+	return nil
+}
+
+func (c *Compiler) compileExpression(exp ast.Expression) error {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: exp.Value}))
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: exp.Value}))
+	case *ast.Boolean:
+		if exp.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case *ast.Null:
+		c.emit(code.OpNull)
+	case *ast.Identifier:
+		c.loadSymbol(c.symbolTable.Resolve(exp.Value))
+	case *ast.PrefixExpression:
+		if err := c.compileExpression(exp.Right); err != nil {
+			return err
+		}
+		op := code.OperatorIndex(code.PrefixOperators, exp.Operator)
+		if op < 0 {
+			return fmt.Errorf("unknown operator: %s", exp.Operator)
+		}
+		c.emit(code.OpPrefix, op)
+	case *ast.InfixExpression:
+		if ast.IsChainElement(exp) {
+			return c.compileChain(exp)
+		}
+		return c.compileInfixExpression(exp)
+	case *ast.IfExpression:
+		return c.compileIfExpression(exp)
+	case *ast.TryExpression:
+		return c.compileTryExpression(exp)
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(exp)
+	case *ast.CallExpression:
+		return c.compileChain(exp)
+	case *ast.ArrayLiteral:
+		return c.compileElements(exp.Elements)
+	case *ast.IndexExpression:
+		return c.compileChain(exp)
+	case *ast.HashLiteral:
+		return c.compileHashLiteral(exp)
+	case *ast.NameSpaceLiteral:
+		return c.compileNameSpaceLiteral(exp)
+	case *ast.AssignExpression:
+		return c.compileAssignExpression(exp)
+	default:
+		return fmt.Errorf("cannot compile expression %T", exp)
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileInfixExpression(exp *ast.InfixExpression) error {
+	if err := c.compileExpression(exp.Left); err != nil {
+		return err
+	}
+
+	switch exp.Operator {
+	case "&&", "||", "??":
+		jumpPos := c.emitShortCut(exp.Operator)
+		if err := c.compileExpression(exp.Right); err != nil {
+			return err
+		}
+		c.changeJumpTarget(jumpPos)
+		return nil
+	}
+
+	if err := c.compileExpression(exp.Right); err != nil {
+		return err
+	}
+	op := code.OperatorIndex(code.InfixOperators, exp.Operator)
+	if op < 0 {
+		return fmt.Errorf("unknown operator: %s", exp.Operator)
+	}
+	c.emit(code.OpInfix, op)
+	return nil
+}
+
+// メンバーの連鎖(`a?.b.c`)をコンパイルする
+// `?.`, `?[`の左辺がnullの場合は、連鎖の残りも飛ばして連鎖の最後へジャンプする
+func (c *Compiler) compileChain(exp ast.Expression) error {
+	jumps := []int{}
+	if err := c.compileChainElement(exp, &jumps); err != nil {
+		return err
+	}
+	for _, pos := range jumps {
+		c.changeJumpTarget(pos)
+	}
+	return nil
+}
+
+// 連鎖の要素をコンパイルし、連鎖の最後へのジャンプ命令の位置をjumpsに追加する
+func (c *Compiler) compileChainElement(exp ast.Expression, jumps *[]int) error {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		if err := c.compileChainLeft(exp.Left, jumps); err != nil {
+			return err
+		}
+		// NOTE: null以外に対する"?."は"."と同じ
+		if exp.Operator == "?." {
+			*jumps = append(*jumps, c.emitShortCut(exp.Operator))
+		}
+		return c.compileDotExpression(exp)
+	case *ast.IndexExpression:
+		if err := c.compileChainLeft(exp.Left, jumps); err != nil {
+			return err
+		}
+		if exp.Optional {
+			*jumps = append(*jumps, c.emitShortCut(exp.TokenLiteral()))
+		}
+		if err := c.compileExpression(exp.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+		return nil
+	case *ast.CallExpression:
+		if err := c.compileChainLeft(exp.Function, jumps); err != nil {
+			return err
+		}
+		return c.compileCallExpression(exp)
+	default:
+		return c.compileExpression(exp)
+	}
+}
+
+// 連鎖の左側(`a?.b.c`の`a?.b`)
+func (c *Compiler) compileChainLeft(exp ast.Expression, jumps *[]int) error {
+	if ast.IsChainElement(exp) {
+		return c.compileChainElement(exp, jumps)
+	}
+	return c.compileExpression(exp)
+}
+
+// 左辺(スタックトップ)がnamespaceなら右辺をその環境で、
+// それ以外なら右辺を現在のスコープで評価して"."を適用
+func (c *Compiler) compileDotExpression(exp *ast.InfixExpression) error {
+	notNameSpacePos := c.emit(code.OpJumpNotNameSpace, 9999)
+
+	if err := c.compileInNameSpace(exp.Left, code.NameSpaceAccess, func() error {
+		return c.compileExpression(exp.Right)
+	}); err != nil {
+		return err
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeJumpTarget(notNameSpacePos)
+	if err := c.compileExpression(exp.Right); err != nil {
+		return err
+	}
+	c.emit(code.OpInfix, code.OperatorIndex(code.InfixOperators, exp.Operator))
+
+	c.changeJumpTarget(jumpPos)
+	return nil
+}
+
+// namespace(スタックトップ)の環境でcompileBodyの命令を評価
+func (c *Compiler) compileInNameSpace(left ast.Expression, mode int,
+	compileBody func() error) error {
+
+	// エラーメッセージに表示するnamespaceの変数名
+	var nameSpaceIdent string
+	if ident, ok := left.(*ast.Identifier); ok {
+		nameSpaceIdent = ident.Value
+	}
+	c.emit(code.OpEnterNameSpace, c.nameConstant(nameSpaceIdent), mode)
+
+	outer := c.symbolTable
+	c.symbolTable = NewDynamicSymbolTable(outer)
+	err := compileBody()
+	c.symbolTable = outer
+
+	c.emit(code.OpLeaveNameSpace)
+	return err
+}
+
+func (c *Compiler) compileIfExpression(exp *ast.IfExpression) error {
+	if err := c.compileExpression(exp.Condition); err != nil {
+		return err
+	}
+	notTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.compileBlock(exp.Consequence); err != nil {
+		return err
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeJumpTarget(notTruthyPos)
+	if err := c.compileBlock(exp.Alternative); err != nil {
+		return err
+	}
+
+	c.changeJumpTarget(jumpPos)
+	return nil
+}
+
+// NOTE: ハンドラは評価器のevalTryExpressionと同じ順で値を決める
+//
+//	OpSetupFinally L_finally
+//	OpSetupCatch L_catch
+//	(block)
+//	OpPopHandler
+//	OpJump L_end
+//
+// L_catch: (vmが捕捉したエラーのハッシュをpush)
+//
+//	OpPushScope, OpDefine param, (catch), OpPopScope
+//
+// L_end:
+//
+//	OpPopHandler
+//	OpBeginFinally
+//
+// L_finally: (vmが中断したエラー、returnを保存)
+//
+//	(finally), OpPop
+//	OpEndFinally
+func (c *Compiler) compileTryExpression(exp *ast.TryExpression) error {
+	finallyPos := -1
+	if exp.Finally != nil {
+		finallyPos = c.emit(code.OpSetupFinally, 9999)
+	}
+	catchPos := -1
+	if exp.Catch != nil {
+		if !c.symbolTable.IsDynamic() {
+			return fmt.Errorf("catch is not supported in static scope")
+		}
+		catchPos = c.emit(code.OpSetupCatch, 9999)
+	}
+
+	if err := c.compileBlock(exp.Block); err != nil {
+		return err
+	}
+
+	if catchPos >= 0 {
+		c.emit(code.OpPopHandler)
+		jumpPos := c.emit(code.OpJump, 9999)
+
+		c.changeJumpTarget(catchPos)
+		c.emit(code.OpPushScope)
+		c.emit(code.OpDefine, c.nameConstant(exp.Parameter.Value))
+		if err := c.compileBlock(exp.Catch); err != nil {
+			return err
+		}
+		c.emit(code.OpPopScope)
+
+		c.changeJumpTarget(jumpPos)
+	}
+
+	if finallyPos >= 0 {
+		c.emit(code.OpPopHandler)
+		c.emit(code.OpBeginFinally)
+
+		c.changeJumpTarget(finallyPos)
+		if err := c.compileBlock(exp.Finally); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+		c.emit(code.OpEndFinally)
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileFunctionLiteral(lit *ast.FunctionLiteral) error {
+	info, ok := c.infos[lit]
+	if !ok {
+		info = &functionInfo{dynamic: true}
+	}
+
+	outer := c.symbolTable
+	if info.dynamic {
+		c.symbolTable = NewDynamicSymbolTable(outer)
+	} else {
+		c.symbolTable = NewStaticSymbolTable(outer)
+	}
+	c.scopes = append(c.scopes, CompilationScope{})
+
+	fn := &object.CompiledFunction{
+		NumParameters: len(lit.Parameters),
+		Dynamic:       info.dynamic,
+		Literal:       lit,
+	}
+	for _, param := range lit.Parameters {
+		fn.ParameterNames = append(fn.ParameterNames, param.Value)
+	}
+	if !info.dynamic {
+		for _, name := range info.locals {
+			symbol := c.symbolTable.Define(name, info.captured[name])
+			fn.LocalNames = append(fn.LocalNames, name)
+			if symbol.Scope == CellScope {
+				fn.CellSlots = append(fn.CellSlots, symbol.Index)
+			}
+		}
+		fn.NumLocals = len(info.locals)
+	}
+
+	err := c.compileBlock(lit.Body)
+	c.emit(code.OpReturnValue)
+
+	for _, free := range c.symbolTable.FreeSymbols {
+		source := object.FreeSource{Name: free.Name, Index: free.Index}
+		switch free.Scope {
+		case FreeScope:
+			source.IsFree = true
+		case CellScope:
+		default:
+			return fmt.Errorf("cannot capture %s variable: %s", free.Scope, free.Name)
+		}
+		fn.FreeSources = append(fn.FreeSources, source)
+	}
+
+	scope := c.scopes[len(c.scopes)-1]
+	fn.Instructions = scope.instructions
+	fn.Statements = scope.statements
+	fn.Calls = scope.calls
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.symbolTable = outer
+	if err != nil {
+		return err
+	}
+
+	c.functions = append(c.functions, fn)
+	c.emit(code.OpClosure, c.addConstant(fn))
+	return nil
+}
+
+func (c *Compiler) compileNameSpaceLiteral(lit *ast.NameSpaceLiteral) error {
+	outer := c.symbolTable
+	c.symbolTable = NewDynamicSymbolTable(outer)
+	c.scopes = append(c.scopes, CompilationScope{})
+
+	err := c.compileBlock(lit.Body)
+	c.emit(code.OpReturnValue)
+
+	scope := c.scopes[len(c.scopes)-1]
+	fn := &object.CompiledFunction{
+		Instructions: scope.instructions,
+		Dynamic:      true,
+		Statements:   scope.statements,
+		Calls:        scope.calls,
+	}
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.symbolTable = outer
+	if err != nil {
+		return err
+	}
+
+	c.functions = append(c.functions, fn)
+	c.emit(code.OpNameSpace, c.addConstant(fn))
+	return nil
+}
+
+// 関数(スタックトップ)の呼び出し
+func (c *Compiler) compileCallExpression(exp *ast.CallExpression) error {
+	// `ns?.f()`はns.fがnullの場合も引数を評価せずnullを返す
+	jumpPos := -1
+	if infix, ok := exp.Function.(*ast.InfixExpression); ok && infix.Operator == "?." {
+		jumpPos = c.emitShortCut(infix.Operator)
+	}
+
+	var pos int
+	if hasSpread(exp.Arguments) {
+		if err := c.compileElements(exp.Arguments); err != nil {
+			return err
+		}
+		tail := 0
+		if exp.Tail {
+			tail = 1
+		}
+		pos = c.emit(code.OpCallSpread, tail)
+	} else {
+		for _, arg := range exp.Arguments {
+			if err := c.compileExpression(arg); err != nil {
+				return err
+			}
+		}
+		op := code.OpCall
+		if exp.Tail {
+			op = code.OpTailCall
+		}
+		pos = c.emit(op, len(exp.Arguments))
+	}
+
+	// トレースバック用に呼び出し位置を記録
+	scope := &c.scopes[len(c.scopes)-1]
+	scope.calls = append(scope.calls, object.SourceRange{
+		Start:  pos,
+		End:    len(scope.instructions),
+		Line:   exp.Token.Line,
+		Column: exp.Token.Column,
+	})
+
+	if jumpPos >= 0 {
+		c.changeJumpTarget(jumpPos)
+	}
+	return nil
+}
+
+// 配列リテラル(または関数の引数の配列)
+func (c *Compiler) compileElements(elements []ast.Expression) error {
+	if !hasSpread(elements) {
+		for _, el := range elements {
+			if err := c.compileExpression(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(elements))
+		return nil
+	}
+
+	c.emit(code.OpArray, 0)
+	for _, el := range elements {
+		if spread, ok := el.(*ast.SpreadExpression); ok {
+			if err := c.compileExpression(spread.Value); err != nil {
+				return err
+			}
+			c.emit(code.OpArrayExtend)
+			continue
+		}
+
+		if err := c.compileExpression(el); err != nil {
+			return err
+		}
+		c.emit(code.OpArrayAppend)
+	}
+	return nil
+}
+
+func (c *Compiler) compileHashLiteral(exp *ast.HashLiteral) error {
+	c.emit(code.OpHash)
+
+	// NOTE: 同じkeyは後に書かれたものが優先されるよう、ソース上の順序で評価
+	for _, key := range exp.Keys {
+		if spread, ok := key.(*ast.SpreadExpression); ok {
+			if err := c.compileExpression(spread.Value); err != nil {
+				return err
+			}
+			c.emit(code.OpHashMerge)
+			continue
+		}
+
+		if err := c.compileExpression(key); err != nil {
+			return err
+		}
+		c.emit(code.OpHashKey)
+		if err := c.compileExpression(exp.Pairs[key]); err != nil {
+			return err
+		}
+		c.emit(code.OpHashSet)
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileAssignExpression(exp *ast.AssignExpression) error {
+	if err := c.compileExpression(exp.Value); err != nil {
+		return err
+	}
+
+	switch target := exp.Target.(type) {
+	case *ast.IndexExpression:
+		return c.compileIndexAssignment(target)
+	case *ast.InfixExpression:
+		if err := c.compileExpression(target.Left); err != nil {
+			return err
+		}
+
+		switch field := target.Right.(type) {
+		case *ast.Identifier:
+			c.emit(code.OpSetField, c.nameConstant(field.Value))
+			return nil
+		case *ast.IndexExpression:
+			// `ns.arr[i] = v`は`ns.(arr[i]) = v`とパースされるため、namespace内で評価
+			return c.compileInNameSpace(target.Left, code.NameSpaceAssign, func() error {
+				return c.compileIndexAssignment(field)
+			})
+		default:
+			return fmt.Errorf("cannot assign to %s", field.String())
+		}
+	default:
+		return fmt.Errorf("cannot assign to %s", target.String())
+	}
+}
+
+func (c *Compiler) compileIndexAssignment(target *ast.IndexExpression) error {
+	if err := c.compileExpression(target.Left); err != nil {
+		return err
+	}
+	if err := c.compileExpression(target.Index); err != nil {
+		return err
+	}
+	c.emit(code.OpSetIndex)
+	return nil
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case CellScope:
+		c.emit(code.OpGetCell, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case NameScope:
+		c.emit(code.OpGetName, c.nameConstant(s.Name))
+	}
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) nameConstant(name string) int {
+	if idx, ok := c.names[name]; ok {
+		return idx
+	}
+
+	idx := c.addConstant(&object.String{Value: name})
+	c.names[name] = idx
+	return idx
+}
+
+// 命令を追加し、その位置を返す
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+	scope := &c.scopes[len(c.scopes)-1]
+
+	pos := len(scope.instructions)
+	scope.instructions = append(scope.instructions, ins...)
+	return pos
+}
+
+func (c *Compiler) emitShortCut(operator string) int {
+	return c.emit(code.OpJumpShortCut,
+		code.OperatorIndex(code.ShortCutOperators, operator), 9999)
+}
+
+// posのジャンプ命令のジャンプ先を現在の位置にする
+// (ジャンプ先はいずれも最後のオペランド)
+func (c *Compiler) changeJumpTarget(pos int) {
+	ins := c.scopes[len(c.scopes)-1].instructions
+	op := code.Opcode(ins[pos])
+	def, _ := code.Lookup(byte(op))
+
+	operands, _ := code.ReadOperands(def, ins[pos+1:])
+	operands[len(operands)-1] = len(ins)
+	copy(ins[pos:], code.Make(op, operands...))
+}
+
+func hasSpread(elements []ast.Expression) bool {
+	for _, el := range elements {
+		if _, ok := el.(*ast.SpreadExpression); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func statementToken(stmt ast.Statement) token.Token {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Token
+	case *ast.ReturnStatement:
+		return stmt.Token
+	case *ast.ThrowStatement:
+		return stmt.Token
+	case *ast.ExpressionStatement:
+		return stmt.Token
+	case *ast.BlockStatement:
+		return stmt.Token
+	default:
+		return token.Token{}
+	}
+}
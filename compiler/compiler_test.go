@@ -0,0 +1,241 @@
+package compiler
+
+import (
+	"../ast"
+	"../code"
+	"../lexer"
+	"../object"
+	"../parser"
+	"testing"
+)
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+	out := code.Instructions{}
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+func compile(t *testing.T, input string) *Bytecode {
+	comp := New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return comp.Bytecode()
+}
+
+func testInstructions(t *testing.T, input string, expected []code.Instructions,
+	actual code.Instructions) {
+
+	concatted := concatInstructions(expected)
+	if actual.String() != concatted.String() {
+		t.Errorf("wrong instructions for %q.\nwant=\n%s\ngot=\n%s",
+			input, concatted, actual)
+	}
+}
+
+func TestCompileTopLevel(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []code.Instructions
+	}{
+		{
+			"1 + 2",
+			[]code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpInfix, code.OperatorIndex(code.InfixOperators, "+")),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			// トップレベルの変数は環境に名前で束縛
+			"let x = 1; x",
+			[]code.Instructions{
+				code.Make(code.OpCheckConst, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpNameFunction, 0),
+				code.Make(code.OpDefine, 0),
+				code.Make(code.OpGetName, 0),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			// 最後の文がletなら値を返さない
+			"1; const y = 2;",
+			[]code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpCheckConst, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpNameFunction, 1),
+				code.Make(code.OpDefineConst, 1),
+				code.Make(code.OpHalt),
+			},
+		},
+		{
+			"if (true) { 10 }",
+			[]code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 10),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpJump, 11),
+				code.Make(code.OpNull),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			"a ?? b",
+			[]code.Instructions{
+				code.Make(code.OpGetName, 0),
+				code.Make(code.OpJumpShortCut,
+					code.OperatorIndex(code.ShortCutOperators, "??"), 10),
+				code.Make(code.OpGetName, 1),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			"ns.x",
+			[]code.Instructions{
+				code.Make(code.OpGetName, 0),
+				code.Make(code.OpJumpNotNameSpace, 17),
+				code.Make(code.OpEnterNameSpace, 0, code.NameSpaceAccess),
+				code.Make(code.OpGetName, 1),
+				code.Make(code.OpLeaveNameSpace),
+				code.Make(code.OpJump, 22),
+				code.Make(code.OpGetName, 1),
+				code.Make(code.OpInfix, code.OperatorIndex(code.InfixOperators, ".")),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		bytecode := compile(t, tt.input)
+		testInstructions(t, tt.input, tt.expected, bytecode.Main.Instructions)
+	}
+}
+
+func TestCompileFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []code.Instructions
+		dynamic  bool
+	}{
+		{
+			// 局所変数はスタック上に置く
+			"fn(a) { let b = a; b }",
+			[]code.Instructions{
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpNameFunction, 0),
+				code.Make(code.OpSetLocal, 1),
+				code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpReturnValue),
+			},
+			false,
+		},
+		{
+			// 内側の関数に捕捉される局所変数はCell
+			"fn(a) { fn() { a } }",
+			[]code.Instructions{
+				code.Make(code.OpClosure, 0),
+				code.Make(code.OpReturnValue),
+			},
+			false,
+		},
+		{
+			// self()を使う関数は評価器と同様に環境に束縛
+			"fn(a) { self() }",
+			[]code.Instructions{
+				code.Make(code.OpGetName, 0),
+				code.Make(code.OpTailCall, 0),
+				code.Make(code.OpReturnValue),
+			},
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		bytecode := compile(t, tt.input)
+
+		fn := lastFunction(bytecode)
+		if fn == nil {
+			t.Fatalf("function not compiled: %q", tt.input)
+		}
+		testInstructions(t, tt.input, tt.expected, fn.Instructions)
+		if fn.Dynamic != tt.dynamic {
+			t.Errorf("wrong Dynamic for %q. want=%t, got=%t",
+				tt.input, tt.dynamic, fn.Dynamic)
+		}
+	}
+}
+
+func lastFunction(bytecode *Bytecode) *object.CompiledFunction {
+	for i := len(bytecode.Constants) - 1; i >= 0; i-- {
+		if fn, ok := bytecode.Constants[i].(*object.CompiledFunction); ok {
+			return fn
+		}
+	}
+	return nil
+}
+
+func TestCompileFreeVariables(t *testing.T) {
+	bytecode := compile(t, "fn(a) { fn() { a } }")
+
+	inner := bytecode.Constants[0].(*object.CompiledFunction)
+	testInstructions(t, "inner", []code.Instructions{
+		code.Make(code.OpGetFree, 0),
+		code.Make(code.OpReturnValue),
+	}, inner.Instructions)
+
+	expected := []object.FreeSource{{Name: "a", IsFree: false, Index: 0}}
+	if len(inner.FreeSources) != 1 || inner.FreeSources[0] != expected[0] {
+		t.Errorf("wrong FreeSources. want=%+v, got=%+v", expected, inner.FreeSources)
+	}
+
+	outer := bytecode.Constants[1].(*object.CompiledFunction)
+	if len(outer.CellSlots) != 1 || outer.CellSlots[0] != 0 {
+		t.Errorf("wrong CellSlots. want=[0], got=%v", outer.CellSlots)
+	}
+}
+
+func TestAnalyzeDynamicFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"fn(x) { let y = x + 1; y * 2 }", false},
+		{"fn(n) { if (n < 2) { n } else { f(n - 1) } }", false},
+		{"fn() { let f = fn() { f() }; f }", false},
+		// 束縛前の参照は外側の変数が見える
+		{"fn() { let g = fn() { y }; let y = 1; g() }", true},
+		{"fn(x) { if (x) { let y = 1 } }", true},
+		{"fn() { outer() }", true},
+		{"fn() { namespace { let a = 1; } }", true},
+		{"fn() { try { 1 } catch (e) { 2 } }", true},
+		{"fn() { try { 1 } finally { 2 } }", false},
+		{"fn() { const a = 1; let a = 2 }", true},
+		{"fn(x, x) { x }", true},
+		// 内側の関数が動的なら外側も動的
+		{"fn() { fn() { self() } }", true},
+		{"fn(ns) { ns.f(fn() { 1 }) }", false},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		lit := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+
+		infos := analyze(program)
+		if infos[lit].dynamic != tt.expected {
+			t.Errorf("wrong dynamic for %q. want=%t, got=%t",
+				tt.input, tt.expected, infos[lit].dynamic)
+		}
+	}
+}
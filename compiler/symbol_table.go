@@ -0,0 +1,81 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	LocalScope SymbolScope = "LOCAL" // スタック上の局所変数
+	CellScope  SymbolScope = "CELL"  // 内側の関数に捕捉される局所変数
+	FreeScope  SymbolScope = "FREE"  // 外側の関数の局所変数
+	// 実行時に環境から名前で探す(見つからなければ組み込み関数)
+	NameScope SymbolScope = "NAME"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+// NOTE: 評価器と同じ結果になるよう、以下のスコープは静的に解決せず
+// 実行時に環境(Environment)から名前で探す
+// - トップレベル、namespaceの本体 (self()やimport()で環境ごと参照される)
+// - `ns.x`の右辺 (nsの環境で評価される)
+// - 局所変数をスタックに置けない関数 (analyze.go参照)
+type SymbolTable struct {
+	Outer   *SymbolTable
+	dynamic bool
+
+	store          map[string]Symbol
+	numDefinitions int
+	FreeSymbols    []Symbol // 捕捉した外側の変数(外側のスコープでのSymbol)
+}
+
+func NewDynamicSymbolTable(outer *SymbolTable) *SymbolTable {
+	return &SymbolTable{Outer: outer, dynamic: true, store: make(map[string]Symbol)}
+}
+
+func NewStaticSymbolTable(outer *SymbolTable) *SymbolTable {
+	return &SymbolTable{Outer: outer, store: make(map[string]Symbol)}
+}
+
+func (s *SymbolTable) IsDynamic() bool {
+	return s.dynamic
+}
+
+// 局所変数を定義(capturedなら内側の関数に捕捉される)
+func (s *SymbolTable) Define(name string, captured bool) Symbol {
+	scope := LocalScope
+	if captured {
+		scope = CellScope
+	}
+
+	symbol := Symbol{Name: name, Scope: scope, Index: s.numDefinitions}
+	s.store[name] = symbol
+	s.numDefinitions++
+	return symbol
+}
+
+func (s *SymbolTable) Resolve(name string) Symbol {
+	if symbol, ok := s.store[name]; ok {
+		return symbol
+	}
+
+	if s.dynamic || s.Outer == nil {
+		return Symbol{Name: name, Scope: NameScope}
+	}
+
+	symbol := s.Outer.Resolve(name)
+	if symbol.Scope == NameScope {
+		return symbol
+	}
+
+	return s.defineFree(symbol)
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Scope: FreeScope, Index: len(s.FreeSymbols) - 1}
+	s.store[original.Name] = symbol
+	return symbol
+}
@@ -0,0 +1,627 @@
+package conformance
+
+// NOTE: 評価結果のInspect()で確かめられるテストケース
+// (evaluatorのテストでも使用する。エラーの位置等を確かめるものはevaluator_test.goに書く)
+var Cases = []Case{
+	// integers
+	{"5", "5"},
+	{"10", "10"},
+	{"-5", "-5"},
+	{"-10", "-10"},
+	{"5 + 5 + 5 + 5 - 10", "10"},
+	{"2 * 2 * 2 * 2 * 2", "32"},
+	{"-50 + 100 + -50", "0"},
+	{"5 * 2 + 10", "20"},
+	{"5 + 2 * 10", "25"},
+	{"20 + 2 * -10", "0"},
+	{"50 / 2 * 2 + 10", "60"},
+	{"2 * (5 + 10)", "30"},
+	{"3 * 3 * 3 + 10", "37"},
+	{"3 * (3 * 3) + 10", "37"},
+	{"(5 + 10 * 2 + 15 / 3) * 2 + -10", "50"},
+	{"1 && 2", "2"},
+	{"0 && 10", "10"},
+	{"1 || 2", "1"},
+	{"true && 2 || 3", "2"},
+	// booleans
+	{"true", "true"},
+	{"false", "false"},
+	{"1 < 2", "true"},
+	{"1 > 2", "false"},
+	{"1 < 1", "false"},
+	{"1 > 1", "false"},
+	{"1 == 1", "true"},
+	{"1 != 1", "false"},
+	{"1 == 2", "false"},
+	{"1 != 2", "true"},
+	{"true == true", "true"},
+	{"false == false", "true"},
+	{"true == false", "false"},
+	{"true != false", "true"},
+	{"false != true", "true"},
+	{"(1 < 2) == true", "true"},
+	{"(1 < 2) == false", "false"},
+	{"(1 > 2) == true", "false"},
+	{"(1 > 2) == false", "true"},
+	{"\"Hello\" == \"Hello\"", "true"},
+	{"\"Hello\" == \"bye\"", "false"},
+	{"\"Hello\" == \"hello\"", "false"},
+	{"\"hello\" != \"bye\"", "true"},
+	{"\"hello\" != \"hello\"", "false"},
+	{"\"hello\" == 5", "false"},
+	{"\"hello\" != 5", "true"},
+	{"\"hello\" == true", "false"},
+	{"\"hello\" == false", "false"},
+	{"\"hello\" != true", "true"},
+	{"\"hello\" != false", "true"},
+	{"5 == true", "false"},
+	{"5 == false", "false"},
+	{"5 != true", "true"},
+	{"5 != false", "true"},
+	{"5 <= 10", "true"},
+	{"10 <= 5", "false"},
+	{"5 <= 5", "true"},
+	{"10 >= 5", "true"},
+	{"5 >= 10", "false"},
+	{"10 >= 10", "true"},
+	{"true && true", "true"},
+	{"true && false", "false"},
+	{"false && false", "false"},
+	{"true || true", "true"},
+	{"true || false", "true"},
+	{"false || false", "false"},
+	{"false && unknownVar", "false"},
+	{"true || unknownVar", "true"},
+	// prefix operators
+	{"!true", "false"},
+	{"!false", "true"},
+	{"!5", "false"},
+	{"!!true", "true"},
+	{"!!false", "false"},
+	{"!!5", "true"},
+	// if
+	{"if (true) { 10 }", "10"},
+	{"if (false) { 10 }", "null"},
+	{"if (1) { 10 }", "10"},
+	{"if (1 < 2) { 10 }", "10"},
+	{"if (1 > 2) { 10 }", "null"},
+	{"if (1 > 2) { 10 } else { 20 }", "20"},
+	{"if (1 < 2) { 10 } else { 20 }", "10"},
+	{"if (0) { 10 } else { 20 }", "10"},
+	// return
+	{"return 10;", "10"},
+	{"return 10; 9;", "10"},
+	{"return 2 * 5; 9;", "10"},
+	{"9; return 2 * 5; 9;", "10"},
+	{"if (10 > 1) { if (10 > 1) { return 10; }; return 1; }", "10"},
+	// errors
+	{"5 + true;", "ERROR: type mismatch: INTEGER + BOOLEAN"},
+	{"5 + true; 5;", "ERROR: type mismatch: INTEGER + BOOLEAN"},
+	{"-true", "ERROR: unknown operator: -BOOLEAN"},
+	{"true + false", "ERROR: unknown operator: BOOLEAN + BOOLEAN"},
+	{"5; true + false; 5;", "ERROR: unknown operator: BOOLEAN + BOOLEAN"},
+	{"if (10 > 1) { true + false; }", "ERROR: unknown operator: BOOLEAN + BOOLEAN"},
+	{`
+		if (10 > 1) {
+			if (10 > 1) {
+				return true + false;
+			} 
+			return 1;
+		}
+	`, "ERROR: unknown operator: BOOLEAN + BOOLEAN"},
+	{"foobar", "ERROR: identifier not found: foobar"},
+	{"\"Hello\" - \"world\"", "ERROR: unknown operator: STRING - STRING"},
+	{"{\"name\": \"Monkey\"}[fn(x) { x }];", "ERROR: unusable as hash key: FUNCTION"},
+	{"true <= 5", "ERROR: type mismatch: BOOLEAN <= INTEGER"},
+	{"false <= false", "ERROR: unknown operator: BOOLEAN <= BOOLEAN"},
+	{"true >= 5", "ERROR: type mismatch: BOOLEAN >= INTEGER"},
+	{"false >= false", "ERROR: unknown operator: BOOLEAN >= BOOLEAN"},
+	{"true.5", "ERROR: type mismatch: BOOLEAN . INTEGER"},
+	{"\"string\".false", "ERROR: type mismatch: STRING . BOOLEAN"},
+	{"5.true", "ERROR: type mismatch: INTEGER . BOOLEAN"},
+	{"true.true", "ERROR: unknown operator: BOOLEAN . BOOLEAN"},
+	{"\"string\".\"string\"", "ERROR: unknown operator: STRING . STRING"},
+	{"fn(x, y) { x + y; }(1)", "ERROR: wrong number of arguments. got=1, want=2"},
+	// throw
+	{"throw \"boom\";", "ERROR: boom"},
+	{`1;
+		throw "boom"; 2;`, "ERROR: boom"},
+	{"throw 5;", "ERROR: 5"},
+	{"throw {\"message\": \"bad value\"};", "ERROR: bad value"},
+	{"throw unknownVar;", "ERROR: identifier not found: unknownVar"},
+	{`let f = fn() {
+			throw "in function";
+		};
+		f();`, "ERROR: in function"},
+	{`let f = fn(x) {
+			x + true
+		};
+		f(1);`, "ERROR: type mismatch: INTEGER + BOOLEAN"},
+	// try/catch/finally
+	{"try { 1 } catch (e) { 2 }", "1"},
+	{"try { throw \"boom\"; 1 } catch (e) { 2 }", "2"},
+	{"try { throw \"boom\" } catch (e) { e[\"message\"] }", "boom"},
+	{"try { throw \"boom\" } catch (e) { e[\"type\"] }", "Error"},
+	{"try { throw 5 } catch (e) { e[\"value\"] }", "5"},
+	{"try { throw \"boom\" } catch (e) { e[\"line\"] }", "1"},
+	{`try {
+			1;
+			throw "boom"
+		} catch (e) { e["line"] }`, "3"},
+	{"try { throw \"boom\" } catch (e) { e[\"column\"] }", "7"},
+	{"try { throw {\"type\": \"ValueError\", \"message\": \"bad\", \"code\": 3} } catch (e) { e[\"type\"] }", "ValueError"},
+	{"try { throw {\"type\": \"ValueError\", \"message\": \"bad\", \"code\": 3} } catch (e) { e[\"message\"] }", "bad"},
+	{"try { throw {\"type\": \"ValueError\", \"message\": \"bad\", \"code\": 3} } catch (e) { e[\"code\"] }", "3"},
+	{"try { len(1, 2) } catch (e) { e[\"message\"] }", "wrong number of arguments. got=2, want=1"},
+	{"try { len(1) } catch (e) { e[\"type\"] }", "RuntimeError"},
+	{"try { 1 + true } catch (e) { e[\"message\"] }", "type mismatch: INTEGER + BOOLEAN"},
+	{"try { unknownVar } catch (e) { e[\"value\"] }", "null"},
+	{"let f = fn() { throw \"deep\" }; let g = fn() { f() }; try { g() } catch (e) { e[\"message\"] }", "deep"},
+	{"let ns = namespace { let f = fn() { throw \"x\" }; }; try { ns.f() } catch (e) { e[\"message\"] }", "x"},
+	{"let ns = namespace { let f = fn() { throw {\"type\": \"T\"} }; }; try { ns.f() } catch (e) { e[\"type\"] }", "T"},
+	{"try { try { throw \"inner\" } catch (e) { throw e } } catch (e) { e[\"message\"] }", "inner"},
+	{"try { try { throw {\"type\": \"T\"} } catch (e) { throw e } } catch (e) { e[\"type\"] }", "T"},
+	{"try { throw \"boom\" } catch (e) { throw \"again\" }", "ERROR: again"},
+	{"let e = 1; try { throw \"boom\" } catch (e) { 2 }; e;", "1"},
+	{"let safe = fn(x) { try { 10 / x } catch (e) { 0 } }; safe(2) + safe(\"a\")", "5"},
+	{"let a = [0]; try { 1 } finally { a[0] = 5 }; a[0]", "5"},
+	{"let a = [0]; try { throw \"boom\" } catch (e) { 1 } finally { a[0] = 5 }; a[0]", "5"},
+	{"try { 1 } finally { 2 }", "1"},
+	{"try { throw \"boom\" } catch (e) { 1 } finally { 2 }", "1"},
+	{"let a = [0]; try { try { throw \"boom\" } finally { a[0] = 5 } } catch (e) { a[0] }", "5"},
+	{"try { throw \"boom\" } finally { 2 }", "ERROR: boom"},
+	{"try { 1 } finally { throw \"in finally\" }", "ERROR: in finally"},
+	{"fn() { try { return 1; } finally { 2 }; 3 }()", "1"},
+	{"fn() { try { return 1; } finally { return 2; } }()", "2"},
+	{"fn() { try { throw \"x\" } catch (e) { return 1; }; 3 }()", "1"},
+	{`let ns = namespace {}; try { ns.x } catch (e) { e["message"] }`, "In namespace \"ns\": identifier not found: x"},
+	{`let h = {}; h["me"] = h; try { throw h } catch (e) { 1 }`, "1"},
+	{`let h = {}; h["me"] = h; try { throw h } catch (e) { e["message"] }`, "{me: {...}}"},
+	{`let a = [1]; a[0] = a; try { throw a } catch (e) { e["message"] }`, "[[...]]"},
+	// errors in functions
+	{"1 + true;", "ERROR: type mismatch: INTEGER + BOOLEAN"},
+	{`let f = fn(x) {
+			x + true;
+		};
+		let g = fn() {
+			f(1) + 1;
+		};
+		g();`, "ERROR: type mismatch: INTEGER + BOOLEAN"},
+	{`let f = fn() {
+			let x = fn() { throw "boom" }();
+			x;
+		};
+		f();`, "ERROR: boom"},
+	{`let f = fn() { throw "boom" };
+		let g = fn() { f() };
+		g();`, "ERROR: boom"},
+	{`let f = fn() { len(1) };
+		let g = f;
+		g();`, "ERROR: argument to `len` not supported, got INTEGER"},
+	{`let ns = namespace {
+			let f = fn() { -true };
+		};
+		ns.f();`, "ERROR: unknown operator: -BOOLEAN"},
+	{`let f = fn(n) {
+			if (n == 0) { throw "boom" };
+			1 + f(n - 1);
+		};
+		f(5);`, "ERROR: boom"},
+	{`let THIS_FILE = "script.monkey";
+		let f = fn() { throw "boom" };
+		f();`, "ERROR: boom"},
+	// let
+	{"let a = 5; a;", "5"},
+	{"let a = 5 * 5; a;", "25"},
+	{"let a = 5; let b = a; b;", "5"},
+	{"let a = 5; let b = a; let c = a + b + 5; c;", "15"},
+	// literals
+	{"\"Hello World!\"", "Hello World!"},
+	{"\"Hello\" + \" \" + \"World!\"", "Hello World!"},
+	{"[1, 2 * 2, 3 + 3]", "[1, 4, 6]"},
+	{"{\"one\": 10 - 9}", "{one: 1}"},
+	{`
+		let two = "two";
+		{
+			"one": 10 - 9,
+			two: 1 + 1,
+			"thr" + "ee": 6 / 2,
+			4: 4,
+			true: 5,
+			false: 6
+		}
+	`, "{false: 6, true: 5, 4: 4, one: 1, three: 3, two: 2}"},
+	// const
+	{"const a = 5; a;", "5"},
+	{"const a = 5; let b = a + 1; b;", "6"},
+	{"let a = 5; const a = 6; a;", "6"},
+	{"const a = 5; let a = 6;", "ERROR: cannot redeclare const: a"},
+	{"const a = 5; const a = 6;", "ERROR: cannot redeclare const: a"},
+	{"const a = 5; let f = fn() { let a = 6; a }; f();", "6"},
+	{"const a = 5; let f = fn(a) { a }; f(6);", "6"},
+	{"const a = 5; let f = fn() { let a = 6; a }; f(); a;", "5"},
+	{"let ns = namespace { const a = 5; }; ns.a = 6;", "ERROR: cannot assign to const: a"},
+	{"let ns = namespace { let a = 5; }; ns.a = 6; ns.a;", "6"},
+	{"const a = [1]; a[0] = 5; a[0];", "5"},
+	// function literals
+	{"fn(x) { x + 2; };", "fn(x) {\n(x + 2)\n}"},
+	// function calls
+	{"let identity = fn(x) { x; }; identity(5);", "5"},
+	{"let identity = fn(x) { return x; }; identity(5);", "5"},
+	{"let double = fn(x) { x * 2; }; double(5);", "10"},
+	{"let add = fn(x, y) { x + y; }; add(5, 5);", "10"},
+	{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", "20"},
+	{"fn(x) { x; }(5)", "5"},
+	{"fn() {}()", "null"},
+	{"let newAdder = fn(x) { fn(y) { x + y } }; let addTwo = newAdder(2); addTwo(2);", "4"},
+	// closures
+	{`
+		let newAdder = fn(x) {
+			fn(y) { x + y };
+		};
+		let addTwo = newAdder(2);
+		addTwo(3);
+	`, "5"},
+	// tail calls
+	{`let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } };
+		count(100000, 0);`, "100000"},
+	{`let count = fn(n) { if (n == 0) { return "done"; }; return count(n - 1); };
+		count(100000);`, "done"},
+	{`let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+		let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+		isEven(100001);`, "false"},
+	{`let log = [];
+		let f = fn() { 1 };
+		let g = fn() { try { return f(); } finally { append!(log, "finally") } };
+		[g(), log[0]];`, "[1, finally]"},
+	// recursion depth limit
+	{"let f = fn(n) { 1 + f(n + 1) }; f(0);", "ERROR: maximum recursion depth exceeded: depth=10001, function=f"},
+	{"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(99);", "99"},
+	{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(1000);", "0"},
+	{`let f = fn(n) { 1 + f(n + 1) };
+		let r = try { f(0) } catch (e) { "caught" };
+		[r, fn(x) { x }(1)];`, "[caught, 1]"},
+	// builtin functions
+	{"len(\"\")", "0"},
+	{"len(\"four\")", "4"},
+	{"len(\"hello world\")", "11"},
+	{"len(1)", "ERROR: argument to `len` not supported, got INTEGER"},
+	{"len(\"one\", \"two\")", "ERROR: wrong number of arguments. got=2, want=1"},
+	{"len([])", "0"},
+	{"len([1])", "1"},
+	{"len([1, 2, 3, 4])", "4"},
+	{"len([[1, 2], [3, 4]])", "2"},
+	{"len([1, 2], [3])", "ERROR: wrong number of arguments. got=2, want=1"},
+	{"first([1])", "1"},
+	{"first([2, 3])", "2"},
+	{"first(1)", "ERROR: argument to `first` must be ARRAY, got INTEGER"},
+	{"first([1, 2], [3])", "ERROR: wrong number of arguments. got=2, want=1"},
+	{"first([])", "null"},
+	{"first([[1, 2], [3]])", "[1, 2]"},
+	{"last([1])", "1"},
+	{"last([1, 2, 3])", "3"},
+	{"last([[1, 2], [3, 4]])", "[3, 4]"},
+	{"last([1, 2], [3])", "ERROR: wrong number of arguments. got=2, want=1"},
+	{"last(1)", "ERROR: argument to `last` must be ARRAY, got INTEGER"},
+	{"last([])", "null"},
+	{"rest([1, 2])", "[2]"},
+	{"rest([1])", "[]"},
+	{"rest([1, 2, 3])", "[2, 3]"},
+	{"rest(rest([1, 2, 3]))", "[3]"},
+	{"rest([1, 2], [3])", "ERROR: wrong number of arguments. got=2, want=1"},
+	{"rest(1)", "ERROR: argument to `rest` must be ARRAY, got INTEGER"},
+	{"rest([])", "null"},
+	{"let a = [1, 2]; rest(a); a;", "[1, 2]"},
+	{"push([1, 2, 3], 4)", "[1, 2, 3, 4]"},
+	{"push([], 1)", "[1]"},
+	{"let a = [1]; let b = push(a, 2); b;", "[1, 2]"},
+	{"let a = [1]; let b = push(a, 2); a;", "[1]"},
+	{"push([1, 2])", "ERROR: wrong number of arguments. got=1, want=2"},
+	{"push(1, 1)", "ERROR: argument to `push` must be ARRAY, got INTEGER"},
+	{"append!([1, 2], 3)", "[1, 2, 3]"},
+	{"append!([1], 2, 3)", "[1, 2, 3]"},
+	{"let a = [1]; append!(a, 2); a;", "[1, 2]"},
+	{"let a = []; append!(a, 1) == a; a;", "[1]"},
+	{"append!()", "ERROR: wrong number of arguments. got=0, want>=1"},
+	{"append!(1, 1)", "ERROR: argument to `append!` must be ARRAY, got INTEGER"},
+	{"let a = [1, 2, 3]; delete(a, 1); a;", "[1, 3]"},
+	{"let h = {\"a\": 1, \"b\": 2}; delete(h, \"a\")[\"a\"];", "null"},
+	{"let h = {\"a\": 1, \"b\": 2}; delete(h, \"a\")[\"b\"];", "2"},
+	{"delete([1], 1)", "ERROR: index out of range: 1"},
+	{"delete([1], \"a\")", "ERROR: index of `delete` must be INTEGER, got STRING"},
+	{"delete({}, fn() {})", "ERROR: unusable as hash key: FUNCTION"},
+	{"delete(1, 1)", "ERROR: argument to `delete` must be HASH or ARRAY, got INTEGER"},
+	{"delete([1])", "ERROR: wrong number of arguments. got=1, want=2"},
+	{"puts(1)", "null"},
+	{"puts(\"foo\")", "null"},
+	{"puts(true)", "null"},
+	{"puts([1])", "null"},
+	{"puts({\"foo\": \"bar\"})", "null"},
+	{"puts()", "null"},
+	{"puts(1, \"two\", [\"three\"], {\"four\": \"five\"}, true)", "null"},
+	{"fn() { outer(); }() == self()", "true"},
+	{"(namespace { let o = outer(); }).o == self()", "true"},
+	{"import()", "ERROR: wrong number of arguments. got=0, want=1"},
+	{"import(1)", "ERROR: argument to `import` must be STRING, got INTEGER"},
+	{"import(\"_\")", "ERROR: file could not open: _.monkey"},
+	{"type()", "ERROR: wrong number of arguments. got=0, want=1"},
+	// assert
+	{`assert(1 < 2)`, "null"},
+	{`assert(null)`, "ERROR: assert failed: got null"},
+	{`assert(false, "must be true")`, "ERROR: must be true: assert failed: got false"},
+	{`assert_eq([1, "a"], [1, "a"])`, "null"},
+	{`assert_eq({"a": [1, 2]}, {"a": [1, 2]})`, "null"},
+	{`assert_eq(1, "1")`, "ERROR: assert_eq failed: expected \"1\", got 1"},
+	{`assert_eq(1 + 1, 3, "sum")`, "ERROR: sum: assert_eq failed: expected 3, got 2"},
+	{`assert_eq([1, 2, 3], [1, 5])`, "ERROR: assert_eq failed:\n  [1]: expected 5, got 2\n  expected length 2, got 3"},
+	{`assert_eq({"a": 1, "b": {"c": true}}, {"b": {"c": false}, "d": 1})`, "ERROR: assert_eq failed:\n  [\"a\"]: unexpected 1\n  [\"b\"][\"c\"]: expected false, got true\n  [\"d\"]: missing (expected 1)"},
+	{`let f = fn() {}; assert_eq(f, f)`, "null"},
+	{`assert_eq(fn() {}, fn() {})`, "ERROR: assert_eq failed: expected fn() {\n\n}, got fn() {\n\n}"},
+	// 自身を含む値も比較できる
+	{`let a = [1]; a[0] = a; let b = [1]; b[0] = b; try { assert_eq(a, b) } catch (e) { 1 }`, "null"},
+	{`let a = [1, 2]; a[0] = a; let b = [1, 3]; b[0] = b; assert_eq(a, b)`,
+		"ERROR: assert_eq failed: [1]: expected 3, got 2"},
+	{`let h = {"n": 1}; h["me"] = h; let g = {"n": 1}; g["me"] = g; assert_eq(h, g)`, "null"},
+	{`assert_error(fn() { throw "boom" }, "oo")["message"]`, "boom"},
+	{`assert_error(fn() { x })["type"]`, "RuntimeError"},
+	{`assert_error(fn() { 1 })`, "ERROR: assert_error failed: no error occurred (got 1)"},
+	{`assert_error(fn() { throw "boom" }, "bang")`, "ERROR: assert_error failed: error message \"boom\" does not contain \"bang\""},
+	{`assert_error(1)`, "ERROR: argument to `assert_error` must be FUNCTION, got INTEGER"},
+	{`assert()`, "ERROR: wrong number of arguments. got=0, want=1 or 2"},
+	// type()
+	{"type(1)", "INTEGER"},
+	{"type(true)", "BOOLEAN"},
+	{"type(if (!0) {})", "NULL"},
+	{"type(fn(x) { x })", "FUNCTION"},
+	{"type(\"hello\")", "STRING"},
+	{"type(puts)", "BUILTIN"},
+	{"type([1, 2, 3])", "ARRAY"},
+	{"type({\"age\": 24})", "HASH"},
+	{"type(namespace {})", "NAMESPACE"},
+	// self(), outer()
+	{"self(1);", "ERROR: wrong number of arguments. got=1, want=0"},
+	{"outer(1);", "ERROR: wrong number of arguments. got=1, want=0"},
+	{"outer();", "null"},
+	{`
+		let x = 3;
+		self();
+	`, "namespace {x: 3}"},
+	{`
+		fn() {
+			let x = 3;
+			self();
+		}();
+	`, "namespace {x: 3}"},
+	{`fn(x) { self(); }(3);`, "namespace {x: 3}"},
+	{`
+		let x = 3;
+		fn() { outer() }();
+	`, "namespace {x: 3}"},
+	{`namespace { let ns = namespace { let five = 5; }; };`, "namespace {ns: namespace {...}}"},
+	{`namespace { let ns = self(); };`, "namespace {ns: namespace {...}}"},
+	// array index
+	{"[1, 2, 3][0]", "1"},
+	{"[1, 2, 3][1]", "2"},
+	{"[1, 2, 3][2]", "3"},
+	{"let i = 0; [1][i]", "1"},
+	{"[1, 2, 3][1 + 1]", "3"},
+	{"let myArray = [1, 2, 3]; myArray[2];", "3"},
+	{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", "6"},
+	{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i];", "2"},
+	{"[1, 2, 3][3]", "null"},
+	{"[1, 2, 3][-1]", "null"},
+	// hash index
+	{"{\"foo\": 5}[\"foo\"]", "5"},
+	{"{\"foo\": 5}[\"bar\"]", "null"},
+	{"let key = \"foo\"; {\"foo\": 5}[key]", "5"},
+	{"{}[\"foo\"]", "null"},
+	{"{5: 5}[5]", "5"},
+	{"{true: 5}[true]", "5"},
+	{"{false: 5}[false]", "5"},
+	{"{true: 5}[5 == 5]", "5"},
+	{"{\"age\": 5}[\"a\" + \"ge\"]", "5"},
+	// assignment
+	{"let a = [1, 2, 3]; a[0] = 5; a[0];", "5"},
+	{"let a = [1, 2, 3]; a[2] = 5;", "5"},
+	{"let a = [1, 2, 3]; let b = a; a[1] = 5; b[1];", "5"},
+	{"let a = [[1], [2]]; a[1][0] = 5; a[1][0];", "5"},
+	{"let a = [1]; let b = [2]; a[0] = b[0] = 5; a[0] + b[0];", "10"},
+	{"let h = {\"a\": 1}; h[\"a\"] = 5; h[\"a\"];", "5"},
+	{"let h = {}; h[\"b\"] = 5; h[\"b\"];", "5"},
+	{"let h = {}; h[true] = 5; h[1 == 1];", "5"},
+	{"let ns = namespace { let x = 1; }; ns.x = 5; ns.x;", "5"},
+	{"let ns = namespace {}; ns.y = 5; ns.y;", "5"},
+	{"let ns = namespace { let a = [1]; }; ns.a[0] = 5; ns.a[0];", "5"},
+	{"let x = 1; let ns = namespace {}; ns.x = 5; x;", "1"},
+	{`
+		let Counter = namespace {
+			let new = fn() { let count = 0; self(); };
+			let inc = fn() { outer().count = count + 1; };
+		};
+		let c = Counter.new();
+		c.inc();
+		c.inc();
+		c.count;
+	`, "2"},
+	{"let a = [1]; a[1] = 5;", "ERROR: index out of range: 1"},
+	{"let a = [1]; a[-1] = 5;", "ERROR: index out of range: -1"},
+	{"let h = {}; h[fn() {}] = 5;", "ERROR: unusable as hash key: FUNCTION"},
+	{"let s = \"a\"; s[0] = \"b\";", "ERROR: index assignment not supported: STRING"},
+	{"let h = {}; h.x = 5;", "ERROR: field assignment not supported: HASH"},
+	{"let a = [1]; a[0] = unknownVar;", "ERROR: identifier not found: unknownVar"},
+	// self-referential values
+	{"let a = [1]; a[0] = a; puts(a); a;", "[[...]]"},
+	{"let a = [1]; append!(a, a); a;", "[1, [...]]"},
+	{`let h = {}; h["k"] = h; puts(h); h;`, "{k: {...}}"},
+	{`let a = [1]; let h = {"a": a}; a[0] = h; a;`, "[{a: [...]}]"},
+	{`let ns = namespace { let a = [1]; }; ns.a[0] = ns; ns.a;`, "[namespace {a: [...]}]"},
+	{"let b = [1]; [b, b];", "[[1], [1]]"},
+	// null
+	{"null", "null"},
+	{"let x = null; x;", "null"},
+	{"null == null", "true"},
+	{"null != null", "false"},
+	{"null == if (false) { 1 }", "true"},
+	{"null == 0", "false"},
+	{"!null", "true"},
+	{"{\"a\": 1}[\"b\"] == null", "true"},
+	// ??, ?., ?[
+	{"null ?? 5", "5"},
+	{"3 ?? 5", "3"},
+	{"false ?? 5", "false"},
+	{"null ?? null", "null"},
+	{"null ?? null ?? 5", "5"},
+	{"1 ?? unknownVar", "1"},
+	{"null ?? unknownVar", "ERROR: identifier not found: unknownVar"},
+	{"{\"a\": 1}[\"b\"] ?? 5", "5"},
+	{"let ns = namespace { let x = 5; }; ns?.x", "5"},
+	{"let ns = namespace { let f = fn() { 5 }; }; ns?.f()", "5"},
+	{"let ns = null; ns?.x", "null"},
+	{"let ns = null; ns?.x ?? 5", "5"},
+	{"let ns = null; ns?.f(unknownVar)", "null"},
+	{"let ns = namespace { let f = null; }; ns?.f()", "null"},
+	{"let f = null; f()", "ERROR: not a function: NULL"},
+	{"let ns = namespace { let child = null; }; ns?.child?.x", "null"},
+	{"let ns = null; ns.x", "ERROR: identifier not found: x"},
+	{"5?.true", "ERROR: type mismatch: INTEGER ?. BOOLEAN"},
+	{"[1, 2]?[0]", "1"},
+	{"{\"a\": 5}?[\"a\"]", "5"},
+	{"let a = null; a?[0]", "null"},
+	{"let a = null; a?[unknownVar]", "null"},
+	{"let h = {\"a\": null}; h[\"a\"]?[\"b\"]?[0] ?? 5", "5"},
+	{"let a = null; a[0]", "ERROR: index operator not supported: NULL"},
+	// ?., ?[で左辺がnullなら、連鎖の残りも評価しない
+	{"null?.a.b", "null"},
+	{"let ns = null; ns?.a.b.c", "null"},
+	{"let ns = null; ns?.f().x", "null"},
+	{"let ns = null; ns?.a[0][unknownVar]", "null"},
+	{"let a = null; a?[0].x(1)[2]", "null"},
+	{"let a = null; a?[0][1] ?? 5", "5"},
+	{"let ns = namespace { let child = null; }; ns?.child.x", "ERROR: identifier not found: x"},
+	{"let ns = namespace { let child = namespace { let x = 5; }; }; ns?.child.x", "5"},
+	{"let h = {\"a\": null}; h?[\"a\"][0]", "ERROR: index operator not supported: NULL"},
+	// spread operator
+	{"let a = [1, 2]; [...a, 3];", "[1, 2, 3]"},
+	{"let a = [1, 2]; let b = [4]; [0, ...a, 3, ...b];", "[0, 1, 2, 3, 4]"},
+	{"[...[]]", "[]"},
+	{"let a = [1]; let b = [...a]; append!(b, 2); a;", "[1]"},
+	{"let add = fn(x, y, z) { x + y + z }; add(...[1, 2, 3]);", "6"},
+	{"let add = fn(x, y, z) { x + y + z }; add(1, ...[2], 3);", "6"},
+	{"let add = fn(x, y) { x + y }; add(...[1, 2, 3]);", "ERROR: wrong number of arguments. got=3, want=2"},
+	{"len(...[[1, 2]])", "2"},
+	{"let d = {\"a\": 1, \"b\": 2}; {...d, \"b\": 3}[\"b\"];", "3"},
+	{"let d = {\"a\": 1, \"b\": 2}; {...d, \"b\": 3}[\"a\"];", "1"},
+	{"let d = {\"a\": 1, \"b\": 2}; {\"b\": 3, ...d}[\"b\"];", "2"},
+	{"let d = {\"a\": 1}; let e = {...d}; e[\"a\"] = 5; d[\"a\"];", "1"},
+	{"[...1]", "ERROR: spread operator not supported: INTEGER"},
+	{"{...\"a\"}", "ERROR: spread operator not supported: STRING"},
+	{"[...unknownVar]", "ERROR: identifier not found: unknownVar"},
+	{"let f = fn(x) { x }; f(...{})", "ERROR: spread operator not supported: HASH"},
+	// namespace literals
+	{`
+		namespace {
+			let x = 1;
+			let cond = true;
+			let y = x + 2;
+		}
+	`, "namespace {cond: true, x: 1, y: 3}"},
+	{`
+		let mySpace = namespace { let x = 1; };
+		mySpace;
+	`, "namespace {x: 1}"},
+	{`
+		let mySpace = namespace { let x = 1; };
+		let alias = mySpace;
+		alias;
+	`, "namespace {x: 1}"},
+	// namespace as OOP
+	{`
+		let Person = namespace {
+			let new = fn(age) { self(); };
+		};
+		let person = Person.new(20);
+		person.age;
+	`, "20"},
+	{`
+		let Person = namespace {
+			let new = fn(age) { self(); };
+			let canDrink = fn() { age >= 20; };
+		};
+		let person = Person.new(30);
+		person.canDrink();
+	`, "true"},
+	{`
+		let Person = namespace {
+			let new = fn(age) { self(); };
+			let reachBirthDay = fn() { outer().new(age + 1); };
+		};
+		let person = Person.new(14);
+		let person = person.reachBirthDay();
+		person.age;
+	`, "15"},
+	{`
+		let Person = namespace {
+			let new = fn(age) { self(); };
+			let isOlder = fn(other) { age > other.age };
+		};
+		let mike = Person.new(14);
+		let judy = Person.new(18);
+		judy.isOlder(mike);
+	`, "true"},
+	// namespace scopes
+	{`
+		let mySpace = namespace { let x = 10; };
+		let x = 1;
+		x;
+	`, "1"},
+	{`
+		let x = 1;
+		let mySpace = namespace { let x = 10; };
+		x;
+	`, "1"},
+	// . operator
+	{`
+		let mySpace = namespace {
+			let five = 5;
+		};
+		mySpace.five;
+	`, "5"},
+	{`
+		let mySpace = namespace {
+			let five = fn() { 5; };
+		};
+		mySpace.five();
+	`, "5"},
+	{`
+		let mySpace = namespace {
+			let childSpace = namespace {
+				let five = 5;
+			};
+		};
+		mySpace.childSpace.five;
+	`, "5"},
+	{`let mySpace = namespace {
+			let five = 5;
+		};
+		let f = fn() { mySpace; };
+		f().five;
+	`, "5"},
+	{"namespace { let x = 5; }.x;", "5"},
+	{"let std = import(\"" + SCRIPTS_DIR + "/std\"); std.map([1, 2, 3], fn(x) { x * x; });", "[1, 4, 9]"},
+	{"let std = import(\"" + SCRIPTS_DIR + "/std\"); std.sum(std.arange(0, 5, 1));", "10"},
+	// resolved scopes
+	{"let f = fn(a) { fn(b) { fn(c) { a + b + c } } }; f(1)(2)(3);", "6"},
+	{"let x = 1; let f = fn(c) { if (c) { let x = 2; }; x }; f(false);", "1"},
+	{"let x = 1; let f = fn(c) { if (c) { let x = 2; }; x }; f(true);", "2"},
+	{"let x = 1; let f = fn() { let y = x; let x = 2; y }; f();", "1"},
+	{"let f = fn() { let s = self(); s.y = 5; fn() { y } }; f()();", "5"},
+	{"let f = fn(x) { fn() { let o = outer(); o.x = 7; }(); x }; f(1);", "7"},
+	{`
+		let a = namespace { let v = 1; let get = fn() { v }; };
+		let b = namespace { let v = 2; };
+		b.(a.get)();
+	`, "2"},
+	{"let f = fn(e) { try { throw 1; } catch (e) { e[\"value\"] }; e }; f(8);", "8"},
+	{"let f = fn() { try { throw 9; } catch (e) { let v = e[\"value\"]; fn() { v } } }; f()();", "9"},
+	{"let f = fn(n) { if (n == 0) { return 0; }; n + f(n - 1) }; f(100);", "5050"},
+}
@@ -0,0 +1,77 @@
+package conformance
+
+import (
+	"../ast"
+	"../lexer"
+	"../object"
+	"../parser"
+	"fmt"
+	"strings"
+)
+
+// NOTE: 実行エンジンによらない振る舞いを、ソースと評価結果のInspect()の組で表す
+// (エラーはInspect()と同じく"ERROR: "に続くメッセージ)
+
+type Case struct {
+	Input    string
+	Expected string
+}
+
+// Inputに含まれるこの文字列は、scriptsディレクトリの絶対パスに置き換える
+const SCRIPTS_DIR = "$SCRIPTS_DIR"
+
+type Failure struct {
+	Case Case
+	Got  string
+}
+
+func (f *Failure) String() string {
+	return fmt.Sprintf("wrong result of %q.\nwant=%s\ngot=%s",
+		f.Case.Input, f.Case.Expected, f.Got)
+}
+
+// 全てのCasesをengineで評価し、期待と異なるものを返す
+func Run(engine Engine, scriptsDir string) []*Failure {
+	failures := []*Failure{}
+
+	for _, c := range Cases {
+		input := strings.Replace(c.Input, SCRIPTS_DIR, scriptsDir, -1)
+
+		got, err := evalInput(engine, input)
+		if err != nil {
+			got = err.Error()
+		}
+
+		if got != c.Expected {
+			failures = append(failures, &Failure{Case: c, Got: got})
+		}
+	}
+
+	return failures
+}
+
+func evalInput(engine Engine, input string) (string, error) {
+	program, err := parse(input)
+	if err != nil {
+		return "", err
+	}
+
+	// 各ケースごとに新しい(=独立した)環境
+	evaluated := engine.Eval(program, object.NewEnvironment())
+	if evaluated == nil {
+		return "", fmt.Errorf("no value returned")
+	}
+
+	return evaluated.Inspect(), nil
+}
+
+func parse(input string) (*ast.Program, error) {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("parser errors: %s", strings.Join(p.Errors(), ", "))
+	}
+
+	return program, nil
+}
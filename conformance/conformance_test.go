@@ -0,0 +1,79 @@
+package conformance
+
+import (
+	"../object"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func scriptsDir(t *testing.T) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(filepath.Dir(wd), "scripts")
+}
+
+func TestCases(t *testing.T) {
+	for _, engine := range Engines {
+		for _, f := range Run(engine, scriptsDir(t)) {
+			t.Errorf("engine %s: %s", engine.Name(), f)
+		}
+	}
+}
+
+func TestDifferential(t *testing.T) {
+	for _, m := range Differential(Evaluator, VM, 1, 500) {
+		t.Errorf("results differ\n%s", m)
+	}
+}
+
+func TestGeneratorIsDeterministic(t *testing.T) {
+	g1 := NewGenerator(42)
+	g2 := NewGenerator(42)
+
+	for i := 0; i < 20; i++ {
+		p1 := g1.Program()
+		p2 := g2.Program()
+		if p1 != p2 {
+			t.Fatalf("programs differ with the same seed.\n%s\n---\n%s", p1, p2)
+		}
+	}
+}
+
+func TestGeneratedProgramsParse(t *testing.T) {
+	g := NewGenerator(1)
+
+	for i := 0; i < 500; i++ {
+		program := g.Program()
+		if _, err := parse(program); err != nil {
+			t.Fatalf("generated program has %s\n%s", err, program)
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b": 2, "a": 1}`, `{a: 1, b: 2}`},
+		{`{"a": {"d": 1, "c": [2, 3]}}`, `{a: {c: [2, 3], d: 1}}`},
+		{`namespace { let y = 2; let x = namespace { let z = 1 } }`,
+			`namespace {x: namespace {...}, y: 2}`},
+		{`1 + true`, "ERROR: type mismatch: INTEGER + BOOLEAN (line 1, column 1, file \"\")\n" +
+			"traceback (most recent call last):\n    at <main> (line 1)\n"},
+	}
+
+	for _, tt := range tests {
+		program, err := parse(tt.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := Describe(Evaluator.Eval(program, object.NewEnvironment()))
+		if got != tt.expected {
+			t.Errorf("wrong description of %q.\nwant=%q\ngot=%q", tt.input, tt.expected, got)
+		}
+	}
+}
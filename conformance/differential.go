@@ -0,0 +1,107 @@
+package conformance
+
+import (
+	"../object"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ランダムなプログラムの評価結果がエンジン間で異なったもの
+type Mismatch struct {
+	Program string
+	Engines [2]string
+	Results [2]string
+}
+
+func (m *Mismatch) String() string {
+	return fmt.Sprintf("program:\n%s\n--- %s:\n%s\n--- %s:\n%s",
+		m.Program, m.Engines[0], m.Results[0], m.Engines[1], m.Results[1])
+}
+
+// seedから生成したcount個のランダムなプログラムをa, bで評価し、結果が異なるものを返す
+func Differential(a, b Engine, seed int64, count int) []*Mismatch {
+	g := NewGenerator(seed)
+	mismatches := []*Mismatch{}
+
+	for i := 0; i < count; i++ {
+		program := g.Program()
+
+		resultA := Describe(evalProgram(a, program))
+		resultB := Describe(evalProgram(b, program))
+		if resultA != resultB {
+			mismatches = append(mismatches, &Mismatch{
+				Program: program,
+				Engines: [2]string{a.Name(), b.Name()},
+				Results: [2]string{resultA, resultB},
+			})
+		}
+	}
+
+	return mismatches
+}
+
+func evalProgram(engine Engine, input string) object.Object {
+	program, err := parse(input)
+	if err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+
+	return engine.Eval(program, object.NewEnvironment())
+}
+
+// 評価結果の比較用の表現
+// NOTE: Inspect()と異なり、ハッシュとnamespaceはkeyの順序によらない
+// エラーは位置とトレースバックも含む
+func Describe(obj object.Object) string {
+	if errObj, ok := obj.(*object.Error); ok {
+		message := errObj.Inspect()
+		// throwされた値のメッセージもkeyの順序によらない表現にする
+		if errObj.Value != nil {
+			message = "ERROR: thrown " + describe(errObj.Value)
+		}
+		return fmt.Sprintf("%s (line %d, column %d, file %q)\n%s",
+			message, errObj.Line, errObj.Column, errObj.File, errObj.Traceback())
+	}
+
+	if nameSpace, ok := obj.(*object.NameSpace); ok {
+		pairs := []string{}
+		for _, name := range nameSpace.Env.Names() {
+			val, _ := nameSpace.Env.Get(name)
+			pairs = append(pairs, fmt.Sprintf("%s: %s", name, describe(val)))
+		}
+		return "namespace {" + strings.Join(pairs, ", ") + "}"
+	}
+
+	return describe(obj)
+}
+
+func describe(obj object.Object) string {
+	switch obj := obj.(type) {
+	case nil:
+		return "<nil>"
+	case *object.Array:
+		elements := []string{}
+		for _, el := range obj.Elements {
+			elements = append(elements, describe(el))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *object.Hash:
+		pairs := []string{}
+		for _, pair := range obj.Pairs {
+			pairs = append(pairs, fmt.Sprintf("%s: %s",
+				describe(pair.Key), describe(pair.Value)))
+		}
+		sort.Strings(pairs)
+		return "{" + strings.Join(pairs, ", ") + "}"
+	case *object.NameSpace:
+		// NOTE: 自己参照で無限ループしないよう、内部は省略
+		return "namespace {...}"
+	case *object.ReturnValue:
+		// NOTE: `let x = if (c) { return v }`はReturnValueを束縛する
+		// (Inspect()はnamespaceを含むと無限ループすることがある)
+		return "return " + describe(obj.Value)
+	default:
+		return obj.Inspect()
+	}
+}
@@ -0,0 +1,38 @@
+package conformance
+
+import (
+	"../ast"
+	"../evaluator"
+	"../object"
+	"../vm"
+)
+
+// 実行エンジン(評価器、vm等)
+// NOTE: Evalは評価器のEvalと同じく、最後に評価した文の値(エラーは*object.Error)を返す
+type Engine interface {
+	Name() string
+	Eval(node ast.Node, env *object.Environment) object.Object
+}
+
+type engine struct {
+	name string
+	eval evaluator.EvalFunc
+}
+
+func (e *engine) Name() string { return e.name }
+func (e *engine) Eval(node ast.Node, env *object.Environment) object.Object {
+	return e.eval(node, env)
+}
+
+// Eval関数をEngineとして扱う
+func NewEngine(name string, eval evaluator.EvalFunc) Engine {
+	return &engine{name: name, eval: eval}
+}
+
+var (
+	Evaluator = NewEngine("eval", evaluator.Eval)
+	VM        = NewEngine("vm", vm.Eval)
+)
+
+// 組み込みのエンジン
+var Engines = []Engine{Evaluator, VM}
@@ -0,0 +1,367 @@
+package conformance
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// NOTE: 実行エンジン間の差分を探すため、ランダムなプログラムを生成する
+// 生成されるプログラムは必ず停止する
+// (関数は自身より前にletで束縛された関数のみ呼び出すため、再帰しない)
+// 型の合わない演算、未定義の変数等、エラーになるプログラムも生成する
+
+const (
+	MAX_EXPRESSION_DEPTH = 3
+	MAX_STATEMENTS       = 6
+)
+
+type Generator struct {
+	r      *rand.Rand
+	scopes []*genScope
+	// 変数名の通し番号
+	counter int
+	// 関数、ブロック等の入れ子の深さ(深いほど式を小さくする)
+	nest int
+	// 関数の本体内の、if, tryのブロックの深さ
+	blockDepth int
+}
+
+type genScope struct {
+	values     []string
+	functions  []genFunction
+	nameSpaces []genNameSpace
+	inFunction bool
+}
+
+type genFunction struct {
+	name  string
+	arity int
+}
+
+type genNameSpace struct {
+	name    string
+	members []string
+}
+
+func NewGenerator(seed int64) *Generator {
+	return &Generator{r: rand.New(rand.NewSource(seed))}
+}
+
+func (g *Generator) Program() string {
+	g.scopes = []*genScope{{}}
+	g.counter = 0
+	g.nest = 0
+
+	return g.statements(1+g.r.Intn(MAX_STATEMENTS), "\n")
+}
+
+// n個の文(最後は式文)
+func (g *Generator) statements(n int, sep string) string {
+	stmts := []string{}
+	for i := 0; i < n-1; i++ {
+		stmts = append(stmts, g.statement()+";")
+	}
+	stmts = append(stmts, g.expression(0)+";")
+
+	return strings.Join(stmts, sep)
+}
+
+func (g *Generator) scope() *genScope {
+	return g.scopes[len(g.scopes)-1]
+}
+
+// NOTE: 識別子には数字を使えないため、通し番号は英小文字で表す(1 -> "a", 27 -> "aa")
+func (g *Generator) newName(prefix string) string {
+	g.counter++
+
+	suffix := ""
+	for n := g.counter; n > 0; n = (n - 1) / 26 {
+		suffix = string(rune('a'+(n-1)%26)) + suffix
+	}
+	return prefix + "_" + suffix
+}
+
+func (g *Generator) statement() string {
+	if g.nest >= MAX_EXPRESSION_DEPTH {
+		return g.expression(0)
+	}
+
+	switch n := g.r.Intn(40); {
+	case n < 16:
+		name := g.newName("v")
+		stmt := fmt.Sprintf("let %s = %s", name, g.expression(0))
+		g.scope().values = append(g.scope().values, name)
+		return stmt
+	case n < 24:
+		name := g.newName("f")
+		arity := g.r.Intn(3)
+		stmt := fmt.Sprintf("let %s = %s", name, g.functionLiteral(arity))
+		g.scope().functions = append(g.scope().functions, genFunction{name, arity})
+		return stmt
+	case n < 28:
+		return g.nameSpaceStatement()
+	// NOTE: ブロック内のreturnは`let x = if (c) { return v }`のように
+	// ReturnValueが束縛され、Inspect()が無限ループすることがあるため生成しない
+	case n < 30 && g.scope().inFunction && g.blockDepth == 0:
+		return "return " + g.expression(0)
+	case n < 31:
+		return "throw " + g.expression(1)
+	case n < 33:
+		return "const " + g.newName("c") + " = " + g.expression(1)
+	default:
+		return g.expression(0)
+	}
+}
+
+func (g *Generator) functionLiteral(arity int) string {
+	params := []string{}
+	for i := 0; i < arity; i++ {
+		params = append(params, g.newName("p"))
+	}
+
+	g.scopes = append(g.scopes, &genScope{values: params, inFunction: true})
+	g.nest++
+	blockDepth := g.blockDepth
+	g.blockDepth = 0
+	body := g.statements(1+g.r.Intn(3), " ")
+	g.blockDepth = blockDepth
+	g.nest--
+	g.scopes = g.scopes[:len(g.scopes)-1]
+
+	return fmt.Sprintf("fn(%s) { %s }", strings.Join(params, ", "), body)
+}
+
+func (g *Generator) nameSpaceStatement() string {
+	name := g.newName("ns")
+	members := []string{}
+	stmts := []string{}
+
+	g.scopes = append(g.scopes, &genScope{})
+	g.nest++
+	for i := 0; i < 1+g.r.Intn(3); i++ {
+		member := g.newName("m")
+		if g.r.Intn(3) == 0 {
+			// self()を返すコンストラクタ
+			stmts = append(stmts, fmt.Sprintf("let %s = fn(%s) { self() };",
+				member, g.newName("a")))
+		} else {
+			stmts = append(stmts, fmt.Sprintf("let %s = %s;", member, g.expression(1)))
+		}
+		g.scope().values = append(g.scope().values, member)
+		members = append(members, member)
+	}
+	g.nest--
+	g.scopes = g.scopes[:len(g.scopes)-1]
+
+	g.scope().nameSpaces = append(g.scope().nameSpaces, genNameSpace{name, members})
+	return fmt.Sprintf("let %s = namespace { %s }", name, strings.Join(stmts, " "))
+}
+
+// 現在のスコープから見える変数名
+func (g *Generator) visibleValues() []string {
+	values := []string{}
+	for _, s := range g.scopes {
+		values = append(values, s.values...)
+	}
+	return values
+}
+
+func (g *Generator) visibleFunctions() []genFunction {
+	functions := []genFunction{}
+	for _, s := range g.scopes {
+		functions = append(functions, s.functions...)
+	}
+	return functions
+}
+
+func (g *Generator) visibleNameSpaces() []genNameSpace {
+	nameSpaces := []genNameSpace{}
+	for _, s := range g.scopes {
+		nameSpaces = append(nameSpaces, s.nameSpaces...)
+	}
+	return nameSpaces
+}
+
+func (g *Generator) expression(depth int) string {
+	if depth+g.nest >= MAX_EXPRESSION_DEPTH {
+		return g.atom()
+	}
+
+	switch g.r.Intn(16) {
+	case 0, 1, 2:
+		return g.atom()
+	case 3, 4:
+		ops := []string{"+", "-", "*", "<", ">", "<=", ">=", "==", "!=", "&&", "||", "??"}
+		op := ops[g.r.Intn(len(ops))]
+		return fmt.Sprintf("(%s %s %s)", g.expression(depth+1), op, g.expression(depth+1))
+	case 5:
+		// NOTE: 0除算は評価器がpanicするため、右辺は正の整数に限る
+		return fmt.Sprintf("(%s / %d)", g.expression(depth+1), 1+g.r.Intn(5))
+	case 6:
+		ops := []string{"!", "-"}
+		return fmt.Sprintf("(%s%s)", ops[g.r.Intn(len(ops))], g.expression(depth+1))
+	case 7:
+		return g.ifExpression(depth)
+	case 8:
+		elements := g.expressions(depth, g.r.Intn(4))
+		if g.r.Intn(3) == 0 {
+			elements = append(elements, "..."+g.collection(depth+1, "["))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case 9:
+		return g.hashLiteral(depth)
+	case 10:
+		ops := []string{"[", "?["}
+		brackets := []string{"[", "{"}
+		return fmt.Sprintf("%s%s%s]", g.collection(depth+1, brackets[g.r.Intn(2)]),
+			ops[g.r.Intn(len(ops))], g.expression(depth+1))
+	case 11:
+		return g.call(depth)
+	case 12:
+		return g.nameSpaceAccess(depth)
+	case 13:
+		return g.tryExpression(depth)
+	case 14:
+		return fmt.Sprintf("%s(%s)", g.functionLiteral(1), g.expression(depth+1))
+	default:
+		builtins := []string{"len", "first", "last", "rest", "type"}
+		if g.r.Intn(3) == 0 {
+			return fmt.Sprintf("push(%s, %s)", g.expression(depth+1), g.expression(depth+1))
+		}
+		return fmt.Sprintf("%s(%s)", builtins[g.r.Intn(len(builtins))], g.expression(depth+1))
+	}
+}
+
+func (g *Generator) expressions(depth, n int) []string {
+	exps := []string{}
+	for i := 0; i < n; i++ {
+		exps = append(exps, g.expression(depth+1))
+	}
+	return exps
+}
+
+func (g *Generator) atom() string {
+	values := g.visibleValues()
+
+	// NOTE: エラーになるプログラムばかりにならないよう、未定義の変数はまれにする
+	switch n := g.r.Intn(40); {
+	case n < 14 && len(values) > 0:
+		return values[g.r.Intn(len(values))]
+	case n < 24:
+		return fmt.Sprintf("%d", g.r.Intn(20))
+	case n < 28:
+		strs := []string{`""`, `"a"`, `"bc"`, `"message"`}
+		return strs[g.r.Intn(len(strs))]
+	case n < 32:
+		return []string{"true", "false"}[g.r.Intn(2)]
+	case n < 34:
+		return "null"
+	case n < 35:
+		return "undefinedName"
+	case n < 37 && g.scope().inFunction:
+		return "self()"
+	default:
+		return fmt.Sprintf("%d", g.r.Intn(5))
+	}
+}
+
+func (g *Generator) ifExpression(depth int) string {
+	// NOTE: ブロック内のletは関数(またはトップレベル)の環境に束縛される
+	// (束縛されないまま参照されることもある)
+	cons := g.block()
+	if g.r.Intn(2) == 0 {
+		return fmt.Sprintf("if (%s) { %s }", g.expression(depth+1), cons)
+	}
+	return fmt.Sprintf("if (%s) { %s } else { %s }", g.expression(depth+1), cons, g.block())
+}
+
+func (g *Generator) block() string {
+	g.nest++
+	g.blockDepth++
+	defer func() {
+		g.nest--
+		g.blockDepth--
+	}()
+	return g.statements(1+g.r.Intn(2), " ")
+}
+
+// 配列(bracketが"[")またはハッシュ("{")になることが多い式
+// (型の誤りでエラーになるプログラムばかりにならないようにする)
+func (g *Generator) collection(depth int, bracket string) string {
+	if g.r.Intn(4) == 0 || depth+g.nest >= MAX_EXPRESSION_DEPTH {
+		return g.expression(depth)
+	}
+	if bracket == "{" {
+		return g.hashLiteral(depth)
+	}
+	return "[" + strings.Join(g.expressions(depth, 1+g.r.Intn(3)), ", ") + "]"
+}
+
+func (g *Generator) hashLiteral(depth int) string {
+	keys := []string{`"a"`, `"b"`, `"message"`, "1", "true"}
+	pairs := []string{}
+	for i := 0; i < g.r.Intn(3); i++ {
+		pairs = append(pairs, fmt.Sprintf("%s: %s", keys[g.r.Intn(len(keys))],
+			g.expression(depth+1)))
+	}
+	if g.r.Intn(4) == 0 {
+		pairs = append(pairs, "..."+g.collection(depth+1, "{"))
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+func (g *Generator) call(depth int) string {
+	functions := g.visibleFunctions()
+	if len(functions) == 0 {
+		return g.atom()
+	}
+
+	f := functions[g.r.Intn(len(functions))]
+	arity := f.arity
+	// 引数の数の誤り
+	if g.r.Intn(10) == 0 {
+		arity++
+	}
+
+	args := g.expressions(depth, arity)
+	if arity > 0 && g.r.Intn(5) == 0 {
+		return fmt.Sprintf("%s(...[%s])", f.name, strings.Join(args, ", "))
+	}
+	return fmt.Sprintf("%s(%s)", f.name, strings.Join(args, ", "))
+}
+
+func (g *Generator) nameSpaceAccess(depth int) string {
+	nameSpaces := g.visibleNameSpaces()
+	if len(nameSpaces) == 0 {
+		return g.atom()
+	}
+
+	ns := nameSpaces[g.r.Intn(len(nameSpaces))]
+	member := ns.members[g.r.Intn(len(ns.members))]
+
+	switch g.r.Intn(5) {
+	case 0:
+		return fmt.Sprintf("%s?.%s", ns.name, member)
+	case 1:
+		return fmt.Sprintf("(%s.%s = %s)", ns.name, member, g.expression(depth+1))
+	case 2:
+		// コンストラクタの呼び出し(引数がnamespaceのメンバーになる)
+		return fmt.Sprintf("%s.%s(%s)", ns.name, member, g.expression(depth+1))
+	default:
+		return fmt.Sprintf("%s.%s", ns.name, member)
+	}
+}
+
+func (g *Generator) tryExpression(depth int) string {
+	switch g.r.Intn(3) {
+	case 0:
+		// NOTE: ハッシュ等のメッセージ(Inspect())はkeyの順序が不定なため使わない
+		return fmt.Sprintf("try { %s } catch (e) { e[\"type\"] }", g.block())
+	case 1:
+		return fmt.Sprintf("try { %s } finally { %s }", g.block(), g.block())
+	default:
+		return fmt.Sprintf("try { %s } catch (e) { [e[\"type\"], e[\"line\"]] } finally { %s }",
+			g.block(), g.block())
+	}
+}
@@ -0,0 +1,299 @@
+package coverage
+
+import (
+	"../ast"
+	"../evaluator"
+	"../lexer"
+	"../parser"
+	"../runscript"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// NOTE: evaluatorのフック(StatementHook, BranchHook)で評価した文とif式の分岐を数える
+// 評価されなかった文は、レポートを作る時にファイルを構文解析して探す
+// (スクリプトファイル以外(REPL等)で評価した文は数えない)
+
+// 文、if式の先頭のトークンの位置
+type position struct {
+	line   int
+	column int
+}
+
+// if式の分岐を評価した回数
+type branchCount struct {
+	consequence int
+	alternative int
+}
+
+type fileCounts struct {
+	statements map[position]int
+	branches   map[position]*branchCount
+}
+
+type Coverage struct {
+	files         map[string]*fileCounts
+	prevStatement evaluator.StatementHook
+	prevBranch    evaluator.BranchHook
+}
+
+func New() *Coverage {
+	return &Coverage{files: make(map[string]*fileCounts)}
+}
+
+// evaluatorのフックに設定し、計測を始める
+// NOTE: 以前のStatementHook(デバッガ等)も引き続き呼ばれる
+func (c *Coverage) Start() {
+	c.prevStatement = evaluator.SetStatementHook(c.statement)
+	c.prevBranch = evaluator.SetBranchHook(c.branch)
+}
+
+// 計測を終え、以前のフックに戻す
+func (c *Coverage) Stop() {
+	evaluator.SetStatementHook(c.prevStatement)
+	evaluator.SetBranchHook(c.prevBranch)
+}
+
+func (c *Coverage) statement(step *evaluator.Step) error {
+	if step.File != "" {
+		c.counts(step.File).statements[position{step.Line, step.Column}]++
+	}
+	if c.prevStatement != nil {
+		return c.prevStatement(step)
+	}
+	return nil
+}
+
+func (c *Coverage) branch(file string, node *ast.IfExpression, consequence bool) {
+	if file != "" {
+		pos := position{node.Token.Line, node.Token.Column}
+		counts := c.counts(file)
+		branch, ok := counts.branches[pos]
+		if !ok {
+			branch = &branchCount{}
+			counts.branches[pos] = branch
+		}
+		if consequence {
+			branch.consequence++
+		} else {
+			branch.alternative++
+		}
+	}
+	if c.prevBranch != nil {
+		c.prevBranch(file, node, consequence)
+	}
+}
+
+func (c *Coverage) counts(file string) *fileCounts {
+	counts, ok := c.files[file]
+	if !ok {
+		counts = &fileCounts{statements: make(map[position]int),
+			branches: make(map[position]*branchCount)}
+		c.files[file] = counts
+	}
+	return counts
+}
+
+// 評価した文のあるファイル(importしたファイルを含む、名前順)
+func (c *Coverage) Files() []string {
+	files := make([]string, 0, len(c.files))
+	for file := range c.files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// ファイルのカバレッジ
+type FileReport struct {
+	File  string
+	Lines []*Line
+	// 文、分岐(if式1つにつき2つ)の数と評価された数
+	Statements        int
+	CoveredStatements int
+	Branches          int
+	CoveredBranches   int
+}
+
+// ソースの1行
+type Line struct {
+	Number int
+	Source string
+	// この行で始まる文の数(0なら文の無い行)
+	Statements int
+	// この行で始まる文(if式)を評価した回数の最大値
+	Count int
+	// 評価されなかった文の数
+	Missed int
+	// この行で始まるif式
+	Branches []*Branch
+}
+
+// if式の分岐を評価した回数
+type Branch struct {
+	Consequence int
+	Alternative int
+}
+
+func (b *Branch) String() string {
+	return fmt.Sprintf("then %d, else %d", b.Consequence, b.Alternative)
+}
+
+// 評価されなかった文、分岐があるか
+func (l *Line) Partial() bool {
+	if l.Missed > 0 {
+		return true
+	}
+	for _, b := range l.Branches {
+		if b.Consequence == 0 || b.Alternative == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *FileReport) StatementRate() float64 {
+	return rate(r.CoveredStatements, r.Statements)
+}
+
+func (r *FileReport) BranchRate() float64 {
+	return rate(r.CoveredBranches, r.Branches)
+}
+
+func rate(covered, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return 100 * float64(covered) / float64(total)
+}
+
+// ファイルを読み、計測した回数と合わせてレポートを作る
+func (c *Coverage) Report(file string) (*FileReport, error) {
+	source, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("file could not open: %s", file)
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("parser errors in %s: %s", file, p.Errors()[0])
+	}
+
+	report := &FileReport{File: file}
+	for i, text := range strings.Split(string(source), "\n") {
+		report.Lines = append(report.Lines,
+			&Line{Number: i + 1, Source: strings.TrimRight(text, "\r")})
+	}
+
+	counts, ok := c.files[file]
+	if !ok {
+		// 1つも文を評価していないファイル
+		counts = &fileCounts{}
+	}
+	ast.Walk(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			report.addStatement(node.Token.Line, node.Token.Column, counts)
+		case *ast.ReturnStatement:
+			report.addStatement(node.Token.Line, node.Token.Column, counts)
+		case *ast.ThrowStatement:
+			report.addStatement(node.Token.Line, node.Token.Column, counts)
+		case *ast.ExpressionStatement:
+			report.addStatement(node.Token.Line, node.Token.Column, counts)
+		case *ast.IfExpression:
+			report.addBranch(node.Token.Line, node.Token.Column, counts)
+		}
+		return true
+	})
+	return report, nil
+}
+
+func (r *FileReport) addStatement(line, column int, counts *fileCounts) {
+	count := counts.statements[position{line, column}]
+	l := r.Lines[line-1]
+	l.Statements++
+	r.Statements++
+	if count > l.Count {
+		l.Count = count
+	}
+	if count == 0 {
+		l.Missed++
+	} else {
+		r.CoveredStatements++
+	}
+}
+
+func (r *FileReport) addBranch(line, column int, counts *fileCounts) {
+	branch := &Branch{}
+	if count, ok := counts.branches[position{line, column}]; ok {
+		branch.Consequence, branch.Alternative = count.consequence, count.alternative
+	}
+	l := r.Lines[line-1]
+	l.Branches = append(l.Branches, branch)
+	// NOTE: 式の途中の行で始まるif式は、条件を評価した回数を行の評価回数とする
+	if count := branch.Consequence + branch.Alternative; count > l.Count {
+		l.Count = count
+	}
+	r.Branches += 2
+	if branch.Consequence > 0 {
+		r.CoveredBranches++
+	}
+	if branch.Alternative > 0 {
+		r.CoveredBranches++
+	}
+}
+
+// 全てのファイルのレポート
+func (c *Coverage) Reports() ([]*FileReport, error) {
+	reports := []*FileReport{}
+	for _, file := range c.Files() {
+		report, err := c.Report(file)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// カバレッジを計測してスクリプトファイルを実行する
+// reportFileの拡張子が".html"ならHTML、それ以外はテキストのレポートを書き込み、
+// ファイルごとの集計をsummaryに書く
+func RunScript(fileName string, reportFile string, out io.Writer,
+	summary io.Writer) error {
+
+	c := New()
+	c.Start()
+	runscript.RunScript(fileName, out)
+	c.Stop()
+
+	return c.WriteReports(reportFile, summary)
+}
+
+// reportFileにレポートを、summaryにファイルごとの集計を書く
+func (c *Coverage) WriteReports(reportFile string, summary io.Writer) error {
+	reports, err := c.Reports()
+	if err != nil {
+		return err
+	}
+
+	if err := WriteSummary(summary, reports); err != nil {
+		return err
+	}
+
+	f, err := os.Create(reportFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if strings.HasSuffix(reportFile, ".html") {
+		return WriteHTML(f, reports)
+	}
+	return WriteText(f, reports)
+}
@@ -0,0 +1,144 @@
+package coverage
+
+import (
+	"../evaluator"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const MAIN_SCRIPT = `let lib = import(THIS_DIR + "lib");
+let abs = fn(x) {
+  if (x < 0) {
+    -x
+  } else {
+    x
+  }
+};
+let a = abs(2) + abs(3);
+let b = lib.sign(a);
+`
+
+const LIB_SCRIPT = `let sign = fn(x) {
+  if (x > 0) { return 1; }
+  if (x < 0) { return -1; }
+  0
+};
+let unused = fn() { puts("never"); 1 };
+`
+
+// スクリプトをTempDirに書き、そのディレクトリでカバレッジを計測する
+func measure(t *testing.T) []*FileReport {
+	dir, err := ioutil.TempDir("", "monkey-coverage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, script := range map[string]string{
+		"main.monkey": MAIN_SCRIPT,
+		"lib.monkey":  LIB_SCRIPT,
+	} {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(script), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(wd)
+
+	c := New()
+	c.Start()
+	_, err = evaluator.EvalScriptFile("main.monkey")
+	c.Stop()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// NOTE: レポートはファイルを読み直すため、TempDirを消す前に作る
+	reports, err := c.Reports()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return reports
+}
+
+func TestWriteText(t *testing.T) {
+	reports := measure(t)
+
+	expected := `== lib.monkey: statements  44.4% (4/9)       branches  25.0% (1/4)
+      1 | let sign = fn(x) {
+     1* |   if (x > 0) { return 1; }  [then 1, else 0]
+  ##### |   if (x < 0) { return -1; }  [then 0, else 0]
+  ##### |   0
+      - | };
+     1* | let unused = fn() { puts("never"); 1 };
+      - |
+
+== main.monkey: statements  85.7% (6/7)       branches  50.0% (1/2)
+      1 | let lib = import(THIS_DIR + "lib");
+      1 | let abs = fn(x) {
+     2* |   if (x < 0) {  [then 0, else 2]
+  ##### |     -x
+      - |   } else {
+      2 |     x
+      - |   }
+      - | };
+      1 | let a = abs(2) + abs(3);
+      1 | let b = lib.sign(a);
+      - |
+
+`
+
+	var out bytes.Buffer
+	if err := WriteText(&out, reports); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out.String() != expected {
+		t.Errorf("wrong report.\nexpected=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestWriteSummary(t *testing.T) {
+	reports := measure(t)
+
+	expected := `lib.monkey   statements  44.4% (4/9)       branches  25.0% (1/4)
+main.monkey  statements  85.7% (6/7)       branches  50.0% (1/2)
+total        statements  62.5% (10/16)     branches  33.3% (2/6)
+`
+
+	var out bytes.Buffer
+	if err := WriteSummary(&out, reports); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out.String() != expected {
+		t.Errorf("wrong summary.\nexpected=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	reports := measure(t)
+
+	var out bytes.Buffer
+	if err := WriteHTML(&out, reports); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []string{
+		`<li><a href="#file0">lib.monkey</a>: statements  44.4% (4/9)`,
+		`<h2 id="file1">main.monkey</h2>`,
+		`<span class="partial"><span class="count">   3      2* |</span>   if (x &lt; 0) {`,
+		`<span class="missed"><span class="count">   4   ##### |</span>     -x</span>`,
+		`<span class="covered"><span class="count">   6       2 |</span>     x</span>`,
+		`<span class=""><span class="count">   5       - |</span>   } else {</span>`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(out.String(), e) {
+			t.Errorf("%q is not found in:\n%s", e, out.String())
+		}
+	}
+}
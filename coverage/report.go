@@ -0,0 +1,143 @@
+package coverage
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ファイルごと(と合計)の集計
+// `file  statements  80.0% (8/10)      branches  75.0% (3/4)`
+func WriteSummary(w io.Writer, reports []*FileReport) error {
+	total := &FileReport{File: "total"}
+	width := len(total.File)
+	for _, r := range reports {
+		total.Statements += r.Statements
+		total.CoveredStatements += r.CoveredStatements
+		total.Branches += r.Branches
+		total.CoveredBranches += r.CoveredBranches
+		if len(r.File) > width {
+			width = len(r.File)
+		}
+	}
+
+	var out strings.Builder
+	for _, r := range reports {
+		fmt.Fprintf(&out, "%-*s  %s\n", width, r.File, summaryOf(r))
+	}
+	fmt.Fprintf(&out, "%-*s  %s\n", width, total.File, summaryOf(total))
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+func summaryOf(r *FileReport) string {
+	statements := fmt.Sprintf("(%d/%d)", r.CoveredStatements, r.Statements)
+	branches := fmt.Sprintf("(%d/%d)", r.CoveredBranches, r.Branches)
+	return fmt.Sprintf("statements %5.1f%% %-11s branches %5.1f%% %s",
+		r.StatementRate(), statements, r.BranchRate(), branches)
+}
+
+// 行の評価回数の表示
+// 文の無い行は"-"、評価されなかった行は"#####"、
+// 評価されなかった文、分岐がある行は回数の後に"*"
+func countOf(l *Line) string {
+	switch {
+	case l.Statements == 0 && len(l.Branches) == 0:
+		return "-"
+	case l.Count == 0:
+		return "#####"
+	case l.Partial():
+		return strconv.Itoa(l.Count) + "*"
+	default:
+		return strconv.Itoa(l.Count)
+	}
+}
+
+func branchesOf(l *Line) string {
+	branches := []string{}
+	for _, b := range l.Branches {
+		branches = append(branches, "["+b.String()+"]")
+	}
+	return strings.Join(branches, " ")
+}
+
+// ファイルごとに、各行の評価回数を付けたソース
+func WriteText(w io.Writer, reports []*FileReport) error {
+	var out strings.Builder
+	for _, r := range reports {
+		fmt.Fprintf(&out, "== %s: %s\n", r.File, summaryOf(r))
+		for _, l := range r.Lines {
+			line := fmt.Sprintf("%7s | %s", countOf(l), l.Source)
+			if len(l.Branches) > 0 {
+				line += "  " + branchesOf(l)
+			}
+			fmt.Fprintln(&out, strings.TrimRight(line, " "))
+		}
+		fmt.Fprintln(&out)
+	}
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+const htmlHeader = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>monkey coverage</title>
+<style>
+body { font-family: sans-serif; }
+pre { font-family: monospace; }
+.covered { background: #dfd; }
+.partial { background: #ffd; }
+.missed { background: #fdd; }
+.count { color: #666; }
+.branches { color: #a60; }
+</style>
+</head>
+<body>
+`
+
+// ファイルごとに、評価された行を緑、一部が評価されなかった行を黄、
+// 評価されなかった行を赤で表示する
+func WriteHTML(w io.Writer, reports []*FileReport) error {
+	var out strings.Builder
+	out.WriteString(htmlHeader)
+
+	out.WriteString("<h1>Coverage</h1>\n<ul>\n")
+	for i, r := range reports {
+		fmt.Fprintf(&out, "<li><a href=\"#file%d\">%s</a>: %s</li>\n",
+			i, html.EscapeString(r.File), summaryOf(r))
+	}
+	out.WriteString("</ul>\n")
+
+	for i, r := range reports {
+		fmt.Fprintf(&out, "<h2 id=\"file%d\">%s</h2>\n<pre>\n", i, html.EscapeString(r.File))
+		for _, l := range r.Lines {
+			class := ""
+			switch {
+			case l.Statements == 0 && len(l.Branches) == 0:
+			case l.Count == 0:
+				class = "missed"
+			case l.Partial():
+				class = "partial"
+			default:
+				class = "covered"
+			}
+
+			fmt.Fprintf(&out, "<span class=\"%s\"><span class=\"count\">%4d %7s |</span> %s",
+				class, l.Number, countOf(l), html.EscapeString(l.Source))
+			if len(l.Branches) > 0 {
+				fmt.Fprintf(&out, "  <span class=\"branches\">%s</span>",
+					html.EscapeString(branchesOf(l)))
+			}
+			out.WriteString("</span>\n")
+		}
+		out.WriteString("</pre>\n")
+	}
+
+	out.WriteString("</body>\n</html>\n")
+	_, err := io.WriteString(w, out.String())
+	return err
+}
@@ -0,0 +1,185 @@
+package debugger
+
+import (
+	"../evaluator"
+	"../object"
+	"../runscript"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+const PROMPT = "(mdb) "
+
+// 現在の行の前後に表示する行数
+const LIST_LINES = 5
+
+const HELP = `commands:
+  b, break [file:]line  set a breakpoint (list breakpoints without arguments)
+  d, delete id          delete a breakpoint
+  c, continue           continue until the next breakpoint
+  s, step               step into function calls
+  n, next               step over function calls
+  o, out                step out of the current function
+  bt, backtrace         print function calls
+  env                   print the environment chain (innermost first)
+  p, print expr         evaluate expr in the current environment
+  l, list               print source lines around the current line
+  q, quit               abort the script
+  h, help               print this help
+end of input continues the script without stopping`
+
+// コマンドラインのフロントエンド
+type CLI struct {
+	scanner  *bufio.Scanner
+	out      io.Writer
+	Debugger *Debugger
+	// 表示したファイルの行
+	sources map[string][]string
+}
+
+func NewCLI(in io.Reader, out io.Writer) *CLI {
+	return &CLI{scanner: bufio.NewScanner(in), out: out,
+		sources: make(map[string][]string)}
+}
+
+// デバッガでスクリプトファイルを実行する(最初の文で止まる)
+func RunScript(fileName string, in io.Reader, out io.Writer) {
+	cli := NewCLI(in, out)
+	cli.Debugger = New(fileName, cli)
+	prev := cli.Debugger.Attach()
+	defer evaluator.SetStatementHook(prev)
+
+	_, err := runscript.EvalScriptFile(fileName)
+	if evalErr, ok := err.(*evaluator.EvalError); ok &&
+		errors.Is(evalErr.Object.Cause, evaluator.ErrDebuggerQuit) {
+		return
+	}
+	if err != nil {
+		io.WriteString(out, fmt.Sprintf("%s", err))
+		if evalErr, ok := err.(*evaluator.EvalError); ok {
+			io.WriteString(out, "\n"+evalErr.Object.Traceback())
+		}
+	}
+	fmt.Fprintln(out, "program finished")
+}
+
+func (c *CLI) Paused(step *evaluator.Step, reason string) Resume {
+	fmt.Fprintf(c.out, "stopped at %s (%s)\n", location(step.File, step.Line), reason)
+	c.list(step.File, step.Line, 0)
+
+	for {
+		fmt.Fprint(c.out, PROMPT)
+		if !c.scanner.Scan() {
+			fmt.Fprintln(c.out)
+			return DETACH
+		}
+
+		line := strings.TrimSpace(c.scanner.Text())
+		command, arg := line, ""
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			command, arg = line[:i], strings.TrimSpace(line[i+1:])
+		}
+
+		switch command {
+		case "":
+		case "c", "continue":
+			return CONTINUE
+		case "s", "step":
+			return STEP_INTO
+		case "n", "next":
+			return STEP_OVER
+		case "o", "out":
+			return STEP_OUT
+		case "q", "quit":
+			return QUIT
+		case "b", "break":
+			c.breakpoint(arg)
+		case "d", "delete":
+			c.delete(arg)
+		case "bt", "backtrace":
+			for _, frame := range evaluator.Backtrace(step.Env, step.File, step.Line) {
+				fmt.Fprintf(c.out, "    %s\n", frame.String())
+			}
+		case "env":
+			for _, env := range Environments(step.Env) {
+				fmt.Fprintln(c.out, env)
+			}
+		case "p", "print":
+			evaluated := Evaluate(arg, step.Env)
+			if errObj, ok := evaluated.(*object.Error); ok {
+				fmt.Fprintln(c.out, errObj.Inspect())
+			} else {
+				fmt.Fprintln(c.out, evaluated.Inspect())
+			}
+		case "l", "list":
+			c.list(step.File, step.Line, LIST_LINES)
+		case "h", "help":
+			fmt.Fprintln(c.out, HELP)
+		default:
+			fmt.Fprintf(c.out, "unknown command: %s (type help for commands)\n", command)
+		}
+	}
+}
+
+func (c *CLI) breakpoint(arg string) {
+	if arg == "" {
+		for _, bp := range c.Debugger.Breakpoints() {
+			fmt.Fprintln(c.out, bp)
+		}
+		return
+	}
+
+	bp, err := c.Debugger.SetBreakpoint(arg)
+	if err != nil {
+		fmt.Fprintln(c.out, err)
+		return
+	}
+	fmt.Fprintln(c.out, bp)
+}
+
+func (c *CLI) delete(arg string) {
+	id, err := strconv.Atoi(arg)
+	if err != nil {
+		fmt.Fprintf(c.out, "invalid breakpoint id: %q\n", arg)
+		return
+	}
+	if err := c.Debugger.DeleteBreakpoint(id); err != nil {
+		fmt.Fprintln(c.out, err)
+	}
+}
+
+// 現在の行とその前後aroundLines行を表示(現在の行には"->"を付ける)
+func (c *CLI) list(file string, line int, aroundLines int) {
+	lines, ok := c.sources[file]
+	if !ok {
+		source, err := ioutil.ReadFile(file)
+		if err != nil {
+			return
+		}
+		lines = strings.Split(string(source), "\n")
+		c.sources[file] = lines
+	}
+
+	for i := line - aroundLines; i <= line+aroundLines; i++ {
+		if i <= 0 || i > len(lines) {
+			continue
+		}
+		marker := "  "
+		if i == line {
+			marker = "->"
+		}
+		fmt.Fprintf(c.out, "%s %4d | %s\n", marker, i, strings.TrimRight(lines[i-1], "\r"))
+	}
+}
+
+func location(file string, line int) string {
+	if file == "" {
+		return fmt.Sprintf("line %d", line)
+	}
+	return fmt.Sprintf("%s:%d", file, line)
+}
@@ -0,0 +1,285 @@
+package debugger
+
+import (
+	"../ast"
+	"../evaluator"
+	"../lexer"
+	"../object"
+	"../parser"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NOTE: evaluatorの文ごとのフック(evaluator.SetStatementHook)で評価を止める
+// 止まった時の操作(コマンドの入力等)はFrontendが行う
+// (コマンドライン以外のフロントエンド(Debug Adapter Protocol等)も差し替えられる)
+
+// 再開の方法
+type Resume int
+
+const (
+	CONTINUE  Resume = iota // 次のブレークポイントまで
+	STEP_INTO               // 次の文(呼び出した関数の中も含む)
+	STEP_OVER               // 同じ深さ以下の次の文
+	STEP_OUT                // 現在の関数から戻った後の次の文
+	DETACH                  // 以降は止まらない
+	QUIT                    // 評価を打ち切る
+)
+
+type Frontend interface {
+	// 評価が止まった時に呼ばれる(reasonは"breakpoint 1"等)
+	// 再開の方法を返すまで評価は止まる
+	Paused(step *evaluator.Step, reason string) Resume
+}
+
+type Breakpoint struct {
+	ID   int
+	File string
+	Line int
+}
+
+func (bp *Breakpoint) String() string {
+	return fmt.Sprintf("breakpoint %d at %s:%d", bp.ID, bp.File, bp.Line)
+}
+
+type Debugger struct {
+	// 実行するスクリプトファイル(ファイル名の無いブレークポイントはこのファイル)
+	MainFile    string
+	Frontend    Frontend
+	breakpoints []*Breakpoint
+	nextID      int
+
+	resume Resume
+	// 最後に止まった位置と深さ
+	stoppedFile  string
+	stoppedLine  int
+	stoppedDepth int
+	// 直前に評価した文の位置と深さ
+	// (同じ行の2つ目以降の文ではブレークポイントで止まらない)
+	lastFile  string
+	lastLine  int
+	lastDepth int
+	// Frontendが止まっている間(Evaluateで評価する式では止まらない)
+	paused bool
+}
+
+// 最初の文で止まるデバッガ
+func New(mainFile string, frontend Frontend) *Debugger {
+	return &Debugger{MainFile: mainFile, Frontend: frontend, resume: STEP_INTO,
+		nextID: 1}
+}
+
+// evaluatorのフックとして設定する(以前のフックを返す)
+func (d *Debugger) Attach() evaluator.StatementHook {
+	return evaluator.SetStatementHook(d.hook)
+}
+
+func (d *Debugger) hook(step *evaluator.Step) error {
+	if d.paused {
+		return nil
+	}
+
+	reason := d.stopReason(step)
+	d.lastFile, d.lastLine, d.lastDepth = step.File, step.Line, step.Depth
+	if reason == "" {
+		return nil
+	}
+
+	d.stoppedFile, d.stoppedLine, d.stoppedDepth = step.File, step.Line, step.Depth
+	d.paused = true
+	d.resume = d.Frontend.Paused(step, reason)
+	d.paused = false
+	if d.resume == QUIT {
+		return evaluator.ErrDebuggerQuit
+	}
+	return nil
+}
+
+// 止まる理由(止まらなければ空文字)
+func (d *Debugger) stopReason(step *evaluator.Step) string {
+	if d.resume == DETACH {
+		return ""
+	}
+
+	sameLine := step.File == d.lastFile && step.Line == d.lastLine &&
+		step.Depth == d.lastDepth
+	if !sameLine {
+		for _, bp := range d.breakpoints {
+			if bp.Line == step.Line && sameFile(bp.File, step.File) {
+				return fmt.Sprintf("breakpoint %d", bp.ID)
+			}
+		}
+	}
+
+	// NOTE: 1行に複数の文がある場合、ステップ実行は次の行まで進める
+	stoppedLine := step.File == d.stoppedFile && step.Line == d.stoppedLine &&
+		step.Depth == d.stoppedDepth
+	switch {
+	case d.resume == STEP_INTO && !stoppedLine:
+		return "step"
+	case d.resume == STEP_OVER && step.Depth <= d.stoppedDepth && !stoppedLine:
+		return "step"
+	case d.resume == STEP_OUT && step.Depth < d.stoppedDepth:
+		return "step"
+	}
+	return ""
+}
+
+func sameFile(a, b string) bool {
+	if a == b {
+		return true
+	}
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// `file:line`または`line`(MainFile)にブレークポイントを置く
+// 行に文が無い場合は、文のある次の行に置く
+func (d *Debugger) SetBreakpoint(location string) (*Breakpoint, error) {
+	file := d.MainFile
+	lineStr := location
+	if i := strings.LastIndex(location, ":"); i >= 0 {
+		file, lineStr = location[:i], location[i+1:]
+	}
+
+	line, err := strconv.Atoi(lineStr)
+	if err != nil || line <= 0 {
+		return nil, fmt.Errorf("invalid line number: %q", lineStr)
+	}
+
+	// NOTE: import()と同様、見つからなければscriptsディレクトリを探す
+	path, err := evaluator.FindScriptFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if !sameFile(file, path) {
+		file = path
+	}
+
+	lines, err := statementLines(file)
+	if err != nil {
+		return nil, err
+	}
+	i := sort.SearchInts(lines, line)
+	if i == len(lines) {
+		return nil, fmt.Errorf("no statement at or after %s:%d", file, line)
+	}
+
+	bp := &Breakpoint{ID: d.nextID, File: file, Line: lines[i]}
+	d.nextID++
+	d.breakpoints = append(d.breakpoints, bp)
+	return bp, nil
+}
+
+func (d *Debugger) DeleteBreakpoint(id int) error {
+	for i, bp := range d.breakpoints {
+		if bp.ID == id {
+			d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("no breakpoint %d", id)
+}
+
+func (d *Debugger) Breakpoints() []*Breakpoint {
+	return d.breakpoints
+}
+
+// ファイル中の文が始まる行(昇順、重複無し)
+func statementLines(file string) ([]int, error) {
+	source, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("file could not open: %s", file)
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("parser errors in %s: %s", file, p.Errors()[0])
+	}
+
+	found := make(map[int]bool)
+	ast.Walk(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			found[node.Token.Line] = true
+		case *ast.ReturnStatement:
+			found[node.Token.Line] = true
+		case *ast.ThrowStatement:
+			found[node.Token.Line] = true
+		case *ast.ExpressionStatement:
+			found[node.Token.Line] = true
+		}
+		return true
+	})
+
+	lines := []int{}
+	for line := range found {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines, nil
+}
+
+// 止まっている環境で式(文)を評価する
+// NOTE: 入力のトップレベルの変数はresolverが解決しないため、停止中の環境でも名前で探される
+// (Programとしては評価しない)
+func Evaluate(input string, env *object.Environment) object.Object {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return &object.Error{Message: "parser errors: " + strings.Join(p.Errors(), ", ")}
+	}
+
+	var result object.Object = evaluator.NULL
+	for _, stmt := range program.Statements {
+		result = evaluator.Eval(stmt, env)
+		if returnValue, ok := result.(*object.ReturnValue); ok {
+			return returnValue.Value
+		}
+		if _, ok := result.(*object.Error); ok {
+			return result
+		}
+	}
+	if result == nil {
+		// letは値を返さない
+		return evaluator.NULL
+	}
+	return result
+}
+
+// 環境とその外側の環境の変数(内側から順、1つの環境につき1行)
+func Environments(env *object.Environment) []string {
+	lines := []string{}
+	for depth := 0; env != nil; depth++ {
+		vars := []string{}
+		for _, name := range env.Names() {
+			val, _ := env.Get(name)
+			vars = append(vars, name+" = "+inspectShort(val))
+		}
+		lines = append(lines, fmt.Sprintf("#%d {%s}", depth, strings.Join(vars, ", ")))
+		env = env.Outer()
+	}
+	return lines
+}
+
+// 関数、namespaceの中身は省略する
+func inspectShort(obj object.Object) string {
+	switch obj := obj.(type) {
+	case *object.Function:
+		params := []string{}
+		for _, p := range obj.Parameters {
+			params = append(params, p.String())
+		}
+		return "fn(" + strings.Join(params, ", ") + ") {...}"
+	case *object.NameSpace:
+		return "namespace {...}"
+	default:
+		return obj.Inspect()
+	}
+}
@@ -0,0 +1,160 @@
+package debugger
+
+import (
+	"../object"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const MAIN_SCRIPT = `let lib = import(THIS_DIR + "lib");
+let fib = fn(n) {
+  if (n < 2) {
+    return n;
+  }
+  fib(n - 1) + fib(n - 2)
+};
+let a = fib(3); let b = 1;
+let c = lib.twice(a);
+`
+
+const LIB_SCRIPT = `let twice = fn(x) {
+  x * 2
+};
+`
+
+func writeScripts(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "monkey-debugger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, script := range map[string]string{
+		"main.monkey": MAIN_SCRIPT,
+		"lib.monkey":  LIB_SCRIPT,
+	} {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(script), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestRunScript(t *testing.T) {
+	dir, remove := writeScripts(t)
+	defer remove()
+
+	tests := []struct {
+		commands string
+		expected []string // 停止した位置(と、コマンドの出力)
+	}{
+		// ステップ実行
+		{"n\nn\ns\ns\ns\nbt\no\nc\n", []string{
+			"main.monkey:1 (step)", "main.monkey:2 (step)", "main.monkey:8 (step)",
+			"main.monkey:3 (step)", "main.monkey:6 (step)", "main.monkey:3 (step)",
+			"    at <main> (main.monkey:8)", "    at fib (main.monkey:6)",
+			"    at fib (main.monkey:3)",
+			// fib(3)の残りの文は全てfib(2), fib(1)の中
+			"main.monkey:8 (step)",
+			"program finished",
+		}},
+		// ブレークポイント(文の無い行は次の文の行に置く)
+		{"b 5\nb lib.monkey:2\nb\nc\np n * 10\nenv\nd 1\nc\np x\nq\n", []string{
+			"main.monkey:1 (step)",
+			"breakpoint 1 at main.monkey:6", "breakpoint 2 at lib.monkey:2",
+			"breakpoint 1 at main.monkey:6", "breakpoint 2 at lib.monkey:2",
+			"main.monkey:6 (breakpoint 1)",
+			"30",
+			"#0 {n = 3}",
+			"#1 {THIS_DIR = ./, THIS_FILE = main.monkey, fib = fn(n) {...}, lib = namespace {...}}",
+			"lib.monkey:2 (breakpoint 2)",
+			"2",
+		}},
+		// 停止中の環境での評価
+		{"n\nn\np let z = 5; fib(z)\np z\np undefined\np 1 +\nc\n", []string{
+			"main.monkey:1 (step)", "main.monkey:2 (step)", "main.monkey:8 (step)",
+			"5", "5",
+			"ERROR: identifier not found: undefined",
+			"ERROR: parser errors: no prefix parse function for EOF found",
+			"program finished",
+		}},
+		// 停止中に評価する関数の中のブレークポイントでは止まらない
+		{"b 6\nc\np fib(2)\nc\n", []string{
+			"main.monkey:1 (step)", "breakpoint 1 at main.monkey:6",
+			"main.monkey:6 (breakpoint 1)",
+			"1",
+			"main.monkey:6 (breakpoint 1)", "",
+			"program finished",
+		}},
+		// 入力の終端では止まらずに最後まで実行
+		{"b 6\n", []string{
+			"main.monkey:1 (step)", "breakpoint 1 at main.monkey:6", "",
+			"program finished",
+		}},
+		{"b 100\nb x:1\nd 3\nfoo\n", []string{
+			"main.monkey:1 (step)",
+			"no statement at or after main.monkey:100",
+			"file could not open: x",
+			"no breakpoint 3",
+			"unknown command: foo (type help for commands)",
+			"",
+			"program finished",
+		}},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		wd, _ := os.Getwd()
+		os.Chdir(dir)
+		RunScript("main.monkey", strings.NewReader(tt.commands), &out)
+		os.Chdir(wd)
+
+		actual := []string{}
+		for _, line := range strings.Split(out.String(), "\n") {
+			// 停止位置のソース、プロンプトは比べない
+			for strings.HasPrefix(line, PROMPT) {
+				line = strings.TrimPrefix(line, PROMPT)
+			}
+			switch {
+			case strings.HasPrefix(line, "->"):
+				continue
+			case strings.HasPrefix(line, "stopped at "):
+				line = strings.TrimPrefix(line, "stopped at ")
+			}
+			actual = append(actual, line)
+		}
+		actual = actual[:len(actual)-1]
+
+		if strings.Join(actual, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("wrong output for %q.\nexpected=%q\ngot=%q",
+				tt.commands, tt.expected, actual)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("x", &object.Integer{Value: 2})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x * 3", "6"},
+		{"let y = x + 1;", "null"},
+		{"y", "3"},
+		{"let f = fn(a) { a + y }; f(1)", "4"},
+		{"return 5; 6", "5"},
+		{"z", "ERROR: identifier not found: z"},
+	}
+
+	for _, tt := range tests {
+		if actual := Evaluate(tt.input, env).Inspect(); actual != tt.expected {
+			t.Errorf("wrong result of %q. expected=%q, got=%q",
+				tt.input, tt.expected, actual)
+		}
+	}
+}
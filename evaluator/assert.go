@@ -0,0 +1,238 @@
+package evaluator
+
+import (
+	"../object"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// テスト(`monkey test`)用の組み込み関数
+// 失敗するとエラーを返す(tryでcatchできる)
+
+// NOTE: assert_errorは関数を呼び出す(applyFunction)ため、import()同様initで登録する
+// (builtins -> applyFunction -> Eval -> evalIdentifier -> builtins の初期化ループを避ける)
+func init() {
+	assertBuiltins := map[string]*object.Builtin{
+		"assert": &object.Builtin{
+			Signature: "fn(any, ...string) -> null",
+			Fn:        builtinAssert,
+		},
+		"assert_eq": &object.Builtin{
+			Signature: "fn(any, any, ...string) -> null",
+			Fn:        builtinAssertEq,
+		},
+		"assert_error": &object.Builtin{
+			Signature: "fn(fn, ...string) -> hash",
+			Fn: func(env *object.Environment, args ...object.Object) object.Object {
+				return AssertError(args, env, applyFunction)
+			},
+		},
+	}
+
+	for name, builtin := range assertBuiltins {
+		builtin.Name = name
+		builtins[name] = builtin
+	}
+}
+
+// `assert(cond, message)`: condが偽(false, null)なら失敗
+func builtinAssert(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) < 1 || len(args) > 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+
+	if isTruthy(args[0]) {
+		return NULL
+	}
+	return assertionError(args[1:], "assert failed: got %s", args[0].Inspect())
+}
+
+// `assert_eq(actual, expected, message)`: 配列、ハッシュは要素ごとに比べ、
+// 異なる要素を全て表示する
+func builtinAssertEq(env *object.Environment, args ...object.Object) object.Object {
+	if len(args) < 2 || len(args) > 3 {
+		return newError("wrong number of arguments. got=%d, want=2 or 3", len(args))
+	}
+
+	diffs := diffObjects("", args[0], args[1], map[objectPair]bool{})
+	switch len(diffs) {
+	case 0:
+		return NULL
+	case 1:
+		return assertionError(args[2:], "assert_eq failed: %s", diffs[0])
+	default:
+		return assertionError(args[2:], "assert_eq failed:\n  %s",
+			strings.Join(diffs, "\n  "))
+	}
+}
+
+// 関数を呼び出す関数(applyFunction、vmの関数呼び出し等)
+type ApplyFunc func(fn object.Object, args []object.Object,
+	env *object.Environment) object.Object
+
+// `assert_error(f, message)`: 引数無しでfを呼び、エラーにならなければ失敗
+// messageを渡した場合、エラーのメッセージにmessageを含まなければ失敗
+// catchと同様、エラーをハッシュで返す
+// NOTE: import()同様、vmでも使用するため関数を呼び出す関数を引数で受け取る
+func AssertError(args []object.Object, env *object.Environment,
+	apply ApplyFunc) object.Object {
+
+	if len(args) < 1 || len(args) > 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	if args[0].Type() != object.FUNCTION_OBJ && args[0].Type() != object.BUILDIN_OBJ {
+		return newError("argument to `assert_error` must be FUNCTION, got %s",
+			args[0].Type())
+	}
+	if len(args) == 2 && args[1].Type() != object.STRING_OBJ {
+		return newError("message of `assert_error` must be STRING, got %s",
+			args[1].Type())
+	}
+
+	result := apply(args[0], []object.Object{}, env)
+	errObj, ok := result.(*object.Error)
+	if !ok {
+		return newError("assert_error failed: no error occurred (got %s)",
+			result.Inspect())
+	}
+	// NOTE: キャンセル等で評価を打ち切った場合はテストも打ち切る
+	if errObj.Cause != nil {
+		return errObj
+	}
+
+	if len(args) == 2 {
+		expected := args[1].(*object.String).Value
+		if !strings.Contains(errObj.Message, expected) {
+			return newError("assert_error failed: error message %q does not contain %q",
+				errObj.Message, expected)
+		}
+	}
+	return errorToHash(errObj)
+}
+
+func assertionError(message []object.Object, format string,
+	a ...interface{}) *object.Error {
+
+	errObj := newError(format, a...)
+	if len(message) == 1 {
+		if str, ok := message[0].(*object.String); ok {
+			errObj.Message = str.Value + ": " + errObj.Message
+		} else {
+			errObj.Message = message[0].Inspect() + ": " + errObj.Message
+		}
+	}
+	return errObj
+}
+
+// 比較中の(actual, expected)の組
+type objectPair struct {
+	actual, expected object.Object
+}
+
+// actualとexpectedの異なる箇所(pathは`[0]["key"]`形式の位置)
+// NOTE: 自身を含む配列、ハッシュで無限ループしないよう、比較中の組は等しいとみなす
+func diffObjects(path string, actual, expected object.Object,
+	visiting map[objectPair]bool) []string {
+
+	at := func(format string, a ...interface{}) []string {
+		msg := fmt.Sprintf(format, a...)
+		if path == "" {
+			return []string{msg}
+		}
+		return []string{path + ": " + msg}
+	}
+
+	pair := objectPair{actual: actual, expected: expected}
+	if visiting[pair] {
+		return []string{}
+	}
+
+	switch expected := expected.(type) {
+	case *object.Array:
+		actual, ok := actual.(*object.Array)
+		if !ok {
+			break
+		}
+		visiting[pair] = true
+		defer delete(visiting, pair)
+
+		diffs := []string{}
+		for i := 0; i < len(expected.Elements) && i < len(actual.Elements); i++ {
+			diffs = append(diffs, diffObjects(fmt.Sprintf("%s[%d]", path, i),
+				actual.Elements[i], expected.Elements[i], visiting)...)
+		}
+		if len(actual.Elements) != len(expected.Elements) {
+			diffs = append(diffs, at("expected length %d, got %d",
+				len(expected.Elements), len(actual.Elements))...)
+		}
+		return diffs
+
+	case *object.Hash:
+		actual, ok := actual.(*object.Hash)
+		if !ok {
+			break
+		}
+		visiting[pair] = true
+		defer delete(visiting, pair)
+
+		// NOTE: 表示順を固定するため、キーの表示で並べる
+		keys := map[string]object.HashKey{}
+		for hashed, pair := range expected.Pairs {
+			keys[inspectValue(pair.Key)] = hashed
+		}
+		for hashed, pair := range actual.Pairs {
+			keys[inspectValue(pair.Key)] = hashed
+		}
+		names := []string{}
+		for name := range keys {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		diffs := []string{}
+		for _, name := range names {
+			keyPath := path + "[" + name + "]"
+			expectedPair, inExpected := expected.Pairs[keys[name]]
+			actualPair, inActual := actual.Pairs[keys[name]]
+			switch {
+			case !inActual:
+				diffs = append(diffs, fmt.Sprintf("%s: missing (expected %s)",
+					keyPath, inspectValue(expectedPair.Value)))
+			case !inExpected:
+				diffs = append(diffs, fmt.Sprintf("%s: unexpected %s",
+					keyPath, inspectValue(actualPair.Value)))
+			default:
+				diffs = append(diffs, diffObjects(keyPath, actualPair.Value,
+					expectedPair.Value, visiting)...)
+			}
+		}
+		return diffs
+	}
+
+	if !sameObject(actual, expected) {
+		return at("expected %s, got %s", inspectValue(expected), inspectValue(actual))
+	}
+	return []string{}
+}
+
+func sameObject(a, b object.Object) bool {
+	if a.Type() != b.Type() {
+		return false
+	}
+	switch a.(type) {
+	case *object.Integer, *object.String, *object.Boolean, *object.Null:
+		return a.Inspect() == b.Inspect()
+	default:
+		// 関数、namespace等は同じオブジェクトかどうか
+		return a == b
+	}
+}
+
+// 文字列は""で囲んで表示する(1と"1"を区別するため)
+func inspectValue(obj object.Object) string {
+	if str, ok := obj.(*object.String); ok {
+		return fmt.Sprintf("%q", str.Value)
+	}
+	return obj.Inspect()
+}
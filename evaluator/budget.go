@@ -0,0 +1,130 @@
+package evaluator
+
+import (
+	"../ast"
+	"../object"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// EvalContextで評価する際の上限(0の場合は上限無し)
+type Limits struct {
+	MaxSteps int // 評価するノード数
+	// 生成する配列の要素数と文字列のバイト数の合計
+	// NOTE: 生成されたものを数えるので、GCで回収された分も減らない
+	MaxAllocation int
+}
+
+var (
+	ErrStepLimitExceeded       = errors.New("step limit exceeded")
+	ErrAllocationLimitExceeded = errors.New("allocation limit exceeded")
+)
+
+type limitsKey struct{}
+
+// EvalContextで使用する上限をctxに設定
+func WithLimits(ctx context.Context, limits Limits) context.Context {
+	return context.WithValue(ctx, limitsKey{}, limits)
+}
+
+// NOTE: ctxのキャンセルを確認する間隔(ノード数)
+// (毎回確認すると評価が遅くなるため)
+const CONTEXT_CHECK_INTERVAL = 1024
+
+type budget struct {
+	ctx       context.Context
+	limits    Limits
+	steps     int
+	allocated int
+}
+
+// ctxがキャンセルされるか、WithLimitsで設定した上限を超えた場合は評価を打ち切る
+// WithOptionsで設定した設定(フック等)で評価する
+// 打ち切った場合はCauseを持つ*object.Errorを返す(tryでcatchできない)
+// NOTE: 異なる環境であれば、複数のgoroutineから同時に呼び出せる
+// (同じ環境を同時に評価することはできない)
+func EvalContext(ctx context.Context, node ast.Node,
+	env *object.Environment) object.Object {
+
+	limits, _ := ctx.Value(limitsKey{}).(Limits)
+
+	// 予算は今回の評価のみ(評価後はenvを元の評価に戻す)
+	prev := env.Evaluation()
+	env.SetEvaluation(&evaluation{budget: &budget{ctx: ctx, limits: limits},
+		options: optionsOf(ctx)})
+	defer env.SetEvaluation(prev)
+
+	if err := ctx.Err(); err != nil {
+		return newAbortError(err)
+	}
+
+	return Eval(node, env)
+}
+
+// 評価打ち切りによるエラーかどうか
+func IsAborted(obj object.Object) bool {
+	errObj, ok := obj.(*object.Error)
+	return ok && errObj.Cause != nil
+}
+
+func newAbortError(cause error) *object.Error {
+	return &object.Error{
+		Message: fmt.Sprintf("evaluation aborted: %s", cause),
+		Cause:   cause,
+	}
+}
+
+// ノードを1つ評価するごとに呼ぶ
+func (b *budget) step() *object.Error {
+	b.steps++
+
+	if b.limits.MaxSteps > 0 && b.steps > b.limits.MaxSteps {
+		return newAbortError(fmt.Errorf("%w (limit=%d)",
+			ErrStepLimitExceeded, b.limits.MaxSteps))
+	}
+
+	if b.steps%CONTEXT_CHECK_INTERVAL == 0 {
+		if err := b.ctx.Err(); err != nil {
+			return newAbortError(err)
+		}
+	}
+
+	return nil
+}
+
+// 配列、文字列を生成する前に呼ぶ(sizeは要素数またはバイト数)
+func allocate(env *object.Environment, size int) *object.Error {
+	ev := evaluationOf(env)
+	if ev.options.CallTracer != nil {
+		ev.options.CallTracer.Allocate(size)
+	}
+	b := ev.budget
+	if b == nil {
+		return nil
+	}
+
+	b.allocated += size
+
+	if b.limits.MaxAllocation > 0 && b.allocated > b.limits.MaxAllocation {
+		return newAbortError(fmt.Errorf("%w (limit=%d)",
+			ErrAllocationLimitExceeded, b.limits.MaxAllocation))
+	}
+
+	return nil
+}
+
+// 文字列の連結(`left + right`)で生成する文字列を数える
+func allocateConcat(operator string, left, right object.Object,
+	env *object.Environment) *object.Error {
+
+	leftStr, ok := left.(*object.String)
+	if !ok || operator != "+" {
+		return nil
+	}
+	rightStr, ok := right.(*object.String)
+	if !ok {
+		return nil
+	}
+	return allocate(env, len(leftStr.Value)+len(rightStr.Value))
+}
@@ -0,0 +1,227 @@
+package evaluator
+
+import (
+	"../lexer"
+	"../object"
+	"../parser"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testEvalContext(ctx context.Context, input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+
+	return EvalContext(ctx, program, env)
+}
+
+func TestEvalContextAborted(t *testing.T) {
+	infiniteLoop := "let loop = fn() { loop() }; loop();"
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		ctx      func() (context.Context, context.CancelFunc)
+		input    string
+		expected error
+	}{
+		{
+			func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 50*time.Millisecond)
+			},
+			infiniteLoop,
+			context.DeadlineExceeded,
+		},
+		{
+			func() (context.Context, context.CancelFunc) {
+				return canceled, func() {}
+			},
+			"1 + 1",
+			context.Canceled,
+		},
+		{
+			func() (context.Context, context.CancelFunc) {
+				return WithLimits(context.Background(), Limits{MaxSteps: 1000}), func() {}
+			},
+			infiniteLoop,
+			ErrStepLimitExceeded,
+		},
+		{
+			func() (context.Context, context.CancelFunc) {
+				return WithLimits(context.Background(), Limits{MaxAllocation: 1000}), func() {}
+			},
+			"let f = fn(arr) { f(push(arr, 1)) }; f([]);",
+			ErrAllocationLimitExceeded,
+		},
+		{
+			func() (context.Context, context.CancelFunc) {
+				return WithLimits(context.Background(), Limits{MaxAllocation: 10}), func() {}
+			},
+			`"hello" + "world!"`,
+			ErrAllocationLimitExceeded,
+		},
+		// 打ち切りはcatchできない
+		{
+			func() (context.Context, context.CancelFunc) {
+				return WithLimits(context.Background(), Limits{MaxSteps: 1000}), func() {}
+			},
+			`let r = try { ` + infiniteLoop + ` } catch (e) { "caught" } finally { "finally" }; r;`,
+			ErrStepLimitExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		ctx, cancel := tt.ctx()
+		evaluated := testEvalContext(ctx, tt.input)
+		cancel()
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok || !IsAborted(errObj) {
+			t.Errorf("evaluation was not aborted. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if !errors.Is(errObj.Cause, tt.expected) {
+			t.Errorf("wrong cause. expected=%q, got=%q", tt.expected, errObj.Cause)
+		}
+	}
+}
+
+func TestEvalContextRestoresEvaluation(t *testing.T) {
+	env := object.NewEnvironment()
+	ctx := WithLimits(context.Background(), Limits{MaxSteps: 1000})
+	defined := EvalContext(ctx, parser.New(lexer.New(`
+	let ns = namespace {
+		let count = fn(n) { if (n > 0) { count(n - 1) } else { n } };
+	};`)).ParseProgram(), env)
+	if isError(defined) {
+		t.Fatalf("unexpected error: %s", defined.Inspect())
+	}
+
+	if env.Evaluation() != nil {
+		t.Errorf("evaluation of env was not restored. got=%T", env.Evaluation())
+	}
+
+	// EvalContextの予算は、その評価で作られた環境(namespace)を後で評価する際には使われない
+	evaluated := Eval(parser.New(lexer.New("ns.count(1000);")).ParseProgram(), env)
+	if evaluated.Inspect() != "0" {
+		t.Errorf("wrong value. got=%s", evaluated.Inspect())
+	}
+}
+
+// NOTE: go test -raceで、評価の状態がgoroutine間で共有されていないことを確認する
+func TestEvalContextConcurrently(t *testing.T) {
+	input := `
+	let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+	let f = fn(s) { let r = push([], s + "!"); throw r };
+	let r = try { f("boom") } catch (e) { e["message"] };
+	[fib(15), r];
+	`
+	expected := "[610, [boom!]]"
+	const goroutines = 8
+	// NOTE: 評価はASTを書き換えないため、全てのgoroutineで1つのprogramを共有できる
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	// 評価が重なるよう、CPUが1つでも複数のgoroutineを並行に動かし、全て同時に始める
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(goroutines))
+	results := make(chan string, goroutines)
+	start := make(chan struct{})
+	for i := 0; i < goroutines; i++ {
+		go func() {
+			<-start
+			ctx := WithLimits(context.Background(), Limits{MaxSteps: 1000000})
+			results <- EvalContext(ctx, program, object.NewEnvironment()).Inspect()
+		}()
+	}
+	close(start)
+
+	for i := 0; i < goroutines; i++ {
+		if actual := <-results; actual != expected {
+			t.Errorf("wrong value. expected=%s, got=%s", expected, actual)
+		}
+	}
+}
+
+// 関数の呼び出し(Enter)を数えるトレーサ
+type countingTracer struct {
+	calls int
+}
+
+func (c *countingTracer) Enter(fn object.Object)                { c.calls++ }
+func (c *countingTracer) Exit(fn object.Object)                 {}
+func (c *countingTracer) TailCall(caller, callee object.Object) {}
+func (c *countingTracer) Allocate(size int)                     {}
+
+// 同時に評価する評価ごとに、異なる設定を使える
+func TestEvalContextOptionsConcurrently(t *testing.T) {
+	input := `
+	let len = 1;
+	let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } };
+	try { f(1000) } catch (e) { e["message"] };
+	`
+
+	const goroutines = 8
+	tracers := make([]*countingTracer, goroutines)
+	outs := make([]*bytes.Buffer, goroutines)
+	results := make([]string, goroutines)
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		tracers[i], outs[i] = &countingTracer{}, &bytes.Buffer{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx := WithOptions(context.Background(), Options{
+				MaxCallDepth:  10 * (i + 1),
+				StrictMode:    i%2 == 0,
+				StrictModeOut: outs[i],
+				CallTracer:    tracers[i],
+			})
+			results[i] = testEvalContext(ctx, input).Inspect()
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < goroutines; i++ {
+		depth := 10 * (i + 1)
+		expected := fmt.Sprintf("maximum recursion depth exceeded: depth=%d, function=f",
+			depth+1)
+		if results[i] != expected {
+			t.Errorf("wrong value of %d. expected=%s, got=%s", i, expected, results[i])
+		}
+		if tracers[i].calls != depth {
+			t.Errorf("wrong calls traced by %d. expected=%d, got=%d",
+				i, depth, tracers[i].calls)
+		}
+		warning := ""
+		if i%2 == 0 {
+			warning = "warning: let \"len\" shadows builtin function\n"
+		}
+		if outs[i].String() != warning {
+			t.Errorf("wrong warning of %d. expected=%q, got=%q", i, warning, outs[i])
+		}
+	}
+}
+
+func TestEvalContextWithinLimits(t *testing.T) {
+	ctx := WithLimits(context.Background(), Limits{MaxSteps: 1000, MaxAllocation: 100})
+	input := `
+	let add = fn(a, b) { a + b };
+	let arr = push([1, 2], add(1, 2));
+	let r = try { throw "boom" } catch (e) { e["message"] };
+	[arr, r];
+	`
+
+	evaluated := testEvalContext(ctx, input)
+	if evaluated.Inspect() != "[[1, 2, 3], boom]" {
+		t.Errorf("wrong value. got=%s", evaluated.Inspect())
+	}
+}
@@ -2,6 +2,7 @@ package evaluator
 
 import (
 	"../object"
+	"../pretty"
 	"fmt"
 )
 
@@ -9,6 +10,7 @@ import (
 // (import, self, outer等は、評価の際今のスコープを知る必要があるため)
 var builtins = map[string]*object.Builtin{
 	"len": &object.Builtin{
+		Signature: "fn(string | array) -> int",
 		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1",
@@ -27,6 +29,7 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"first": &object.Builtin{
+		Signature: "fn(array) -> any",
 		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1",
@@ -46,6 +49,7 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"last": &object.Builtin{
+		Signature: "fn(array) -> any",
 		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1",
@@ -66,6 +70,7 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"rest": &object.Builtin{
+		Signature: "fn(array) -> array | null",
 		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1",
@@ -79,6 +84,9 @@ var builtins = map[string]*object.Builtin{
 			arr := args[0].(*object.Array)
 			length := len(arr.Elements)
 			if length > 0 {
+				if errObj := allocate(env, length-1); errObj != nil {
+					return errObj
+				}
 				newElements := make([]object.Object, length-1, length-1)
 				copy(newElements, arr.Elements[1:length])
 				return &object.Array{Elements: newElements}
@@ -88,6 +96,7 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"push": &object.Builtin{
+		Signature: "fn(array, any) -> array",
 		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 2 {
 				return newError("wrong number of arguments. got=%d, want=2",
@@ -101,6 +110,9 @@ var builtins = map[string]*object.Builtin{
 			arr := args[0].(*object.Array)
 			length := len(arr.Elements)
 
+			if errObj := allocate(env, length+1); errObj != nil {
+				return errObj
+			}
 			newElements := make([]object.Object, length+1, length+1)
 			copy(newElements, arr.Elements)
 			newElements[length] = args[1]
@@ -108,7 +120,68 @@ var builtins = map[string]*object.Builtin{
 			return &object.Array{Elements: newElements}
 		},
 	},
+	// NOTE: pushと違い配列をコピーせず、引数の配列自体に要素を追加する
+	"append!": &object.Builtin{
+		Signature: "fn(array, ...any) -> array",
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) < 1 {
+				return newError("wrong number of arguments. got=%d, want>=1",
+					len(args))
+			}
+			if args[0].Type() != object.ARRAY_OBJ {
+				return newError("argument to `append!` must be ARRAY, got %s",
+					args[0].Type())
+			}
+
+			arr := args[0].(*object.Array)
+			if errObj := allocate(env, len(args)-1); errObj != nil {
+				return errObj
+			}
+			arr.Elements = append(arr.Elements, args[1:]...)
+
+			return arr
+		},
+	},
+	"delete": &object.Builtin{
+		Signature: "fn(hash | array, any) -> hash | array",
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2",
+					len(args))
+			}
+
+			switch collection := args[0].(type) {
+			case *object.Hash:
+				key, ok := args[1].(object.Hashable)
+				if !ok {
+					return newError("unusable as hash key: %s", args[1].Type())
+				}
+
+				delete(collection.Pairs, key.HashKey())
+				return collection
+			case *object.Array:
+				index, ok := args[1].(*object.Integer)
+				if !ok {
+					return newError("index of `delete` must be INTEGER, got %s",
+						args[1].Type())
+				}
+
+				idx := index.Value
+				if idx < 0 || idx > int64(len(collection.Elements)-1) {
+					return newError("index out of range: %d", idx)
+				}
+
+				collection.Elements = append(collection.Elements[:idx],
+					collection.Elements[idx+1:]...)
+				return collection
+			default:
+				return newError("argument to `delete` must be HASH or ARRAY, got %s",
+					args[0].Type())
+			}
+		},
+	},
 	"puts": &object.Builtin{
+		Signature: "fn(...any) -> null",
 		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			for _, arg := range args {
 				fmt.Println(arg.Inspect())
@@ -117,7 +190,19 @@ var builtins = map[string]*object.Builtin{
 			return NULL
 		},
 	},
+	// 配列、ハッシュ等を字下げして表示する(1行に収まらない場合)
+	"pp": &object.Builtin{
+		Signature: "fn(...any) -> null",
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			for _, arg := range args {
+				fmt.Println(pretty.Format(arg, pretty.DefaultOptions))
+			}
+
+			return NULL
+		},
+	},
 	"self": &object.Builtin{
+		Signature: "fn() -> namespace",
 		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 0 {
 				return newError("wrong number of arguments. got=%d, want=0",
@@ -128,6 +213,7 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"outer": &object.Builtin{
+		Signature: "fn() -> namespace | null",
 		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 0 {
 				return newError("wrong number of arguments. got=%d, want=0",
@@ -142,24 +228,17 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"import": &object.Builtin{
+		Signature: "fn(string) -> namespace",
 		Fn: func(env *object.Environment, args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
-					len(args))
-			}
-
-			if args[0].Type() != object.STRING_OBJ {
-				return newError("argument to `import` must be STRING, got %s",
-					args[0].Type())
-			}
-
-			fileStem := args[0].(*object.String).Value
-
-			// NOTE: namespace中THIS_DIR, THIS_FILEにファイル名をSTRINGで束縛
-			return importScript(env, fileStem+".monkey")
+			// NOTE: use init() to avoid initialization loop (see importscript.go)
+			// same as "EvalScriptFile" (evaluated in the same evaluation as env)
+			return ImportScript(args, func(fileName string) (*object.Environment, error) {
+				return _evalScriptFile(fileName, env)
+			})
 		},
 	},
 	"type": &object.Builtin{
+		Signature: "fn(any) -> string",
 		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1",
@@ -170,3 +249,9 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 }
+
+func init() {
+	for name, builtin := range builtins {
+		builtin.Name = name
+	}
+}
@@ -0,0 +1,100 @@
+package evaluator
+
+import (
+	"../ast"
+	"../object"
+)
+
+// NOTE: エラーのトレースバックを表示するため、評価中の関数呼び出しを記録する
+// (呼び出し元の位置とファイル名は、エラー発生時にのみ求める)
+type callFrame struct {
+	function *object.Function
+	callSite *ast.CallExpression // スクリプトの外(`monkey test`等)からの呼び出しはnil
+	env      *object.Environment // 呼び出し元の環境
+}
+
+// 関数呼び出しのネストの上限(超えた場合はエラー)の既定値(Options.MaxCallDepth)
+// NOTE: 上限が無いと、無限再帰でGoのスタックが溢れプロセスごと異常終了してしまう
+// (末尾呼び出しはネストしないので数えない、0以下の場合は上限無し)
+// プロセス全体で共有するため、評価中(vmを含む)は変更できない
+var MaxCallDepth = 10000
+
+func (ev *evaluation) pushCallFrame(fn *object.Function, node *ast.CallExpression,
+	env *object.Environment) {
+
+	ev.callStack = append(ev.callStack, callFrame{function: fn, callSite: node, env: env})
+}
+
+func (ev *evaluation) popCallFrame() {
+	// NOTE: 呼び出しが終わった環境を参照し続けないよう消す
+	ev.callStack[len(ev.callStack)-1] = callFrame{}
+	ev.callStack = ev.callStack[:len(ev.callStack)-1]
+}
+
+func (ev *evaluation) callDepthExceeded() bool {
+	maxDepth := ev.options.MaxCallDepth
+	return maxDepth > 0 && len(ev.callStack) > maxDepth
+}
+
+// 末尾呼び出しでは呼び出し元の関数を置き換える
+// (呼び出し元の関数はトレースバックに表示されない)
+func (ev *evaluation) replaceCallFrame(fn *object.Function) {
+	if len(ev.callStack) == 0 {
+		return
+	}
+	ev.callStack[len(ev.callStack)-1].function = fn
+}
+
+// 呼び出しを記録してfnを呼び出す
+func (ev *evaluation) callFunction(fn *object.Function, node *ast.CallExpression,
+	args []object.Object, env *object.Environment) object.Object {
+
+	ev.pushCallFrame(fn, node, env)
+	defer ev.popCallFrame()
+
+	evaluated := applyFunction(fn, args, env)
+
+	// NOTE: 位置が未設定のエラー(引数の数の誤り等)は呼び出し元で発生したものとして扱う
+	if errObj, ok := evaluated.(*object.Error); ok && errObj.Trace == nil &&
+		errObj.Line != 0 {
+		errObj.Trace = ev.captureTraceback(errObj)
+	}
+	return evaluated
+}
+
+// 現在のcallStackからトレースバックを生成
+// callStack[i]は「呼び出し元(callStack[i-1]の関数)で評価中だった位置」と
+// 「呼び出された関数」を持つので、1つずつずらして組み合わせる(backtrace)
+func (ev *evaluation) captureTraceback(errObj *object.Error) []object.TraceFrame {
+	// 最も内側の関数ではエラーの発生位置を表示
+	return ev.backtrace(errObj.File, errObj.Line)
+}
+
+func (ev *evaluation) backtrace(file string, line int) []object.TraceFrame {
+	trace := []object.TraceFrame{}
+
+	caller := object.TOPLEVEL_FUNCTION_NAME
+	for _, frame := range ev.callStack {
+		// NOTE: スクリプトの外からの呼び出しは、呼び出し元を表示しない
+		if frame.callSite != nil {
+			trace = append(trace, object.TraceFrame{
+				Function: caller,
+				File:     fileNameOf(frame.env),
+				Line:     frame.callSite.Token.Line,
+			})
+		}
+		caller = frame.function.DisplayName()
+	}
+
+	return append(trace, object.TraceFrame{Function: caller, File: file, Line: line})
+}
+
+// NOTE: スクリプトファイルの場合、一番外側の環境にTHIS_FILEが束縛されている
+func fileNameOf(env *object.Environment) string {
+	if fileName, ok := env.Get("THIS_FILE"); ok {
+		if str, ok := fileName.(*object.String); ok {
+			return str.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,31 @@
+package evaluator
+
+import (
+	"../object"
+)
+
+// NOTE: プロファイラ用に、関数(object.Function, object.Builtin)の呼び出しと
+// 配列、文字列の生成を通知する
+
+type CallTracer interface {
+	// 関数の本体を評価する直前
+	Enter(fn object.Object)
+	// 関数の本体を評価した直後(Enter(fn)またはTailCall(_, fn)と必ず対になる)
+	Exit(fn object.Object)
+	// callerの本体がcalleeの末尾呼び出しを返した直後
+	// (callerのExitの代わり、callerはcalleeから戻るまで呼び出し中とみなせる)
+	TailCall(caller, callee object.Object)
+	// 配列、文字列を生成する直前(sizeは要素数またはバイト数)
+	Allocate(size int)
+}
+
+var callTracer CallTracer
+
+// トレーサの既定値(Options.CallTracer)を設定し、以前のトレーサを返す(nilで解除)
+// NOTE: 設定した後に始める評価から使われる
+// (既定値はプロセス全体で共有するため、他のgoroutineが評価を始める間は設定できない)
+func SetCallTracer(tracer CallTracer) CallTracer {
+	prev := callTracer
+	callTracer = tracer
+	return prev
+}
@@ -0,0 +1,20 @@
+package evaluator_test
+
+import (
+	"../conformance"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// NOTE: conformanceはevaluatorをimportするため、外部テストパッケージで実行する
+func TestConformance(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range conformance.Run(conformance.Evaluator, filepath.Join(filepath.Dir(wd), "scripts")) {
+		t.Error(f)
+	}
+}
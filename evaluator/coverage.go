@@ -0,0 +1,23 @@
+package evaluator
+
+import (
+	"../ast"
+)
+
+// NOTE: カバレッジ計測用に、if式がどちらの分岐を評価するかを通知する
+// (文の評価はStatementHookで通知する)
+
+// if式の条件を評価した直後に呼ばれる関数
+// consequenceは条件が真(else側でない)かどうか、fileはスクリプトファイル以外は空文字
+type BranchHook func(file string, node *ast.IfExpression, consequence bool)
+
+var branchHook BranchHook
+
+// フックの既定値(Options.BranchHook)を設定し、以前のフックを返す(nilで解除)
+// NOTE: 設定した後に始める評価から使われる
+// (既定値はプロセス全体で共有するため、他のgoroutineが評価を始める間は設定できない)
+func SetBranchHook(hook BranchHook) BranchHook {
+	prev := branchHook
+	branchHook = hook
+	return prev
+}
@@ -0,0 +1,70 @@
+package evaluator
+
+import (
+	"../ast"
+	"../object"
+	"errors"
+)
+
+// NOTE: デバッガ用に、文を評価する直前にフックを呼ぶ
+// (フックが返るまで評価は止まるので、その間に環境を調べたり式を評価したりできる)
+
+// 評価する直前の文
+type Step struct {
+	Statement ast.Statement
+	Env       *object.Environment
+	File      string // スクリプトファイル以外(REPL等)は空文字
+	Line      int
+	Column    int
+	// 関数呼び出し、import()のネストの深さ(トップレベルは0)
+	Depth int
+}
+
+// 文を評価する直前に呼ばれる関数
+// エラーを返すと評価を打ち切る(tryでcatchできない)
+type StatementHook func(step *Step) error
+
+var statementHook StatementHook
+
+var ErrDebuggerQuit = errors.New("debugger quit")
+
+// フックの既定値(Options.StatementHook)を設定し、以前のフックを返す(nilで解除)
+// NOTE: 設定した後に始める評価から使われる
+// (既定値はプロセス全体で共有するため、他のgoroutineが評価を始める間は設定できない)
+func SetStatementHook(hook StatementHook) StatementHook {
+	prev := statementHook
+	statementHook = hook
+	return prev
+}
+
+// envを評価中の関数呼び出し、import()のネストの深さ
+func CallDepth(env *object.Environment) int {
+	ev := evaluationOf(env)
+	return len(ev.callStack) + ev.importDepth
+}
+
+func callStatementHook(hook StatementHook, stmt ast.Statement,
+	env *object.Environment) *object.Error {
+
+	tok := statementToken(stmt)
+	step := &Step{
+		Statement: stmt,
+		Env:       env,
+		File:      fileNameOf(env),
+		Line:      tok.Line,
+		Column:    tok.Column,
+		Depth:     CallDepth(env),
+	}
+
+	if err := hook(step); err != nil {
+		errObj := newAbortError(err)
+		setErrorLocation(errObj, stmt, env)
+		return errObj
+	}
+	return nil
+}
+
+// envを評価中の位置(file, line)までの関数呼び出し(外側から順)
+func Backtrace(env *object.Environment, file string, line int) []object.TraceFrame {
+	return evaluationOf(env).backtrace(file, line)
+}
@@ -0,0 +1,90 @@
+package evaluator
+
+import (
+	"../ast"
+	"../object"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestStatementHook(t *testing.T) {
+	input := `let f = fn(x) {
+  let y = x + 1;
+  y * 2
+};
+let a = f(1); if (a > 0) {
+  f(a)
+}`
+	steps := []string{}
+	prev := SetStatementHook(func(step *Step) error {
+		steps = append(steps, fmt.Sprintf("%d@%d", step.Line, step.Depth))
+		return nil
+	})
+	defer SetStatementHook(prev)
+
+	testIntegerObject(t, testEval(input), 10)
+
+	expected := "1@0 5@0 2@1 3@1 5@0 6@0 2@1 3@1"
+	if actual := strings.Join(steps, " "); actual != expected {
+		t.Errorf("wrong steps. expected=%q, got=%q", expected, actual)
+	}
+}
+
+func TestStatementHookAbort(t *testing.T) {
+	input := `try { 1; 2; 3 } catch (e) { "caught" }`
+	quit := errors.New("quit")
+
+	count := 0
+	prev := SetStatementHook(func(step *Step) error {
+		count++
+		if count == 3 {
+			return quit
+		}
+		return nil
+	})
+	defer SetStatementHook(prev)
+
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	if !errors.Is(errObj.Cause, quit) {
+		t.Errorf("wrong cause. expected=%v, got=%v", quit, errObj.Cause)
+	}
+	if errObj.Line != 1 {
+		t.Errorf("wrong line. expected=1, got=%d", errObj.Line)
+	}
+}
+
+func TestBacktrace(t *testing.T) {
+	// NOTE: 末尾呼び出しは呼び出し元を置き換えるため、末尾以外で呼ぶ
+	input := `let g = fn() {
+  1
+};
+let f = fn() {
+  let r = g(); r
+};
+f();`
+	var trace []object.TraceFrame
+	prev := SetStatementHook(func(step *Step) error {
+		if _, ok := step.Statement.(*ast.ExpressionStatement); ok && step.Line == 2 {
+			trace = Backtrace(step.Env, step.File, step.Line)
+		}
+		return nil
+	})
+	defer SetStatementHook(prev)
+
+	testEval(input)
+
+	actual := []string{}
+	for _, frame := range trace {
+		actual = append(actual, frame.String())
+	}
+	expected := []string{"at <main> (line 7)", "at f (line 5)", "at g (line 2)"}
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong backtrace. expected=%q, got=%q", expected, actual)
+	}
+}
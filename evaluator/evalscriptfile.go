@@ -1,6 +1,7 @@
 package evaluator
 
 import (
+	"../ast"
 	"../lexer"
 	"../object"
 	"../parser"
@@ -12,36 +13,82 @@ import (
 )
 
 func EvalScriptFile(fileName string) (*object.Environment, error) {
+	return EvalScriptFileWith(fileName, Eval)
+}
+
+// 評価関数(Eval、vm.Eval等)
+type EvalFunc func(node ast.Node, env *object.Environment) object.Object
+
+// evalでスクリプトファイルを評価
+// (ファイルの探索、エラーの形式は実行エンジンによらず共通)
+func EvalScriptFileWith(fileName string, eval EvalFunc) (*object.Environment, error) {
 	// NOTE: enviroment内の変数"THIS_DIR","THIS_FILE"に
 	// スクリプトファイルのディレクトリ/ファイルパスをSTRINGで格納
 
-	script, absFileName, err := tryAllPathsReadScript(fileName)
+	program, absFileName, err := parseScriptFile(fileName)
 	if err != nil {
 		return nil, err
 	}
 
+	env := NewScriptEnvironment(absFileName)
+	evaluated := eval(program, env)
+
+	if errObj, ok := evaluated.(*object.Error); ok {
+		return nil, formatEvaluatorErrors(errObj)
+	}
+
+	return env, nil
+}
+
+// スクリプトファイルを既存の環境で評価する(replの`:load`)
+// NOTE: replの環境を汚さないよう、THIS_DIR, THIS_FILEは束縛しない
+func LoadScriptFile(fileName string, env *object.Environment, eval EvalFunc) error {
+	program, _, err := parseScriptFile(fileName)
+	if err != nil {
+		return err
+	}
+
+	if errObj, ok := eval(program, env).(*object.Error); ok {
+		return formatEvaluatorErrors(errObj)
+	}
+	return nil
+}
+
+func parseScriptFile(fileName string) (*ast.Program, string, error) {
+	script, absFileName, err := tryAllPathsReadScript(fileName)
+	if err != nil {
+		return nil, "", err
+	}
+
 	l := lexer.New(script)
 	p := parser.New(l)
 	program := p.ParseProgram()
 
 	if len(p.Errors()) != 0 {
-		return nil, formatParserErrors(p.Errors())
+		return nil, "", formatParserErrors(p.Errors())
 	}
+	return program, absFileName, nil
+}
 
+// スクリプトファイルを評価する環境
+func NewScriptEnvironment(absFileName string) *object.Environment {
 	env := object.NewEnvironment()
 	// env内にディレクトリ場所を格納する変数"THIS_DIR"を束縛
 	if absFileName != "" {
 		env.Set("THIS_DIR", &object.String{Value: filepath.Dir(absFileName) + "/"})
 		env.Set("THIS_FILE", &object.String{Value: absFileName})
 	}
+	return env
+}
 
-	evaluated := Eval(program, env)
-
-	if errObj, ok := evaluated.(*object.Error); ok {
-		return nil, formatEvaluatorErrors(errObj)
+// import(fileName)で読まれるスクリプトファイルの絶対パス
+// (fileNameには拡張子".monkey"を含める)
+func FindScriptFile(fileName string) (string, error) {
+	_, path, err := tryAllPathsReadScript(fileName)
+	if err != nil {
+		return "", err
 	}
-
-	return env, nil
+	return filepath.Abs(path)
 }
 
 func tryAllPathsReadScript(fileName string) (string, string, error) {
@@ -136,9 +183,16 @@ func formatParserErrors(errors []string) error {
 		errMsg.WriteString("\t" + err + "\n")
 	}
 
-	return fmt.Errorf(errMsg.String())
+	return fmt.Errorf("%s", errMsg.String())
+}
+
+// 評価時のエラー(トレースバックを表示できるよう、エラーオブジェクトを保持)
+type EvalError struct {
+	Object *object.Error
 }
 
+func (e *EvalError) Error() string { return e.Object.Message }
+
 func formatEvaluatorErrors(errObj *object.Error) error {
-	return fmt.Errorf(errObj.Message)
+	return &EvalError{Object: errObj}
 }
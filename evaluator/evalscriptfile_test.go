@@ -1,6 +1,7 @@
 package evaluator
 
 import (
+	"../object"
 	"fmt"
 	"os"
 	"testing"
@@ -50,3 +51,26 @@ func TestRunScriptErrors(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadScriptFile(t *testing.T) {
+	curDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("fail to fetch current diretory:\n%s", err)
+	}
+	fileName := curDir + "/errsample/err_no_ident.monkey"
+
+	env := object.NewEnvironment()
+	if err := LoadScriptFile(fileName, env, Eval); err == nil ||
+		err.Error() != "identifier not found: a" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+
+	// 渡した環境で評価する
+	env.Set("a", &object.Integer{Value: 1})
+	if err := LoadScriptFile(fileName, env, Eval); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if _, ok := env.Get("THIS_FILE"); ok {
+		t.Errorf("THIS_FILE must not be bound")
+	}
+}
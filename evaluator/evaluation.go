@@ -0,0 +1,81 @@
+package evaluator
+
+import (
+	"../object"
+	"context"
+	"io"
+)
+
+// 1回の評価(Eval、EvalContextの呼び出し)ごとの状態
+// NOTE: パッケージ変数に持つと、別々の環境でも複数のgoroutineから同時に評価できないため、
+// 環境から参照する(同じ環境を複数のgoroutineから同時に評価することはできない)
+type evaluation struct {
+	callStack []callFrame
+	// import()で評価中のスクリプトファイルのネスト
+	importDepth int
+	// 評価中の予算(Evalで評価している場合はnil)
+	budget  *budget
+	options Options
+}
+
+// 評価の設定
+// NOTE: 評価を始める時に、既定値(MaxCallDepth、StrictMode、SetCallTracer等)をコピーする
+// (評価中に既定値を変えても、始まっている評価には影響しない)
+// 同時に評価する評価ごとに設定を変える場合は、WithOptionsで設定しEvalContextで評価する
+type Options struct {
+	// 関数呼び出しのネストの上限(callstack.go)
+	MaxCallDepth int
+	// strict modeの警告と出力先(strictmode.go、出力先がnilの場合は警告しない)
+	StrictMode    bool
+	StrictModeOut io.Writer
+	// フック(nilの場合は呼ばない)
+	CallTracer    CallTracer
+	StatementHook StatementHook
+	BranchHook    BranchHook
+}
+
+// 既定値の設定
+// NOTE: 既定値はプロセス全体で共有するため、他のgoroutineが評価を始める間は変更できない
+func DefaultOptions() Options {
+	return Options{
+		MaxCallDepth:  MaxCallDepth,
+		StrictMode:    StrictMode,
+		StrictModeOut: StrictModeOut,
+		CallTracer:    callTracer,
+		StatementHook: statementHook,
+		BranchHook:    branchHook,
+	}
+}
+
+type optionsKey struct{}
+
+// EvalContextで使用する設定をctxに設定(設定しない場合は既定値)
+func WithOptions(ctx context.Context, options Options) context.Context {
+	return context.WithValue(ctx, optionsKey{}, options)
+}
+
+func optionsOf(ctx context.Context) Options {
+	if options, ok := ctx.Value(optionsKey{}).(Options); ok {
+		return options
+	}
+	return DefaultOptions()
+}
+
+// envを評価中の状態
+// NOTE: 評価器の外で作られた環境(object.NewEnvironment等)は、新たに評価を始める
+func evaluationOf(env *object.Environment) *evaluation {
+	if ev, ok := env.Evaluation().(*evaluation); ok {
+		return ev
+	}
+	ev := &evaluation{options: DefaultOptions()}
+	env.SetEvaluation(ev)
+	return ev
+}
+
+// nameSpace.Env内を評価する間、評価の状態をenvのものに差し替える(戻す関数を返す)
+// NOTE: nameSpace.Envは別の評価(import()、以前のREPLの入力等)で作られた場合がある
+func enterNameSpace(nameSpace *object.NameSpace, env *object.Environment) func() {
+	prev := nameSpace.Env.Evaluation()
+	nameSpace.Env.SetEvaluation(evaluationOf(env))
+	return func() { nameSpace.Env.SetEvaluation(prev) }
+}
@@ -16,9 +16,16 @@ var (
 
 // 全ての子ノードを再帰的にたどり評価
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	if ev, ok := env.Evaluation().(*evaluation); ok && ev.budget != nil {
+		if errObj := ev.budget.step(); errObj != nil {
+			return errObj
+		}
+	}
+
 	switch node := node.(type) {
 	// statements
 	case *ast.Program:
+		// NOTE: 変数の参照はパース時(parser.ParseProgram)に解決済み
 		return evalProgram(node, env)
 	case *ast.ExpressionStatement:
 		return Eval(node.Expression, env)
@@ -30,13 +37,37 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return val // エラー呼び出し元へ返す
 		}
 		return &object.ReturnValue{Value: val}
+	case *ast.ThrowStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return newThrownError(val)
 	case *ast.LetStatement:
+		if env.IsConst(node.Name.Value) {
+			return newError("cannot redeclare const: %s", node.Name.Value)
+		}
+		if options := evaluationOf(env).options; options.StrictMode &&
+			options.StrictModeOut != nil {
+			warnShadowing(node, env, options.StrictModeOut)
+		}
+
 		val := Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
+		// 関数はトレースバックで表示するため名前を覚えておく
+		if fn, ok := val.(*object.Function); ok && fn.Name == "" {
+			fn.Name = node.Name.Value
+		}
 		// 束縛された変数名とその値はenvironmentに保存
-		env.Set(node.Name.Value, val)
+		if node.IsConst() {
+			env.SetConst(node.Name.Value, val)
+		} else if node.Name.Resolved {
+			env.SetSlot(node.Name.Slot, val)
+		} else {
+			env.Set(node.Name.Value, val)
+		}
 
 	// expressions
 	case *ast.IntegerLiteral:
@@ -44,7 +75,12 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 	case *ast.StringLiteral:
+		if errObj := allocate(env, len(node.Value)); errObj != nil {
+			return errObj
+		}
 		return &object.String{Value: node.Value}
+	case *ast.Null:
+		return NULL
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
 		if isError(right) {
@@ -52,15 +88,16 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return evalPrefixExpression(node.Operator, right)
 	case *ast.InfixExpression:
-		if isShortCutOperator(node.Operator) {
-			return evalShortCutInfixExpression(node, env)
-		}
-
 		// "."演算子は左辺と右辺をばらして評価できないため別関数で処理
-		if evaluated, ok := evalCallInfixExpression(node, env); ok {
+		if ast.IsChainElement(node) {
+			evaluated, _ := evalChain(node, env)
 			return evaluated
 		}
 
+		if isShortCutOperator(node.Operator) {
+			return evalShortCutInfixExpression(node, env)
+		}
+
 		left := Eval(node.Left, env)
 		if isError(left) {
 			return left
@@ -69,50 +106,43 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(right) {
 			return right
 		}
+		// NOTE: evalInfixExpressionは環境を持たない(vmと共通)ため、文字列の連結はここで数える
+		if errObj := allocateConcat(node.Operator, left, right, env); errObj != nil {
+			return errObj
+		}
 		return evalInfixExpression(node.Operator, left, right)
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return &object.Function{Parameters: params, Env: env, Body: body,
+			Scope: node.Scope}
 	case *ast.CallExpression:
-		// node.Functionは*ast.Identifierか*ast.FunctionLiteral
-		// Envは関数の外側の名前空間
-		function := Eval(node.Function, env)
-		if isError(function) {
-			return function
-		}
-		// 各引数の評価
-		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
-			return args[0]
-		}
-
-		// 関数内の名前空間はenvの内側の新たなEnvironmentを参照
-		return applyFunction(function, args, env)
+		evaluated, _ := evalChain(node, env)
+		return evaluated
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
+		if errObj := allocate(env, len(elements)); errObj != nil {
+			return errObj
+		}
 		return &object.Array{Elements: elements}
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
-		if isError(left) {
-			return left
-		}
-		index := Eval(node.Index, env)
-		if isError(index) {
-			return index
-		}
-		return evalIndexExpression(left, index)
+		evaluated, _ := evalChain(node, env)
+		return evaluated
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
 	case *ast.NameSpaceLiteral:
 		return evalNameSpaceLiteral(node, env)
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
 	}
 
 	return nil
@@ -120,8 +150,14 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 
 func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
+	hook := evaluationOf(env).options.StatementHook
 
 	for _, stmt := range program.Statements {
+		if hook != nil {
+			if errObj := callStatementHook(hook, stmt, env); errObj != nil {
+				return errObj
+			}
+		}
 		result = Eval(stmt, env)
 
 		switch result := result.(type) {
@@ -131,6 +167,7 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 			return result.Value
 		case *object.Error:
 			// return同様評価を「中断して」エラーを返す
+			setErrorLocation(result, stmt, env)
 			return result
 		}
 	}
@@ -144,13 +181,22 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 	// この設計にしないと、ネストしたブロック文の内側にreturn文が合った場合
 	// 内側のブロックのreturn文が評価された結果式となり、外側のブロックの次の文を評価してしまう
 	var result object.Object
+	hook := evaluationOf(env).options.StatementHook
 
 	for _, stmt := range block.Statements {
+		if hook != nil {
+			if errObj := callStatementHook(hook, stmt, env); errObj != nil {
+				return errObj
+			}
+		}
 		result = Eval(stmt, env)
 
 		if result != nil {
 			rt := result.Type()
 			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				if errObj, ok := result.(*object.Error); ok {
+					setErrorLocation(errObj, stmt, env)
+				}
 				// ブロックのネストを全て抜けるまでアンラップしない(前述)
 				return result
 			}
@@ -288,6 +334,10 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 		return condition // エラーを呼び出し元へ返す
 	}
 
+	if hook := evaluationOf(env).options.BranchHook; hook != nil {
+		hook(fileNameOf(env), ie, isTruthy(condition))
+	}
+
 	if isTruthy(condition) {
 		return Eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
@@ -323,7 +373,11 @@ func isError(obj object.Object) bool {
 }
 
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
-	if val, ok := env.Get(node.Value); ok {
+	if node.Resolved {
+		if val, ok := env.GetSlot(node.Depth, node.Slot, node.Value); ok {
+			return val
+		}
+	} else if val, ok := env.Get(node.Value); ok {
 		return val
 	}
 
@@ -332,7 +386,7 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 		return builtin
 	}
 
-	return newError("identifier not found: " + node.Value)
+	return newError("identifier not found: %s", node.Value)
 }
 
 func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
@@ -340,6 +394,15 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 
 	// NOTE: 引数は左から順に評価(多くの言語と同様)
 	for _, e := range exps {
+		if spread, ok := e.(*ast.SpreadExpression); ok {
+			elements := evalArraySpread(spread, env)
+			if len(elements) == 1 && isError(elements[0]) {
+				return elements
+			}
+			result = append(result, elements...)
+			continue
+		}
+
 		evaluated := Eval(e, env)
 		if isError(evaluated) {
 			// この関数の戻り値は配列なので、配列でラップ
@@ -351,39 +414,107 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 	return result
 }
 
+// `...arr`を展開した要素を返す(evalExpressions同様、エラーは配列でラップ)
+func evalArraySpread(spread *ast.SpreadExpression,
+	env *object.Environment) []object.Object {
+
+	evaluated := Eval(spread.Value, env)
+	if isError(evaluated) {
+		return []object.Object{evaluated}
+	}
+
+	array, ok := evaluated.(*object.Array)
+	if !ok {
+		return []object.Object{
+			newError("spread operator not supported: %s", evaluated.Type()),
+		}
+	}
+
+	return array.Elements
+}
+
 func applyFunction(fn object.Object, args []object.Object,
 	env *object.Environment) object.Object {
 
 	switch fn := fn.(type) {
 	case *object.Function:
-		// ality check
-		if len(fn.Parameters) != len(args) {
-			return newError("wrong number of arguments. got=%d, want=%d",
-				len(args), len(fn.Parameters))
+		ev := evaluationOf(env)
+		tracer := ev.options.CallTracer
+		// NOTE: 呼び出し中の関数は既にcallStackに積まれている
+		if ev.callDepthExceeded() {
+			return newError("maximum recursion depth exceeded: depth=%d, function=%s",
+				len(ev.callStack), fn.DisplayName())
 		}
 
-		// 関数内スコープの名前空間に引数を束縛
-		extendedEnv := extendFunctionEnv(fn, args)
-		// スコープ内の名前空間を使用
-		evaluated := Eval(fn.Body, extendedEnv)
-		// evaluatedは*obj.ReturnValueなので、中の値を取り出して返す
-		// (そのまま返すと、スコープを全て抜け出して外側の関数の評価も中断してしまう)
-		return unWrapReturnValue(evaluated)
+		// NOTE: 末尾呼び出しはループで評価(trampoline)
+		tail := false
+		for {
+			// ality check
+			if len(fn.Parameters) != len(args) {
+				// 末尾呼び出しでは、トレーサには呼び出し済みとして通知している
+				if tail && tracer != nil {
+					tracer.Exit(fn)
+				}
+				return newError("wrong number of arguments. got=%d, want=%d",
+					len(args), len(fn.Parameters))
+			}
+
+			// 関数内スコープの名前空間に引数を束縛
+			extendedEnv := extendFunctionEnv(fn, args, ev)
+			if tracer != nil && !tail {
+				tracer.Enter(fn)
+			}
+			// スコープ内の名前空間を使用
+			evaluated := Eval(fn.Body, extendedEnv)
+			// evaluatedは*obj.ReturnValueなので、中の値を取り出して返す
+			// (そのまま返すと、スコープを全て抜け出して外側の関数の評価も中断してしまう)
+			evaluated = unWrapReturnValue(evaluated)
+
+			tailCall, ok := evaluated.(*object.TailCall)
+			if !ok {
+				if tracer != nil {
+					tracer.Exit(fn)
+				}
+				return evaluated
+			}
+			if tracer != nil {
+				tracer.TailCall(fn, tailCall.Function)
+			}
+			fn, args = tailCall.Function, tailCall.Arguments
+			tail = true
+			ev.replaceCallFrame(fn)
+		}
 
 	// 組み込み関数の呼び出し
 	case *object.Builtin:
 		// NOTE: 組み込み関数はReturnValueを返さないのでunwrapの必要なし
-		return fn.Fn(env, args...)
+		tracer := evaluationOf(env).options.CallTracer
+		if tracer == nil {
+			return fn.Fn(env, args...)
+		}
+		tracer.Enter(fn)
+		result := fn.Fn(env, args...)
+		tracer.Exit(fn)
+		return result
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
 }
 
-func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
-	env := object.NewEnclosedEnvironment(fn.Env)
+func extendFunctionEnv(fn *object.Function, args []object.Object,
+	ev *evaluation) *object.Environment {
+
+	// NOTE: namespace経由で参照された関数は、外側の変数を名前で探す
+	env := object.NewScopedEnvironment(fn.Env, fn.Scope, fn.Rebound)
+	// 宣言時ではなく呼び出し元の評価を引き継ぐ
+	env.SetEvaluation(ev)
 
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		if param.Resolved {
+			env.SetSlot(param.Slot, args[paramIdx])
+		} else {
+			env.Set(param.Value, args[paramIdx])
+		}
 	}
 
 	return env
@@ -424,7 +555,27 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
 	pairs := make(map[object.HashKey]object.HashPair)
 
-	for keyNode, valueNode := range node.Pairs {
+	// NOTE: 同じkeyは後に書かれたものが優先されるよう、ソース上の順序で評価
+	for _, keyNode := range node.Keys {
+		if spread, ok := keyNode.(*ast.SpreadExpression); ok {
+			evaluated := Eval(spread.Value, env)
+			if isError(evaluated) {
+				return evaluated
+			}
+
+			hash, ok := evaluated.(*object.Hash)
+			if !ok {
+				return newError("spread operator not supported: %s",
+					evaluated.Type())
+			}
+
+			for hashed, pair := range hash.Pairs {
+				pairs[hashed] = pair
+			}
+			continue
+		}
+
+		valueNode := node.Pairs[keyNode]
 		key := Eval(keyNode, env)
 		if isError(key) {
 			return key
@@ -465,7 +616,7 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 
 func isShortCutOperator(op string) bool {
 	switch op {
-	case "&&", "||":
+	case "&&", "||", "??", "?.":
 		return true
 	default:
 		return false
@@ -484,16 +635,31 @@ func evalShortCutInfixExpression(node *ast.InfixExpression,
 		return left
 	}
 
+	// NOTE: null以外に対する"?."は"."と同じ
+	if node.Operator == "?." {
+		return evalDotExpression(node, left, env)
+	}
+
 	// NOTE: エラー返却もこの一行で済む
 	return Eval(node.Right, env)
 }
 
+func isOptionalCall(node *ast.CallExpression, function object.Object) bool {
+	infix, ok := node.Function.(*ast.InfixExpression)
+	return ok && infix.Operator == "?." && function == NULL
+}
+
 func canShortCut(operator string, left object.Object) bool {
 	switch operator {
 	case "&&":
 		return !isTruthy(left)
 	case "||":
 		return isTruthy(left)
+	case "??":
+		return left != NULL
+	case "?.", "?[":
+		// NOTE: 左辺がnullの場合、右辺を評価せずnull(=left)を返す
+		return left == NULL
 	default:
 		return false
 	}
@@ -502,7 +668,7 @@ func canShortCut(operator string, left object.Object) bool {
 func evalNameSpaceLiteral(node *ast.NameSpaceLiteral,
 	outerEnv *object.Environment) object.Object {
 
-	env := object.NewEnclosedEnvironment(outerEnv)
+	env := object.NewScopedEnvironment(outerEnv, node.Scope, false)
 	Eval(node.Body, env)
 
 	return &object.NameSpace{Env: env}
@@ -525,42 +691,125 @@ func evalNameSpaceInfixExpression(operator string,
 	}
 }
 
-func evalCallInfixExpression(node *ast.InfixExpression,
-	env *object.Environment) (object.Object, bool) {
+// 連鎖の要素を評価する
+// `?.`, `?[`の左辺がnullだった場合、連鎖の残り(`a?.b.c`の`.c`)も評価せずnullを返すため、
+// shortCutで呼び出し元の要素に伝える
+func evalChain(node ast.Expression, env *object.Environment) (object.Object, bool) {
+	switch node := node.(type) {
+	case *ast.InfixExpression:
+		left, shortCut := evalChainLeft(node.Left, env)
+		if shortCut || isError(left) {
+			return left, shortCut
+		}
+		// `left?.right`はleftがnullならrightを評価せずnullを返す
+		// NOTE: null以外に対する"?."は"."と同じ
+		if node.Operator == "?." && canShortCut(node.Operator, left) {
+			return left, true
+		}
+		return evalDotExpression(node, left, env), false
 
-	// 呼び出しエラーが起きた際に、左辺の束縛も表示するために利用
-	var nameSpaceIdent string
-	if _, ok := node.Left.(*ast.Identifier); ok {
-		nameSpaceIdent = node.Left.String()
-	} else {
-		nameSpaceIdent = ""
+	case *ast.IndexExpression:
+		left, shortCut := evalChainLeft(node.Left, env)
+		if shortCut || isError(left) {
+			return left, shortCut
+		}
+		// `left?[index]`はleftがnullならindexを評価せずnullを返す
+		if node.Optional && canShortCut(node.TokenLiteral(), left) {
+			return left, true
+		}
+		index := Eval(node.Index, env)
+		if isError(index) {
+			return index, false
+		}
+		return evalIndexExpression(left, index), false
+
+	case *ast.CallExpression:
+		// Envは関数の外側の名前空間
+		function, shortCut := evalChainLeft(node.Function, env)
+		if shortCut || isError(function) {
+			return function, shortCut
+		}
+		// `ns?.f()`はns.fがnullの場合も引数を評価せずnullを返す
+		if isOptionalCall(node, function) {
+			return NULL, false
+		}
+		return evalCallExpression(node, function, env), false
 	}
 
-	leftObj := Eval(node.Left, env)
-	if isError(leftObj) {
-		return leftObj, true
+	return Eval(node, env), false
+}
+
+// 連鎖の左側(`a?.b.c`の`a?.b`)を評価する
+func evalChainLeft(node ast.Expression, env *object.Environment) (object.Object, bool) {
+	if ast.IsChainElement(node) {
+		return evalChain(node, env)
 	}
+	return Eval(node, env), false
+}
 
-	switch {
-	case node.Operator == "." && leftObj.Type() == object.NAMESPACE_OBJ:
-		return evalNameSpaceCall(leftObj, node.Right, nameSpaceIdent), true
-	default:
-		return nil, false
+func evalCallExpression(node *ast.CallExpression, function object.Object,
+	env *object.Environment) object.Object {
+
+	// 各引数の評価
+	args := evalExpressions(node.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+
+	// トレースバック用に呼び出しを記録(組み込み関数は記録しない)
+	fn, isFunction := function.(*object.Function)
+
+	// 末尾呼び出しは、Goのスタックを積まないよう呼び出し元のapplyFunctionで評価
+	if isFunction && node.Tail {
+		return &object.TailCall{Function: fn, Arguments: args}
 	}
+
+	// 関数内の名前空間はenvの内側の新たなEnvironmentを参照
+	if isFunction {
+		return evaluationOf(env).callFunction(fn, node, args, env)
+	}
+	return applyFunction(function, args, env)
+}
+
+func evalDotExpression(node *ast.InfixExpression, leftObj object.Object,
+	env *object.Environment) object.Object {
+
+	if leftObj.Type() == object.NAMESPACE_OBJ {
+		// 呼び出しエラーが起きた際に、左辺の束縛も表示するために利用
+		var nameSpaceIdent string
+		if _, ok := node.Left.(*ast.Identifier); ok {
+			nameSpaceIdent = node.Left.String()
+		} else {
+			nameSpaceIdent = ""
+		}
+
+		return evalNameSpaceCall(leftObj, node.Right, nameSpaceIdent, env)
+	}
+
+	// namespace以外の"."はエラー(type mismatch等)
+	right := Eval(node.Right, env)
+	if isError(right) {
+		return right
+	}
+	return evalInfixExpression(node.Operator, leftObj, right)
 }
 
 func evalNameSpaceCall(leftObj object.Object, rightNode ast.Node,
-	leftName string) object.Object {
+	leftName string, env *object.Environment) object.Object {
 
 	nameSpace := leftObj.(*object.NameSpace)
 
+	restore := enterNameSpace(nameSpace, env)
 	evaluated := Eval(rightNode, nameSpace.Env)
+	restore()
 
-	if isError(evaluated) {
+	if errObj, ok := evaluated.(*object.Error); ok {
 		// namespaceの変数名をメッセージに追加
-		newErrMsg := fmt.Sprintf(`In namespace "%s": %s`,
-			leftName, evaluated.(*object.Error).Message)
-		return newError(newErrMsg)
+		// (catchできるよう、投げられた値や位置はそのまま)
+		wrapped := *errObj
+		wrapped.Message = fmt.Sprintf(`In namespace "%s": %s`,
+			leftName, errObj.Message)
+		return &wrapped
 	}
 
 	// NOTE: メソッド呼び出し可能にするため、evaluatedが
@@ -572,9 +821,103 @@ func evalNameSpaceCall(leftObj object.Object, rightNode ast.Node,
 	// (nameSpace.Envで宣言された関数を呼び出した場合は、スコープは変わらないので
 	// 普通のnameSpaceの参照として利用する場合も問題ない)
 	if function, ok := evaluated.(*object.Function); ok {
-		function.Env = nameSpace.Env
+		if function.Env != nameSpace.Env {
+			function.Env = nameSpace.Env
+			function.Rebound = true
+		}
 		return function
 	}
 
 	return evaluated
 }
+
+func evalAssignExpression(node *ast.AssignExpression,
+	env *object.Environment) object.Object {
+
+	value := Eval(node.Value, env)
+	if isError(value) {
+		return value
+	}
+
+	return assign(node.Target, value, env)
+}
+
+func assign(target ast.Expression, value object.Object,
+	env *object.Environment) object.Object {
+
+	// NOTE: 代入先の配列/ハッシュ/namespaceは書き換えられる(コピーはしない)
+	// そのため、同じobjectを参照している全ての束縛から変更が見える
+	switch target := target.(type) {
+	case *ast.IndexExpression:
+		left := Eval(target.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := Eval(target.Index, env)
+		if isError(index) {
+			return index
+		}
+		return evalIndexAssignment(left, index, value)
+	case *ast.InfixExpression:
+		left := Eval(target.Left, env)
+		if isError(left) {
+			return left
+		}
+		return evalFieldAssignment(left, target.Right, value, env)
+	default:
+		return newError("cannot assign to %s", target.String())
+	}
+}
+
+func evalIndexAssignment(left, index, value object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		arrayObject := left.(*object.Array)
+		idx := index.(*object.Integer).Value
+		max := int64(len(arrayObject.Elements) - 1)
+
+		if idx < 0 || idx > max {
+			return newError("index out of range: %d", idx)
+		}
+
+		arrayObject.Elements[idx] = value
+		return value
+	case left.Type() == object.HASH_OBJ:
+		hashObject := left.(*object.Hash)
+
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+
+		hashObject.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: value}
+		return value
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+}
+
+func evalFieldAssignment(left object.Object, field ast.Expression,
+	value object.Object, env *object.Environment) object.Object {
+
+	nameSpace, ok := left.(*object.NameSpace)
+	if !ok {
+		return newError("field assignment not supported: %s", left.Type())
+	}
+
+	switch field := field.(type) {
+	case *ast.Identifier:
+		if nameSpace.Env.IsConst(field.Value) {
+			return newError("cannot assign to const: %s", field.Value)
+		}
+		// NOTE: 外側の環境ではなく、namespace自身の環境に束縛する
+		return nameSpace.Env.Set(field.Value, value)
+	case *ast.IndexExpression:
+		// `ns.arr[i] = v`は`ns.(arr[i]) = v`とパースされるため、
+		// 参照時(evalNameSpaceCall)と同様namespace内で評価する
+		defer enterNameSpace(nameSpace, env)()
+		return assign(field, value, nameSpace.Env)
+	default:
+		return newError("cannot assign to %s", field.String())
+	}
+}
@@ -0,0 +1,143 @@
+package evaluator
+
+import (
+	"../ast"
+	"../object"
+	"../token"
+)
+
+// NOTE: throwされた値も組み込みのエラーも、同じ*object.Errorとして
+// 評価を中断しながら呼び出し元へ伝播し、try式のcatchで捕捉される
+// (catchされなかった場合は今まで通りERRORとして表示)
+
+const (
+	RUNTIME_ERROR = "RuntimeError" // 組み込みのエラーのtype
+	THROWN_ERROR  = "Error"        // throwされた値(typeを持つハッシュ以外)のtype
+)
+
+func newThrownError(val object.Object) *object.Error {
+	var message string
+
+	switch val := val.(type) {
+	case *object.String:
+		message = val.Value
+	case *object.Hash:
+		if msg, ok := hashGet(val, "message").(*object.String); ok {
+			message = msg.Value
+		} else {
+			message = val.Inspect()
+		}
+	default:
+		message = val.Inspect()
+	}
+
+	return &object.Error{Message: message, Value: val}
+}
+
+// エラーが起きた文の位置を記録(既に内側の文で記録されている場合は何もしない)
+func setErrorLocation(errObj *object.Error, stmt ast.Statement,
+	env *object.Environment) {
+
+	if errObj.Line != 0 {
+		return
+	}
+
+	tok := statementToken(stmt)
+	errObj.Line = tok.Line
+	errObj.Column = tok.Column
+
+	errObj.File = fileNameOf(env)
+}
+
+func evalTryExpression(node *ast.TryExpression,
+	env *object.Environment) object.Object {
+
+	result := Eval(node.Block, env)
+
+	// NOTE: 評価の打ち切りはcatchもfinallyも評価しない
+	if IsAborted(result) {
+		return result
+	}
+
+	if errObj, ok := result.(*object.Error); ok && node.Catch != nil {
+		// NOTE: catchの変数は外側のスコープを汚さないよう、内側の環境に束縛
+		catchEnv := object.NewScopedEnvironment(env, node.CatchScope, false)
+		catchEnv.Set(node.Parameter.Value, errorToHash(errObj))
+		result = Eval(node.Catch, catchEnv)
+	}
+
+	if node.Finally != nil {
+		// finally内でreturn, エラーが起きた場合はそちらを優先
+		finallyResult := Eval(node.Finally, env)
+		rt := finallyResult.Type()
+		if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			return finallyResult
+		}
+	}
+
+	return result
+}
+
+// catchで束縛されるハッシュ
+// {"message": ..., "type": ..., "value": ..., "line": ..., "column": ..., "file": ...}
+// (ハッシュがthrowされた場合、そのkeyも全て含む)
+func errorToHash(errObj *object.Error) *object.Hash {
+	pairs := make(map[object.HashKey]object.HashPair)
+	hash := &object.Hash{Pairs: pairs}
+
+	errType := RUNTIME_ERROR
+	var value object.Object = NULL
+
+	if errObj.Value != nil {
+		errType = THROWN_ERROR
+		value = errObj.Value
+
+		if thrown, ok := errObj.Value.(*object.Hash); ok {
+			for hashed, pair := range thrown.Pairs {
+				pairs[hashed] = pair
+			}
+			if t, ok := hashGet(thrown, "type").(*object.String); ok {
+				errType = t.Value
+			}
+		}
+	}
+
+	hashSet(hash, "message", &object.String{Value: errObj.Message})
+	hashSet(hash, "type", &object.String{Value: errType})
+	hashSet(hash, "value", value)
+	hashSet(hash, "line", &object.Integer{Value: int64(errObj.Line)})
+	hashSet(hash, "column", &object.Integer{Value: int64(errObj.Column)})
+	hashSet(hash, "file", &object.String{Value: errObj.File})
+
+	return hash
+}
+
+func hashGet(hash *object.Hash, key string) object.Object {
+	pair, ok := hash.Pairs[(&object.String{Value: key}).HashKey()]
+	if !ok {
+		return NULL
+	}
+	return pair.Value
+}
+
+func hashSet(hash *object.Hash, key string, value object.Object) {
+	keyObj := &object.String{Value: key}
+	hash.Pairs[keyObj.HashKey()] = object.HashPair{Key: keyObj, Value: value}
+}
+
+func statementToken(stmt ast.Statement) token.Token {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Token
+	case *ast.ReturnStatement:
+		return stmt.Token
+	case *ast.ThrowStatement:
+		return stmt.Token
+	case *ast.ExpressionStatement:
+		return stmt.Token
+	case *ast.BlockStatement:
+		return stmt.Token
+	default:
+		return token.Token{}
+	}
+}
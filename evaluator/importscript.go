@@ -1,28 +1,63 @@
 package evaluator
 
 import (
+	"../ast"
 	"../object"
-	"fmt"
 )
 
-func importScript(env *object.Environment, fileName string) object.Object {
-	// NOTE: use init() to avoid initialization loop (see below)
-	// same as        "EvalScriptFile(fileName)"
-	importEnv, err := _evalScriptFile(fileName)
+// import()の本体
+// NOTE: vm等、他の実行エンジンのimport()でも使用するため、
+// スクリプトを評価する関数を引数で受け取る
+func ImportScript(args []object.Object,
+	evalScriptFile func(string) (*object.Environment, error)) object.Object {
+
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	if args[0].Type() != object.STRING_OBJ {
+		return newError("argument to `import` must be STRING, got %s",
+			args[0].Type())
+	}
+
+	// NOTE: namespace中THIS_DIR, THIS_FILEにファイル名をSTRINGで束縛
+	fileName := args[0].(*object.String).Value + ".monkey"
+
+	importEnv, err := evalScriptFile(fileName)
 	if err != nil {
-		return newError(fmt.Sprintf("%s", err))
+		// 評価の打ち切りはimport元でもcatchできないようそのまま返す
+		if evalErr, ok := err.(*EvalError); ok && IsAborted(evalErr.Object) {
+			return evalErr.Object
+		}
+		return newError("%s", err)
 	}
 
-	return &object.NameSpace{Env: importEnv}
+	return &object.NameSpace{Env: importEnv, FileName: fileName}
 }
 
 // NOTE: use init() to avoid initialization loop
-// builtin -> importScript -> EvalScriptFile
+// builtin -> ImportScript -> EvalScriptFile
 // -> Eval -> evalIdentifier -> builtin ->...
-var _evalScriptFile func(string) (*object.Environment, error)
+var _evalScriptFile func(string, *object.Environment) (*object.Environment, error)
 
 // (initは特殊な関数で、実行の直前に自動的に呼び出される(コード内での呼び出しは不能)
 // 宣言を実行の直前(importの初期化の直後)まで遅延させるためループしなくなる)
 func init() {
-	_evalScriptFile = EvalScriptFile
+	_evalScriptFile = evalImportedScriptFile
+}
+
+// import()したスクリプトファイルを評価
+// NOTE: トレースバック等のため、評価の状態はimport元(importerを評価中)のものを引き継ぐ
+func evalImportedScriptFile(fileName string,
+	importer *object.Environment) (*object.Environment, error) {
+
+	ev := evaluationOf(importer)
+	ev.importDepth++
+	defer func() { ev.importDepth-- }()
+
+	return EvalScriptFileWith(fileName, func(node ast.Node, env *object.Environment) object.Object {
+		env.SetEvaluation(ev)
+		return Eval(node, env)
+	})
 }
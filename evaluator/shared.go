@@ -0,0 +1,78 @@
+package evaluator
+
+import (
+	"../object"
+	"sort"
+)
+
+// NOTE: vm等、他の実行エンジンと評価結果(エラーメッセージ含む)を揃えるため、
+// 演算子や組み込み関数の評価を公開する
+
+func EvalInfixOperation(operator string, left, right object.Object) object.Object {
+	return evalInfixExpression(operator, left, right)
+}
+
+func EvalPrefixOperation(operator string, right object.Object) object.Object {
+	return evalPrefixExpression(operator, right)
+}
+
+func EvalIndexOperation(left, index object.Object) object.Object {
+	return evalIndexExpression(left, index)
+}
+
+func EvalIndexAssignment(left, index, value object.Object) object.Object {
+	return evalIndexAssignment(left, index, value)
+}
+
+// 左辺だけで`&&`, `||`, `??`, `?.`, `?[`の値が決まるかどうか
+func CanShortCut(operator string, left object.Object) bool {
+	return canShortCut(operator, left)
+}
+
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
+
+func NewError(format string, a ...interface{}) *object.Error {
+	return newError(format, a...)
+}
+
+func NewThrownError(val object.Object) *object.Error {
+	return newThrownError(val)
+}
+
+// catchで束縛されるハッシュ
+func ErrorToHash(errObj *object.Error) *object.Hash {
+	return errorToHash(errObj)
+}
+
+func LookupBuiltin(name string) (*object.Builtin, bool) {
+	builtin, ok := builtins[name]
+	return builtin, ok
+}
+
+// 環境(またはその外側)に束縛されたTHIS_FILE(無ければ空文字)
+func FileNameOf(env *object.Environment) string {
+	return fileNameOf(env)
+}
+
+// 組み込み関数の名前(辞書順)
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 関数(組み込み関数を含む)をargsで呼び出す(`monkey test`等)
+// NOTE: トレースバックにはfnから表示する(呼び出し元はスクリプトの外のため表示しない)
+func ApplyFunction(fn object.Object, args []object.Object,
+	env *object.Environment) object.Object {
+
+	if function, ok := fn.(*object.Function); ok {
+		return evaluationOf(env).callFunction(function, nil, args, env)
+	}
+	return applyFunction(fn, args, env)
+}
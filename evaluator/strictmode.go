@@ -0,0 +1,39 @@
+package evaluator
+
+import (
+	"../ast"
+	"../object"
+	"fmt"
+	"io"
+	"os"
+)
+
+// NOTE: strict modeでは、let(const)で下記の名前を隠してしまう場合に警告する
+// - 組み込み関数 (`let len = ...;`以降lenが使えなくなる)
+// - import()で読み込んだnamespaceが束縛された変数 (`let std = ...;`)
+// (エラーにはせず、評価はそのまま続ける)
+// StrictMode、StrictModeOutは既定値(Options.StrictMode、Options.StrictModeOut)
+// NOTE: プロセス全体で共有するため、他のgoroutineが評価を始める間は変更できない
+var (
+	StrictMode              = false
+	StrictModeOut io.Writer = os.Stderr
+)
+
+func warnShadowing(node *ast.LetStatement, env *object.Environment, out io.Writer) {
+	name := node.Name.Value
+	warn := func(format string, a ...interface{}) {
+		fmt.Fprintf(out, "warning: "+format+"\n", a...)
+	}
+
+	if val, ok := env.Get(name); ok {
+		if nameSpace, ok := val.(*object.NameSpace); ok && nameSpace.FileName != "" {
+			warn("%s %q shadows namespace imported from %q",
+				node.TokenLiteral(), name, nameSpace.FileName)
+		}
+		return
+	}
+
+	if _, ok := builtins[name]; ok {
+		warn("%s %q shadows builtin function", node.TokenLiteral(), name)
+	}
+}
@@ -9,9 +9,17 @@ type Lexer struct {
 	position     int  // 入力における現在読んでいる文字の位置
 	readPosition int  // 次に読む文字の位置(token区切りを判断するために先読み)
 	ch           byte // 現在検査中の文字
+	line         int  // 現在検査中の文字の行(1始まり)
+	column       int  // 現在検査中の文字の列(1始まり)
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line += 1
+		l.column = 0
+	}
+	l.column += 1
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0 // inputの終端に到達したらnull文字セット
 	} else {
@@ -26,6 +34,12 @@ func (l *Lexer) readIdentifier() string {
 	for isLetter(l.ch) {
 		l.readChar()
 	}
+	// NOTE: 破壊的な組み込み関数(append!等)のみ、末尾の'!'を識別子に含める
+	// ("append != y"と区別するため、直後が'='の場合は含めない)
+	if l.ch == '!' && l.peekChar() != '=' &&
+		token.IsBangIdentifier(l.input[position:l.position]) {
+		l.readChar()
+	}
 	return l.input[position:l.position]
 }
 
@@ -52,9 +66,18 @@ func (l *Lexer) peekChar() byte {
 	}
 }
 
+// 2文字先をのぞき見("..."の判定用)
+func (l *Lexer) peekNextChar() byte {
+	if l.readPosition+1 >= len(l.input) {
+		return 0
+	} else {
+		return l.input[l.readPosition+1]
+	}
+}
+
 // Lexerのコンストラクタ
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar() // 一文字目を読みこんでおく
 	return l
 }
@@ -63,6 +86,9 @@ func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 	l.skipWhiteSpace() // 空白読み飛ばさないと不要なILLIGAL tokenが生成されてしまう
 
+	// NOTE: tokenの位置は読み進める前に記録しておく
+	line, column := l.line, l.column
+
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' { // '=='
@@ -76,7 +102,14 @@ func (l *Lexer) NextToken() token.Token {
 	case '+':
 		tok = newToken(token.PLUS, l.ch)
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '>' { // "->"
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.ARROW, Literal: literal}
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case '!':
 		if l.peekChar() == '=' {
 			ch := l.ch
@@ -145,10 +178,36 @@ func (l *Lexer) NextToken() token.Token {
 			literal := string(ch) + string(l.ch)
 			tok = token.Token{Type: token.OR, Literal: literal}
 		} else {
-			tok = newToken(token.ILLEGAL, l.ch)
+			tok = newToken(token.PIPE, l.ch)
 		}
 	case '.':
-		tok = newToken(token.DOT, l.ch)
+		if l.peekChar() == '.' && l.peekNextChar() == '.' { // "..."
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.SPREAD, Literal: "..."}
+		} else {
+			tok = newToken(token.DOT, l.ch)
+		}
+	case '?':
+		switch l.peekChar() {
+		case '?': // "??"
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.NULLISH, Literal: literal}
+		case '.': // "?."
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.OPTIONAL_DOT, Literal: literal}
+		case '[': // "?["
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.OPTIONAL_LBRACKET, Literal: literal}
+		default:
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF //newTokenで生成しないのは、null文字をstringで変換できないため？
@@ -157,10 +216,12 @@ func (l *Lexer) NextToken() token.Token {
 			// 記号とは別処理なのでreadCharしない(ident終わるまで塊で１tokenとして読むため)
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal) // 変数名 or keyword
+			tok.Line, tok.Column = line, column
 			return tok
 		} else if isDigit(l.ch) {
 			tok.Literal = l.readNumber()
 			tok.Type = token.INT
+			tok.Line, tok.Column = line, column
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch) // 使用不可能記号
@@ -168,6 +229,7 @@ func (l *Lexer) NextToken() token.Token {
 	}
 
 	l.readChar() // 次の文字を読む
+	tok.Line, tok.Column = line, column
 	return tok
 }
 
@@ -38,6 +38,13 @@ func TestNextToken(t *testing.T) {
 
 	namespace{}
 	taro.name
+	append!(arr, 1)
+	x!=y
+	null ?? a?.b?[0]
+	[...a]
+	const c = 1;
+	throw try catch finally
+	fn(x: int) -> string | null
 	`
 
 	tests := []struct {
@@ -150,6 +157,46 @@ func TestNextToken(t *testing.T) {
 		{token.IDENT, "taro"},
 		{token.DOT, "."},
 		{token.IDENT, "name"},
+		{token.IDENT, "append!"},
+		{token.LPAREN, "("},
+		{token.IDENT, "arr"},
+		{token.COMMA, ","},
+		{token.INT, "1"},
+		{token.RPAREN, ")"},
+		{token.IDENT, "x"},
+		{token.NOT_EQ, "!="},
+		{token.IDENT, "y"},
+		{token.NULL, "null"},
+		{token.NULLISH, "??"},
+		{token.IDENT, "a"},
+		{token.OPTIONAL_DOT, "?."},
+		{token.IDENT, "b"},
+		{token.OPTIONAL_LBRACKET, "?["},
+		{token.INT, "0"},
+		{token.RBRACKET, "]"},
+		{token.LBRACKET, "["},
+		{token.SPREAD, "..."},
+		{token.IDENT, "a"},
+		{token.RBRACKET, "]"},
+		{token.CONST, "const"},
+		{token.IDENT, "c"},
+		{token.ASSIGN, "="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.THROW, "throw"},
+		{token.TRY, "try"},
+		{token.CATCH, "catch"},
+		{token.FINALLY, "finally"},
+		{token.FUNCTION, "fn"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.COLON, ":"},
+		{token.IDENT, "int"},
+		{token.RPAREN, ")"},
+		{token.ARROW, "->"},
+		{token.IDENT, "string"},
+		{token.PIPE, "|"},
+		{token.NULL, "null"},
 		{token.EOF, ""},
 	}
 
@@ -169,3 +216,79 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+// 末尾の'!'は破壊的な組み込み関数の名前のみに含める
+func TestBangSuffix(t *testing.T) {
+	type expectedToken struct {
+		Type    token.TokenType
+		Literal string
+	}
+
+	tests := []struct {
+		input    string
+		expected []expectedToken
+	}{
+		{"append!(a)", []expectedToken{{token.IDENT, "append!"}, {token.LPAREN, "("},
+			{token.IDENT, "a"}, {token.RPAREN, ")"}}},
+		{"a!=b", []expectedToken{{token.IDENT, "a"}, {token.NOT_EQ, "!="},
+			{token.IDENT, "b"}}},
+		{"a! = b", []expectedToken{{token.IDENT, "a"}, {token.BANG, "!"},
+			{token.ASSIGN, "="}, {token.IDENT, "b"}}},
+		{"let x! = 1", []expectedToken{{token.LET, "let"}, {token.IDENT, "x"},
+			{token.BANG, "!"}, {token.ASSIGN, "="}, {token.INT, "1"}}},
+		{"append!=b", []expectedToken{{token.IDENT, "append"}, {token.NOT_EQ, "!="},
+			{token.IDENT, "b"}}},
+		{"append!!b", []expectedToken{{token.IDENT, "append!"}, {token.BANG, "!"},
+			{token.IDENT, "b"}}},
+		{"x!", []expectedToken{{token.IDENT, "x"}, {token.BANG, "!"}}},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		for i, expected := range append(tt.expected, expectedToken{token.EOF, ""}) {
+			tok := l.NextToken()
+			if tok.Type != expected.Type || tok.Literal != expected.Literal {
+				t.Errorf("tokens[%d] of %q wrong. expected=%s %q, got=%s %q",
+					i, tt.input, expected.Type, expected.Literal, tok.Type, tok.Literal)
+				break
+			}
+		}
+	}
+}
+
+func TestTokenPosition(t *testing.T) {
+	input := "let five = 5;\n  five >= \"a b\"\n\n}"
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, 1, 1},
+		{token.IDENT, 1, 5},
+		{token.ASSIGN, 1, 10},
+		{token.INT, 1, 12},
+		{token.SEMICOLON, 1, 13},
+		{token.IDENT, 2, 3},
+		{token.GEQ, 2, 8},
+		{token.STRING, 2, 11},
+		{token.RBRACE, 4, 1},
+		{token.EOF, 4, 2},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
@@ -0,0 +1,425 @@
+package lint
+
+import (
+	"../ast"
+	"../evaluator"
+	"../lexer"
+	"../parser"
+	"../token"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// NOTE: スクリプトを評価せずに、ASTから以下の問題を見つける
+//   - 使われていないlet
+//     (関数、catchの本体のみ。トップレベル、namespaceの変数はimport元や`.`から参照されうる)
+//   - どのスコープにも組み込み関数にも無い名前の参照
+//   - 引数の数が合わない関数呼び出し(呼び出す関数が静的に分かる場合のみ)
+//   - return, throwの後の到達しない文
+//   - 組み込み関数を隠すlet
+//
+// 評価時に決まる束縛は誤検知しないよう、以下の名前は定義済みとみなす
+//   - `ns.x = v`で代入されたフィールド名(self(), outer()で得た環境に束縛されうる)
+//   - namespace内で宣言された名前(namespace内の関数は`ns.f`で別の環境から呼ばれうる)
+
+// 問題の種類
+const (
+	SYNTAX_ERROR         = "syntax-error"
+	UNUSED_VARIABLE      = "unused-variable"
+	UNDEFINED_NAME       = "undefined-name"
+	WRONG_ARGUMENT_COUNT = "wrong-argument-count"
+	UNREACHABLE_CODE     = "unreachable-code"
+	SHADOWED_BUILTIN     = "shadowed-builtin"
+)
+
+type Diagnostic struct {
+	File string `json:"file"`
+	// 位置が分からない場合は0
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (d *Diagnostic) String() string {
+	if d.Line == 0 {
+		return fmt.Sprintf("%s: %s (%s)", d.File, d.Message, d.Rule)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s (%s)", d.File, d.Line, d.Column, d.Message,
+		d.Rule)
+}
+
+func LintFile(fileName string) ([]*Diagnostic, error) {
+	source, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return LintSource(string(source), fileName), nil
+}
+
+func LintSource(source string, fileName string) []*Diagnostic {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		diagnostics := []*Diagnostic{}
+		for _, e := range p.ParseErrors() {
+			diagnostics = append(diagnostics, &Diagnostic{File: fileName,
+				Line: e.Line, Column: e.Column, Rule: SYNTAX_ERROR, Message: e.Msg})
+		}
+		return diagnostics
+	}
+
+	return Lint(program, fileName)
+}
+
+// programの問題(ソース上の順)
+func Lint(program *ast.Program, fileName string) []*Diagnostic {
+	l := &linter{
+		fileName:    fileName,
+		diagnostics: []*Diagnostic{},
+		fields:      assignedFields(program),
+	}
+
+	s := l.newScope(nil, program.Statements, nil)
+	// スクリプトファイルの環境に束縛される変数
+	for _, name := range []string{"THIS_DIR", "THIS_FILE"} {
+		if _, ok := s.bindings[name]; !ok {
+			s.bindings[name] = &binding{}
+		}
+	}
+	l.statements(program.Statements, s)
+
+	sort.SliceStable(l.diagnostics, func(i, j int) bool {
+		a, b := l.diagnostics[i], l.diagnostics[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return l.diagnostics
+}
+
+type linter struct {
+	fileName    string
+	diagnostics []*Diagnostic
+	fields      map[string]bool
+}
+
+// 宣言された変数
+type binding struct {
+	token token.Token // 変数名の位置
+	// letで宣言された(引数、catchの変数でない)
+	let          bool
+	declarations int
+	used         bool
+	// 一度だけ関数リテラルで束縛された場合、その関数
+	function *ast.FunctionLiteral
+}
+
+// 関数、namespace、catchの本体の環境(if, tryのブロックは環境を作らない)
+type scope struct {
+	bindings map[string]*binding
+	names    []string // 宣言順
+	outer    *scope
+	// 使われていないletを報告するか
+	checkUnused bool
+	// namespaceの本体(内側の関数を含む)で宣言された全ての名前
+	members map[string]bool
+}
+
+func (l *linter) report(tok token.Token, rule string, format string,
+	a ...interface{}) {
+
+	l.diagnostics = append(l.diagnostics, &Diagnostic{
+		File:    l.fileName,
+		Line:    tok.Line,
+		Column:  tok.Column,
+		Rule:    rule,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+func (l *linter) newScope(outer *scope, stmts []ast.Statement,
+	params []*ast.Identifier) *scope {
+
+	s := &scope{bindings: make(map[string]*binding), outer: outer}
+	for _, param := range params {
+		s.declare(param, nil)
+	}
+	for _, stmt := range stmts {
+		l.collect(s, stmt)
+	}
+	return s
+}
+
+func (s *scope) declare(name *ast.Identifier, value ast.Expression) *binding {
+	b, ok := s.bindings[name.Value]
+	if !ok {
+		b = &binding{token: name.Token}
+		s.bindings[name.Value] = b
+		s.names = append(s.names, name.Value)
+	}
+	b.declarations++
+
+	b.function = nil
+	if function, ok := value.(*ast.FunctionLiteral); ok && b.declarations == 1 {
+		b.function = function
+	}
+	return b
+}
+
+// 本体で宣言される変数(内側の関数、namespace、catchの本体は別の環境)
+func (l *linter) collect(s *scope, node ast.Node) {
+	ast.Walk(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			s.declare(node.Name, node.Value).let = true
+			if _, ok := evaluator.LookupBuiltin(node.Name.Value); ok {
+				l.report(node.Name.Token, SHADOWED_BUILTIN,
+					"%s %q shadows builtin function", node.TokenLiteral(),
+					node.Name.Value)
+			}
+		case *ast.FunctionLiteral, *ast.NameSpaceLiteral:
+			return false
+		case *ast.TryExpression:
+			l.collect(s, node.Block)
+			if node.Finally != nil {
+				l.collect(s, node.Finally)
+			}
+			return false
+		case *ast.InfixExpression:
+			if isDot(node) {
+				l.collect(s, node.Left)
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// 環境の本体の文を調べ、使われていないletを報告する
+func (l *linter) body(stmts []ast.Statement, s *scope) {
+	l.statements(stmts, s)
+
+	if !s.checkUnused {
+		return
+	}
+	for _, name := range s.names {
+		b := s.bindings[name]
+		// NOTE: `_`で始まる変数は意図的に使わないものとみなす
+		if b.let && !b.used && !strings.HasPrefix(name, "_") {
+			l.report(b.token, UNUSED_VARIABLE, "unused variable: %s", name)
+		}
+	}
+}
+
+func (l *linter) statements(stmts []ast.Statement, s *scope) {
+	for i, stmt := range stmts {
+		l.node(stmt, s)
+
+		if exits(stmt) && i < len(stmts)-1 {
+			l.report(tokenOf(stmts[i+1]), UNREACHABLE_CODE,
+				"unreachable code after %s", stmt.TokenLiteral())
+			// NOTE: 到達しない文の中の問題も報告する
+			for _, rest := range stmts[i+1:] {
+				l.node(rest, s)
+			}
+			return
+		}
+	}
+}
+
+func (l *linter) node(node ast.Node, s *scope) {
+	ast.Walk(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.BlockStatement:
+			l.statements(node.Statements, s)
+			return false
+		case *ast.Identifier:
+			l.reference(node, s)
+		case *ast.LetStatement:
+			// 変数名は参照ではない
+			if node.Value != nil {
+				l.node(node.Value, s)
+			}
+			return false
+		case *ast.FunctionLiteral:
+			inner := l.newScope(s, node.Body.Statements, node.Parameters)
+			inner.checkUnused = !usesEnvironment(node.Body)
+			l.body(node.Body.Statements, inner)
+			return false
+		case *ast.NameSpaceLiteral:
+			inner := l.newScope(s, node.Body.Statements, nil)
+			inner.members = declaredNames(node.Body)
+			l.body(node.Body.Statements, inner)
+			return false
+		case *ast.TryExpression:
+			l.node(node.Block, s)
+			if node.Catch != nil {
+				inner := l.newScope(s, node.Catch.Statements,
+					[]*ast.Identifier{node.Parameter})
+				inner.checkUnused = !usesEnvironment(node.Catch)
+				l.body(node.Catch.Statements, inner)
+			}
+			if node.Finally != nil {
+				l.node(node.Finally, s)
+			}
+			return false
+		case *ast.InfixExpression:
+			// `ns.x`の右辺は左辺のnamespaceで評価される
+			if isDot(node) {
+				l.node(node.Left, s)
+				return false
+			}
+		case *ast.CallExpression:
+			l.checkArguments(node, s)
+		}
+		return true
+	})
+}
+
+func (l *linter) reference(ident *ast.Identifier, s *scope) {
+	if b := lookup(ident.Value, s); b != nil {
+		b.used = true
+		return
+	}
+
+	if _, ok := evaluator.LookupBuiltin(ident.Value); ok {
+		return
+	}
+	if l.fields[ident.Value] {
+		return
+	}
+	for ; s != nil; s = s.outer {
+		if s.members[ident.Value] {
+			return
+		}
+	}
+
+	l.report(ident.Token, UNDEFINED_NAME, "identifier not found: %s", ident.Value)
+}
+
+func lookup(name string, s *scope) *binding {
+	for ; s != nil; s = s.outer {
+		if b, ok := s.bindings[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+// 呼び出す関数リテラルが静的に分かる場合、引数の数を比べる
+func (l *linter) checkArguments(call *ast.CallExpression, s *scope) {
+	var function *ast.FunctionLiteral
+	var tok token.Token
+	switch f := call.Function.(type) {
+	case *ast.FunctionLiteral:
+		function, tok = f, f.Token
+	case *ast.Identifier:
+		if b := lookup(f.Value, s); b != nil && !l.fields[f.Value] {
+			function, tok = b.function, f.Token
+		}
+	}
+	if function == nil {
+		return
+	}
+
+	// NOTE: スプレッドされる配列の長さは分からない
+	for _, arg := range call.Arguments {
+		if _, ok := arg.(*ast.SpreadExpression); ok {
+			return
+		}
+	}
+
+	if len(call.Arguments) != len(function.Parameters) {
+		l.report(tok, WRONG_ARGUMENT_COUNT,
+			"wrong number of arguments. got=%d, want=%d",
+			len(call.Arguments), len(function.Parameters))
+	}
+}
+
+// 後の文が評価されない文
+func exits(stmt ast.Statement) bool {
+	switch stmt.(type) {
+	case *ast.ReturnStatement, *ast.ThrowStatement:
+		return true
+	default:
+		return false
+	}
+}
+
+func tokenOf(stmt ast.Statement) token.Token {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Token
+	case *ast.ReturnStatement:
+		return stmt.Token
+	case *ast.ThrowStatement:
+		return stmt.Token
+	case *ast.ExpressionStatement:
+		return stmt.Token
+	case *ast.BlockStatement:
+		return stmt.Token
+	default:
+		return token.Token{}
+	}
+}
+
+// self(), outer()で環境がnamespaceとして取り出されうる
+// (取り出された環境の変数は`.`で参照されうる)
+func usesEnvironment(node ast.Node) bool {
+	found := false
+	ast.Walk(node, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok {
+			if ident.Value == "self" || ident.Value == "outer" {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// node内(内側の関数等を含む)で宣言された全ての名前
+func declaredNames(node ast.Node) map[string]bool {
+	names := make(map[string]bool)
+	ast.Walk(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			names[node.Name.Value] = true
+		case *ast.FunctionLiteral:
+			for _, param := range node.Parameters {
+				names[param.Value] = true
+			}
+		case *ast.TryExpression:
+			if node.Catch != nil {
+				names[node.Parameter.Value] = true
+			}
+		}
+		return true
+	})
+	return names
+}
+
+// `ns.x = v`で代入されたフィールド名
+func assignedFields(program *ast.Program) map[string]bool {
+	fields := make(map[string]bool)
+	ast.Walk(program, func(node ast.Node) bool {
+		if assign, ok := node.(*ast.AssignExpression); ok {
+			if infix, ok := assign.Target.(*ast.InfixExpression); ok && isDot(infix) {
+				if ident, ok := infix.Right.(*ast.Identifier); ok {
+					fields[ident.Value] = true
+				}
+			}
+		}
+		return true
+	})
+	return fields
+}
+
+func isDot(node *ast.InfixExpression) bool {
+	return node.Operator == "." || node.Operator == "?."
+}
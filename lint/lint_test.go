@@ -0,0 +1,99 @@
+package lint
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		// 問題無し
+		{"let add = fn(x, y) { x + y }; add(1, 2);", []string{}},
+		{"let f = fn() { g() }; let g = fn() { 1 };", []string{}},
+		{"puts(THIS_DIR, THIS_FILE);", []string{}},
+		// 使われていないlet
+		{"fn() { let a = 1; 2 }", []string{"1:12: unused variable: a (unused-variable)"}},
+		{"fn() { let _a = 1; 2 }", []string{}},
+		{"let a = 1; namespace { let b = 2; };", []string{}},
+		{"fn() { let a = 1; self() }", []string{}},
+		{"fn() { let a = 1; fn() { outer() } }", []string{}},
+		{"try { 1 } catch (e) { let v = 1; e }", []string{"1:27: unused variable: v (unused-variable)"}},
+		// 未定義の名前
+		{"puts(x);", []string{"1:6: identifier not found: x (undefined-name)"}},
+		{"fn(a) { fn() { a + b } }", []string{"1:20: identifier not found: b (undefined-name)"}},
+		{"try { 1 } catch (e) { 2 }; e", []string{"1:28: identifier not found: e (undefined-name)"}},
+		{"let ns = namespace { let x = 1; }; ns.x; ns.y;", []string{}},
+		{"fn() { let s = self(); s.y = 5; fn() { y } }", []string{}},
+		{`
+let Person = namespace {
+  let new = fn(age, name) { self(); };
+  let sayHi = fn() { puts(name); };
+};`, []string{}},
+		// 引数の数
+		{"let f = fn(x, y) { x }; f(1);", []string{"1:25: wrong number of arguments. got=1, want=2 (wrong-argument-count)"}},
+		{"fn(x) { x }(1, 2);", []string{"1:1: wrong number of arguments. got=2, want=1 (wrong-argument-count)"}},
+		{"let f = fn(x, y) { x }; f(...[1, 2]);", []string{}},
+		{"let f = fn(x) { x }; let f = fn(x, y) { x }; f(1);", []string{}},
+		// 到達しない文
+		{"fn() { return 1; puts(2); }", []string{"1:18: unreachable code after return (unreachable-code)"}},
+		{"fn() { throw 1; 2 }", []string{"1:17: unreachable code after throw (unreachable-code)"}},
+		{"fn() { if (true) { return 1; }; 2 }", []string{}},
+		{"fn() { return 1; x }", []string{
+			"1:18: unreachable code after return (unreachable-code)",
+			"1:18: identifier not found: x (undefined-name)",
+		}},
+		// 組み込み関数を隠すlet
+		{"let len = 1;", []string{`1:5: let "len" shadows builtin function (shadowed-builtin)`}},
+		{"fn() { const puts = 1; puts }", []string{`1:14: const "puts" shadows builtin function (shadowed-builtin)`}},
+		// 構文エラー
+		{"let x = ;", []string{"1:9: no prefix parse function for ; found (syntax-error)"}},
+	}
+
+	for _, tt := range tests {
+		diagnostics := LintSource(tt.input, "test.monkey")
+
+		if len(diagnostics) != len(tt.expected) {
+			t.Errorf("wrong number of diagnostics for %q. expected=%d, got=%v",
+				tt.input, len(tt.expected), diagnostics)
+			continue
+		}
+
+		for i, d := range diagnostics {
+			actual := strings.TrimPrefix(d.String(), "test.monkey:")
+			actual = strings.TrimPrefix(actual, " ")
+			if actual != tt.expected[i] {
+				t.Errorf("wrong diagnostic for %q. expected=%q, got=%q",
+					tt.input, tt.expected[i], actual)
+			}
+		}
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var out bytes.Buffer
+	WriteJSON(&out, LintSource("puts(x);", "a.monkey"))
+
+	expected := `[
+  {
+    "file": "a.monkey",
+    "line": 1,
+    "column": 6,
+    "rule": "undefined-name",
+    "message": "identifier not found: x"
+  }
+]
+`
+	if out.String() != expected {
+		t.Errorf("wrong JSON. expected=%q, got=%q", expected, out.String())
+	}
+
+	out.Reset()
+	WriteJSON(&out, nil)
+	if out.String() != "[]\n" {
+		t.Errorf("wrong JSON. expected=%q, got=%q", "[]\n", out.String())
+	}
+}
@@ -0,0 +1,25 @@
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// 1行に1つ、`file:line:column: message (rule)`の形式で出力
+func WriteText(out io.Writer, diagnostics []*Diagnostic) {
+	for _, d := range diagnostics {
+		fmt.Fprintln(out, d)
+	}
+}
+
+// Diagnosticの配列(問題が無ければ空配列)をJSONで出力
+func WriteJSON(out io.Writer, diagnostics []*Diagnostic) error {
+	if diagnostics == nil {
+		diagnostics = []*Diagnostic{}
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(diagnostics)
+}
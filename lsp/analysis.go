@@ -0,0 +1,577 @@
+package lsp
+
+import (
+	"../ast"
+	"../evaluator"
+	"../lexer"
+	"../object"
+	"../parser"
+	"../token"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// NOTE: スクリプトを評価せずに、ASTから名前の宣言と参照を対応付ける
+// (if, tryのブロックは環境を作らない、関数、namespace、catchの本体は環境を作る)
+//   - 変数の参照は、評価順で直前の宣言(無ければ環境の最初の宣言)を指す
+//   - `ns.x`の右辺は、左辺が静的に分かるnamespace(namespaceリテラル、
+//     import()の戻り値、それらを束縛した変数)のメンバーを指す
+
+// 宣言された名前
+type symbol struct {
+	name string
+	// 宣言されたファイルの解析結果(組み込み関数はnil)
+	analysis *analysis
+	token    token.Token // 名前の位置
+	// letで宣言された場合、その文
+	let *ast.LetStatement
+	// 引数、catchの変数の場合、その識別子
+	parameter *ast.Identifier
+	builtin   *object.Builtin
+}
+
+// 関数、namespace、catchの本体、ファイル全体の環境
+type scope struct {
+	outer *scope
+	// 宣言順の全ての宣言
+	symbols []*symbol
+	first   map[string]*symbol
+	// 評価順で直前の宣言(本体を解析し終えた後は最後の宣言)
+	current map[string]*symbol
+}
+
+// 名前の参照(宣言の名前自身も含む)
+type reference struct {
+	token token.Token
+	scope *scope
+	// 変数の参照の場合、その宣言(見つからなければnil)
+	symbol *symbol
+	// `left.x`の右辺の場合、その左辺
+	left ast.Expression
+}
+
+type analysis struct {
+	path      string
+	source    *source
+	program   *ast.Program
+	workspace *workspace
+	top       *scope
+	// ソース上の順
+	references  []*reference
+	identifiers map[*ast.Identifier]*reference
+	lets        map[*ast.LetStatement]*symbol
+	namespaces  map[*ast.NameSpaceLiteral]*scope
+}
+
+// 1リクエストの間に解析したファイル
+// (import先のファイルは必要になってから解析する)
+type workspace struct {
+	// 開かれているファイルの本文(パス→本文)
+	documents map[string]string
+	analyses  map[string]*analysis
+}
+
+func newWorkspace(documents map[string]string) *workspace {
+	return &workspace{documents: documents, analyses: make(map[string]*analysis)}
+}
+
+// ファイルを解析する(開かれていればその本文、読めなければnil)
+func (w *workspace) analyze(path string) *analysis {
+	if a, ok := w.analyses[path]; ok {
+		return a
+	}
+
+	text, ok := w.documents[path]
+	if !ok {
+		script, err := readFile(path)
+		if err != nil {
+			w.analyses[path] = nil
+			return nil
+		}
+		text = script
+	}
+
+	a := w.analyzeSource(path, text)
+	w.analyses[path] = a
+	return a
+}
+
+// 本文を解析する(構文エラーがあっても、パースできた部分を解析する)
+func (w *workspace) analyzeSource(path string, text string) *analysis {
+	a := &analysis{
+		path:        path,
+		source:      newSource(text),
+		program:     parser.New(lexer.New(text)).ParseProgram(),
+		workspace:   w,
+		identifiers: make(map[*ast.Identifier]*reference),
+		lets:        make(map[*ast.LetStatement]*symbol),
+		namespaces:  make(map[*ast.NameSpaceLiteral]*scope),
+	}
+
+	a.top = a.newScope(nil, a.program.Statements, nil)
+	a.statements(a.program.Statements, a.top)
+	return a
+}
+
+func (a *analysis) newScope(outer *scope, stmts []ast.Statement,
+	params []*ast.Identifier) *scope {
+
+	s := &scope{
+		outer:   outer,
+		first:   make(map[string]*symbol),
+		current: make(map[string]*symbol),
+	}
+	for _, param := range params {
+		sym := &symbol{name: param.Value, analysis: a, token: param.Token,
+			parameter: param}
+		s.declare(sym)
+		s.current[param.Value] = sym
+	}
+	for _, stmt := range stmts {
+		a.collect(s, stmt)
+	}
+	return s
+}
+
+func (s *scope) declare(sym *symbol) {
+	s.symbols = append(s.symbols, sym)
+	if _, ok := s.first[sym.name]; !ok {
+		s.first[sym.name] = sym
+	}
+}
+
+// 本体で宣言される変数(内側の関数、namespace、catchの本体は別の環境)
+func (a *analysis) collect(s *scope, node ast.Node) {
+	ast.Walk(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			sym := &symbol{name: node.Name.Value, analysis: a, token: node.Name.Token,
+				let: node}
+			a.lets[node] = sym
+			s.declare(sym)
+		case *ast.FunctionLiteral, *ast.NameSpaceLiteral:
+			return false
+		case *ast.TryExpression:
+			a.collect(s, node.Block)
+			if node.Finally != nil {
+				a.collect(s, node.Finally)
+			}
+			return false
+		}
+		return true
+	})
+}
+
+func (s *scope) lookup(name string) *symbol {
+	for ; s != nil; s = s.outer {
+		if sym, ok := s.current[name]; ok {
+			return sym
+		}
+		if sym, ok := s.first[name]; ok {
+			return sym
+		}
+	}
+	return nil
+}
+
+// 環境から見える全ての名前(内側の環境が優先)
+func (s *scope) visible() map[string]*symbol {
+	symbols := make(map[string]*symbol)
+	for ; s != nil; s = s.outer {
+		for name := range s.first {
+			if _, ok := symbols[name]; !ok {
+				symbols[name] = s.member(name)
+			}
+		}
+	}
+	return symbols
+}
+
+// 本体を解析し終えた環境の変数
+func (s *scope) member(name string) *symbol {
+	if sym, ok := s.current[name]; ok {
+		return sym
+	}
+	return s.first[name]
+}
+
+func (s *scope) memberNames() []string {
+	names := []string{}
+	for name := range s.first {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (a *analysis) statements(stmts []ast.Statement, s *scope) {
+	for _, stmt := range stmts {
+		a.node(stmt, s)
+	}
+}
+
+func (a *analysis) node(node ast.Node, s *scope) {
+	ast.Walk(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.Identifier:
+			a.reference(node, s)
+		case *ast.LetStatement:
+			// NOTE: `let x = x + 1`の右辺のxは以前の宣言を指す
+			if node.Value != nil {
+				a.node(node.Value, s)
+			}
+			sym := a.lets[node]
+			if sym == nil {
+				return false
+			}
+			s.current[sym.name] = sym
+			a.addReference(node.Name, &reference{token: node.Name.Token, scope: s,
+				symbol: sym})
+			return false
+		case *ast.FunctionLiteral:
+			inner := a.newScope(s, node.Body.Statements, node.Parameters)
+			for _, param := range node.Parameters {
+				a.addReference(param, &reference{token: param.Token, scope: inner,
+					symbol: inner.current[param.Value]})
+			}
+			a.statements(node.Body.Statements, inner)
+			return false
+		case *ast.NameSpaceLiteral:
+			inner := a.newScope(s, node.Body.Statements, nil)
+			a.namespaces[node] = inner
+			a.statements(node.Body.Statements, inner)
+			return false
+		case *ast.TryExpression:
+			a.node(node.Block, s)
+			if node.Catch != nil {
+				params := []*ast.Identifier{node.Parameter}
+				inner := a.newScope(s, node.Catch.Statements, params)
+				a.addReference(node.Parameter, &reference{token: node.Parameter.Token,
+					scope: inner, symbol: inner.current[node.Parameter.Value]})
+				a.statements(node.Catch.Statements, inner)
+			}
+			if node.Finally != nil {
+				a.node(node.Finally, s)
+			}
+			return false
+		case *ast.InfixExpression:
+			// `ns.x`の右辺は左辺のnamespaceのメンバー
+			if node.Operator == "." || node.Operator == "?." {
+				a.node(node.Left, s)
+				if right, ok := node.Right.(*ast.Identifier); ok {
+					a.addReference(right, &reference{token: right.Token, scope: s,
+						left: node.Left})
+				}
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func (a *analysis) reference(ident *ast.Identifier, s *scope) {
+	sym := s.lookup(ident.Value)
+	if sym == nil {
+		sym = builtinSymbol(ident.Value)
+	}
+	a.addReference(ident, &reference{token: ident.Token, scope: s, symbol: sym})
+}
+
+func (a *analysis) addReference(ident *ast.Identifier, ref *reference) {
+	a.identifiers[ident] = ref
+	a.references = append(a.references, ref)
+}
+
+func builtinSymbol(name string) *symbol {
+	builtin, ok := evaluator.LookupBuiltin(name)
+	if !ok {
+		return nil
+	}
+	return &symbol{name: name, builtin: builtin}
+}
+
+// 参照している宣言(見つからなければnil)
+func (a *analysis) resolve(ref *reference) *symbol {
+	if ref.left == nil {
+		return ref.symbol
+	}
+
+	ns := a.namespaceOf(ref.left, 0)
+	if ns == nil {
+		return nil
+	}
+	return ns.member(ref.token.Literal)
+}
+
+// 循環するimport等で止まらないよう、解決を打ち切る深さ
+const maxResolveDepth = 32
+
+// 式が静的に分かるnamespaceを返す場合、その環境(分からなければnil)
+func (a *analysis) namespaceOf(exp ast.Expression, depth int) *scope {
+	if depth > maxResolveDepth {
+		return nil
+	}
+
+	switch exp := exp.(type) {
+	case *ast.NameSpaceLiteral:
+		return a.namespaces[exp]
+	case *ast.Identifier:
+		ref, ok := a.identifiers[exp]
+		if !ok {
+			return nil
+		}
+		sym := a.resolve(ref)
+		if sym == nil {
+			return nil
+		}
+		return sym.namespace(depth + 1)
+	case *ast.InfixExpression:
+		right, ok := exp.Right.(*ast.Identifier)
+		if !ok || (exp.Operator != "." && exp.Operator != "?.") {
+			return nil
+		}
+		ns := a.namespaceOf(exp.Left, depth+1)
+		if ns == nil {
+			return nil
+		}
+		member := ns.member(right.Value)
+		if member == nil {
+			return nil
+		}
+		return member.namespace(depth + 1)
+	case *ast.CallExpression:
+		imported := a.importedFile(exp)
+		if imported == "" {
+			return nil
+		}
+		if importedAnalysis := a.workspace.analyze(imported); importedAnalysis != nil {
+			return importedAnalysis.top
+		}
+	}
+	return nil
+}
+
+// 変数に束縛されたnamespaceの環境(分からなければnil)
+func (sym *symbol) namespace(depth int) *scope {
+	if sym.let == nil || sym.let.Value == nil {
+		return nil
+	}
+	return sym.analysis.namespaceOf(sym.let.Value, depth)
+}
+
+// `import(path)`で読まれるファイルの絶対パス(静的に分からなければ空文字)
+func (a *analysis) importedFile(call *ast.CallExpression) string {
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok || ident.Value != "import" || len(call.Arguments) != 1 {
+		return ""
+	}
+	if ref := a.identifiers[ident]; ref == nil || ref.symbol == nil ||
+		ref.symbol.builtin == nil {
+		return ""
+	}
+
+	name, ok := a.staticString(call.Arguments[0])
+	if !ok {
+		return ""
+	}
+	fileName := name + ".monkey"
+
+	// NOTE: 評価時と同じく作業ディレクトリ、scriptsディレクトリの順に探し、
+	// 見つからなければ開いているファイルのディレクトリを探す
+	if path, err := evaluator.FindScriptFile(fileName); err == nil {
+		return path
+	}
+	if !filepath.IsAbs(fileName) {
+		path := filepath.Join(filepath.Dir(a.path), fileName)
+		if _, err := readFile(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// 文字列リテラル、THIS_DIR、それらの`+`の値
+func (a *analysis) staticString(exp ast.Expression) (string, bool) {
+	switch exp := exp.(type) {
+	case *ast.StringLiteral:
+		return exp.Value, true
+	case *ast.Identifier:
+		ref := a.identifiers[exp]
+		if exp.Value == "THIS_DIR" && ref != nil && ref.symbol == nil {
+			return filepath.Dir(a.path) + "/", true
+		}
+	case *ast.InfixExpression:
+		if exp.Operator != "+" {
+			return "", false
+		}
+		left, ok := a.staticString(exp.Left)
+		if !ok {
+			return "", false
+		}
+		right, ok := a.staticString(exp.Right)
+		if !ok {
+			return "", false
+		}
+		return left + right, true
+	}
+	return "", false
+}
+
+// 位置にある参照(無ければnil)
+func (a *analysis) referenceAt(pos Position) *reference {
+	for _, ref := range a.references {
+		r := a.source.tokenRange(ref.token)
+		if r.Start.Line == pos.Line && r.Start.Character <= pos.Character &&
+			pos.Character <= r.End.Character {
+			return ref
+		}
+	}
+	return nil
+}
+
+// 宣言の種類(SymbolKind)
+func (sym *symbol) kind() int {
+	switch {
+	case sym.builtin != nil:
+		return SYMBOL_FUNCTION
+	case sym.let == nil:
+		return SYMBOL_VARIABLE
+	}
+
+	if _, ok := sym.let.Value.(*ast.FunctionLiteral); ok {
+		return SYMBOL_FUNCTION
+	}
+	if sym.namespace(0) != nil {
+		return SYMBOL_NAMESPACE
+	}
+	if sym.let.IsConst() {
+		return SYMBOL_CONSTANT
+	}
+	return SYMBOL_VARIABLE
+}
+
+// ホバーで表示する説明(値はInspect()と同様の形式)
+func (sym *symbol) describe() string {
+	switch {
+	case sym.builtin != nil:
+		return sym.name + ": " + sym.builtin.Signature
+	case sym.parameter != nil:
+		return parameterString(sym.parameter) + " (parameter)"
+	case sym.let == nil || sym.let.Value == nil:
+		return sym.name
+	}
+
+	if fn, ok := sym.let.Value.(*ast.FunctionLiteral); ok {
+		return sym.name + ": " + signature(fn)
+	}
+	if ns := sym.namespace(0); ns != nil {
+		return sym.name + ": namespace {" + strings.Join(ns.memberNames(), ", ") + "}"
+	}
+	// NOTE: 入力途中の部分的なASTは子ノードが欠けていて、String()で表示できない
+	if !isComplete(sym.let.Value) {
+		return sym.name
+	}
+	return sym.let.String()
+}
+
+// nodeとその子孫に、欠けている(nilの)子ノードが無いかどうか
+func isComplete(node ast.Node) bool {
+	complete := true
+	ast.Walk(node, func(n ast.Node) bool {
+		complete = complete && !hasMissingChild(n)
+		return complete
+	})
+	return complete
+}
+
+func hasMissingChild(node ast.Node) bool {
+	switch node := node.(type) {
+	case *ast.PrefixExpression:
+		return node.Right == nil
+	case *ast.InfixExpression:
+		return node.Left == nil || node.Right == nil
+	case *ast.IfExpression:
+		return node.Condition == nil || node.Consequence == nil
+	case *ast.TryExpression:
+		return node.Block == nil
+	case *ast.FunctionLiteral:
+		return node.Body == nil
+	case *ast.CallExpression:
+		return node.Function == nil || hasNil(node.Arguments)
+	case *ast.ArrayLiteral:
+		return hasNil(node.Elements)
+	case *ast.IndexExpression:
+		return node.Left == nil || node.Index == nil
+	case *ast.HashLiteral:
+		for _, key := range node.Keys {
+			if key == nil {
+				return true
+			}
+			if _, ok := key.(*ast.SpreadExpression); !ok && node.Pairs[key] == nil {
+				return true
+			}
+		}
+	case *ast.SpreadExpression:
+		return node.Value == nil
+	case *ast.NameSpaceLiteral:
+		return node.Body == nil
+	case *ast.AssignExpression:
+		return node.Target == nil || node.Value == nil
+	}
+	return false
+}
+
+func hasNil(exps []ast.Expression) bool {
+	for _, exp := range exps {
+		if exp == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// 本体を除いた関数リテラル(`fn(x: int, y) -> int`)
+func signature(fn *ast.FunctionLiteral) string {
+	params := []string{}
+	for _, p := range fn.Parameters {
+		params = append(params, parameterString(p))
+	}
+
+	sig := "fn(" + strings.Join(params, ", ") + ")"
+	if fn.ReturnType != nil {
+		sig += " -> " + fn.ReturnType.String()
+	}
+	return sig
+}
+
+func parameterString(param *ast.Identifier) string {
+	if param.Type == nil {
+		return param.Value
+	}
+	return param.Value + ": " + param.Type.String()
+}
+
+// 環境のletをDocumentSymbolにする(namespaceのメンバーは子にする)
+func (a *analysis) documentSymbols(s *scope) []*DocumentSymbol {
+	symbols := []*DocumentSymbol{}
+	for _, sym := range s.symbols {
+		if sym.let == nil {
+			continue
+		}
+
+		r := a.source.tokenRange(sym.token)
+		docSym := &DocumentSymbol{
+			Name:           sym.name,
+			Detail:         strings.TrimPrefix(sym.describe(), sym.name+": "),
+			Kind:           sym.kind(),
+			Range:          r,
+			SelectionRange: r,
+		}
+		if lit, ok := sym.let.Value.(*ast.NameSpaceLiteral); ok {
+			docSym.Children = a.documentSymbols(a.namespaces[lit])
+		}
+		symbols = append(symbols, docSym)
+	}
+	return symbols
+}
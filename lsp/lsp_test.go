@@ -0,0 +1,318 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 入力中のこの文字の位置をカーソルの位置とする(文字自体は取り除く)
+const CURSOR = "|"
+
+const TEST_FILE = "/test/main.monkey"
+
+func newTestServer(input string) (*Server, Position) {
+	offset := strings.Index(input, CURSOR)
+	text := strings.Replace(input, CURSOR, "", 1)
+
+	s := NewServer(nil, ioutil.Discard)
+	s.documents[TEST_FILE] = text
+
+	src := newSource(text)
+	line := strings.Count(text[:offset], "\n")
+	return s, src.position(line, offset-src.offsets[line])
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1; x;", []string{}},
+		{"let x = ;", []string{"0:8-0:9 syntax-error 1: no prefix parse function for ; found"}},
+		{"let x = 1;\nlet y = x +;", []string{"1:11-1:12 syntax-error 1: no prefix parse function for ; found"}},
+		{"let f = fn() { let a = 1; };", []string{"0:19-0:20 unused-variable 2: unused variable: a"}},
+		{"\"a\" - 1;\nfoo;", []string{
+			"0:4-0:5 type-error 1: type mismatch: string - int",
+			"1:0-1:3 undefined-name 1: identifier not found: foo",
+		}},
+		// 列はUTF-16のコード単位
+		{"\"あ\" + foo;", []string{"0:6-0:9 undefined-name 1: identifier not found: foo"}},
+	}
+
+	for _, tt := range tests {
+		diagnostics := Diagnostics(TEST_FILE, tt.input)
+
+		actual := []string{}
+		for _, d := range diagnostics {
+			actual = append(actual, fmt.Sprintf("%d:%d-%d:%d %s %d: %s",
+				d.Range.Start.Line, d.Range.Start.Character,
+				d.Range.End.Line, d.Range.End.Character, d.Code, d.Severity, d.Message))
+		}
+		if strings.Join(actual, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("wrong diagnostics for %q. expected=%q, got=%q",
+				tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestHover(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let add = fn(x: int, y) -> int { x + y }; ad|d(1, 2);", "add: fn(x: int, y) -> int"},
+		{"let add = fn(x: int, y) -> int { |x + y };", "x: int (parameter)"},
+		{"le|n([1])", "len: fn(string | array) -> int"},
+		{"let n: int = 1 + 2; n|;", "let n: int = (1 + 2);"},
+		{"let ns = namespace { let b = 1; let a = fn() { b }; }; n|s;", "ns: namespace {a, b}"},
+		{"let ns = namespace { let a = fn(v) { v }; }; ns.|a(1);", "a: fn(v)"},
+		{"try { 1 } catch (e) { e| }", "e (parameter)"},
+		// 評価順で直前の宣言
+		{"let x = 1; let x = \"a\"; x|;", "let x = a;"},
+		{"let x = 1; let y = x|; let x = 2;", "let x = 1;"},
+		// 見つからない名前、メンバー
+		{"fo|o", ""},
+		{"let ns = namespace {}; ns.fo|o", ""},
+		{"|1 + 2", ""},
+	}
+
+	for _, tt := range tests {
+		s, pos := newTestServer(tt.input)
+		hover := s.hover(TEST_FILE, pos)
+
+		actual := ""
+		if hover != nil {
+			actual = strings.TrimSuffix(
+				strings.TrimPrefix(hover.Contents.Value, "```monkey\n"), "\n```")
+		}
+		if actual != tt.expected {
+			t.Errorf("wrong hover for %q. expected=%q, got=%q",
+				tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monkey-lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	imported := filepath.Join(dir, "person.monkey")
+	script := "let Person = namespace {\n  let new = fn(name) { self() };\n};\n"
+	if err := ioutil.WriteFile(imported, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dir += "/"
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1;\nlet y = x| + 1;", TEST_FILE + " 0:4-0:5"},
+		{"let f = fn(a) {\n  a|\n};", TEST_FILE + " 0:11-0:12"},
+		{"let ns = namespace { let v = 1; };\nns.v|", TEST_FILE + " 0:25-0:26"},
+		{"let a = namespace { let b = namespace { let c = 1; }; };\na.b.c|", TEST_FILE + " 0:44-0:45"},
+		{"let alias = namespace { let v = 1; }; let ns = alias; ns.v|", TEST_FILE + " 0:28-0:29"},
+		// import先のファイル
+		{"let p = import(\"" + dir + "person\");\np.Person.ne|w(\"Tom\")", imported + " 1:6-1:9"},
+		{"import(\"" + dir + "person\").Per|son", imported + " 0:4-0:10"},
+		{"let Person = import(\"" + dir + "person\").Person;\nPerson.ne|w(\"Tom\")", imported + " 1:6-1:9"},
+		// 組み込み関数、解決できない名前
+		{"pu|ts(1)", ""},
+		{"let p = import(\"" + dir + "nothing\");\np.fo|o", ""},
+		{"let f = fn(ns) { ns.fo|o };", ""},
+	}
+
+	for _, tt := range tests {
+		s, pos := newTestServer(tt.input)
+		location := s.definition(TEST_FILE, pos)
+
+		actual := ""
+		if location != nil {
+			r := location.Range
+			actual = fmt.Sprintf("%s %d:%d-%d:%d", uriToPath(location.URI),
+				r.Start.Line, r.Start.Character, r.End.Line, r.End.Character)
+		}
+		if actual != tt.expected {
+			t.Errorf("wrong definition for %q. expected=%q, got=%q",
+				tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	input := `
+let Shapes = namespace {
+  let unit = 1;
+  let area = fn(w, h) { w * h };
+  let Square = namespace { let side = 2; };
+};
+const limit = 10;
+let f = fn() { let inner = 1; inner };
+`
+	s, _ := newTestServer(input + CURSOR)
+	symbols := s.documentSymbols(TEST_FILE)
+
+	var format func(symbols []*DocumentSymbol) string
+	format = func(symbols []*DocumentSymbol) string {
+		out := []string{}
+		for _, sym := range symbols {
+			str := fmt.Sprintf("%s(%d)", sym.Name, sym.Kind)
+			if len(sym.Children) != 0 {
+				str += "{" + format(sym.Children) + "}"
+			}
+			out = append(out, str)
+		}
+		return strings.Join(out, " ")
+	}
+
+	expected := "Shapes(3){unit(13) area(12) Square(3){side(13)}} limit(14) f(12)"
+	if actual := format(symbols); actual != expected {
+		t.Errorf("wrong document symbols. expected=%q, got=%q", expected, actual)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		// namespaceのメンバー(入力途中でパースできない場合も含む)
+		{"let ns = namespace { let area = 1; let add = fn() {}; };\nns.|", []string{"add", "area"}},
+		{"let ns = namespace { let area = 1; let add = fn() {}; };\nns.ar|", []string{"area"}},
+		{"let ns = namespace { let area = 1; };\nlet f = fn() { ns.|ea };", []string{"area"}},
+		{"let ns = namespace { let a = namespace { let b = 1; }; };\nns?.a.|", []string{"b"}},
+		{"let x = 1;\nx.|", []string{}},
+		// 見える変数、組み込み関数
+		{"let first_value = 1; let f = fn(firstArg) { fir| };",
+			[]string{"firstArg", "first_value", "first"}},
+		{"let fn_outer = 1; let f = fn() { let local = 1; }; lo|", []string{}},
+		{"let push = 1; pus|", []string{"push"}},
+	}
+
+	for _, tt := range tests {
+		s, pos := newTestServer(tt.input)
+		items := s.completion(TEST_FILE, pos)
+
+		actual := []string{}
+		for _, item := range items {
+			actual = append(actual, item.Label)
+		}
+		if strings.Join(actual, " ") != strings.Join(tt.expected, " ") {
+			t.Errorf("wrong completion for %q. expected=%q, got=%q",
+				tt.input, tt.expected, actual)
+		}
+	}
+}
+
+// 入力途中(子ノードがnilの部分的なAST)でも失敗しない
+func TestIncompleteInput(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // 最初のシンボルの名前と説明(説明できない場合は名前)
+	}{
+		{"let ns = namespace { let m = fn(x: int) -|", "ns: namespace {m}"},
+		{"let h = {..|", "h: h"},
+		{"let f = fn(x) { x + |", "f: fn(x)"},
+		{"let a = [1, |", "a: let a = [];"},
+		{"let s = -|", "s: s"},
+		{"let c = if (|", "c: c"},
+	}
+
+	for _, tt := range tests {
+		s, pos := newTestServer(tt.input)
+		s.completion(TEST_FILE, pos)
+		s.hover(TEST_FILE, pos)
+
+		symbols := s.documentSymbols(TEST_FILE)
+		if len(symbols) == 0 {
+			t.Errorf("no document symbols for %q", tt.input)
+			continue
+		}
+		if actual := symbols[0].Name + ": " + symbols[0].Detail; actual != tt.expected {
+			t.Errorf("wrong document symbol for %q. expected=%q, got=%q",
+				tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	uri := "file:///test/main.monkey"
+	messages := []string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","method":"initialized","params":{}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":` +
+			`{"uri":"` + uri + `","languageId":"monkey","version":1,"text":"len(1)"}}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"textDocument/hover","params":{"textDocument":` +
+			`{"uri":"` + uri + `"},"position":{"line":0,"character":1}}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"unknown/method","params":{}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	}
+
+	var in bytes.Buffer
+	for _, msg := range messages {
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(msg), msg)
+	}
+	var out bytes.Buffer
+
+	if code := Start(&in, &out); code != 0 {
+		t.Errorf("wrong exit status. expected=0, got=%d", code)
+	}
+
+	expected := []string{
+		`"id":1,"result":{"capabilities"`,
+		`"method":"textDocument/publishDiagnostics","params":{"uri":"` + uri + `"`,
+		`"id":2,"result":{"contents":{"kind":"markdown","value":"` +
+			"```monkey\\nlen: fn(string | array) -\\u003e int\\n```" + `"}`,
+		`"id":3,"error":{"code":-32601,"message":"method not found: unknown/method"}`,
+		`"id":4,"result":null`,
+	}
+
+	responses := []string{}
+	r := bufio.NewReader(&out)
+	for {
+		body, err := readMessage(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("invalid message: %s", err)
+		}
+		var v map[string]interface{}
+		if err := json.Unmarshal(body, &v); err != nil {
+			t.Fatalf("invalid JSON: %s", body)
+		}
+		responses = append(responses, string(body))
+	}
+
+	if len(responses) != len(expected) {
+		t.Fatalf("wrong number of messages. expected=%d, got=%q",
+			len(expected), responses)
+	}
+	for i, e := range expected {
+		if !strings.Contains(responses[i], e) {
+			t.Errorf("wrong message %d. expected to contain %q, got=%q",
+				i, e, responses[i])
+		}
+	}
+}
+
+func TestStartWithoutShutdown(t *testing.T) {
+	msg := `{"jsonrpc":"2.0","method":"exit"}`
+	in := bytes.NewBufferString(fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(msg), msg))
+
+	if code := Start(in, ioutil.Discard); code != 1 {
+		t.Errorf("wrong exit status. expected=1, got=%d", code)
+	}
+}
@@ -0,0 +1,411 @@
+package lsp
+
+import (
+	"../evaluator"
+	"../lexer"
+	"../lint"
+	"../parser"
+	"../typechecker"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// `monkey lsp`: 標準入出力でLSPを話すサーバー
+// 終了ステータスは、shutdownの後にexitで終了すれば0、それ以外は1
+func Start(in io.Reader, out io.Writer) int {
+	s := NewServer(in, out)
+	if err := s.Run(); err != nil {
+		return 1
+	}
+	if !s.shutdown {
+		return 1
+	}
+	return 0
+}
+
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+	// 開かれているファイル(パス→本文)
+	documents map[string]string
+	// 開かれているファイルのURI(クライアントが送った表記のまま)
+	uris     map[string]string
+	shutdown bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		documents: make(map[string]string),
+		uris:      make(map[string]string),
+	}
+}
+
+// exit通知を受けるか、入力が終わるまでメッセージを処理する
+func (s *Server) Run() error {
+	for {
+		body, err := readMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			s.replyError(nil, PARSE_ERROR, err.Error())
+			continue
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+		s.handle(&req)
+	}
+}
+
+// 未知の通知は無視する($/cancelRequest等)
+func (s *Server) handle(req *request) {
+	result, code, err := s.dispatch(req)
+	if req.ID == nil {
+		return
+	}
+	if err != nil {
+		s.replyError(req.ID, code, err.Error())
+		return
+	}
+	writeMessage(s.out, &response{JSONRPC: "2.0", ID: req.ID, Result: result})
+}
+
+func (s *Server) dispatch(req *request) (result interface{}, code int, err error) {
+	// NOTE: 解析中のpanicでサーバーを止めない
+	defer func() {
+		if r := recover(); r != nil {
+			result, code, err = nil, INTERNAL_ERROR, fmt.Errorf("%v", r)
+		}
+	}()
+
+	switch req.Method {
+	case "initialize":
+		return initializeResult(), 0, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, 0, nil
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, INVALID_PARAMS, err
+		}
+		s.open(params.TextDocument.URI, params.TextDocument.Text)
+		return nil, 0, nil
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, INVALID_PARAMS, err
+		}
+		if n := len(params.ContentChanges); n > 0 {
+			s.open(params.TextDocument.URI, params.ContentChanges[n-1].Text)
+		}
+		return nil, 0, nil
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, INVALID_PARAMS, err
+		}
+		s.close(params.TextDocument.URI)
+		return nil, 0, nil
+	case "textDocument/hover":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, INVALID_PARAMS, err
+		}
+		return s.hover(uriToPath(params.TextDocument.URI), params.Position), 0, nil
+	case "textDocument/definition":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, INVALID_PARAMS, err
+		}
+		return s.definition(uriToPath(params.TextDocument.URI), params.Position), 0, nil
+	case "textDocument/documentSymbol":
+		var params documentSymbolParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, INVALID_PARAMS, err
+		}
+		return s.documentSymbols(uriToPath(params.TextDocument.URI)), 0, nil
+	case "textDocument/completion":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, INVALID_PARAMS, err
+		}
+		return s.completion(uriToPath(params.TextDocument.URI), params.Position), 0, nil
+	default:
+		if strings.HasPrefix(req.Method, "$/") || req.ID == nil {
+			return nil, 0, nil
+		}
+		return nil, METHOD_NOT_FOUND, fmt.Errorf("method not found: %s", req.Method)
+	}
+}
+
+func initializeResult() interface{} {
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"textDocumentSync":       1, // 全文を同期
+			"hoverProvider":          true,
+			"definitionProvider":     true,
+			"documentSymbolProvider": true,
+			"completionProvider": map[string]interface{}{
+				"triggerCharacters": []string{"."},
+			},
+		},
+		"serverInfo": map[string]string{"name": "monkey"},
+	}
+}
+
+func (s *Server) replyError(id *json.RawMessage, code int, message string) {
+	writeMessage(s.out, &errorResponse{JSONRPC: "2.0", ID: id,
+		Error: &responseError{Code: code, Message: message}})
+}
+
+func (s *Server) notify(method string, params interface{}) {
+	writeMessage(s.out, &notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *Server) open(uri string, text string) {
+	path := uriToPath(uri)
+	s.documents[path] = text
+	s.uris[path] = uri
+	s.notify("textDocument/publishDiagnostics", &publishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: Diagnostics(path, text),
+	})
+}
+
+func (s *Server) close(uri string) {
+	path := uriToPath(uri)
+	delete(s.documents, path)
+	delete(s.uris, path)
+	s.notify("textDocument/publishDiagnostics", &publishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: []*Diagnostic{},
+	})
+}
+
+func (s *Server) uriOf(path string) string {
+	if uri, ok := s.uris[path]; ok {
+		return uri
+	}
+	return pathToURI(path)
+}
+
+// 開かれているファイルを解析する(開かれていなければnil)
+func (s *Server) analyze(path string) *analysis {
+	text, ok := s.documents[path]
+	if !ok {
+		return nil
+	}
+	return newWorkspace(s.documents).analyzeSource(path, text)
+}
+
+// 構文エラー、lint、型検査の問題(評価はしない)
+func Diagnostics(path string, text string) []*Diagnostic {
+	p := parser.New(lexer.New(text))
+	program := p.ParseProgram()
+
+	var found []*lint.Diagnostic
+	if len(p.Errors()) != 0 {
+		found = lint.LintSource(text, path)
+	} else {
+		found = append(lint.Lint(program, path), typechecker.Check(program, path)...)
+		sort.SliceStable(found, func(i, j int) bool {
+			a, b := found[i], found[j]
+			if a.Line != b.Line {
+				return a.Line < b.Line
+			}
+			return a.Column < b.Column
+		})
+	}
+
+	src := newSource(text)
+	diagnostics := []*Diagnostic{}
+	for _, d := range found {
+		severity := SEVERITY_WARNING
+		switch d.Rule {
+		case lint.SYNTAX_ERROR, lint.UNDEFINED_NAME, typechecker.TYPE_ERROR:
+			severity = SEVERITY_ERROR
+		}
+
+		// NOTE: 位置が分からないものは、ファイルの先頭に表示する
+		var r Range
+		if d.Line == 0 {
+			r = src.wordRange(0, 0)
+		} else {
+			r = src.wordRange(d.Line-1, d.Column-1)
+		}
+
+		diagnostics = append(diagnostics, &Diagnostic{
+			Range:    r,
+			Severity: severity,
+			Code:     d.Rule,
+			Source:   "monkey",
+			Message:  d.Message,
+		})
+	}
+	return diagnostics
+}
+
+func (s *Server) hover(path string, pos Position) *Hover {
+	a := s.analyze(path)
+	if a == nil {
+		return nil
+	}
+	ref := a.referenceAt(pos)
+	if ref == nil {
+		return nil
+	}
+	sym := a.resolve(ref)
+	if sym == nil {
+		return nil
+	}
+
+	return &Hover{
+		Contents: markupContent{
+			Kind:  "markdown",
+			Value: "```monkey\n" + sym.describe() + "\n```",
+		},
+		Range: a.source.tokenRange(ref.token),
+	}
+}
+
+// 宣言の位置(組み込み関数、見つからない場合はnil)
+func (s *Server) definition(path string, pos Position) *Location {
+	a := s.analyze(path)
+	if a == nil {
+		return nil
+	}
+	ref := a.referenceAt(pos)
+	if ref == nil {
+		return nil
+	}
+	sym := a.resolve(ref)
+	if sym == nil || sym.analysis == nil {
+		return nil
+	}
+
+	return &Location{
+		URI:   s.uriOf(sym.analysis.path),
+		Range: sym.analysis.source.tokenRange(sym.token),
+	}
+}
+
+func (s *Server) documentSymbols(path string) []*DocumentSymbol {
+	a := s.analyze(path)
+	if a == nil {
+		return []*DocumentSymbol{}
+	}
+	return a.documentSymbols(a.top)
+}
+
+// 補完中の語の代わりに置く識別子
+const completionMarker = "__monkey_completion__"
+
+// `ns.`の後ではnamespaceのメンバー、それ以外では見える変数と組み込み関数
+func (s *Server) completion(path string, pos Position) []*CompletionItem {
+	text, ok := s.documents[path]
+	if !ok {
+		return []*CompletionItem{}
+	}
+
+	// NOTE: 入力途中の文("ns."等)はパースできないため、
+	// 補完中の語(カーソルの後ろも含む)を識別子に置き換えてから解析する
+	src := newSource(text)
+	offset := src.offset(pos)
+	start := offset
+	for start > 0 && isIdentifierChar(text[start-1]) {
+		start--
+	}
+	end := offset
+	for end < len(text) && isIdentifierChar(text[end]) {
+		end++
+	}
+	prefix := text[start:offset]
+	a := newWorkspace(s.documents).analyzeSource(path,
+		text[:start]+completionMarker+text[end:])
+
+	var marker *reference
+	for _, ref := range a.references {
+		if ref.token.Literal == completionMarker {
+			marker = ref
+			break
+		}
+	}
+
+	items := []*CompletionItem{}
+	if marker != nil && marker.left != nil {
+		ns := a.namespaceOf(marker.left, 0)
+		if ns == nil {
+			return items
+		}
+		for _, name := range ns.memberNames() {
+			if strings.HasPrefix(name, prefix) {
+				items = append(items, completionItem(ns.member(name)))
+			}
+		}
+		return items
+	}
+	if strings.HasSuffix(text[:start], ".") {
+		return items
+	}
+
+	s.completeNames(&items, a, marker, prefix)
+	return items
+}
+
+func (s *Server) completeNames(items *[]*CompletionItem, a *analysis,
+	marker *reference, prefix string) {
+
+	sc := a.top
+	if marker != nil {
+		sc = marker.scope
+	}
+
+	visible := sc.visible()
+	names := []string{}
+	for name := range visible {
+		if name != completionMarker && strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		*items = append(*items, completionItem(visible[name]))
+	}
+
+	for _, name := range evaluator.BuiltinNames() {
+		if _, ok := visible[name]; !ok && strings.HasPrefix(name, prefix) {
+			*items = append(*items, completionItem(builtinSymbol(name)))
+		}
+	}
+}
+
+func completionItem(sym *symbol) *CompletionItem {
+	kind := COMPLETION_VARIABLE
+	switch sym.kind() {
+	case SYMBOL_FUNCTION:
+		kind = COMPLETION_FUNCTION
+	case SYMBOL_NAMESPACE:
+		kind = COMPLETION_MODULE
+	case SYMBOL_CONSTANT:
+		kind = COMPLETION_CONSTANT
+	}
+
+	return &CompletionItem{
+		Label:  sym.name,
+		Kind:   kind,
+		Detail: strings.TrimPrefix(sym.describe(), sym.name+": "),
+	}
+}
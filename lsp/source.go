@@ -0,0 +1,120 @@
+package lsp
+
+import (
+	"../token"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// NOTE: tokenの位置は1始まりの行、バイト単位の列
+// LSPの位置は0始まりの行、UTF-16のコード単位の列
+type source struct {
+	text  string
+	lines []string
+	// 各行の先頭のバイト位置
+	offsets []int
+}
+
+func newSource(text string) *source {
+	src := &source{text: text, lines: strings.Split(text, "\n")}
+	offset := 0
+	for _, line := range src.lines {
+		src.offsets = append(src.offsets, offset)
+		offset += len(line) + 1
+	}
+	return src
+}
+
+// 行、バイト単位の列(共に0始まり)をLSPの位置に変換
+func (src *source) position(line int, column int) Position {
+	if line < 0 || line >= len(src.lines) {
+		return Position{Line: line}
+	}
+	text := src.lines[line]
+	if column > len(text) {
+		column = len(text)
+	}
+	return Position{Line: line, Character: utf16Length(text[:column])}
+}
+
+// LSPの位置を本文のバイト位置に変換(行末、本文の末尾を超える場合は切り詰める)
+func (src *source) offset(pos Position) int {
+	if pos.Line >= len(src.lines) {
+		return len(src.text)
+	}
+	if pos.Line < 0 {
+		return 0
+	}
+
+	text := src.lines[pos.Line]
+	units := 0
+	for i, r := range text {
+		if units >= pos.Character {
+			return src.offsets[pos.Line] + i
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return src.offsets[pos.Line] + len(text)
+}
+
+// tokenの範囲(識別子等、リテラルがそのまま書かれたtokenのみ正確)
+func (src *source) tokenRange(tok token.Token) Range {
+	start := src.position(tok.Line-1, tok.Column-1)
+	end := src.position(tok.Line-1, tok.Column-1+len(tok.Literal))
+	return Range{Start: start, End: end}
+}
+
+// 位置から始まる語の範囲(語が無ければ1文字)
+func (src *source) wordRange(line int, column int) Range {
+	if line < 0 || line >= len(src.lines) {
+		return Range{}
+	}
+
+	text := src.lines[line]
+	end := column
+	for end < len(text) && isIdentifierChar(text[end]) {
+		end++
+	}
+	if end == column && end < len(text) {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+	return Range{Start: src.position(line, column), End: src.position(line, end)}
+}
+
+func utf16Length(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+func isIdentifierChar(ch byte) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+}
+
+func readFile(path string) (string, error) {
+	script, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(script), nil
+}
+
+// file URIをパスに変換(fileスキーマ以外はそのまま)
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return u.Path
+}
+
+func pathToURI(path string) string {
+	// "untitled:..."等、ファイルでないドキュメント
+	// (Windowsのドライブ名"C:"はスキーマとみなさない)
+	if u, err := url.Parse(path); err == nil && len(u.Scheme) > 1 {
+		return path
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
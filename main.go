@@ -1,22 +1,134 @@
 package main
 
 import (
+	"./conformance"
+	"./coverage"
+	"./debugger"
+	"./evaluator"
+	"./lint"
+	"./lsp"
+	"./object"
+	"./optimizer"
+	"./profiler"
 	"./repl"
 	"./runscript"
+	"./testrunner"
+	"./typechecker"
+	"./vm"
 	"flag"
 	"fmt"
 	"os"
 	"os/user"
+	"path/filepath"
+	"strings"
 )
 
 var (
 	scriptFileName = flag.String("f", "",
 		"monkey script file name to run (run REPL instead if empty)")
+	strictMode = flag.Bool("strict", false,
+		"warn when let shadows builtin functions or imported namespaces")
+	maxCallDepth = flag.Int("max-depth", evaluator.MaxCallDepth,
+		"maximum depth of nested function calls (no limit if <= 0)")
+	engine = flag.String("engine", "eval",
+		"execution engine: eval (tree-walking evaluator) or vm (bytecode virtual machine)")
+	optimize = flag.Bool("optimize", false,
+		"fold constants and remove dead code before evaluation")
+	differential = flag.Int("differential", 0,
+		"run the given number of random programs by eval and vm and compare the results")
+	seed  = flag.Int64("seed", 1, "random seed of -differential")
+	debug = flag.Bool("debug", false,
+		"run the script file given by -f in the debugger (eval engine only)")
+	profile = flag.String("profile", "",
+		"profile the script file given by -f and write folded stacks to the given file (eval engine only)")
+	cover = flag.String("cover", "",
+		"measure coverage of the script file given by -f and write the report to the given file (.html or text, eval engine only)")
 )
 
 func main() {
+	// サブコマンド
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "lint":
+			os.Exit(runDiagnostics("lint", os.Args[2:], lint.LintFile))
+		case "check":
+			os.Exit(runDiagnostics("check", os.Args[2:], typechecker.CheckFile))
+		case "lsp":
+			os.Exit(lsp.Start(os.Stdin, os.Stdout))
+		case "test":
+			os.Exit(runTests(os.Args[2:]))
+		}
+	}
+
 	flag.Parse()
 
+	evaluator.StrictMode = *strictMode
+	evaluator.MaxCallDepth = *maxCallDepth
+
+	if *differential > 0 {
+		runDifferential(*differential, *seed)
+		return
+	}
+
+	var eval evaluator.EvalFunc
+	switch *engine {
+	case "eval":
+		eval = evaluator.Eval
+	case "vm":
+		eval = vm.Eval
+	default:
+		fmt.Fprintf(os.Stderr, "unknown engine: %s\n", *engine)
+		os.Exit(2)
+	}
+	if err := checkStrictMode(*engine, *strictMode); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if *optimize {
+		eval = optimizer.Wrap(eval)
+	}
+	repl.Eval = eval
+	runscript.EvalScriptFile = func(fileName string) (*object.Environment, error) {
+		return evaluator.EvalScriptFileWith(fileName, eval)
+	}
+
+	if *debug {
+		if *scriptFileName == "" || *engine != "eval" {
+			fmt.Fprintln(os.Stderr, "-debug requires -f and -engine eval")
+			os.Exit(2)
+		}
+		debugger.RunScript(*scriptFileName, os.Stdin, os.Stdout)
+		return
+	}
+
+	if *profile != "" {
+		if *scriptFileName == "" || *engine != "eval" {
+			fmt.Fprintln(os.Stderr, "-profile requires -f and -engine eval")
+			os.Exit(2)
+		}
+		// NOTE: スクリプトの出力と混ざらないよう、レポートは標準エラー出力に書く
+		err := profiler.RunScript(*scriptFileName, *profile, os.Stdout, os.Stderr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *cover != "" {
+		if *scriptFileName == "" || *engine != "eval" {
+			fmt.Fprintln(os.Stderr, "-cover requires -f and -engine eval")
+			os.Exit(2)
+		}
+		err := coverage.RunScript(*scriptFileName, *cover, os.Stdout, os.Stderr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if *scriptFileName != "" {
 		runScriptFile(*scriptFileName)
 	} else {
@@ -24,6 +136,15 @@ func main() {
 	}
 }
 
+// NOTE: strict modeの警告は評価器(evaluator)のみが出すため、vmでは使えない
+// (警告が出ないまま実行されないよう、エラーにする)
+func checkStrictMode(engine string, strict bool) error {
+	if strict && engine != "eval" {
+		return fmt.Errorf("-strict requires -engine eval")
+	}
+	return nil
+}
+
 func runRepl() {
 	user, err := user.Current()
 	if err != nil {
@@ -31,10 +152,144 @@ func runRepl() {
 	}
 	fmt.Printf("Hello %s! This is the Monkey programming language!\n",
 		user.Username)
-	fmt.Printf("Feel free to type in commands\n")
+	fmt.Printf("Feel free to type in commands (:help for REPL commands)\n")
 	repl.Start(os.Stdin, os.Stdout)
 }
 
 func runScriptFile(fileName string) {
 	runscript.RunScript(fileName, os.Stdout)
 }
+
+func runDifferential(count int, seed int64) {
+	mismatches := conformance.Differential(conformance.Evaluator, conformance.VM,
+		seed, count)
+	for _, m := range mismatches {
+		fmt.Printf("%s\n\n", m)
+	}
+
+	fmt.Printf("%d programs (seed %d), %d mismatches\n", count, seed, len(mismatches))
+	if len(mismatches) > 0 {
+		os.Exit(1)
+	}
+}
+
+// `monkey lint [-json] file_or_dir...`, `monkey check [-json] file_or_dir...`
+// 終了ステータスは、問題が無ければ0、問題があれば1、ファイルを読めなければ2
+func runDiagnostics(command string, args []string,
+	analyze func(fileName string) ([]*lint.Diagnostic, error)) int {
+
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	jsonOutput := flags.Bool("json", false, "output diagnostics in JSON")
+	flags.Parse(args)
+
+	fileNames, err := scriptFiles(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	diagnostics := []*lint.Diagnostic{}
+	for _, fileName := range fileNames {
+		found, err := analyze(fileName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		diagnostics = append(diagnostics, found...)
+	}
+
+	if *jsonOutput {
+		lint.WriteJSON(os.Stdout, diagnostics)
+	} else {
+		lint.WriteText(os.Stdout, diagnostics)
+	}
+
+	if len(diagnostics) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// `monkey test [-format text|tap|junit] [-v] [-cover file] [file_or_dir...]`
+// 終了ステータスは、全てのテストが成功すれば0、失敗があれば1、ファイルが無ければ2
+func runTests(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	format := flags.String("format", "text", "output format: text, tap or junit")
+	verbose := flags.Bool("v", false, "print passed tests too (text format)")
+	cover := flags.String("cover", "",
+		"measure coverage of the tests and write the report to the given file (.html or text)")
+	flags.Parse(args)
+
+	fileNames, err := testrunner.Discover(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if len(fileNames) == 0 {
+		fmt.Fprintln(os.Stderr, "no test files found")
+		return 2
+	}
+
+	var c *coverage.Coverage
+	if *cover != "" {
+		c = coverage.New()
+		c.Start()
+	}
+	results := testrunner.Run(fileNames)
+	if c != nil {
+		c.Stop()
+		if err := c.WriteReports(*cover, os.Stderr); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+
+	switch *format {
+	case "text":
+		err = testrunner.WriteText(os.Stdout, results, *verbose)
+	case "tap":
+		err = testrunner.WriteTAP(os.Stdout, results)
+	case "junit":
+		err = testrunner.WriteJUnit(os.Stdout, results)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown format: %s\n", *format)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	if _, failed := testrunner.Count(results); failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// 引数のファイル(ディレクトリの場合は中の*.monkey)
+func scriptFiles(paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no script files given")
+	}
+
+	fileNames := []string{}
+	for _, path := range paths {
+		err := filepath.Walk(path, func(fileName string, info os.FileInfo,
+			err error) error {
+
+			if err != nil {
+				return err
+			}
+			// NOTE: 引数で直接指定されたファイルは拡張子によらず含める
+			if !info.IsDir() &&
+				(fileName == path || strings.HasSuffix(fileName, ".monkey")) {
+				fileNames = append(fileNames, fileName)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fileNames, nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCheckStrictMode(t *testing.T) {
+	tests := []struct {
+		engine   string
+		strict   bool
+		expected string
+	}{
+		{"eval", true, ""},
+		{"eval", false, ""},
+		{"vm", false, ""},
+		{"vm", true, "-strict requires -engine eval"},
+	}
+
+	for _, tt := range tests {
+		err := checkStrictMode(tt.engine, tt.strict)
+		actual := ""
+		if err != nil {
+			actual = err.Error()
+		}
+		if actual != tt.expected {
+			t.Errorf("wrong error for -engine %s -strict=%t. expected=%q, got=%q",
+				tt.engine, tt.strict, tt.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package object
+
+import (
+	"../ast"
+	"../code"
+	"fmt"
+)
+
+// NOTE: 以下はvm(バイトコードの実行エンジン)でのみ使用
+
+const (
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	CELL_OBJ              = "CELL"
+)
+
+// ソース上の位置(エラーの発生位置、トレースバックの表示用)
+// [Start, End)の範囲の命令がLine, Columnの文(または関数呼び出し)に対応する
+type SourceRange struct {
+	Start, End   int
+	Line, Column int
+}
+
+// 内側の関数に捕捉される変数の場所
+type FreeSource struct {
+	Name   string
+	IsFree bool // trueなら外側の関数の捕捉した変数、falseならCell
+	Index  int
+}
+
+type CompiledFunction struct {
+	Instructions code.Instructions
+	// 定数プール(コンパイル単位ごとに共有)
+	Constants []Object
+	// 局所変数の数(引数を含む)
+	NumLocals     int
+	NumParameters int
+	// 局所変数をスタックではなくEnvironmentに束縛する
+	// (self()等で環境が参照される場合)
+	Dynamic        bool
+	ParameterNames []string
+	LocalNames     []string
+	CellSlots      []int // 内側の関数に捕捉される局所変数
+	FreeSources    []FreeSource
+	// 関数リテラル(トップレベル、namespaceの本体はnil)
+	Literal *ast.FunctionLiteral
+
+	Statements []SourceRange
+	Calls      []SourceRange
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// 命令の位置ipを含む最も内側の範囲(見つからなければnil)
+// NOTE: 内側の文は外側の文より後に追加される
+func FindSourceRange(ranges []SourceRange, ip int) *SourceRange {
+	for i := len(ranges) - 1; i >= 0; i-- {
+		if ranges[i].Start <= ip && ip < ranges[i].End {
+			return &ranges[i]
+		}
+	}
+	return nil
+}
+
+// クロージャから参照される局所変数
+// (クロージャ生成後に束縛された値も参照できるよう、値ではなくCellを共有する)
+type Cell struct {
+	Value Object
+}
+
+func (c *Cell) Type() ObjectType { return CELL_OBJ }
+func (c *Cell) Inspect() string  { return fmt.Sprintf("Cell[%p]", c) }
+
+// NOTE: Functionと同様、Envは関数が作られたときの環境
+// (コンパイル時に解決できない変数はEnvから探す)
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []*Cell
+	Env  *Environment
+	// 最初にletで束縛された変数名(トレースバック用、無名関数は空文字)
+	Name string
+}
+
+func (c *Closure) DisplayName() string {
+	if c.Name == "" {
+		return ANONYMOUS_FUNCTION_NAME
+	}
+	return c.Name
+}
+
+// NOTE: 評価器(Function)と同じ値に見えるよう、型と表示を揃える
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string {
+	return inspectFunction(c.Fn.Literal.Parameters, c.Fn.Literal.Body)
+}
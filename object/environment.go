@@ -1,40 +1,129 @@
 package object
 
 import (
+	"../ast"
 	"bytes"
 	"fmt"
+	"sort"
 	"strings"
 )
 
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s}
+	c := make(map[string]bool)
+	return &Environment{store: s, consts: c}
 }
 
 type Environment struct {
 	store map[string]Object
+	// constで宣言された変数名(再宣言、再代入不可)
+	consts map[string]bool
 	// 内部のenvironmentに存在しない束縛は、外側のenvironmentを参照する
 	outer *Environment
+
+	// resolverが静的に解決した変数(scope.Namesの順、束縛前はnil)
+	// scopeに無い変数(self()で得たnamespaceへの代入等)はstoreに束縛する
+	scope *ast.Scope
+	slots []Object
+	// outerが宣言時の外側の環境ではない(namespace経由で参照された関数の呼び出し)
+	dynamicOuter bool
+
+	// 評価器が評価ごとに持つ状態(コールスタック等、中身は評価器が決める)
+	// NOTE: 内側の環境は外側の環境のものを引き継ぐ
+	evaluation interface{}
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
-	obj, ok := e.store[name]
+	if obj, ok := e.getLocal(name); ok {
+		return obj, ok
+	}
 	// 内部のenvironmentに存在しない束縛は、外側のenvironmentを参照する
-	if !ok && e.outer != nil {
-		obj, ok = e.outer.Get(name)
+	if e.outer != nil {
+		return e.outer.Get(name)
+	}
+	return nil, false
+}
+
+func (e *Environment) getLocal(name string) (Object, bool) {
+	if e.scope != nil {
+		if slot, ok := e.scope.Slots[name]; ok {
+			obj := e.slots[slot]
+			return obj, obj != nil
+		}
 	}
+	obj, ok := e.store[name]
 	return obj, ok
 }
 
+// depth個外側の環境のslot番目の変数(resolverが解決したnameの束縛)
+func (e *Environment) GetSlot(depth, slot int, name string) (Object, bool) {
+	env := e
+	for i := 0; i < depth; i++ {
+		// NOTE: 静的に宣言されていない束縛(self(), outer()で得たnamespaceへの代入)が優先
+		if len(env.store) != 0 {
+			if obj, ok := env.store[name]; ok {
+				return obj, true
+			}
+		}
+		if env.dynamicOuter {
+			return env.outer.Get(name)
+		}
+		env = env.outer
+	}
+
+	if obj := env.slots[slot]; obj != nil {
+		return obj, true
+	}
+	// 束縛される前(評価されなかったifの中のlet等)は外側を名前で探す
+	if env.outer != nil {
+		return env.outer.Get(name)
+	}
+	return nil, false
+}
+
 func (e *Environment) Set(name string, val Object) Object {
+	if e.scope != nil {
+		if slot, ok := e.scope.Slots[name]; ok {
+			e.slots[slot] = val
+			return val
+		}
+	}
+	// NOTE: スロットを持つ環境のstoreは必要になるまで作らない
+	if e.store == nil {
+		e.store = make(map[string]Object)
+	}
 	e.store[name] = val
 	return val
 }
 
+func (e *Environment) SetSlot(slot int, val Object) Object {
+	e.slots[slot] = val
+	return val
+}
+
+func (e *Environment) SetConst(name string, val Object) Object {
+	if e.consts == nil {
+		e.consts = make(map[string]bool)
+	}
+	e.consts[name] = true
+	return e.Set(name, val)
+}
+
+// NOTE: 外側のenvironmentは調べない
+// (内側のスコープでは同名の変数を新たに宣言できる)
+func (e *Environment) IsConst(name string) bool {
+	return e.consts[name]
+}
+
 func (e *Environment) Inspect() string {
+	return e.inspect(map[Object]bool{})
+}
+
+func (e *Environment) inspect(visiting map[Object]bool) string {
 	var out bytes.Buffer
 	pairs := []string{}
-	for k, v := range e.store {
+	for _, k := range e.Names() {
+		v, _ := e.getLocal(k)
 		// NOTE: 下記の問題を回避するため、namespace内のnamespaceは略記する
 		// namespaceをそのまま表示すると自己参照で無限ループ
 		// `namespace { let ns = self(); };`
@@ -44,7 +133,7 @@ func (e *Environment) Inspect() string {
 			pairs = append(pairs, fmt.Sprintf("%s: namespace {...}", k))
 		default:
 			// 束縛されたobjectをinspect
-			pairs = append(pairs, fmt.Sprintf("%s: %s", k, v.Inspect()))
+			pairs = append(pairs, fmt.Sprintf("%s: %s", k, inspect(v, visiting)))
 		}
 	}
 
@@ -55,14 +144,65 @@ func (e *Environment) Inspect() string {
 	return out.String()
 }
 
+// 束縛されている変数名(外側のenvironmentは含まない、辞書順)
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store)+len(e.slots))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	for slot, obj := range e.slots {
+		if obj != nil {
+			names = append(names, e.scope.Names[slot])
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 // 組み込み関数outer()の評価に必要なためgetterとして追加
 func (e *Environment) Outer() *Environment {
 	return e.outer
 }
 
+// 評価器が評価中の状態を取り出すためのgetter
+func (e *Environment) Evaluation() interface{} {
+	return e.evaluation
+}
+
+// NOTE: 関数呼び出しの環境は、宣言時ではなく呼び出し元の評価の状態に差し替える
+func (e *Environment) SetEvaluation(evaluation interface{}) {
+	e.evaluation = evaluation
+}
+
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	// 関数内等のローカルな名前空間を返す
 	env := NewEnvironment()
 	env.outer = outer
+	if outer != nil {
+		env.evaluation = outer.evaluation
+	}
+	return env
+}
+
+// resolverが解決した変数をスロットに置く環境
+// (dynamicOuterの場合、外側の変数は名前で探す)
+func NewScopedEnvironment(outer *Environment, scope *ast.Scope,
+	dynamicOuter bool) *Environment {
+
+	if scope == nil {
+		env := NewEnclosedEnvironment(outer)
+		env.dynamicOuter = dynamicOuter
+		return env
+	}
+
+	env := &Environment{
+		outer:        outer,
+		scope:        scope,
+		slots:        make([]Object, len(scope.Names)),
+		dynamicOuter: dynamicOuter,
+	}
+	if outer != nil {
+		env.evaluation = outer.evaluation
+	}
 	return env
 }
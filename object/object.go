@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"sort"
 	"strings"
 )
 
@@ -31,6 +32,7 @@ const (
 	BOOLEAN_OBJ      = "BOOLEAN"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	TAIL_CALL_OBJ    = "TAIL_CALL"
 	ERROR_OBJ        = "ERROR"
 	FUNCTION_OBJ     = "FUNCTION"
 	STRING_OBJ       = "STRING"
@@ -86,15 +88,98 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+// 末尾呼び出し(呼び出し元のapplyFunctionに戻ってから関数を呼び出す)
+// NOTE: ReturnValue同様、評価途中でのみ使用しユーザーからは見えない
+type TailCall struct {
+	Function  *Function
+	Arguments []Object
+}
+
+func (tc *TailCall) Type() ObjectType { return TAIL_CALL_OBJ }
+func (tc *TailCall) Inspect() string  { return "tail call of " + tc.Function.DisplayName() }
+
 // NOTE: ErrorはReturnValueのように使う
 // (エラーもreturnも「その先の評価を中断し脱出」という点で同じ)
 type Error struct {
 	Message string
+	// throwで投げられた値(組み込みのエラーはnil)
+	Value Object
+	// エラーが発生した位置(未設定の場合Lineは0)
+	Line   int
+	Column int
+	File   string
+	// 評価を打ち切った原因(キャンセル、上限超過)
+	// nilでない場合、tryでcatchできない
+	Cause error
+	// エラー発生時の関数呼び出し(外側から順に並ぶ、最後の要素がエラーの発生位置)
+	// 関数呼び出しの外で発生したエラーはnil
+	Trace []TraceFrame
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
 
+// トレースバックの1行分(関数名と、その関数内で評価中だった位置)
+type TraceFrame struct {
+	Function string
+	File     string
+	Line     int
+}
+
+func (tf *TraceFrame) String() string {
+	if tf.File == "" {
+		return fmt.Sprintf("at %s (line %d)", tf.Function, tf.Line)
+	}
+	return fmt.Sprintf("at %s (%s:%d)", tf.Function, tf.File, tf.Line)
+}
+
+const TOPLEVEL_FUNCTION_NAME = "<main>"
+
+func (e *Error) Traceback() string {
+	trace := e.Trace
+	// 関数呼び出しの外で発生したエラーは発生位置のみ表示
+	if trace == nil {
+		if e.Line == 0 {
+			return ""
+		}
+		trace = []TraceFrame{
+			{Function: TOPLEVEL_FUNCTION_NAME, File: e.File, Line: e.Line},
+		}
+	}
+
+	var out bytes.Buffer
+	out.WriteString("traceback (most recent call last):\n")
+
+	// NOTE: 再帰呼び出しで同じ行が続く場合は省略
+	repeated := 0
+	for i, frame := range trace {
+		if i > 0 && frame == trace[i-1] {
+			repeated++
+			if repeated >= MAX_REPEATED_TRACE_FRAMES {
+				continue
+			}
+		} else {
+			writeOmittedTraceFrames(&out, repeated)
+			repeated = 0
+		}
+		out.WriteString("    " + frame.String() + "\n")
+	}
+	writeOmittedTraceFrames(&out, repeated)
+
+	return out.String()
+}
+
+// トレースバックで同じ行を続けて表示する数
+const MAX_REPEATED_TRACE_FRAMES = 3
+
+func writeOmittedTraceFrames(out *bytes.Buffer, repeated int) {
+	if repeated < MAX_REPEATED_TRACE_FRAMES {
+		return
+	}
+	out.WriteString(fmt.Sprintf("    ... (previous line repeated %d more times)\n",
+		repeated-MAX_REPEATED_TRACE_FRAMES+1))
+}
+
 // EnvをFunctionのフィールドにしたのは、クロージャを実現するため
 // (Envに入るのは関数が作られたときの、この関数のすぐ外側の名前空間。
 // そのため、関数outer内で関数innerを生成すると、inner内ではouterの束縛は
@@ -103,14 +188,33 @@ type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	// 最初にletで束縛された変数名(トレースバック用、無名関数は空文字)
+	Name string
+	// 引数と本体で宣言される変数(resolverが設定)
+	Scope *ast.Scope
+	// Envが宣言時の環境から変更された(namespace経由で参照された)
+	Rebound bool
+}
+
+const ANONYMOUS_FUNCTION_NAME = "<anonymous>"
+
+func (f *Function) DisplayName() string {
+	if f.Name == "" {
+		return ANONYMOUS_FUNCTION_NAME
+	}
+	return f.Name
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
 func (f *Function) Inspect() string {
+	return inspectFunction(f.Parameters, f.Body)
+}
+
+func inspectFunction(parameters []*ast.Identifier, body *ast.BlockStatement) string {
 	var out bytes.Buffer
 
 	params := []string{}
-	for _, p := range f.Parameters {
+	for _, p := range parameters {
 		params = append(params, p.String())
 	}
 
@@ -118,7 +222,7 @@ func (f *Function) Inspect() string {
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") {\n")
-	out.WriteString(f.Body.String())
+	out.WriteString(body.String())
 	out.WriteString("\n}")
 
 	return out.String()
@@ -155,7 +259,11 @@ func (s *String) HashKey() HashKey {
 type BuiltinFunction func(env *Environment, args ...Object) Object
 
 type Builtin struct {
-	Fn BuiltinFunction
+	// builtinsに登録した名前(評価器が設定する)
+	Name string
+	Fn   BuiltinFunction
+	// 型注釈の構文で書いた引数、戻り値の型(型検査用、`fn(string | array) -> int`)
+	Signature string
 }
 
 func (b *Builtin) Type() ObjectType { return BUILDIN_OBJ }
@@ -167,11 +275,23 @@ type Array struct {
 
 func (a *Array) Type() ObjectType { return ARRAY_OBJ }
 func (a *Array) Inspect() string {
+	return a.inspect(map[Object]bool{})
+}
+
+// NOTE: 自身を含む配列、ハッシュ(`a[0] = a`)は無限ループするため、
+// 表示中のobject(visiting)に再び出会ったら略記する
+func (a *Array) inspect(visiting map[Object]bool) string {
+	if visiting[a] {
+		return "[...]"
+	}
+	visiting[a] = true
+	defer delete(visiting, a)
+
 	var out bytes.Buffer
 	elements := []string{}
 
 	for _, e := range a.Elements {
-		elements = append(elements, e.Inspect())
+		elements = append(elements, inspect(e, visiting))
 	}
 
 	out.WriteString("[")
@@ -194,11 +314,21 @@ type Hash struct {
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
 func (h *Hash) Inspect() string {
+	return h.inspect(map[Object]bool{})
+}
+
+func (h *Hash) inspect(visiting map[Object]bool) string {
+	if visiting[h] {
+		return "{...}"
+	}
+	visiting[h] = true
+	defer delete(visiting, h)
+
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for _, pair := range h.Pairs {
-		pairs = append(pairs, pair.Key.Inspect()+": "+pair.Value.Inspect())
+	for _, pair := range h.SortedPairs() {
+		pairs = append(pairs, pair.Key.Inspect()+": "+inspect(pair.Value, visiting))
 	}
 
 	out.WriteString("{")
@@ -208,15 +338,63 @@ func (h *Hash) Inspect() string {
 	return out.String()
 }
 
+// keyの順に並べたペア(表示順を固定するため)
+// NOTE: keyの型(BOOLEAN, INTEGER, STRINGの順)、値の順に並べる
+func (h *Hash) SortedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return lessKey(pairs[i].Key, pairs[j].Key)
+	})
+	return pairs
+}
+
+func lessKey(a, b Object) bool {
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value < b.(*Integer).Value
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	default:
+		return a.Inspect() < b.Inspect()
+	}
+}
+
 type NameSpace struct {
 	Env *Environment
+	// import()で読み込んだスクリプトのファイル名(それ以外は空文字)
+	FileName string
 }
 
 func (ns *NameSpace) Type() ObjectType { return NAMESPACE_OBJ }
 func (ns *NameSpace) Inspect() string {
+	return ns.inspect(map[Object]bool{})
+}
+
+func (ns *NameSpace) inspect(visiting map[Object]bool) string {
 	var out bytes.Buffer
 	out.WriteString("namespace ")
-	out.WriteString(ns.Env.Inspect())
+	out.WriteString(ns.Env.inspect(visiting))
 
 	return out.String()
 }
+
+// 表示中の配列、ハッシュを引き継いでinspectする
+// (namespaceを経由して自身を含む場合も略記するため)
+func inspect(obj Object, visiting map[Object]bool) string {
+	switch obj := obj.(type) {
+	case *Array:
+		return obj.inspect(visiting)
+	case *Hash:
+		return obj.inspect(visiting)
+	case *NameSpace:
+		return obj.inspect(visiting)
+	default:
+		return obj.Inspect()
+	}
+}
@@ -66,3 +66,21 @@ func TestIntegerHashKeys(t *testing.T) {
 		t.Errorf("integers with different contants has same hash keys")
 	}
 }
+
+func TestHashInspect(t *testing.T) {
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	for _, key := range []Hashable{
+		&String{Value: "b"}, &Integer{Value: 10}, &String{Value: "a"},
+		&Boolean{Value: true}, &Integer{Value: 2}, &Boolean{Value: false},
+	} {
+		hash.Pairs[key.HashKey()] = HashPair{Key: key.(Object), Value: &Null{}}
+	}
+
+	expected := "{false: null, true: null, 2: null, 10: null, a: null, b: null}"
+	// NOTE: mapの順によらず同じ順で表示する
+	for i := 0; i < 10; i++ {
+		if actual := hash.Inspect(); actual != expected {
+			t.Fatalf("wrong inspect. expected=%q, got=%q", expected, actual)
+		}
+	}
+}
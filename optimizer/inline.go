@@ -0,0 +1,145 @@
+package optimizer
+
+import (
+	"../ast"
+)
+
+// スコープ内(内側の関数、namespaceは含まない)で各変数が宣言された回数
+// (引数、catchの変数も含む)
+func countDeclarations(stmts []ast.Statement, params []*ast.Identifier) map[string]int {
+	declarations := make(map[string]int)
+	for _, param := range params {
+		declarations[param.Value]++
+	}
+
+	for _, stmt := range stmts {
+		ast.Walk(stmt, func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.LetStatement:
+				declarations[node.Name.Value]++
+			case *ast.TryExpression:
+				if node.Catch != nil {
+					declarations[node.Parameter.Value]++
+				}
+			case *ast.FunctionLiteral, *ast.NameSpaceLiteral:
+				return false
+			}
+			return true
+		})
+	}
+
+	return declarations
+}
+
+// stmt内のnameの参照をvalue(定数)に置き換える
+func substituteStatement(stmt ast.Statement, name string, value ast.Expression) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		stmt.Value = substitute(stmt.Value, name, value)
+	case *ast.ReturnStatement:
+		stmt.ReturnValue = substitute(stmt.ReturnValue, name, value)
+	case *ast.ThrowStatement:
+		stmt.Value = substitute(stmt.Value, name, value)
+	case *ast.ExpressionStatement:
+		stmt.Expression = substitute(stmt.Expression, name, value)
+	case *ast.BlockStatement:
+		substituteBlock(stmt, name, value)
+	}
+}
+
+func substituteBlock(block *ast.BlockStatement, name string, value ast.Expression) {
+	if block == nil {
+		return
+	}
+	for _, stmt := range block.Statements {
+		substituteStatement(stmt, name, value)
+	}
+}
+
+func substituteExpressions(exps []ast.Expression, name string, value ast.Expression) {
+	for i, exp := range exps {
+		exps[i] = substitute(exp, name, value)
+	}
+}
+
+func substitute(exp ast.Expression, name string, value ast.Expression) ast.Expression {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		if exp.Value == name {
+			return copyConstant(value, exp)
+		}
+	case *ast.PrefixExpression:
+		exp.Right = substitute(exp.Right, name, value)
+	case *ast.InfixExpression:
+		exp.Left = substitute(exp.Left, name, value)
+		// NOTE: "."の右辺は左辺のnamespaceの環境で評価される
+		if exp.Operator != "." && exp.Operator != "?." {
+			exp.Right = substitute(exp.Right, name, value)
+		}
+	case *ast.IfExpression:
+		exp.Condition = substitute(exp.Condition, name, value)
+		substituteBlock(exp.Consequence, name, value)
+		substituteBlock(exp.Alternative, name, value)
+	case *ast.TryExpression:
+		substituteBlock(exp.Block, name, value)
+		substituteBlock(exp.Catch, name, value)
+		substituteBlock(exp.Finally, name, value)
+	case *ast.CallExpression:
+		// NOTE: 呼び出す関数の変数はトレースバック等で使われうるため残す
+		if _, ok := exp.Function.(*ast.Identifier); !ok {
+			exp.Function = substitute(exp.Function, name, value)
+		}
+		substituteExpressions(exp.Arguments, name, value)
+	case *ast.ArrayLiteral:
+		substituteExpressions(exp.Elements, name, value)
+	case *ast.IndexExpression:
+		exp.Left = substitute(exp.Left, name, value)
+		exp.Index = substitute(exp.Index, name, value)
+	case *ast.HashLiteral:
+		pairs := make(map[ast.Expression]ast.Expression)
+		for i, key := range exp.Keys {
+			if spread, ok := key.(*ast.SpreadExpression); ok {
+				spread.Value = substitute(spread.Value, name, value)
+				continue
+			}
+
+			pairValue := exp.Pairs[key]
+			key = substitute(key, name, value)
+			pairs[key] = substitute(pairValue, name, value)
+			exp.Keys[i] = key
+		}
+		exp.Pairs = pairs
+	case *ast.SpreadExpression:
+		exp.Value = substitute(exp.Value, name, value)
+	case *ast.AssignExpression:
+		// NOTE: 代入先はそのまま残す
+		exp.Value = substitute(exp.Value, name, value)
+	}
+	// 関数、namespaceリテラルの中は置き換えない
+	return exp
+}
+
+// 参照していた変数の位置を持つ定数
+func copyConstant(value ast.Expression, ident *ast.Identifier) ast.Expression {
+	switch value := value.(type) {
+	case *ast.IntegerLiteral:
+		return &ast.IntegerLiteral{
+			Token: newToken(value.Token.Type, value.Token.Literal, ident.Token),
+			Value: value.Value,
+		}
+	case *ast.StringLiteral:
+		return &ast.StringLiteral{
+			Token: newToken(value.Token.Type, value.Token.Literal, ident.Token),
+			Value: value.Value,
+		}
+	case *ast.Boolean:
+		return &ast.Boolean{
+			Token: newToken(value.Token.Type, value.Token.Literal, ident.Token),
+			Value: value.Value,
+		}
+	case *ast.Null:
+		return &ast.Null{Token: newToken(value.Token.Type, value.Token.Literal, ident.Token)}
+	default:
+		return ident
+	}
+}
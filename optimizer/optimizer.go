@@ -0,0 +1,377 @@
+package optimizer
+
+import (
+	"../ast"
+	"../evaluator"
+	"../object"
+	"../resolver"
+	"../token"
+	"fmt"
+)
+
+// NOTE: 評価結果(値、エラーメッセージ、エラーの位置、トレースバック)を変えずに
+// プログラムを単純にする
+//   - 定数(整数、文字列、真偽値、null)どうしの演算を畳み込む
+//   - 条件が定数のifから評価されない分岐を取り除く
+//   - 副作用の無い式文(`std.monkey`のコメント代わりの文字列等)を取り除く
+//   - 定数で束縛された変数の参照を、同じスコープ内で定数に置き換える
+//
+// 関数リテラルの本体も書き換えるため、関数のInspect()は最適化後のソースを表示する
+
+// programをその場で書き換える(戻り値はprogram自身)
+func Optimize(program *ast.Program) *ast.Program {
+	o := &optimizer{inline: !usesEnvironment(program)}
+	program.Statements = o.scope(program.Statements, nil)
+	// 取り除いた文、置き換えた式に合わせて変数の参照を解決し直す
+	resolver.Resolve(program)
+	return program
+}
+
+// evalで評価する前にOptimizeする評価関数を返す
+func Wrap(eval evaluator.EvalFunc) evaluator.EvalFunc {
+	return func(node ast.Node, env *object.Environment) object.Object {
+		if program, ok := node.(*ast.Program); ok {
+			node = Optimize(program)
+		}
+		return eval(node, env)
+	}
+}
+
+type optimizer struct {
+	// 変数の参照を定数に置き換えるかどうか
+	inline bool
+}
+
+// NOTE: self(), outer()で得たnamespaceを通して、letで束縛した変数を書き換えられる
+// (`let s = self(); s.x = 2;`)
+// 組み込み関数は別名で呼べるため、名前が現れるだけで置き換えをやめる
+func usesEnvironment(program *ast.Program) bool {
+	found := false
+	ast.Walk(program, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok {
+			if ident.Value == "self" || ident.Value == "outer" {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// 変数の環境を作る文の列(プログラム、関数、namespaceの本体)
+func (o *optimizer) scope(stmts []ast.Statement, params []*ast.Identifier) []ast.Statement {
+	declarations := countDeclarations(stmts, params)
+
+	optimized := []ast.Statement{}
+	for i, stmt := range stmts {
+		stmt = o.statement(stmt)
+
+		// NOTE: 変数を参照する式は、(後の文で)letが評価された後にのみ評価される
+		// 内側の関数、namespaceは(`ns.f`で)別の環境で評価されうるため置き換えない
+		if let, ok := stmt.(*ast.LetStatement); ok && o.inline &&
+			declarations[let.Name.Value] == 1 && isConstant(let.Value) {
+
+			for _, rest := range stmts[i+1:] {
+				substituteStatement(rest, let.Name.Value, let.Value)
+			}
+		}
+
+		optimized = append(optimized, splice(stmt)...)
+	}
+
+	return dropPureStatements(optimized)
+}
+
+// 変数の環境を作らない文の列(if, tryのブロック)
+func (o *optimizer) block(block *ast.BlockStatement) {
+	if block == nil {
+		return
+	}
+
+	optimized := []ast.Statement{}
+	for _, stmt := range block.Statements {
+		optimized = append(optimized, splice(o.statement(stmt))...)
+	}
+	block.Statements = dropPureStatements(optimized)
+}
+
+func (o *optimizer) statement(stmt ast.Statement) ast.Statement {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		stmt.Value = o.expression(stmt.Value)
+	case *ast.ReturnStatement:
+		stmt.ReturnValue = o.expression(stmt.ReturnValue)
+	case *ast.ThrowStatement:
+		stmt.Value = o.expression(stmt.Value)
+	case *ast.ExpressionStatement:
+		stmt.Expression = o.expression(stmt.Expression)
+	case *ast.BlockStatement:
+		o.block(stmt)
+	}
+	return stmt
+}
+
+func (o *optimizer) expressions(exps []ast.Expression) {
+	for i, exp := range exps {
+		exps[i] = o.expression(exp)
+	}
+}
+
+func (o *optimizer) expression(exp ast.Expression) ast.Expression {
+	switch exp := exp.(type) {
+	case *ast.PrefixExpression:
+		exp.Right = o.expression(exp.Right)
+		if right, ok := constantValue(exp.Right); ok {
+			return fold(evaluator.EvalPrefixOperation(exp.Operator, right), exp)
+		}
+	case *ast.InfixExpression:
+		return o.infixExpression(exp)
+	case *ast.IfExpression:
+		return o.ifExpression(exp)
+	case *ast.TryExpression:
+		o.block(exp.Block)
+		o.block(exp.Catch)
+		o.block(exp.Finally)
+	case *ast.FunctionLiteral:
+		exp.Body.Statements = o.scope(exp.Body.Statements, exp.Parameters)
+	case *ast.NameSpaceLiteral:
+		exp.Body.Statements = o.scope(exp.Body.Statements, nil)
+	case *ast.CallExpression:
+		exp.Function = o.expression(exp.Function)
+		o.expressions(exp.Arguments)
+	case *ast.ArrayLiteral:
+		o.expressions(exp.Elements)
+	case *ast.IndexExpression:
+		exp.Left = o.expression(exp.Left)
+		exp.Index = o.expression(exp.Index)
+	case *ast.HashLiteral:
+		o.hashLiteral(exp)
+	case *ast.SpreadExpression:
+		exp.Value = o.expression(exp.Value)
+	case *ast.AssignExpression:
+		exp.Value = o.expression(exp.Value)
+		o.assignTarget(exp.Target)
+	}
+	return exp
+}
+
+func (o *optimizer) infixExpression(exp *ast.InfixExpression) ast.Expression {
+	exp.Left = o.expression(exp.Left)
+	exp.Right = o.expression(exp.Right)
+
+	// NOTE: "."の右辺は左辺のnamespaceの環境で評価されるため畳み込まない
+	if exp.Operator == "." || exp.Operator == "?." {
+		return exp
+	}
+
+	left, ok := constantValue(exp.Left)
+	if !ok {
+		return exp
+	}
+
+	switch exp.Operator {
+	case "&&", "||", "??":
+		if evaluator.CanShortCut(exp.Operator, left) {
+			return exp.Left
+		}
+		// 右辺の値がそのまま式の値になる
+		return exp.Right
+	}
+
+	right, ok := constantValue(exp.Right)
+	if !ok {
+		return exp
+	}
+	// NOTE: 0除算は評価時にpanicするため、そのまま残す
+	if integer, ok := right.(*object.Integer); ok && exp.Operator == "/" &&
+		integer.Value == 0 {
+		return exp
+	}
+
+	return fold(evaluator.EvalInfixOperation(exp.Operator, left, right), exp)
+}
+
+func (o *optimizer) ifExpression(exp *ast.IfExpression) ast.Expression {
+	exp.Condition = o.expression(exp.Condition)
+	o.block(exp.Consequence)
+	o.block(exp.Alternative)
+
+	condition, ok := constantValue(exp.Condition)
+	if !ok {
+		return exp
+	}
+
+	var taken *ast.BlockStatement
+	if evaluator.IsTruthy(condition) {
+		taken = exp.Consequence
+	} else {
+		taken = exp.Alternative
+	}
+
+	if taken == nil {
+		return &ast.Null{Token: newToken(token.NULL, "null", exp.Token)}
+	}
+	// NOTE: ブロック内の文で起きたエラーはその文の位置を持つため、
+	// 定数以外の式はブロックから取り出さない
+	if len(taken.Statements) == 1 {
+		if es, ok := taken.Statements[0].(*ast.ExpressionStatement); ok &&
+			isConstant(es.Expression) {
+			return es.Expression
+		}
+	}
+
+	return &ast.IfExpression{
+		Token:       exp.Token,
+		Condition:   &ast.Boolean{Token: newToken(token.TRUE, "true", exp.Token), Value: true},
+		Consequence: taken,
+	}
+}
+
+func (o *optimizer) hashLiteral(exp *ast.HashLiteral) {
+	pairs := make(map[ast.Expression]ast.Expression)
+	for i, key := range exp.Keys {
+		if spread, ok := key.(*ast.SpreadExpression); ok {
+			spread.Value = o.expression(spread.Value)
+			continue
+		}
+
+		value := exp.Pairs[key]
+		key = o.expression(key)
+		pairs[key] = o.expression(value)
+		exp.Keys[i] = key
+	}
+	exp.Pairs = pairs
+}
+
+func (o *optimizer) assignTarget(target ast.Expression) {
+	switch target := target.(type) {
+	case *ast.IndexExpression:
+		target.Left = o.expression(target.Left)
+		target.Index = o.expression(target.Index)
+	case *ast.InfixExpression:
+		// NOTE: 右辺は代入先のフィールド名
+		target.Left = o.expression(target.Left)
+	}
+}
+
+// `if (true) { ... }`の文は、ブロック内の文に置き換える
+func splice(stmt ast.Statement) []ast.Statement {
+	es, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return []ast.Statement{stmt}
+	}
+
+	ifExp, ok := es.Expression.(*ast.IfExpression)
+	if !ok || ifExp.Alternative != nil {
+		return []ast.Statement{stmt}
+	}
+
+	condition, ok := ifExp.Condition.(*ast.Boolean)
+	if !ok || !condition.Value {
+		return []ast.Statement{stmt}
+	}
+
+	stmts := ifExp.Consequence.Statements
+	// NOTE: 空のブロック、letで終わるブロックはnullを返す(letの文自体は値を返さない)
+	if len(stmts) == 0 {
+		return []ast.Statement{stmt}
+	}
+	if _, ok := stmts[len(stmts)-1].(*ast.LetStatement); ok {
+		return []ast.Statement{stmt}
+	}
+
+	return stmts
+}
+
+// 最後の文以外の、値を捨てる副作用の無い式文を取り除く
+func dropPureStatements(stmts []ast.Statement) []ast.Statement {
+	dropped := []ast.Statement{}
+	for i, stmt := range stmts {
+		if es, ok := stmt.(*ast.ExpressionStatement); ok && i < len(stmts)-1 &&
+			isPure(es.Expression) {
+			continue
+		}
+		dropped = append(dropped, stmt)
+	}
+	return dropped
+}
+
+func isPure(exp ast.Expression) bool {
+	switch exp.(type) {
+	case *ast.FunctionLiteral:
+		return true
+	default:
+		return isConstant(exp)
+	}
+}
+
+func isConstant(exp ast.Expression) bool {
+	_, ok := constantValue(exp)
+	return ok
+}
+
+func constantValue(exp ast.Expression) (object.Object, bool) {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: exp.Value}, true
+	case *ast.StringLiteral:
+		return &object.String{Value: exp.Value}, true
+	case *ast.Boolean:
+		if exp.Value {
+			return evaluator.TRUE, true
+		}
+		return evaluator.FALSE, true
+	case *ast.Null:
+		return evaluator.NULL, true
+	default:
+		return nil, false
+	}
+}
+
+// 定数の演算結果をリテラルにする(エラーの場合は元の式のまま)
+func fold(obj object.Object, exp ast.Expression) ast.Expression {
+	tok := tokenOf(exp)
+
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return &ast.IntegerLiteral{
+			Token: newToken(token.INT, fmt.Sprintf("%d", obj.Value), tok),
+			Value: obj.Value,
+		}
+	case *object.String:
+		return &ast.StringLiteral{
+			Token: newToken(token.STRING, obj.Value, tok),
+			Value: obj.Value,
+		}
+	case *object.Boolean:
+		if obj.Value {
+			return &ast.Boolean{Token: newToken(token.TRUE, "true", tok), Value: true}
+		}
+		return &ast.Boolean{Token: newToken(token.FALSE, "false", tok), Value: false}
+	case *object.Null:
+		return &ast.Null{Token: newToken(token.NULL, "null", tok)}
+	default:
+		return exp
+	}
+}
+
+func tokenOf(exp ast.Expression) token.Token {
+	switch exp := exp.(type) {
+	case *ast.PrefixExpression:
+		return exp.Token
+	case *ast.InfixExpression:
+		return exp.Token
+	default:
+		return token.Token{}
+	}
+}
+
+// 元のtokenの位置を持つtoken
+func newToken(tokenType token.TokenType, literal string, pos token.Token) token.Token {
+	return token.Token{
+		Type:    tokenType,
+		Literal: literal,
+		Line:    pos.Line,
+		Column:  pos.Column,
+	}
+}
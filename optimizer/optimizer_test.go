@@ -0,0 +1,101 @@
+package optimizer
+
+import (
+	"../conformance"
+	"../evaluator"
+	"../lexer"
+	"../parser"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// 定数の畳み込み
+		{"1 + 2 * 3", "7"},
+		{`"a" + "b"`, "ab"},
+		{"!true", "false"},
+		{"-(2 - 5)", "3"},
+		{"1 < 2 == true", "true"},
+		{"null ?? 3", "3"},
+		{"false && x", "false"},
+		{"true && x", "x"},
+		{"1 || x", "1"},
+		{"x + (1 + 2)", "(x + 3)"},
+		// エラーになる演算、0除算は残す
+		{"1 + true", "(1 + true)"},
+		{`"a" - "b"`, "(a - b)"},
+		{"1 / 0", "(1 / 0)"},
+		// "."の右辺は畳み込まない
+		{"ns.x", "(ns . x)"},
+		// 評価されない分岐
+		{"if (true) { 1 } else { 2 }", "1"},
+		{"if (false) { 1 } else { 2 }", "2"},
+		{"if (false) { 1 }", "null"},
+		{"if (1 > 2) { f() } else { g() }", "g()"},
+		{"let a = if (1 > 2) { f() } else { g() };", "let a = iftrue g();"},
+		{"let a = if (0) { f() };", "let a = iftrue f();"},
+		{"if (true) { f(); g() }", "f()g()"},
+		// letで終わるブロックはnullを返すため展開しない
+		{"if (true) { let a = f() }", "iftrue let a = f();"},
+		// 副作用の無い式文
+		{`"comment"; f(); 2; fn() { 3 }; g()`, "f()g()"},
+		{"f(); 2", "f()2"},
+		{`let f = fn() { "comment"; 1 }`, "let f = fn() 1;"},
+		// 定数の変数
+		{"let a = 2; let b = a * 3; b + 1", "let a = 2;let b = 6;7"},
+		{"let a = 1 + 1; f(a); if (a > 1) { a }", "let a = 2;f(2)2"},
+		{`let a = "x"; {a: a}`, "let a = x;{x: x}"},
+		{"let f = fn(a) { let b = 1; a + b }", "let f = fn(a) let b = 1;(a + 1);"},
+		// 引数やcatchの変数、再宣言された変数は置き換えない
+		{"let f = fn(a) { let a = 1; a }", "let f = fn(a) let a = 1;a;"},
+		{"let a = 1; let a = 2; a", "let a = 1;let a = 2;a"},
+		{"let e = 1; try { f() } catch (e) { e }", "let e = 1;try f() catch (e) e"},
+		// 束縛前の参照、内側の関数、namespace、"."の右辺は置き換えない
+		{"a; let a = 1; a", "alet a = 1;1"},
+		{"let a = 1; fn() { a }", "let a = 1;fn() a"},
+		{"let a = 1; namespace { let b = a }", "let a = 1;namespace let b = a;"},
+		{"let a = 1; ns.a", "let a = 1;(ns . a)"},
+		{"let a = 1; a()", "let a = 1;a()"},
+		// self(), outer()で環境が書き換えられうる
+		{"let a = 1; let s = self(); a", "let a = 1;let s = self();a"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser errors in %q: %v", tt.input, p.Errors())
+		}
+
+		optimized := Optimize(program)
+		if optimized.String() != tt.expected {
+			t.Errorf("wrong optimization of %q.\nwant=%q\ngot=%q",
+				tt.input, tt.expected, optimized.String())
+		}
+	}
+}
+
+var optimized = conformance.NewEngine("optimized", Wrap(evaluator.Eval))
+
+func TestOptimizedConformance(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range conformance.Run(optimized, filepath.Join(filepath.Dir(wd), "scripts")) {
+		t.Error(f)
+	}
+}
+
+func TestOptimizedDifferential(t *testing.T) {
+	for _, m := range conformance.Differential(conformance.Evaluator, optimized, 1, 500) {
+		t.Errorf("results differ\n%s", m)
+	}
+}
@@ -3,6 +3,7 @@ package parser
 import (
 	"../ast"
 	"../lexer"
+	"../resolver"
 	"../token"
 	"fmt"
 	"strconv"
@@ -12,6 +13,8 @@ type Parser struct {
 	l *lexer.Lexer
 
 	errors []string
+	// errorsと同じ順に、エラーを検出した位置を持つ
+	parseErrors []ParseError
 
 	curToken  token.Token
 	peekToken token.Token
@@ -40,6 +43,8 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
 	p.registerPrefix(token.NAMESPACE, p.parseNameSpaceLiteral)
+	p.registerPrefix(token.NULL, p.parseNull)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
@@ -56,6 +61,10 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.AND, p.parseInfixExpression)
 	p.registerInfix(token.OR, p.parseInfixExpression)
 	p.registerInfix(token.DOT, p.parseInfixExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.NULLISH, p.parseInfixExpression)
+	p.registerInfix(token.OPTIONAL_DOT, p.parseInfixExpression)
+	p.registerInfix(token.OPTIONAL_LBRACKET, p.parseIndexExpression)
 
 	p.nextToken()
 	p.nextToken()
@@ -63,14 +72,32 @@ func New(l *lexer.Lexer) *Parser {
 	return p
 }
 
+// 構文エラー(位置はエラーを検出したトークンの先頭、1始まり)
+type ParseError struct {
+	Msg    string
+	Line   int
+	Column int
+}
+
 func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+// Errors()に位置を付けたもの
+func (p *Parser) ParseErrors() []ParseError {
+	return p.parseErrors
+}
+
+func (p *Parser) addError(tok token.Token, msg string) {
+	p.errors = append(p.errors, msg)
+	p.parseErrors = append(p.parseErrors,
+		ParseError{Msg: msg, Line: tok.Line, Column: tok.Column})
+}
+
 func (p *Parser) peekError(t token.TokenType) {
 	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
 		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.addError(p.peekToken, msg)
 }
 
 func (p *Parser) nextToken() {
@@ -90,15 +117,27 @@ func (p *Parser) ParseProgram() *ast.Program {
 		p.nextToken()
 	}
 
+	// 変数の参照を静的に解決する(評価時に書き換えないため、同じprogramを同時に評価できる)
+	// NOTE: エラーがある場合、nodeが欠けている場合があるため解決しない(評価もされない)
+	if len(p.errors) == 0 {
+		resolver.Resolve(program)
+	}
+
 	return program
 }
 
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
-	case token.LET:
-		return p.parseLetStatement()
+	case token.LET, token.CONST:
+		// NOTE: nilの*ast.LetStatementをそのまま返すと、nilでないast.Statementになる
+		if stmt := p.parseLetStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
 	default:
 		return p.parseExpressionStatement() // let, return以外の文は式文としてパース
 	}
@@ -122,7 +161,7 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 }
 
 func (p *Parser) parseLetStatement() *ast.LetStatement {
-	stmt := &ast.LetStatement{Token: p.curToken} // Token.Let
+	stmt := &ast.LetStatement{Token: p.curToken} // Token.Let or Token.CONST
 
 	if !p.expectPeek(token.IDENT) { // peekTokenが期待通りなときのみnextToken()
 		return nil
@@ -131,6 +170,12 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	//                                 token.IDENT        var name
 	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		p.nextToken() // curTokenは型注釈の最初のtoken
+		stmt.Name.Type = p.parseType()
+	}
+
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
 	}
@@ -160,6 +205,20 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken() // SEMICOLON省略可能
+	}
+
+	return stmt
+}
+
 func (p *Parser) curTokenIs(t token.TokenType) bool {
 	return p.curToken.Type == t
 }
@@ -197,7 +256,7 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.addError(p.curToken, msg)
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
@@ -243,7 +302,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(p.curToken, msg)
 		return nil
 	}
 
@@ -256,6 +315,10 @@ func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
 }
 
+func (p *Parser) parseNull() ast.Expression {
+	return &ast.Null{Token: p.curToken}
+}
+
 func (p *Parser) parseIfExpression() ast.Expression {
 	expression := &ast.IfExpression{Token: p.curToken}
 
@@ -289,6 +352,60 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expression.Block = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+
+		// `catch (e)`
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		expression.Parameter = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		expression.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		expression.Finally = p.parseBlockStatement()
+	}
+
+	if expression.Catch == nil && expression.Finally == nil {
+		msg := fmt.Sprintf("expected next token to be %s or %s, got %s instead",
+			token.CATCH, token.FINALLY, p.peekToken.Type)
+		p.addError(p.peekToken, msg)
+		return nil
+	}
+
+	return expression
+}
+
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	lit := &ast.FunctionLiteral{Token: p.curToken}
 
@@ -298,11 +415,18 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 
 	lit.Parameters = p.parseFunctionParameters() // RPARENまで進める
 
+	if p.peekTokenIs(token.ARROW) {
+		p.nextToken()
+		p.nextToken() // curTokenは戻り値の型注釈の最初のtoken
+		lit.ReturnType = p.parseType()
+	}
+
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
 	lit.Body = p.parseBlockStatement()
+	markTailCalls(lit.Body, true)
 
 	return lit
 }
@@ -317,14 +441,12 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 
 	p.nextToken()
 
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	identifiers = append(identifiers, ident)
+	identifiers = append(identifiers, p.parseParameter())
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken() // curTokenはCOMMA
 		p.nextToken() // curTokenは次のIDENT(のはず)
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		identifiers = append(identifiers, ident)
+		identifiers = append(identifiers, p.parseParameter())
 	}
 
 	if !p.expectPeek(token.RPAREN) {
@@ -354,12 +476,12 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	}
 
 	p.nextToken()
-	list = append(list, p.parseExpression(LOWEST)) // パースは','の直前で停止
+	list = append(list, p.parseListElement()) // パースは','の直前で停止
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken() // curtokenはCOMMA
 		p.nextToken() // curtokenは次の引数の最初のtoken
-		list = append(list, p.parseExpression(LOWEST))
+		list = append(list, p.parseListElement())
 	}
 
 	if !p.expectPeek(end) {
@@ -369,6 +491,23 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	return list
 }
 
+// 配列要素、引数では`...`によるスプレッドも可能
+func (p *Parser) parseListElement() ast.Expression {
+	if p.curTokenIs(token.SPREAD) {
+		return p.parseSpreadExpression()
+	}
+	return p.parseExpression(LOWEST)
+}
+
+func (p *Parser) parseSpreadExpression() ast.Expression {
+	spread := &ast.SpreadExpression{Token: p.curToken}
+
+	p.nextToken()
+	spread.Value = p.parseExpression(LOWEST)
+
+	return spread
+}
+
 func (p *Parser) parseGroupedExpression() ast.Expression {
 	p.nextToken()
 
@@ -400,6 +539,17 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 
 	for !p.peekTokenIs(token.RBRACE) {
 		p.nextToken() // curToken: keyの最初のtoken
+
+		// `{...h}`: スプレッドはkeyのみ保持
+		if p.curTokenIs(token.SPREAD) {
+			hash.Keys = append(hash.Keys, p.parseSpreadExpression())
+
+			if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+				return nil
+			}
+			continue
+		}
+
 		key := p.parseExpression(LOWEST)
 
 		if !p.expectPeek(token.COLON) {
@@ -410,6 +560,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		value := p.parseExpression(LOWEST)
 
 		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
@@ -427,7 +578,11 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 }
 
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+	exp := &ast.IndexExpression{
+		Token:    p.curToken,
+		Left:     left,
+		Optional: p.curTokenIs(token.OPTIONAL_LBRACKET),
+	}
 
 	p.nextToken()
 	exp.Index = p.parseExpression(LOWEST)
@@ -448,6 +603,7 @@ func (p *Parser) parseNameSpaceLiteral() ast.Expression {
 	}
 
 	lit.Body = p.parseBlockStatement()
+	markTailCalls(lit.Body, true)
 
 	return lit
 }
@@ -483,13 +639,53 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
+	// `arr[i] = v`, `hash[k] = v`, `ns.field = v`
+	exp := &ast.AssignExpression{Token: p.curToken, Target: left}
+
+	if !isAssignable(left) {
+		msg := fmt.Sprintf("cannot assign to %s", left.String())
+		p.addError(p.curToken, msg)
+		return nil
+	}
+
+	p.nextToken()
+	// NOTE: 右結合にするため、右辺はASSIGNより1つ低い優先順位でパース
+	// (`a[0] = b[0] = 1` -> `(a[0] = (b[0] = 1))`)
+	exp.Value = p.parseExpression(ASSIGN - 1)
+
+	return exp
+}
+
+func isAssignable(exp ast.Expression) bool {
+	switch exp := exp.(type) {
+	case *ast.IndexExpression:
+		return !exp.Optional
+	case *ast.InfixExpression:
+		// NOTE: `ns.arr[i]`は`ns.(arr[i])`とパースされる
+		switch right := exp.Right.(type) {
+		case *ast.Identifier:
+			return exp.Operator == "."
+		case *ast.IndexExpression:
+			return exp.Operator == "." && !right.Optional
+		default:
+			return false
+		}
+	default:
+		return false
+	}
+}
+
 // NOTE: ANDがORより優先順位が高いのは、他の多くの言語の仕様と合わせたため
 // 数学的にも論理積は論理和より優先順位が高い[↓]ためこれに倣う
 // https://en.wikipedia.org/wiki/Logical_connective#Order_of_precedence
+// NOTE: ??はJavaScript等に合わせ||より優先順位を低くする
 
 const ( // op priority
 	_ int = iota
 	LOWEST
+	ASSIGN      // =
+	NULLISH     // ??
 	OR          // ||
 	AND         // &&
 	EQUALS      // ==
@@ -517,6 +713,11 @@ var precedences = map[token.TokenType]int{
 	token.LBRACKET: INDEX,
 	token.AND:      AND,
 	token.OR:       OR,
+	token.ASSIGN:   ASSIGN,
+	token.NULLISH:  NULLISH,
+
+	token.OPTIONAL_DOT:      CALL,
+	token.OPTIONAL_LBRACKET: INDEX,
 }
 
 func (p *Parser) peekPrecedence() int {
@@ -35,6 +35,51 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestConstStatements(t *testing.T) {
+	input := "const x = 5;"
+	program := testParse(t, input)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] not *ast.LetStatement. got=%T",
+			program.Statements[0])
+	}
+
+	if !stmt.IsConst() {
+		t.Errorf("stmt.IsConst() is not true")
+	}
+
+	if stmt.String() != "const x = 5;" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+
+	if !testIdentifier(t, stmt.Name, "x") {
+		return
+	}
+
+	testLiteralExpression(t, stmt.Value, 5)
+}
+
+func TestInvalidLetStatementsAreSkipped(t *testing.T) {
+	l := lexer.New("let = 1; x;")
+	p := New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) == 0 {
+		t.Fatalf("parser error should occur")
+	}
+	for _, stmt := range program.Statements {
+		if let, ok := stmt.(*ast.LetStatement); ok && let == nil {
+			t.Errorf("nil *ast.LetStatement in program.Statements")
+		}
+	}
+}
+
 func testLetStatement(t *testing.T, s ast.Statement, name string,
 	expectedValue interface{}) bool {
 
@@ -107,6 +152,150 @@ func TestReturnStatements(t *testing.T) {
 	}
 }
 
+func TestThrowStatements(t *testing.T) {
+	input := `throw "error"; throw x + 1;`
+	program := testParse(t, input)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+
+	expected := []string{`throw error;`, `throw (x + 1);`}
+	for i, stmt := range program.Statements {
+		throwStmt, ok := stmt.(*ast.ThrowStatement)
+		if !ok {
+			t.Errorf("stmt not *ast.ThrowStatement. got=%T", stmt)
+			continue
+		}
+
+		if throwStmt.String() != expected[i] {
+			t.Errorf("throwStmt.String() wrong. expected=%q, got=%q",
+				expected[i], throwStmt.String())
+		}
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedParam   string
+		expectedCatch   bool
+		expectedFinally bool
+		expectedString  string
+	}{
+		{
+			"try { x } catch (e) { y }",
+			"e", true, false,
+			"try x catch (e) y",
+		},
+		{
+			"try { x } finally { z }",
+			"", false, true,
+			"try x finally z",
+		},
+		{
+			"try { x } catch (err) { y } finally { z }",
+			"err", true, true,
+			"try x catch (err) y finally z",
+		},
+	}
+
+	for _, tt := range tests {
+		program := testParse(t, tt.input)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+				program.Statements[0])
+		}
+
+		exp, ok := stmt.Expression.(*ast.TryExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.TryExpression. got=%T",
+				stmt.Expression)
+		}
+
+		if (exp.Catch != nil) != tt.expectedCatch {
+			t.Errorf("exp.Catch wrong. got=%+v", exp.Catch)
+		}
+
+		if (exp.Finally != nil) != tt.expectedFinally {
+			t.Errorf("exp.Finally wrong. got=%+v", exp.Finally)
+		}
+
+		if tt.expectedCatch && !testIdentifier(t, exp.Parameter, tt.expectedParam) {
+			return
+		}
+
+		if exp.String() != tt.expectedString {
+			t.Errorf("exp.String() wrong. expected=%q, got=%q",
+				tt.expectedString, exp.String())
+		}
+	}
+}
+
+func TestTryExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { x }", "expected next token to be CATCH or FINALLY, got EOF instead"},
+		{"try { x } catch { y }", "expected next token to be (, got { instead"},
+		{"try { x } catch (1) { y }", "expected next token to be IDENT, got INT instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("parser error should occur. input=%q", tt.input)
+		}
+
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expected, errors[0])
+		}
+	}
+}
+
+func TestParseErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = ;", "1:9: no prefix parse function for ; found"},
+		{"let x = 1;\nlet y = 2 +;", "2:12: no prefix parse function for ; found"},
+		{"try { x }", "1:10: expected next token to be CATCH or FINALLY, got EOF instead"},
+		{"let x = 1;\n  [1] = 2;", "2:7: cannot assign to [1]"},
+		{"let n: = 1;", "1:8: expected type, got = instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.ParseErrors()
+		if len(errors) == 0 || len(errors) != len(p.Errors()) {
+			t.Fatalf("wrong number of errors for %q. got=%d, Errors()=%d",
+				tt.input, len(errors), len(p.Errors()))
+		}
+
+		actual := fmt.Sprintf("%d:%d: %s", errors[0].Line, errors[0].Column, errors[0].Msg)
+		if actual != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
 func TestIdentifierExpression(t *testing.T) {
 	input := `foobar;`
 	program := testParse(t, input)
@@ -426,6 +615,54 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"f().value()",
 			"(f() . value)()",
 		},
+		{
+			"a[0] = 1 + 2",
+			"((a[0]) = (1 + 2))",
+		},
+		{
+			"a[0] = b[1] = c || d",
+			"((a[0]) = ((b[1]) = (c || d)))",
+		},
+		{
+			"ns.x = f(1)",
+			"((ns . x) = f(1))",
+		},
+		{
+			"ns.arr[i] = 5",
+			"((ns . (arr[i])) = 5)",
+		},
+		{
+			"a ?? b || c",
+			"(a ?? (b || c))",
+		},
+		{
+			"a ?? b ?? c",
+			"((a ?? b) ?? c)",
+		},
+		{
+			"a?.b?.c ?? null",
+			"(((a ?. b) ?. c) ?? null)",
+		},
+		{
+			"a?[0]?[1] + 1",
+			"(((a?[0])?[1]) + 1)",
+		},
+		{
+			"[...a, 1, ...b + c]",
+			"[...a, 1, ...(b + c)]",
+		},
+		{
+			"f(...args, x)",
+			"f(...args, x)",
+		},
+		{
+			`{...defaults, "k": 1, ...f(x)}`,
+			`{...defaults, k: 1, ...f(x)}`,
+		},
+		{
+			"x[0] = a?.b ?? 1",
+			"((x[0]) = ((a ?. b) ?? 1))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -637,6 +874,79 @@ func TestCallExpressionParsing(t *testing.T) {
 	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
 }
 
+func TestTailCallMarking(t *testing.T) {
+	// NOTE: 末尾位置の呼び出しは`tail`、それ以外は`notTail`という名前の関数で表す
+	tests := []string{
+		"fn() { tail() }",
+		"fn() { notTail(); tail() }",
+		"fn() { notTail(); return tail(); }",
+		"fn() { if (notTail()) { tail() } else { notTail(); tail() } }",
+		"fn() { if (c) { return tail(); }; notTail(); tail(); }",
+		"fn() { if (c) { notTail() }; 1 }",
+		"fn() { notTail() + 1 }",
+		"fn() { let x = notTail(); x }",
+		"fn() { tail(notTail()) }",
+		"fn() { try { return notTail(); } finally { notTail() } }",
+		"fn() { fn() { tail() } }",
+		"notTail()",
+	}
+
+	for _, input := range tests {
+		program := testParse(t, input)
+
+		for _, call := range collectCallExpressions(program) {
+			name := call.Function.String()
+			if call.Tail != (name == "tail") {
+				t.Errorf("wrong Tail of %s in %q. got=%t", name, input, call.Tail)
+			}
+		}
+	}
+}
+
+func collectCallExpressions(node ast.Node) []*ast.CallExpression {
+	calls := []*ast.CallExpression{}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, stmt := range node.Statements {
+			calls = append(calls, collectCallExpressions(stmt)...)
+		}
+	case *ast.BlockStatement:
+		if node == nil {
+			return calls
+		}
+		for _, stmt := range node.Statements {
+			calls = append(calls, collectCallExpressions(stmt)...)
+		}
+	case *ast.ExpressionStatement:
+		calls = append(calls, collectCallExpressions(node.Expression)...)
+	case *ast.LetStatement:
+		calls = append(calls, collectCallExpressions(node.Value)...)
+	case *ast.ReturnStatement:
+		calls = append(calls, collectCallExpressions(node.ReturnValue)...)
+	case *ast.InfixExpression:
+		calls = append(calls, collectCallExpressions(node.Left)...)
+		calls = append(calls, collectCallExpressions(node.Right)...)
+	case *ast.IfExpression:
+		calls = append(calls, collectCallExpressions(node.Condition)...)
+		calls = append(calls, collectCallExpressions(node.Consequence)...)
+		calls = append(calls, collectCallExpressions(node.Alternative)...)
+	case *ast.TryExpression:
+		calls = append(calls, collectCallExpressions(node.Block)...)
+		calls = append(calls, collectCallExpressions(node.Finally)...)
+	case *ast.FunctionLiteral:
+		calls = append(calls, collectCallExpressions(node.Body)...)
+	case *ast.CallExpression:
+		calls = append(calls, node)
+		calls = append(calls, collectCallExpressions(node.Function)...)
+		for _, arg := range node.Arguments {
+			calls = append(calls, collectCallExpressions(arg)...)
+		}
+	}
+
+	return calls
+}
+
 func TestStringLiteralExpression(t *testing.T) {
 	input := `"hello, world";`
 	program := testParse(t, input)
@@ -782,6 +1092,100 @@ func testBoolean(t *testing.T, exp ast.Expression, value bool) bool {
 	return true
 }
 
+func TestNullExpression(t *testing.T) {
+	program := testParse(t, "null;")
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program has not enough statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	null, ok := stmt.Expression.(*ast.Null)
+	if !ok {
+		t.Fatalf("exp not *ast.Null. got=%T", stmt.Expression)
+	}
+
+	if null.TokenLiteral() != "null" {
+		t.Errorf("null.TokenLiteral not %s. got=%s", "null", null.TokenLiteral())
+	}
+}
+
+func TestParsingOptionalIndexExpression(t *testing.T) {
+	input := "myArray?[1 + 1]"
+	program := testParse(t, input)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	indexExp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", stmt.Expression)
+	}
+
+	if !indexExp.Optional {
+		t.Errorf("indexExp.Optional is not true")
+	}
+
+	if !testIdentifier(t, indexExp.Left, "myArray") {
+		return
+	}
+
+	if !testInfixExpression(t, indexExp.Index, 1, "+", 1) {
+		return
+	}
+}
+
+func TestParsingSpreadExpressions(t *testing.T) {
+	input := `[1, ...a]; {...b, "c": 2};`
+	program := testParse(t, input)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program does not contain %d statements. got=%d",
+			2, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 2 {
+		t.Fatalf("len(array.Elements) not 2. got=%d", len(array.Elements))
+	}
+
+	spread, ok := array.Elements[1].(*ast.SpreadExpression)
+	if !ok {
+		t.Fatalf("array.Elements[1] not ast.SpreadExpression. got=%T",
+			array.Elements[1])
+	}
+	testIdentifier(t, spread.Value, "a")
+
+	stmt, ok = program.Statements[1].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 1 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	if len(hash.Keys) != 2 {
+		t.Fatalf("hash.Keys has wrong length. got=%d", len(hash.Keys))
+	}
+
+	spread, ok = hash.Keys[0].(*ast.SpreadExpression)
+	if !ok {
+		t.Fatalf("hash.Keys[0] not ast.SpreadExpression. got=%T", hash.Keys[0])
+	}
+	testIdentifier(t, spread.Value, "b")
+}
+
 func TestParsingIndexExpression(t *testing.T) {
 	input := "myArray[1 + 1]"
 	program := testParse(t, input)
@@ -801,6 +1205,69 @@ func TestParsingIndexExpression(t *testing.T) {
 	}
 }
 
+func TestParsingAssignExpression(t *testing.T) {
+	input := "myArray[1] = x + 1"
+	program := testParse(t, input)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	assignExp, ok := stmt.Expression.(*ast.AssignExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.AssignExpression. got=%T", stmt.Expression)
+	}
+
+	indexExp, ok := assignExp.Target.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("assignExp.Target not *ast.IndexExpression. got=%T",
+			assignExp.Target)
+	}
+
+	if !testIdentifier(t, indexExp.Left, "myArray") {
+		return
+	}
+
+	if !testIntegerLiteral(t, indexExp.Index, 1) {
+		return
+	}
+
+	if !testInfixExpression(t, assignExp.Value, "x", "+", 1) {
+		return
+	}
+}
+
+func TestParsingInvalidAssignTargets(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 1", "cannot assign to x"},
+		{"f() = 1", "cannot assign to f()"},
+		{"ns.5 = 1", "cannot assign to (ns . 5)"},
+		{"a?[0] = 1", "cannot assign to (a?[0])"},
+		{"ns?.x = 1", "cannot assign to (ns ?. x)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("parser error should occur. input=%q", tt.input)
+		}
+
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expected, errors[0])
+		}
+	}
+}
+
 func TestParsingHashLiteralsStringKeys(t *testing.T) {
 	input := `{"one": 1, "two": 2, "three": 3}`
 	program := testParse(t, input)
@@ -1013,3 +1480,73 @@ func checkParserErrors(t *testing.T, p *Parser) {
 	}
 	t.FailNow()
 }
+
+func TestParsingTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let n: int = 1;", "let n: int = 1;"},
+		{"const s: string | null = null;", "const s: string | null = null;"},
+		{"let a: array[int] = [];", "let a: array[int] = [];"},
+		{"let h: hash[string, array[int]] = {};", "let h: hash[string, array[int]] = {};"},
+		{"fn(x: int, y) -> int { x }", "fn(x: int, y) -> int x"},
+		{"fn() -> fn(int) -> bool { f }", "fn() -> fn(int) -> bool f"},
+		{"let f: fn(int, ...any) = g;", "let f: fn(int, ...any) = g;"},
+		{"let f: fn = g;", "let f: fn(...any) = g;"},
+		{"let ns: namespace | null = null;", "let ns: namespace | null = null;"},
+		// 型注釈の無い"->"は演算子ではない
+		{"a - -b", "(a - (-b))"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestParsingTypeAnnotationErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let n: = 1;", "expected type, got = instead"},
+		{"let f: fn(...int, int) = g;", "... must be the last parameter type"},
+		{"let a: array[int = [];", "expected next token to be ], got = instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. expected first=%q, got=%q",
+				tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestParseType(t *testing.T) {
+	p := New(lexer.New("fn(string | array) -> int"))
+	typ := p.ParseType()
+	checkParserErrors(t, p)
+
+	fnType, ok := typ.(*ast.FunctionType)
+	if !ok {
+		t.Fatalf("typ is not *ast.FunctionType. got=%T", typ)
+	}
+	if len(fnType.Parameters) != 1 || fnType.Return.String() != "int" {
+		t.Errorf("wrong function type. got=%s", fnType.String())
+	}
+	if _, ok := fnType.Parameters[0].(*ast.UnionType); !ok {
+		t.Errorf("parameter is not *ast.UnionType. got=%T", fnType.Parameters[0])
+	}
+}
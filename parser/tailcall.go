@@ -0,0 +1,47 @@
+package parser
+
+import (
+	"../ast"
+)
+
+// 関数本体の末尾位置にある呼び出しに印を付ける(末尾呼び出し最適化用)
+// 末尾位置は以下の通り
+// - 本体の最後の式文
+// - 末尾位置にあるifの各ブロックの最後の式文
+// - return文の値(ifのブロック内にあるものも含む)
+// NOTE: tryのブロック内はcatch/finallyの評価が残っているため末尾位置ではない
+// (関数リテラルの本体は、そのリテラルのパース時に別途印を付ける)
+func markTailCalls(block *ast.BlockStatement, tail bool) {
+	if block == nil {
+		return
+	}
+
+	for i, stmt := range block.Statements {
+		isLast := tail && i == len(block.Statements)-1
+
+		switch stmt := stmt.(type) {
+		case *ast.ReturnStatement:
+			markTailExpression(stmt.ReturnValue)
+		case *ast.ExpressionStatement:
+			if isLast {
+				markTailExpression(stmt.Expression)
+				continue
+			}
+			// 末尾位置でないifの中にもreturn文があるかもしれない
+			if ifExp, ok := stmt.Expression.(*ast.IfExpression); ok {
+				markTailCalls(ifExp.Consequence, false)
+				markTailCalls(ifExp.Alternative, false)
+			}
+		}
+	}
+}
+
+func markTailExpression(exp ast.Expression) {
+	switch exp := exp.(type) {
+	case *ast.CallExpression:
+		exp.Tail = true
+	case *ast.IfExpression:
+		markTailCalls(exp.Consequence, true)
+		markTailCalls(exp.Alternative, true)
+	}
+}
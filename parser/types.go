@@ -0,0 +1,172 @@
+package parser
+
+import (
+	"../ast"
+	"../token"
+	"fmt"
+)
+
+// NOTE: 型注釈の構文
+//   Type       := Primary ("|" Primary)*
+//   Primary    := IDENT ("[" Type ("," Type)* "]")?
+//               | "null"
+//               | "fn" ("(" (Type | "..." Type) ("," ...)* ")" ("->" Type)?)?
+// 型名(int, string等)はパーサーでは調べない
+
+// 型注釈のみの文字列(組み込み関数のシグネチャ等)をパースする
+func (p *Parser) ParseType() ast.TypeExpression {
+	t := p.parseType()
+	if t != nil && !p.peekTokenIs(token.EOF) {
+		p.peekError(token.EOF)
+	}
+	return t
+}
+
+// 引数(型注釈があればそれも含む)
+func (p *Parser) parseParameter() *ast.Identifier {
+	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		p.nextToken() // curTokenは型注釈の最初のtoken
+		ident.Type = p.parseType()
+	}
+
+	return ident
+}
+
+// curTokenは型の最初のtoken、型の最後のtokenまで進める
+func (p *Parser) parseType() ast.TypeExpression {
+	first := p.parsePrimaryType()
+	if first == nil || !p.peekTokenIs(token.PIPE) {
+		return first
+	}
+
+	union := &ast.UnionType{Token: p.curToken, Types: []ast.TypeExpression{first}}
+	for p.peekTokenIs(token.PIPE) {
+		p.nextToken()
+		p.nextToken()
+		t := p.parsePrimaryType()
+		if t == nil {
+			return nil
+		}
+		union.Types = append(union.Types, t)
+	}
+	return union
+}
+
+func (p *Parser) parsePrimaryType() ast.TypeExpression {
+	switch p.curToken.Type {
+	case token.IDENT:
+		return p.parseNamedType()
+	case token.NULL, token.NAMESPACE:
+		return &ast.NamedType{Token: p.curToken, Name: p.curToken.Literal}
+	case token.FUNCTION:
+		return p.parseFunctionType()
+	default:
+		msg := fmt.Sprintf("expected type, got %s instead", p.curToken.Type)
+		p.addError(p.curToken, msg)
+		return nil
+	}
+}
+
+func (p *Parser) parseNamedType() ast.TypeExpression {
+	named := &ast.NamedType{Token: p.curToken, Name: p.curToken.Literal}
+
+	if !p.peekTokenIs(token.LBRACKET) {
+		return named
+	}
+	p.nextToken()
+
+	args, ok := p.parseTypeList(token.RBRACKET)
+	if !ok {
+		return nil
+	}
+	for _, arg := range args {
+		if arg.variadic {
+			msg := fmt.Sprintf("unexpected ... in type arguments of %s", named.Name)
+			p.addError(named.Token, msg)
+			return nil
+		}
+		named.Arguments = append(named.Arguments, arg.t)
+	}
+	return named
+}
+
+func (p *Parser) parseFunctionType() ast.TypeExpression {
+	fnType := &ast.FunctionType{Token: p.curToken}
+
+	// `fn`のみの場合は引数、戻り値の型を問わない関数
+	if !p.peekTokenIs(token.LPAREN) {
+		fnType.Variadic = &ast.NamedType{Token: p.curToken, Name: "any"}
+		return fnType
+	}
+	p.nextToken()
+
+	params, ok := p.parseTypeList(token.RPAREN)
+	if !ok {
+		return nil
+	}
+	for i, param := range params {
+		if !param.variadic {
+			fnType.Parameters = append(fnType.Parameters, param.t)
+			continue
+		}
+		if i != len(params)-1 {
+			p.addError(fnType.Token, "... must be the last parameter type")
+			return nil
+		}
+		fnType.Variadic = param.t
+	}
+
+	if p.peekTokenIs(token.ARROW) {
+		p.nextToken()
+		p.nextToken()
+		fnType.Return = p.parseType()
+		if fnType.Return == nil {
+			return nil
+		}
+	}
+
+	return fnType
+}
+
+type typeListElement struct {
+	t        ast.TypeExpression
+	variadic bool // `...`が付いている
+}
+
+// curTokenは開き括弧、閉じ括弧(end)まで進める
+func (p *Parser) parseTypeList(end token.TokenType) ([]typeListElement, bool) {
+	list := []typeListElement{}
+
+	if p.peekTokenIs(end) {
+		p.nextToken()
+		return list, true
+	}
+
+	for {
+		p.nextToken()
+
+		variadic := p.curTokenIs(token.SPREAD)
+		if variadic {
+			p.nextToken()
+		}
+
+		t := p.parseType()
+		if t == nil {
+			return nil, false
+		}
+		list = append(list, typeListElement{t: t, variadic: variadic})
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(end) {
+		return nil, false
+	}
+	return list, true
+}
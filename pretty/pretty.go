@@ -0,0 +1,292 @@
+package pretty
+
+import (
+	"../object"
+	"fmt"
+	"strings"
+)
+
+// NOTE: 1行に収まる配列、ハッシュ、namespaceは1行で、収まらなければ要素ごとに改行し字下げする
+//   [1, 2, 3]
+//   {
+//     "a": [1, 2, 3],
+//     "b": {"c": "long string ..."}
+//   }
+// ハッシュのkeyは並べて表示し(Hash.SortedPairs)、自身を含む配列等は略記する
+
+type Options struct {
+	// 1行の幅(これを超える場合に改行する)
+	Width int
+	// 字下げ1段の空白の数
+	Indent int
+	// 配列、ハッシュ、namespaceで表示する要素の数(超えた分は省略、0以下なら全て)
+	MaxElements int
+	// 型(ObjectType)ごとにANSIエスケープシーケンスで色を付ける
+	Color bool
+}
+
+var DefaultOptions = Options{Width: 80, Indent: 2, MaxElements: 100}
+
+// 型ごとの色(SGRのパラメータ)
+var Colors = map[object.ObjectType]string{
+	object.INTEGER_OBJ:   "33",
+	object.STRING_OBJ:    "32",
+	object.BOOLEAN_OBJ:   "35",
+	object.NULL_OBJ:      "90",
+	object.FUNCTION_OBJ:  "36",
+	object.BUILDIN_OBJ:   "36",
+	object.NAMESPACE_OBJ: "34",
+	object.ERROR_OBJ:     "31",
+}
+
+// 省略した要素等の色
+const OMITTED_COLOR = "90"
+
+// objを整形した文字列
+// NOTE: 一番外側の文字列はInspect()同様""で囲まない(配列等の要素は囲む)
+func Format(obj object.Object, opts Options) string {
+	p := &printer{opts: opts, visiting: map[interface{}]bool{}}
+	d := p.doc(obj, true)
+
+	var out strings.Builder
+	p.render(&out, d, 0, 0, 0)
+	return out.String()
+}
+
+// 表示する内容(1行に収めるか改行するかはrenderで決める)
+type doc struct {
+	// 前に付ける文字列(ハッシュのkey等)
+	prefix      string
+	prefixWidth int
+
+	// 要素を持たない値
+	text  string
+	width int
+
+	// 配列、ハッシュ、namespace
+	composite   bool
+	open, close string
+	items       []*doc
+}
+
+type printer struct {
+	opts Options
+	// 表示中の配列、ハッシュ、環境(自身を含む場合に略記するため)
+	visiting map[interface{}]bool
+}
+
+func (p *printer) colored(text string, color string) string {
+	if !p.opts.Color || color == "" {
+		return text
+	}
+	return "\x1b[" + color + "m" + text + "\x1b[0m"
+}
+
+func (p *printer) atom(text string, color string) *doc {
+	return &doc{text: p.colored(text, color), width: len([]rune(text))}
+}
+
+func (p *printer) doc(obj object.Object, top bool) *doc {
+	switch obj := obj.(type) {
+	case *object.String:
+		if top {
+			return p.atom(obj.Value, Colors[obj.Type()])
+		}
+		// NOTE: 文字列にエスケープは無いため、そのまま""で囲む
+		return p.atom(`"`+obj.Value+`"`, Colors[obj.Type()])
+	case *object.Function:
+		// NOTE: 要素の関数は本体を省略する(複数行になるため)
+		if top {
+			return p.atom(obj.Inspect(), Colors[obj.Type()])
+		}
+		return p.atom(functionHeader(obj), Colors[obj.Type()])
+	case *object.Array:
+		if p.visiting[obj] {
+			return p.atom("[...]", OMITTED_COLOR)
+		}
+		p.visiting[obj] = true
+		defer delete(p.visiting, obj)
+
+		items := []*doc{}
+		for i, el := range obj.Elements {
+			if p.omit(i) {
+				items = append(items, p.omitted(len(obj.Elements)-i))
+				break
+			}
+			items = append(items, p.doc(el, false))
+		}
+		return &doc{composite: true, open: "[", close: "]", items: items}
+	case *object.Hash:
+		if p.visiting[obj] {
+			return p.atom("{...}", OMITTED_COLOR)
+		}
+		p.visiting[obj] = true
+		defer delete(p.visiting, obj)
+
+		items := []*doc{}
+		pairs := obj.SortedPairs()
+		for i, pair := range pairs {
+			if p.omit(i) {
+				items = append(items, p.omitted(len(pairs)-i))
+				break
+			}
+			key := p.doc(pair.Key, false)
+			items = append(items, p.withPrefix(key.text+": ", key.width+2,
+				p.doc(pair.Value, false)))
+		}
+		return &doc{composite: true, open: "{", close: "}", items: items}
+	case *object.NameSpace:
+		open := p.colored("namespace", Colors[obj.Type()]) + " {"
+		if p.visiting[obj.Env] {
+			return &doc{text: open + p.colored("...", OMITTED_COLOR) + "}",
+				width: len("namespace {...}")}
+		}
+		p.visiting[obj.Env] = true
+		defer delete(p.visiting, obj.Env)
+
+		items := []*doc{}
+		names := obj.Env.Names()
+		for i, name := range names {
+			if p.omit(i) {
+				items = append(items, p.omitted(len(names)-i))
+				break
+			}
+			value, _ := obj.Env.Get(name)
+			items = append(items, p.withPrefix(name+": ", len(name)+2,
+				p.doc(value, false)))
+		}
+		return &doc{composite: true, open: open, close: "}", items: items,
+			width: len("namespace ")}
+	case nil:
+		return p.atom("<nil>", OMITTED_COLOR)
+	default:
+		return p.atom(obj.Inspect(), Colors[obj.Type()])
+	}
+}
+
+func (p *printer) omit(i int) bool {
+	return p.opts.MaxElements > 0 && i >= p.opts.MaxElements
+}
+
+func (p *printer) omitted(n int) *doc {
+	return p.atom(fmt.Sprintf("... (%d more)", n), OMITTED_COLOR)
+}
+
+func (p *printer) withPrefix(prefix string, width int, d *doc) *doc {
+	d.prefix, d.prefixWidth = prefix+d.prefix, width+d.prefixWidth
+	return d
+}
+
+// `fn(x, y) {...}`
+func functionHeader(fn *object.Function) string {
+	params := []string{}
+	for _, param := range fn.Parameters {
+		params = append(params, param.String())
+	}
+	return "fn(" + strings.Join(params, ", ") + ") {...}"
+}
+
+// 1行で表示した場合の幅(prefixを含む)
+// NOTE: namespaceはopenに"namespace "を含むため、その幅をwidthに持つ
+func flatWidth(d *doc) int {
+	if !d.composite {
+		return d.prefixWidth + d.width
+	}
+	width := d.prefixWidth + d.width + 2
+	for i, item := range d.items {
+		if i > 0 {
+			width += 2
+		}
+		width += flatWidth(item)
+	}
+	return width
+}
+
+func (p *printer) renderFlat(out *strings.Builder, d *doc) {
+	out.WriteString(d.prefix)
+	if !d.composite {
+		out.WriteString(d.text)
+		return
+	}
+	out.WriteString(d.open)
+	for i, item := range d.items {
+		if i > 0 {
+			out.WriteString(", ")
+		}
+		p.renderFlat(out, item)
+	}
+	out.WriteString(d.close)
+}
+
+// dをcolumn桁目から表示する(trailingは後ろに続く文字の幅)
+func (p *printer) render(out *strings.Builder, d *doc, depth, column, trailing int) {
+	if !d.composite || len(d.items) == 0 ||
+		column+flatWidth(d)+trailing <= p.opts.Width {
+
+		p.renderFlat(out, d)
+		return
+	}
+
+	out.WriteString(d.prefix)
+	out.WriteString(d.open + "\n")
+	indent := strings.Repeat(" ", (depth+1)*p.opts.Indent)
+	if fillable(d) {
+		p.renderFill(out, d.items, indent)
+		out.WriteString(strings.Repeat(" ", depth*p.opts.Indent) + d.close)
+		return
+	}
+	for i, item := range d.items {
+		out.WriteString(indent)
+		if i < len(d.items)-1 {
+			p.render(out, item, depth+1, len(indent), 1)
+			out.WriteString(",\n")
+		} else {
+			p.render(out, item, depth+1, len(indent), 0)
+			out.WriteString("\n")
+		}
+	}
+	out.WriteString(strings.Repeat(" ", depth*p.opts.Indent) + d.close)
+}
+
+// 要素が全て数値等の配列(1行に詰めて表示する)
+func fillable(d *doc) bool {
+	if d.open != "[" {
+		return false
+	}
+	for _, item := range d.items {
+		if item.composite {
+			return false
+		}
+	}
+	return true
+}
+
+// 要素を幅に収まるだけ1行に並べる
+func (p *printer) renderFill(out *strings.Builder, items []*doc, indent string) {
+	column := 0
+	for i, item := range items {
+		width := flatWidth(item)
+		if i < len(items)-1 {
+			width++
+		}
+
+		switch {
+		case column == 0:
+			out.WriteString(indent)
+			column = len(indent)
+		case column+1+width > p.opts.Width:
+			out.WriteString("\n" + indent)
+			column = len(indent)
+		default:
+			out.WriteString(" ")
+			column++
+		}
+
+		p.renderFlat(out, item)
+		if i < len(items)-1 {
+			out.WriteString(",")
+		}
+		column += width
+	}
+	out.WriteString("\n")
+}
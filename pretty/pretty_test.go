@@ -0,0 +1,144 @@
+package pretty
+
+import (
+	"../ast"
+	"../object"
+	"../token"
+	"testing"
+)
+
+func integer(v int64) object.Object { return &object.Integer{Value: v} }
+func str(v string) object.Object    { return &object.String{Value: v} }
+
+func array(elements ...object.Object) *object.Array {
+	return &object.Array{Elements: elements}
+}
+
+// keyとvalueを交互に並べる
+func hash(pairs ...object.Object) *object.Hash {
+	h := &object.Hash{Pairs: map[object.HashKey]object.HashPair{}}
+	for i := 0; i < len(pairs); i += 2 {
+		key := pairs[i].(object.Hashable).HashKey()
+		h.Pairs[key] = object.HashPair{Key: pairs[i], Value: pairs[i+1]}
+	}
+	return h
+}
+
+func nameSpace(pairs ...object.Object) *object.NameSpace {
+	env := object.NewEnvironment()
+	for i := 0; i < len(pairs); i += 2 {
+		env.Set(pairs[i].(*object.String).Value, pairs[i+1])
+	}
+	return &object.NameSpace{Env: env}
+}
+
+func function(params ...string) *object.Function {
+	identifiers := []*ast.Identifier{}
+	for _, param := range params {
+		identifiers = append(identifiers, &ast.Identifier{
+			Token: token.Token{Type: token.IDENT, Literal: param}, Value: param})
+	}
+	return &object.Function{Parameters: identifiers, Body: &ast.BlockStatement{}}
+}
+
+func TestFormat(t *testing.T) {
+	selfArray := array(integer(1))
+	selfArray.Elements = append(selfArray.Elements, selfArray)
+	selfHash := hash()
+	selfHash.Pairs[str("h").(object.Hashable).HashKey()] =
+		object.HashPair{Key: str("h"), Value: selfHash}
+	selfNameSpace := nameSpace()
+	selfNameSpace.Env.Set("me", selfNameSpace)
+
+	tests := []struct {
+		obj      object.Object
+		width    int
+		expected string
+	}{
+		{str("a"), 20, `a`},
+		{array(integer(1), str("a"), &object.Boolean{Value: true}, &object.Null{}), 20,
+			`[1, "a", true, null]`},
+		// keyの順に並べる
+		{hash(str("b"), integer(1), str("a"), integer(2), integer(3), integer(3)), 30,
+			`{3: 3, "a": 2, "b": 1}`},
+		{array(function("x", "y"), &object.Builtin{}), 40,
+			`[fn(x, y) {...}, buildin function]`},
+		// 幅に収まらなければ改行する
+		{hash(str("a"), array(integer(1), integer(2)), str("b"), hash(str("c"), str("ddd"))),
+			20, `{
+  "a": [1, 2],
+  "b": {"c": "ddd"}
+}`},
+		{array(array(integer(1), integer(2), integer(3)), array(integer(4), integer(5),
+			integer(6))), 12, `[
+  [1, 2, 3],
+  [4, 5, 6]
+]`},
+		// 要素が数値等の配列は1行に詰める
+		{array(integer(100), integer(200), integer(300), integer(400), integer(500),
+			integer(600), integer(700)), 19, `[
+  100, 200, 300,
+  400, 500, 600,
+  700
+]`},
+		{nameSpace(str("a"), integer(1), str("b"), array(integer(1), integer(2),
+			integer(3))), 20, `namespace {
+  a: 1,
+  b: [1, 2, 3]
+}`},
+		// 自身を含む場合は略記する
+		{selfArray, 20, `[1, [...]]`},
+		{selfHash, 20, `{"h": {...}}`},
+		{selfNameSpace, 40, `namespace {me: namespace {...}}`},
+		{array(), 1, `[]`},
+	}
+
+	for _, tt := range tests {
+		opts := DefaultOptions
+		opts.Width = tt.width
+		actual := Format(tt.obj, opts)
+		if actual != tt.expected {
+			t.Errorf("wrong format.\nexpected=\n%s\ngot=\n%s", tt.expected, actual)
+		}
+	}
+}
+
+func TestFormatMaxElements(t *testing.T) {
+	opts := DefaultOptions
+	opts.MaxElements = 2
+
+	tests := []struct {
+		obj      object.Object
+		expected string
+	}{
+		{array(integer(1), integer(2), integer(3), integer(4)), `[1, 2, ... (2 more)]`},
+		{array(integer(1), integer(2)), `[1, 2]`},
+		{hash(str("a"), integer(1), str("b"), integer(2), str("c"), integer(3)),
+			`{"a": 1, "b": 2, ... (1 more)}`},
+	}
+
+	for _, tt := range tests {
+		if actual := Format(tt.obj, opts); actual != tt.expected {
+			t.Errorf("wrong format. expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestFormatColor(t *testing.T) {
+	opts := DefaultOptions
+	opts.Color = true
+
+	expected := "[\x1b[33m1\x1b[0m, \x1b[32m\"a\"\x1b[0m, \x1b[90mnull\x1b[0m]"
+	actual := Format(array(integer(1), str("a"), &object.Null{}), opts)
+	if actual != expected {
+		t.Errorf("wrong format. expected=%q, got=%q", expected, actual)
+	}
+
+	// 色の分は幅に数えない
+	opts.Width = 19
+	expected = "[\x1b[33m1\x1b[0m, \x1b[32m\"abcdefghij\"\x1b[0m]"
+	actual = Format(array(integer(1), str("abcdefghij")), opts)
+	if actual != expected {
+		t.Errorf("wrong format. expected=%q, got=%q", expected, actual)
+	}
+}
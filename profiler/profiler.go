@@ -0,0 +1,295 @@
+package profiler
+
+import (
+	"../evaluator"
+	"../object"
+	"../runscript"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// NOTE: evaluatorのフック(evaluator.SetCallTracer)で関数の呼び出しを記録する
+// (サンプリングではなく、全ての呼び出しの前後で時刻を測る)
+
+// プロファイラを有効にしてスクリプトファイルを実行する
+// 表形式のレポートをreportに、folded stacksをfoldedFileに書き込む
+func RunScript(fileName string, foldedFile string, out io.Writer,
+	report io.Writer) error {
+
+	p := New()
+	p.Start()
+	runscript.RunScript(fileName, out)
+	p.Stop()
+
+	if err := p.WriteText(report); err != nil {
+		return err
+	}
+
+	f, err := os.Create(foldedFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return p.WriteFolded(f)
+}
+
+// スクリプトのトップレベル(関数の外)
+const MAIN = "<main>"
+
+// 関数ごとの集計
+type Function struct {
+	Name string
+	// 定義した位置(`file:line`、組み込み関数は空文字)
+	Location string
+	Calls    int
+	// 呼び出した関数の時間を含む(再帰呼び出しは一番外側の呼び出しのみ数える)
+	// 末尾呼び出しをした場合は、呼び出し先から戻るまでを含む
+	Inclusive time.Duration
+	// 呼び出した関数の時間を含まない
+	Exclusive time.Duration
+	// 関数内で直接生成した配列、文字列の数と大きさ(要素数またはバイト数)
+	Allocations int
+	Allocated   int
+	// 評価中の呼び出しの数(再帰呼び出しの判定用)
+	active int
+}
+
+func (f *Function) String() string {
+	if f.Location == "" {
+		return f.Name
+	}
+	return fmt.Sprintf("%s (%s)", f.Name, f.Location)
+}
+
+type frame struct {
+	function *Function
+	start    time.Time
+	// 呼び出した関数にかかった時間
+	children time.Duration
+	// `<main>;f;g`形式の呼び出し経路(folded stacks)
+	stack string
+	// この関数を末尾呼び出しした関数(呼び出し元から連続した末尾呼び出しの分)と
+	// 最初の呼び出しの開始時刻
+	// NOTE: 末尾呼び出しのループでも大きくならないよう、関数ごとに1つだけ持つ
+	tailCallers map[*Function]bool
+	tailStart   time.Time
+}
+
+type Profiler struct {
+	// 関数リテラルの本体(*ast.BlockStatement)または*object.Builtinごとの集計
+	functions map[interface{}]*Function
+	stack     []*frame
+	// 呼び出し経路ごとのExclusiveの合計
+	folded map[string]time.Duration
+	main   *Function
+	prev   evaluator.CallTracer
+	// NOTE: テストで差し替えるため
+	now func() time.Time
+}
+
+func New() *Profiler {
+	main := &Function{Name: MAIN}
+	return &Profiler{
+		functions: make(map[interface{}]*Function),
+		folded:    make(map[string]time.Duration),
+		main:      main,
+		now:       time.Now,
+	}
+}
+
+// evaluatorのトレーサに設定し、計測を始める
+func (p *Profiler) Start() {
+	p.prev = evaluator.SetCallTracer(p)
+	p.push(p.main, MAIN)
+}
+
+// 計測を終え、以前のトレーサに戻す
+func (p *Profiler) Stop() {
+	for len(p.stack) > 0 {
+		p.pop()
+	}
+	evaluator.SetCallTracer(p.prev)
+}
+
+func (p *Profiler) Enter(fn object.Object) {
+	function := p.function(fn)
+	parent := p.stack[len(p.stack)-1]
+	p.push(function, parent.stack+";"+function.String())
+}
+
+func (p *Profiler) Exit(fn object.Object) {
+	// NOTE: Start前に評価中だった関数のExitは無視する
+	if len(p.stack) > 1 {
+		p.pop()
+	}
+}
+
+// 呼び出し元のフレームを呼び出し先に置き換える
+// (呼び出し元は呼び出し先から戻るまで評価中として扱い、Inclusiveに含める)
+// NOTE: folded stacksでは、呼び出し先は呼び出し元と同じ深さに並ぶ
+func (p *Profiler) TailCall(caller, callee object.Object) {
+	// NOTE: Start前に評価中だった関数からの末尾呼び出しは、呼び出し先のみ記録する
+	if len(p.stack) <= 1 {
+		p.Enter(callee)
+		return
+	}
+
+	f := p.stack[len(p.stack)-1]
+	now := p.now()
+	self := now.Sub(f.start) - f.children
+	f.function.Exclusive += self
+	p.folded[f.stack] += self
+
+	tailCallers, tailStart := f.tailCallers, f.tailStart
+	if tailCallers == nil {
+		tailCallers, tailStart = make(map[*Function]bool), f.start
+	}
+	if tailCallers[f.function] {
+		f.function.active--
+	} else {
+		tailCallers[f.function] = true
+	}
+
+	function := p.function(callee)
+	function.Calls++
+	function.active++
+	parent := p.stack[len(p.stack)-2]
+	p.stack[len(p.stack)-1] = &frame{
+		function:    function,
+		start:       now,
+		stack:       parent.stack + ";" + function.String(),
+		tailCallers: tailCallers,
+		tailStart:   tailStart,
+	}
+}
+
+func (p *Profiler) Allocate(size int) {
+	function := p.stack[len(p.stack)-1].function
+	function.Allocations++
+	function.Allocated += size
+}
+
+func (p *Profiler) push(function *Function, stack string) {
+	function.Calls++
+	function.active++
+	p.stack = append(p.stack, &frame{function: function, start: p.now(),
+		stack: stack})
+}
+
+func (p *Profiler) pop() {
+	f := p.stack[len(p.stack)-1]
+	p.stack = p.stack[:len(p.stack)-1]
+
+	now := p.now()
+	elapsed := now.Sub(f.start)
+	self := elapsed - f.children
+	f.function.Exclusive += self
+	f.function.active--
+	if f.function.active == 0 {
+		f.function.Inclusive += elapsed
+	}
+	p.folded[f.stack] += self
+
+	// 末尾呼び出しをした関数は、最初の呼び出しからの時間を含める
+	if f.tailCallers != nil {
+		elapsed = now.Sub(f.tailStart)
+		for function := range f.tailCallers {
+			function.active--
+			if function.active == 0 {
+				function.Inclusive += elapsed
+			}
+		}
+	}
+
+	if len(p.stack) > 0 {
+		p.stack[len(p.stack)-1].children += elapsed
+	}
+}
+
+func (p *Profiler) function(fn object.Object) *Function {
+	var key interface{} = fn
+	if f, ok := fn.(*object.Function); ok {
+		// NOTE: 同じ関数リテラルから生成したクロージャはまとめて集計する
+		key = f.Body
+	}
+	if function, ok := p.functions[key]; ok {
+		return function
+	}
+
+	function := &Function{}
+	switch fn := fn.(type) {
+	case *object.Function:
+		function.Name = fn.DisplayName()
+		function.Location = location(fn)
+	case *object.Builtin:
+		function.Name = fn.Name
+	}
+	p.functions[key] = function
+	return function
+}
+
+func location(fn *object.Function) string {
+	// NOTE: 関数リテラルの位置は保持していないため、本体の`{`の行
+	line := fn.Body.Token.Line
+	file := evaluator.FileNameOf(fn.Env)
+	if file == "" {
+		return fmt.Sprintf("line %d", line)
+	}
+	return fmt.Sprintf("%s:%d", filepath.Base(file), line)
+}
+
+// Exclusiveの降順(同じなら名前順)に並べた集計(<main>を含む)
+func (p *Profiler) Functions() []*Function {
+	functions := []*Function{p.main}
+	for _, function := range p.functions {
+		functions = append(functions, function)
+	}
+	sort.SliceStable(functions, func(i, j int) bool {
+		if functions[i].Exclusive != functions[j].Exclusive {
+			return functions[i].Exclusive > functions[j].Exclusive
+		}
+		return functions[i].String() < functions[j].String()
+	})
+	return functions
+}
+
+// 表形式のレポート(時間はミリ秒)
+func (p *Profiler) WriteText(w io.Writer) error {
+	var out strings.Builder
+	fmt.Fprintf(&out, "total: %.3fms\n", milliseconds(p.main.Inclusive))
+	fmt.Fprintf(&out, "%8s %12s %12s %8s %10s  %s\n",
+		"calls", "total(ms)", "self(ms)", "allocs", "allocated", "function")
+	for _, f := range p.Functions() {
+		fmt.Fprintf(&out, "%8d %12.3f %12.3f %8d %10d  %s\n",
+			f.Calls, milliseconds(f.Inclusive), milliseconds(f.Exclusive),
+			f.Allocations, f.Allocated, f)
+	}
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// flame graph用のfolded stacks形式(`<main>;f;g 123`、値はマイクロ秒)
+// NOTE: flamegraph.pl, speedscope, inferno等で描画できる
+func (p *Profiler) WriteFolded(w io.Writer) error {
+	stacks := make([]string, 0, len(p.folded))
+	for stack := range p.folded {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+
+	var out strings.Builder
+	for _, stack := range stacks {
+		fmt.Fprintf(&out, "%s %d\n", stack, p.folded[stack].Microseconds())
+	}
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
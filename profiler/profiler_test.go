@@ -0,0 +1,161 @@
+package profiler
+
+import (
+	"../evaluator"
+	"../lexer"
+	"../object"
+	"../parser"
+	"bytes"
+	"testing"
+	"time"
+)
+
+// 時刻を読むたびに1ms進む時計
+func newTestProfiler() *Profiler {
+	p := New()
+	current := time.Unix(0, 0)
+	p.now = func() time.Time {
+		t := current
+		current = current.Add(time.Millisecond)
+		return t
+	}
+	return p
+}
+
+func profile(t *testing.T, input string) *Profiler {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	p := newTestProfiler()
+	p.Start()
+	evaluated := evaluator.Eval(program, object.NewEnvironment())
+	p.Stop()
+
+	if errObj, ok := evaluated.(*object.Error); ok {
+		t.Fatalf("error in %q: %s", input, errObj.Inspect())
+	}
+	return p
+}
+
+func TestFunctions(t *testing.T) {
+	ms := time.Millisecond
+
+	tests := []struct {
+		input    string
+		expected []Function
+	}{
+		{
+			`let f = fn(x) { len(x) }; f("ab"); f("abc");`,
+			[]Function{
+				{Name: "f", Location: "line 1", Calls: 2, Inclusive: 6 * ms,
+					Exclusive: 4 * ms},
+				{Name: MAIN, Calls: 1, Inclusive: 9 * ms, Exclusive: 3 * ms,
+					Allocations: 2, Allocated: 5},
+				{Name: "len", Calls: 2, Inclusive: 2 * ms, Exclusive: 2 * ms},
+			},
+		},
+		// 再帰呼び出しのInclusiveは一番外側の呼び出しのみ数える
+		{
+			`let g = fn(n) { if (n == 0) { 0 } else { g(n - 1) + 0 } }; g(2);`,
+			[]Function{
+				{Name: "g", Location: "line 1", Calls: 3, Inclusive: 5 * ms,
+					Exclusive: 5 * ms},
+				{Name: MAIN, Calls: 1, Inclusive: 7 * ms, Exclusive: 2 * ms},
+			},
+		},
+		// 末尾呼び出しのInclusiveは呼び出し先から戻るまでを含む
+		{
+			`let g = fn() { 0 }; let f = fn() { g() }; f();`,
+			[]Function{
+				{Name: MAIN, Calls: 1, Inclusive: 4 * ms, Exclusive: 2 * ms},
+				{Name: "f", Location: "line 1", Calls: 1, Inclusive: 2 * ms,
+					Exclusive: 1 * ms},
+				{Name: "g", Location: "line 1", Calls: 1, Inclusive: 1 * ms,
+					Exclusive: 1 * ms},
+			},
+		},
+		{
+			`let h = fn(n) { if (n == 0) { 0 } else { h(n - 1) } }; h(2);`,
+			[]Function{
+				{Name: "h", Location: "line 1", Calls: 3, Inclusive: 3 * ms,
+					Exclusive: 3 * ms},
+				{Name: MAIN, Calls: 1, Inclusive: 5 * ms, Exclusive: 2 * ms},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		functions := profile(t, tt.input).Functions()
+
+		if len(functions) != len(tt.expected) {
+			t.Errorf("wrong number of functions in %q. expected=%d, got=%d",
+				tt.input, len(tt.expected), len(functions))
+			continue
+		}
+
+		for i, expected := range tt.expected {
+			actual := *functions[i]
+			actual.active = 0
+			if actual != expected {
+				t.Errorf("wrong function %d in %q.\nexpected=%+v\ngot=%+v",
+					i, tt.input, expected, actual)
+			}
+		}
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	p := profile(t, `let f = fn(x) { len(x) }; f("ab"); f("abc");`)
+
+	expected := `total: 9.000ms
+   calls    total(ms)     self(ms)   allocs  allocated  function
+       2        6.000        4.000        0          0  f (line 1)
+       1        9.000        3.000        2          5  <main>
+       2        2.000        2.000        0          0  len
+`
+
+	var out bytes.Buffer
+	if err := p.WriteText(&out); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out.String() != expected {
+		t.Errorf("wrong report.\nexpected=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestWriteFolded(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let f = fn(x) { len(x) }; f("ab"); f("abc");`,
+			"<main> 3000\n<main>;f (line 1) 4000\n<main>;f (line 1);len 2000\n",
+		},
+		{
+			`let g = fn(n) { if (n == 0) { 0 } else { g(n - 1) + 0 } }; g(1);`,
+			"<main> 2000\n<main>;g (line 1) 2000\n<main>;g (line 1);g (line 1) 1000\n",
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := profile(t, tt.input).WriteFolded(&out); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if out.String() != tt.expected {
+			t.Errorf("wrong folded stacks of %q.\nexpected=\n%s\ngot=\n%s",
+				tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestStopRestoresTracer(t *testing.T) {
+	outer := New()
+	outer.Start()
+	inner := New()
+	inner.Start()
+	inner.Stop()
+
+	if prev := evaluator.SetCallTracer(nil); prev != outer {
+		t.Errorf("tracer is not restored. got=%v", prev)
+	}
+}
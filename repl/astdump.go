@@ -0,0 +1,186 @@
+package repl
+
+import (
+	"../ast"
+	"fmt"
+	"strings"
+)
+
+// 構文木を1行1nodeで、子を字下げして表示する(`:ast`)
+// 文以外の子には、親のフィールド名を付ける
+func dumpAST(node ast.Node) string {
+	var out strings.Builder
+	writeNode(&out, "", node, 0)
+	return out.String()
+}
+
+type childNode struct {
+	label string
+	node  ast.Node
+}
+
+func writeNode(out *strings.Builder, label string, node ast.Node, depth int) {
+	out.WriteString(strings.Repeat("  ", depth))
+	if label != "" {
+		out.WriteString(label + ": ")
+	}
+	out.WriteString(describeNode(node) + "\n")
+
+	for _, child := range childNodes(node) {
+		writeNode(out, child.label, child.node, depth+1)
+	}
+}
+
+// nodeの種類と、子以外の値(識別子の名前、演算子等)
+func describeNode(node ast.Node) string {
+	switch node := node.(type) {
+	case *ast.Program:
+		return "Program"
+	case *ast.BlockStatement:
+		return "BlockStatement"
+	case *ast.LetStatement:
+		if node.IsConst() {
+			return "LetStatement const"
+		}
+		return "LetStatement"
+	case *ast.ReturnStatement:
+		return "ReturnStatement"
+	case *ast.ThrowStatement:
+		return "ThrowStatement"
+	case *ast.ExpressionStatement:
+		return "ExpressionStatement"
+	case *ast.Identifier:
+		if node.Type != nil {
+			return fmt.Sprintf("Identifier %s: %s", node.Value, node.Type)
+		}
+		return "Identifier " + node.Value
+	case *ast.IntegerLiteral:
+		return fmt.Sprintf("IntegerLiteral %d", node.Value)
+	case *ast.StringLiteral:
+		return fmt.Sprintf("StringLiteral %q", node.Value)
+	case *ast.Boolean:
+		return fmt.Sprintf("Boolean %t", node.Value)
+	case *ast.Null:
+		return "Null"
+	case *ast.PrefixExpression:
+		return "PrefixExpression " + node.Operator
+	case *ast.InfixExpression:
+		return "InfixExpression " + node.Operator
+	case *ast.IfExpression:
+		return "IfExpression"
+	case *ast.TryExpression:
+		return "TryExpression"
+	case *ast.FunctionLiteral:
+		if node.ReturnType != nil {
+			return "FunctionLiteral -> " + node.ReturnType.String()
+		}
+		return "FunctionLiteral"
+	case *ast.CallExpression:
+		return "CallExpression"
+	case *ast.ArrayLiteral:
+		return "ArrayLiteral"
+	case *ast.IndexExpression:
+		if node.Optional {
+			return "IndexExpression ?["
+		}
+		return "IndexExpression"
+	case *ast.HashLiteral:
+		return "HashLiteral"
+	case *ast.SpreadExpression:
+		return "SpreadExpression"
+	case *ast.NameSpaceLiteral:
+		return "NameSpaceLiteral"
+	case *ast.AssignExpression:
+		return "AssignExpression"
+	default:
+		return fmt.Sprintf("%T %s", node, node.String())
+	}
+}
+
+func childNodes(node ast.Node) []childNode {
+	children := []childNode{}
+	add := func(label string, node ast.Node) {
+		children = append(children, childNode{label, node})
+	}
+	addBlock := func(label string, block *ast.BlockStatement) {
+		if block != nil {
+			add(label, block)
+		}
+	}
+	addStatements := func(stmts []ast.Statement) {
+		for _, stmt := range stmts {
+			add("", stmt)
+		}
+	}
+	addExpression := func(label string, exp ast.Expression) {
+		if exp != nil {
+			add(label, exp)
+		}
+	}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		addStatements(node.Statements)
+	case *ast.BlockStatement:
+		addStatements(node.Statements)
+	case *ast.LetStatement:
+		add("Name", node.Name)
+		addExpression("Value", node.Value)
+	case *ast.ReturnStatement:
+		addExpression("ReturnValue", node.ReturnValue)
+	case *ast.ThrowStatement:
+		addExpression("Value", node.Value)
+	case *ast.ExpressionStatement:
+		addExpression("Expression", node.Expression)
+	case *ast.PrefixExpression:
+		addExpression("Right", node.Right)
+	case *ast.InfixExpression:
+		addExpression("Left", node.Left)
+		addExpression("Right", node.Right)
+	case *ast.IfExpression:
+		addExpression("Condition", node.Condition)
+		addBlock("Consequence", node.Consequence)
+		addBlock("Alternative", node.Alternative)
+	case *ast.TryExpression:
+		addBlock("Block", node.Block)
+		if node.Catch != nil {
+			add("Parameter", node.Parameter)
+			addBlock("Catch", node.Catch)
+		}
+		addBlock("Finally", node.Finally)
+	case *ast.FunctionLiteral:
+		for i, param := range node.Parameters {
+			add(fmt.Sprintf("Parameters[%d]", i), param)
+		}
+		addBlock("Body", node.Body)
+	case *ast.CallExpression:
+		addExpression("Function", node.Function)
+		for i, arg := range node.Arguments {
+			add(fmt.Sprintf("Arguments[%d]", i), arg)
+		}
+	case *ast.ArrayLiteral:
+		for i, el := range node.Elements {
+			add(fmt.Sprintf("Elements[%d]", i), el)
+		}
+	case *ast.IndexExpression:
+		addExpression("Left", node.Left)
+		addExpression("Index", node.Index)
+	case *ast.HashLiteral:
+		// NOTE: Pairsはmapのため、ソース上の順(Keys)で表示する
+		// (スプレッドはKeysのみに含まれる)
+		for i, key := range node.Keys {
+			add(fmt.Sprintf("Keys[%d]", i), key)
+			if value, ok := node.Pairs[key]; ok {
+				add(fmt.Sprintf("Values[%d]", i), value)
+			}
+		}
+	case *ast.SpreadExpression:
+		addExpression("Value", node.Value)
+	case *ast.NameSpaceLiteral:
+		addBlock("Body", node.Body)
+	case *ast.AssignExpression:
+		addExpression("Target", node.Target)
+		addExpression("Value", node.Value)
+	}
+	return children
+}
@@ -0,0 +1,167 @@
+package repl
+
+import (
+	"../evaluator"
+	"../lexer"
+	"../object"
+	"../parser"
+	"../pretty"
+	"../token"
+	"../typechecker"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// `:`で始まる行はreplのコマンド(`:type 1 + 2`)
+const COMMAND_PREFIX = ":"
+
+type command struct {
+	name string
+	// 引数の説明(引数を取らなければ空文字)
+	arg         string
+	description string
+	run         func(s *session, arg string)
+}
+
+// NOTE: :helpがcommandsを参照するため、initで代入する(初期化の循環を避ける)
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"env", "", "list the variables of the session", runEnv},
+		{"type", "expr", "show the type of expr (without evaluating it)", runType},
+		{"ast", "expr", "show the syntax tree of expr", runAST},
+		{"tokens", "expr", "show the tokens of expr", runTokens},
+		{"load", "file", "evaluate a script file in the session", runLoad},
+		{"reset", "", "remove all variables of the session", runReset},
+		{"time", "expr", "evaluate expr and show the elapsed time", runTime},
+		{"help", "", "show this help", runHelp},
+	}
+}
+
+// replを開いている間の状態
+type session struct {
+	env *object.Environment
+	out io.Writer
+	// 評価結果の表示形式
+	options pretty.Options
+}
+
+// 出力が端末なら、幅を端末に合わせ型ごとに色を付ける
+// NOTE: 環境変数NO_COLORがあれば色を付けない
+func newSession(out io.Writer) *session {
+	options := pretty.DefaultOptions
+	if f, ok := out.(*os.File); ok && isTerminal(int(f.Fd())) {
+		if width := terminalWidth(int(f.Fd())); width > 0 {
+			options.Width = width
+		}
+		_, noColor := os.LookupEnv("NO_COLOR")
+		options.Color = !noColor
+	}
+	return &session{env: object.NewEnvironment(), out: out, options: options}
+}
+
+func isCommand(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), COMMAND_PREFIX)
+}
+
+func (s *session) runCommand(line string) {
+	line = strings.TrimPrefix(strings.TrimSpace(line), COMMAND_PREFIX)
+	name, arg := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name, arg = line[:i], strings.TrimSpace(line[i+1:])
+	}
+
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		if c.arg != "" && arg == "" {
+			fmt.Fprintf(s.out, "usage: %s%s %s\n", COMMAND_PREFIX, c.name, c.arg)
+			return
+		}
+		c.run(s, arg)
+		return
+	}
+	fmt.Fprintf(s.out, "unknown command: %s%s (type %shelp for help)\n",
+		COMMAND_PREFIX, name, COMMAND_PREFIX)
+}
+
+func runEnv(s *session, arg string) {
+	for _, name := range s.env.Names() {
+		value, _ := s.env.Get(name)
+		fmt.Fprintf(s.out, "%s = %s\n", name, pretty.Format(value, s.options))
+	}
+}
+
+func runType(s *session, arg string) {
+	p := parser.New(lexer.New(arg))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, p.Errors())
+		return
+	}
+
+	t, diagnostics := typechecker.TypeOf(program, s.env)
+	if len(diagnostics) != 0 {
+		for _, d := range diagnostics {
+			fmt.Fprintf(s.out, "%d:%d: %s\n", d.Line, d.Column, d.Message)
+		}
+		return
+	}
+	fmt.Fprintln(s.out, t)
+}
+
+func runAST(s *session, arg string) {
+	p := parser.New(lexer.New(arg))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, p.Errors())
+		return
+	}
+	io.WriteString(s.out, dumpAST(program))
+}
+
+func runTokens(s *session, arg string) {
+	l := lexer.New(arg)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		fmt.Fprintf(s.out, "%-7s %-8s %q\n", fmt.Sprintf("%d:%d", tok.Line, tok.Column),
+			tok.Type, tok.Literal)
+	}
+}
+
+func runLoad(s *session, arg string) {
+	err := evaluator.LoadScriptFile(arg, s.env, Eval)
+	if err == nil {
+		return
+	}
+	if evalErr, ok := err.(*evaluator.EvalError); ok {
+		io.WriteString(s.out, evalErr.Object.Inspect()+"\n")
+		io.WriteString(s.out, evalErr.Object.Traceback())
+		return
+	}
+	io.WriteString(s.out, strings.TrimRight(err.Error(), "\n")+"\n")
+}
+
+func runReset(s *session, arg string) {
+	s.env = object.NewEnvironment()
+}
+
+func runTime(s *session, arg string) {
+	start := time.Now()
+	s.evalInput(arg)
+	fmt.Fprintf(s.out, "time: %s\n", time.Since(start))
+}
+
+func runHelp(s *session, arg string) {
+	for _, c := range commands {
+		usage := COMMAND_PREFIX + c.name
+		if c.arg != "" {
+			usage += " " + c.arg
+		}
+		fmt.Fprintf(s.out, "  %-14s %s\n", usage, c.description)
+	}
+}
@@ -0,0 +1,127 @@
+package repl
+
+import (
+	"../evaluator"
+	"../object"
+	"../token"
+	"sort"
+	"strings"
+)
+
+// 入力中の単語の補完(Tab)
+// カーソルより前の入力から、補完する単語の開始位置(バイト)と候補(辞書順)を返す
+type completer func(prefix string) (start int, candidates []string)
+
+// 補完の候補
+//   - 識別子: セッションの環境(とその外側)の変数、組み込み関数、キーワード
+//   - `ns.`の後: nsに束縛されたnamespace(import()で得たものを含む)のメンバー
+//   - 行頭の`:`の後: replのコマンド
+func (s *session) complete(prefix string) (int, []string) {
+	if isCommand(prefix) && !strings.ContainsAny(strings.TrimSpace(prefix), " \t") {
+		start := strings.Index(prefix, COMMAND_PREFIX)
+		names := []string{}
+		for _, c := range commands {
+			names = append(names, COMMAND_PREFIX+c.name)
+		}
+		sort.Strings(names)
+		return start, filterPrefix(names, prefix[start:])
+	}
+
+	// NOTE: 文字列の中は補完しない
+	if strings.Count(prefix, `"`)%2 == 1 {
+		return len(prefix), []string{}
+	}
+
+	start := len(prefix)
+	for start > 0 && isLetter(prefix[start-1]) {
+		start--
+	}
+	word := prefix[start:]
+
+	if strings.HasSuffix(prefix[:start], ".") {
+		nameSpace, ok := s.lookupNameSpace(prefix[:start-1])
+		if !ok {
+			return start, []string{}
+		}
+		return start, filterPrefix(nameSpace.Env.Names(), word)
+	}
+
+	// NOTE: 空の単語は補完しない(Tabで字下げできるように)
+	if word == "" {
+		return start, []string{}
+	}
+	return start, filterPrefix(s.names(), word)
+}
+
+// 変数、組み込み関数、キーワード(重複無し、辞書順)
+func (s *session) names() []string {
+	found := map[string]bool{}
+	for env := s.env; env != nil; env = env.Outer() {
+		for _, name := range env.Names() {
+			found[name] = true
+		}
+	}
+	for _, name := range evaluator.BuiltinNames() {
+		found[name] = true
+	}
+	for _, name := range token.Keywords() {
+		found[name] = true
+	}
+
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 入力の末尾の`a.b`(`?.`も可)が指すnamespace
+func (s *session) lookupNameSpace(input string) (*object.NameSpace, bool) {
+	end := len(input)
+	if strings.HasSuffix(input, "?") {
+		end--
+	}
+	start := end
+	for start > 0 && isLetter(input[start-1]) {
+		start--
+	}
+	name := input[start:end]
+	if name == "" {
+		return nil, false
+	}
+
+	var obj object.Object
+	var ok bool
+	if start > 0 && input[start-1] == '.' {
+		// `a.b`の`b`は`a`のメンバー
+		outer, found := s.lookupNameSpace(input[:start-1])
+		if !found {
+			return nil, false
+		}
+		obj, ok = outer.Env.Get(name)
+	} else {
+		obj, ok = s.env.Get(name)
+	}
+	if !ok {
+		return nil, false
+	}
+
+	nameSpace, ok := obj.(*object.NameSpace)
+	return nameSpace, ok
+}
+
+func filterPrefix(names []string, prefix string) []string {
+	filtered := []string{}
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			filtered = append(filtered, name)
+		}
+	}
+	return filtered
+}
+
+// NOTE: 識別子に使える文字は英字と_のみ(lexerと同じ)
+func isLetter(ch byte) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+}
@@ -0,0 +1,557 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// 入力中にCtrl-Cが押された(入力を取り消す)
+var ErrInterrupted = errors.New("interrupted")
+
+// 履歴を保存するファイル(ホームディレクトリ直下)
+// NOTE: 環境変数MONKEY_HISTORYで変更できる
+const HISTORY_FILE_NAME = ".monkey_history"
+
+// 履歴に残す行数
+const MAX_HISTORY = 1000
+
+// プロンプトを表示して1行読む
+// 入力の終わり(Ctrl-D)はio.EOF、Ctrl-CはErrInterruptedを返す
+type lineReader interface {
+	readLine(prompt string) (string, error)
+}
+
+// 入出力が端末なら行編集を使い、それ以外(パイプ等)は1行ずつそのまま読む
+func newLineReader(in io.Reader, out io.Writer, complete completer) lineReader {
+	inFile, inOk := in.(*os.File)
+	outFile, outOk := out.(*os.File)
+	if inOk && outOk && isTerminal(int(inFile.Fd())) && isTerminal(int(outFile.Fd())) {
+		return &terminalReader{
+			fd:     int(inFile.Fd()),
+			editor: newLineEditor(in, out, loadHistory(historyFileName()), complete),
+		}
+	}
+	return &scannerReader{scanner: bufio.NewScanner(in), out: out}
+}
+
+type scannerReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (r *scannerReader) readLine(prompt string) (string, error) {
+	io.WriteString(r.out, prompt)
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+// 1行読む間だけ端末をraw modeにする
+// NOTE: 評価中はCtrl-Cで今まで通り終了できるよう、読み終わったら元に戻す
+type terminalReader struct {
+	fd     int
+	editor *lineEditor
+}
+
+func (r *terminalReader) readLine(prompt string) (string, error) {
+	restore, err := makeRaw(r.fd)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+	return r.editor.readLine(prompt)
+}
+
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlG     = 7
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyCtrlJ     = 10
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlR     = 18
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// エスケープシーケンスのキー(矢印等)
+const (
+	keyUp = iota + unicode.MaxRune + 1
+	keyDown
+	keyRight
+	keyLeft
+	keyHome
+	keyEnd
+	keyDelete
+	keyUnknown
+)
+
+// 端末の行編集(emacs風のキー操作、履歴、Ctrl-Rでの履歴検索、Tabでの補完)
+// NOTE: 全角文字等の表示幅は考慮しない(1文字1桁とみなす)
+type lineEditor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	history *history
+	// nilなら補完しない
+	complete completer
+
+	prompt string
+	// 編集中の行とカーソル位置
+	buf []rune
+	pos int
+	// 表示中の履歴の位置(len(history.entries)なら編集中の行)
+	index int
+	// 履歴を遡る前に編集していた行
+	saved string
+}
+
+func newLineEditor(in io.Reader, out io.Writer, history *history,
+	complete completer) *lineEditor {
+
+	return &lineEditor{in: bufio.NewReader(in), out: out, history: history,
+		complete: complete}
+}
+
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	e.prompt, e.buf, e.pos = prompt, []rune{}, 0
+	e.index, e.saved = len(e.history.entries), ""
+	e.refresh()
+
+	for {
+		key, err := e.readKey()
+		if err != nil {
+			return "", err
+		}
+
+		switch key {
+		case keyEnter, keyCtrlJ:
+			return e.submit(), nil
+		case keyCtrlC:
+			io.WriteString(e.out, "^C\n")
+			return "", ErrInterrupted
+		case keyCtrlD:
+			if len(e.buf) == 0 {
+				return "", io.EOF
+			}
+			e.delete()
+		case keyDelete:
+			e.delete()
+		case keyBackspace, keyCtrlH:
+			if e.pos > 0 {
+				e.pos--
+				e.delete()
+			}
+		case keyCtrlA, keyHome:
+			e.pos = 0
+		case keyCtrlE, keyEnd:
+			e.pos = len(e.buf)
+		case keyCtrlB, keyLeft:
+			if e.pos > 0 {
+				e.pos--
+			}
+		case keyCtrlF, keyRight:
+			if e.pos < len(e.buf) {
+				e.pos++
+			}
+		case keyCtrlK:
+			e.buf = e.buf[:e.pos]
+		case keyCtrlU:
+			e.buf = append([]rune{}, e.buf[e.pos:]...)
+			e.pos = 0
+		case keyCtrlW:
+			e.deleteWord()
+		case keyCtrlP, keyUp:
+			e.previous()
+		case keyCtrlN, keyDown:
+			e.next()
+		case keyCtrlR:
+			submitted, err := e.search()
+			if err != nil {
+				return "", err
+			}
+			if submitted {
+				return e.submit(), nil
+			}
+		case keyCtrlL:
+			io.WriteString(e.out, "\x1b[H\x1b[2J")
+		case keyTab:
+			e.completeWord()
+		default:
+			if unicode.IsPrint(key) {
+				e.insert(key)
+			}
+		}
+		e.refresh()
+	}
+}
+
+// Tab: 候補が1つならその単語にし、複数なら共通の部分まで補完する
+// それ以上補完できなければ候補を一覧表示する
+// 補完する単語が無い(行頭等)場合は字下げする
+func (e *lineEditor) completeWord() {
+	if e.complete == nil {
+		e.indent()
+		return
+	}
+
+	prefix := string(e.buf[:e.pos])
+	start, candidates := e.complete(prefix)
+	word := prefix[start:]
+	// NOTE: startはバイト単位のため、rune単位の位置にする
+	runeStart := e.pos - len([]rune(word))
+
+	switch len(candidates) {
+	case 0:
+		if word == "" {
+			e.indent()
+		}
+		return
+	case 1:
+		e.replaceWord(runeStart, candidates[0])
+		return
+	}
+
+	if common := commonPrefix(candidates); len(common) > len(word) {
+		e.replaceWord(runeStart, common)
+		return
+	}
+	io.WriteString(e.out, "\n"+formatCandidates(candidates, CANDIDATES_WIDTH))
+}
+
+// NOTE: タブは表示幅が変わるため空白にする
+func (e *lineEditor) indent() {
+	e.insert(' ', ' ')
+}
+
+// start(rune単位)からカーソルまでをwordにする
+func (e *lineEditor) replaceWord(start int, word string) {
+	rest := e.buf[e.pos:]
+	buf := append([]rune{}, e.buf[:start]...)
+	buf = append(buf, []rune(word)...)
+	e.pos = len(buf)
+	e.buf = append(buf, rest...)
+}
+
+// 候補一覧の幅(端末の幅は調べない)
+const CANDIDATES_WIDTH = 80
+
+func commonPrefix(names []string) string {
+	common := names[0]
+	for _, name := range names[1:] {
+		for !strings.HasPrefix(name, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	return common
+}
+
+// 候補を列に揃えて並べる
+func formatCandidates(candidates []string, width int) string {
+	columnWidth := 0
+	for _, c := range candidates {
+		if len(c) > columnWidth {
+			columnWidth = len(c)
+		}
+	}
+	columnWidth += 2
+	columns := width / columnWidth
+	if columns < 1 {
+		columns = 1
+	}
+
+	var out strings.Builder
+	for i, c := range candidates {
+		if i%columns == columns-1 || i == len(candidates)-1 {
+			out.WriteString(c + "\n")
+		} else {
+			out.WriteString(c + strings.Repeat(" ", columnWidth-len(c)))
+		}
+	}
+	return out.String()
+}
+
+// 入力を確定し、履歴に加える
+func (e *lineEditor) submit() string {
+	line := string(e.buf)
+	e.pos = len(e.buf)
+	e.refresh()
+	io.WriteString(e.out, "\n")
+	e.history.add(line)
+	return line
+}
+
+// 1文字(エスケープシーケンスは1つのキー)読む
+func (e *lineEditor) readKey() (rune, error) {
+	r, _, err := e.in.ReadRune()
+	if err != nil || r != keyEscape {
+		return r, err
+	}
+
+	// ESC [ 引数 終端文字 (ESC O 終端文字)
+	r, _, err = e.in.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if r != '[' && r != 'O' {
+		return keyUnknown, nil
+	}
+	params := ""
+	for {
+		r, _, err = e.in.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		if r >= 0x40 && r <= 0x7e {
+			break
+		}
+		params += string(r)
+	}
+
+	switch r {
+	case 'A':
+		return keyUp, nil
+	case 'B':
+		return keyDown, nil
+	case 'C':
+		return keyRight, nil
+	case 'D':
+		return keyLeft, nil
+	case 'H':
+		return keyHome, nil
+	case 'F':
+		return keyEnd, nil
+	case '~':
+		switch params {
+		case "1", "7":
+			return keyHome, nil
+		case "4", "8":
+			return keyEnd, nil
+		case "3":
+			return keyDelete, nil
+		}
+	}
+	return keyUnknown, nil
+}
+
+func (e *lineEditor) insert(runes ...rune) {
+	buf := append([]rune{}, e.buf[:e.pos]...)
+	buf = append(buf, runes...)
+	e.buf = append(buf, e.buf[e.pos:]...)
+	e.pos += len(runes)
+}
+
+// カーソル位置の1文字を消す
+func (e *lineEditor) delete() {
+	if e.pos < len(e.buf) {
+		e.buf = append(e.buf[:e.pos], e.buf[e.pos+1:]...)
+	}
+}
+
+// カーソルの前の単語(と後ろの空白)を消す
+func (e *lineEditor) deleteWord() {
+	start := e.pos
+	for start > 0 && unicode.IsSpace(e.buf[start-1]) {
+		start--
+	}
+	for start > 0 && !unicode.IsSpace(e.buf[start-1]) {
+		start--
+	}
+	e.buf = append(e.buf[:start], e.buf[e.pos:]...)
+	e.pos = start
+}
+
+func (e *lineEditor) setLine(line string) {
+	e.buf = []rune(line)
+	e.pos = len(e.buf)
+}
+
+func (e *lineEditor) previous() {
+	if e.index == 0 {
+		return
+	}
+	if e.index == len(e.history.entries) {
+		e.saved = string(e.buf)
+	}
+	e.index--
+	e.setLine(e.history.entries[e.index])
+}
+
+func (e *lineEditor) next() {
+	if e.index >= len(e.history.entries) {
+		return
+	}
+	e.index++
+	if e.index == len(e.history.entries) {
+		e.setLine(e.saved)
+		return
+	}
+	e.setLine(e.history.entries[e.index])
+}
+
+// Ctrl-R: 入力した文字列を含む行を履歴の新しい方から探す
+// Ctrl-Rで更に古い行、Enterで確定、Ctrl-G(Ctrl-C)で検索前の行に戻す
+// それ以外のキーを押すと、見つけた行を編集できる
+func (e *lineEditor) search() (submitted bool, err error) {
+	entries := e.history.entries
+	original := string(e.buf)
+	query := []rune{}
+	index := len(entries)
+	failed := false
+
+	find := func(from int) {
+		for i := from; i >= 0; i-- {
+			if strings.Contains(entries[i], string(query)) {
+				index, failed = i, false
+				return
+			}
+		}
+		failed = true
+	}
+	match := func() string {
+		if index < len(entries) {
+			return entries[index]
+		}
+		return original
+	}
+
+	for {
+		label := "reverse-i-search"
+		if failed {
+			label = "failed " + label
+		}
+		fmt.Fprintf(e.out, "\r(%s)`%s': %s\x1b[K", label, string(query), match())
+
+		key, err := e.readKey()
+		if err != nil {
+			return false, err
+		}
+
+		switch key {
+		case keyCtrlR:
+			if index > 0 {
+				find(index - 1)
+			}
+		case keyBackspace, keyCtrlH:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				find(len(entries) - 1)
+			}
+		case keyCtrlG, keyCtrlC:
+			e.setLine(original)
+			return false, nil
+		case keyEnter, keyCtrlJ:
+			e.setLine(match())
+			return true, nil
+		default:
+			if unicode.IsPrint(key) {
+				query = append(query, key)
+				if index == len(entries) {
+					find(len(entries) - 1)
+				} else {
+					find(index)
+				}
+				continue
+			}
+			e.setLine(match())
+			return false, nil
+		}
+	}
+}
+
+// 行を表示し直し、カーソルを移動する
+func (e *lineEditor) refresh() {
+	var out strings.Builder
+	out.WriteString("\r" + e.prompt + string(e.buf) + "\x1b[K")
+	if n := len(e.buf) - e.pos; n > 0 {
+		fmt.Fprintf(&out, "\x1b[%dD", n)
+	}
+	io.WriteString(e.out, out.String())
+}
+
+// 入力した行の履歴
+// NOTE: fileNameが空の場合はファイルに保存しない
+type history struct {
+	entries  []string
+	fileName string
+}
+
+func historyFileName() string {
+	if fileName := os.Getenv("MONKEY_HISTORY"); fileName != "" {
+		return fileName
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, HISTORY_FILE_NAME)
+}
+
+// ファイルから履歴を読む(読めなければ空の履歴)
+// 行数がMAX_HISTORYを超えていたら、古い行を消してファイルを書き直す
+func loadHistory(fileName string) *history {
+	h := &history{entries: []string{}, fileName: fileName}
+	if fileName == "" {
+		return h
+	}
+
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return h
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			h.entries = append(h.entries, line)
+		}
+	}
+
+	if len(h.entries) > MAX_HISTORY {
+		h.entries = h.entries[len(h.entries)-MAX_HISTORY:]
+		ioutil.WriteFile(fileName, []byte(strings.Join(h.entries, "\n")+"\n"), 0600)
+	}
+	return h
+}
+
+// 履歴に加え、ファイルに追記する
+// NOTE: 空行と直前と同じ行は加えない
+func (h *history) add(line string) {
+	if strings.TrimSpace(line) == "" ||
+		(len(h.entries) > 0 && h.entries[len(h.entries)-1] == line) {
+		return
+	}
+	h.entries = append(h.entries, line)
+	if len(h.entries) > MAX_HISTORY {
+		h.entries = h.entries[1:]
+	}
+
+	if h.fileName == "" {
+		return
+	}
+	f, err := os.OpenFile(h.fileName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	io.WriteString(f, line+"\n")
+}
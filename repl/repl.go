@@ -5,41 +5,127 @@ import (
 	"../lexer"
 	"../object"
 	"../parser"
-	"bufio"
-	"fmt"
+	"../pretty"
 	"io"
+	"strings"
 )
 
 const PROMPT = ">> "
 
+// 入力が途中(括弧が閉じていない、文字列が終わっていない)の場合のプロンプト
+const CONTINUATION_PROMPT = ".. "
+
+// 入力途中で空行がこの数だけ続いたら、それまでの入力を捨てる
+const CANCEL_BLANK_LINES = 2
+
+// 入力を評価する関数(実行エンジンを切り替える場合は差し替える)
+var Eval evaluator.EvalFunc = evaluator.Eval
+
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	// replを開いている間、同じ環境(=変数はずっと保持)
-	env := object.NewEnvironment()
+	// replを開いている間、同じ環境(=変数はずっと保持、:resetで消す)
+	s := newSession(out)
+	reader := newLineReader(in, out, s.complete)
+
+	// 入力途中の行
+	pending := []string{}
+	blanks := 0
 
 	for {
-		fmt.Printf(PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		prompt := PROMPT
+		if len(pending) != 0 {
+			prompt = CONTINUATION_PROMPT
+		}
+
+		line, err := reader.readLine(prompt)
+		if err == ErrInterrupted {
+			// Ctrl-C: 入力途中の行も含めて捨てる
+			pending, blanks = []string{}, 0
+			continue
+		}
+		if err != nil {
+			io.WriteString(out, "\n")
+			// NOTE: 入力途中で終わった場合も評価する(構文エラーを表示するため)
+			if len(pending) != 0 {
+				s.evalInput(strings.Join(pending, "\n"))
+			}
 			return
 		}
 
-		line := scanner.Text()
-		l := lexer.New(line)
-		p := parser.New(l)
+		// NOTE: コマンドは入力途中でない場合のみ(1行で完結する)
+		if len(pending) == 0 && isCommand(line) {
+			s.runCommand(line)
+			continue
+		}
 
-		program := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+		if len(pending) != 0 && strings.TrimSpace(line) == "" {
+			blanks++
+			if blanks >= CANCEL_BLANK_LINES {
+				pending, blanks = []string{}, 0
+				io.WriteString(out, "input canceled\n")
+				continue
+			}
+		} else {
+			blanks = 0
+		}
+
+		pending = append(pending, line)
+		input := strings.Join(pending, "\n")
+		if incomplete(input) {
 			continue
 		}
 
-		evaluated := evaluator.Eval(program, env)
-		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
-			io.WriteString(out, "\n")
+		pending, blanks = []string{}, 0
+		s.evalInput(input)
+	}
+}
+
+func (s *session) evalInput(input string) {
+	l := lexer.New(input)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, p.Errors())
+		return
+	}
+
+	evaluated := Eval(program, s.env)
+	if evaluated != nil {
+		io.WriteString(s.out, pretty.Format(evaluated, s.options))
+		io.WriteString(s.out, "\n")
+		if errObj, ok := evaluated.(*object.Error); ok {
+			io.WriteString(s.out, errObj.Traceback())
+		}
+	}
+}
+
+// 括弧({}, [], ())が閉じていない、または文字列が終わっていないかどうか
+// NOTE: 閉じ括弧が多すぎる場合は、構文エラーを表示するため途中とはみなさない
+func incomplete(input string) bool {
+	depth := 0
+	inString := false
+
+	for i := 0; i < len(input); i++ {
+		ch := input[i]
+		if inString {
+			// NOTE: 文字列にエスケープは無い
+			if ch == '"' {
+				inString = false
+			}
+			continue
+		}
+
+		switch ch {
+		case '"':
+			inString = true
+		case '{', '[', '(':
+			depth++
+		case '}', ']', ')':
+			depth--
 		}
 	}
+
+	return inString || depth > 0
 }
 
 const MONKEY_FACE = `
@@ -0,0 +1,321 @@
+package repl
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"let a = 1;", false},
+		{"", false},
+		{"let f = fn(x) {", true},
+		{"let f = fn(x) {\n  x\n};", false},
+		{"[1, 2,", true},
+		{"puts(1,", true},
+		{`"abc`, true},
+		{"\"abc\ndef\"", false},
+		{`"{"`, false},
+		{`let s = "(" + "`, true},
+		// 閉じ括弧が多い場合は構文エラーを表示する
+		{"1 }", false},
+		{"} {", false},
+	}
+
+	for _, tt := range tests {
+		if actual := incomplete(tt.input); actual != tt.expected {
+			t.Errorf("wrong result of %q. expected=%t, got=%t",
+				tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestStart(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let add = fn(a, b) {\n  a + b\n};\nadd(1, 2)\n",
+			">> .. .. >> 3\n>> ",
+		},
+		{
+			"[1,\n2,\n\n3]\n",
+			">> .. .. .. [1, 2, 3]\n>> ",
+		},
+		{
+			"\"a\nb\"\n",
+			">> .. a\nb\n>> ",
+		},
+		// 配列等の要素の文字列は""で囲む
+		{
+			"[\"a\", {\"c\": 1, \"b\": 2}]\n",
+			">> [\"a\", {\"b\": 2, \"c\": 1}]\n>> ",
+		},
+		// 空行が2つ続くと入力を捨てる
+		{
+			"let f = fn() {\n\n\n1 + 1\n",
+			">> .. .. input canceled\n>> 2\n>> ",
+		},
+		// 入力途中で終わった場合は構文エラーを表示する
+		{
+			"puts(1 +\n",
+			">> .. \n" + MONKEY_FACE,
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(strings.NewReader(tt.input), &out)
+
+		if !strings.HasPrefix(out.String(), tt.expected) {
+			t.Errorf("wrong output of %q.\nexpected=%q\ngot=%q",
+				tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let b = 2;\nlet a = [1];\n:env\n", "a = [1]\nb = 2\n"},
+		{"let a = 1;\n:type a + 1\n", "int\n"},
+		// :typeは評価しない
+		{":type let a = 1;\na\n", "null\n>> ERROR: identifier not found: a\n"},
+		{":type \"a\" - 1\n", "1:5: type mismatch: string - int\n"},
+		{":ast -a[0]\n", `Program
+  ExpressionStatement
+    Expression: PrefixExpression -
+      Right: IndexExpression
+        Left: Identifier a
+        Index: IntegerLiteral 0
+`},
+		{":tokens let x\n", "1:1     LET      \"let\"\n1:5     IDENT    \"x\"\n"},
+		{"let a = 1;\n:reset\n:env\na\n", ">> >> >> >> ERROR: identifier not found: a\n"},
+		{":time 1 + 2\n", "3\ntime: "},
+		{":type\n", "usage: :type expr\n"},
+		{":foo\n", "unknown command: :foo (type :help for help)\n"},
+		{":help\n", "  :load file     evaluate a script file in the session\n"},
+		// 入力途中の行はコマンドとみなさない
+		{"[1,\n:env]\n", "parser errors:\n"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(strings.NewReader(tt.input), &out)
+
+		if !strings.Contains(out.String(), tt.expected) {
+			t.Errorf("wrong output of %q.\nexpected to contain=%q\ngot=%q",
+				tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestLoadCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monkey-load")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "lib.monkey")
+	ioutil.WriteFile(fileName, []byte("let double = fn(x) { x * 2 };"), 0644)
+
+	var out bytes.Buffer
+	Start(strings.NewReader(":load "+fileName+"\ndouble(21)\n"), &out)
+
+	if expected := ">> >> 42\n"; !strings.HasPrefix(out.String(), expected) {
+		t.Errorf("wrong output.\nexpected=%q\ngot=%q", expected, out.String())
+	}
+}
+
+func TestLineEditor(t *testing.T) {
+	entries := []string{"let a = 1;", "puts(a)", "let b = 2;"}
+
+	tests := []struct {
+		keys     string
+		expected string
+		err      error
+	}{
+		{"1 + 2\r", "1 + 2", nil},
+		{"ab\x7fc\r", "ac", nil},
+		// 矢印キーでカーソル移動
+		{"ac\x1b[Db\x1b[C!\r", "abc!", nil},
+		{"bc\x01a\x05d\r", "abcd", nil},
+		{"abc\x01\x1b[3~\r", "bc", nil},
+		{"abc\x02\x02\x0b\r", "a", nil},
+		{"abc\x02\x15\r", "c", nil},
+		{"let x = 1\x17\x17\x17y\r", "let y", nil},
+		// 履歴
+		{"\x1b[A\r", "let b = 2;", nil},
+		{"\x1b[A\x1b[A\x1b[A\x1b[A\r", "let a = 1;", nil},
+		{"x\x1b[A\x1b[B\r", "x", nil},
+		{"\x10\x10\x0e\r", "let b = 2;", nil},
+		// Ctrl-R: 履歴の検索
+		{"\x12let\r", "let b = 2;", nil},
+		{"\x12let\x12\r", "let a = 1;", nil},
+		{"x\x12zzz\x07\r", "x", nil},
+		{"\x12puts\x05;\r", "puts(a);", nil},
+		{"abc\x03", "", ErrInterrupted},
+		{"\x04", "", io.EOF},
+		// 入力途中でCtrl-Dを押すとカーソル位置の文字を消す
+		{"abc\x01\x04\r", "bc", nil},
+		{"abc", "", io.EOF},
+	}
+
+	for _, tt := range tests {
+		h := &history{entries: append([]string{}, entries...)}
+		e := newLineEditor(strings.NewReader(tt.keys), ioutil.Discard, h, nil)
+
+		actual, err := e.readLine(PROMPT)
+		if actual != tt.expected || err != tt.err {
+			t.Errorf("wrong result of %q. expected=(%q, %v), got=(%q, %v)",
+				tt.keys, tt.expected, tt.err, actual, err)
+		}
+	}
+}
+
+func TestComplete(t *testing.T) {
+	s := newSession(ioutil.Discard)
+	s.evalInput(`let value = 1;
+let values = [];
+let ns = namespace { let one = 1; let other = 2; let inner = namespace { let deep = 3; }; };
+let std = import("../scripts/std");`)
+
+	tests := []struct {
+		input      string
+		start      int
+		candidates []string
+	}{
+		{"val", 0, []string{"value", "values"}},
+		{"1 + valu", 4, []string{"value", "values"}},
+		// 組み込み関数、キーワード
+		{"le", 0, []string{"len", "let"}},
+		{"name", 0, []string{"namespace"}},
+		// namespaceのメンバー
+		{"ns.o", 3, []string{"one", "other"}},
+		{"ns?.in", 4, []string{"inner"}},
+		{"ns.inner.", 9, []string{"deep"}},
+		{"len(std.ma", 8, []string{"map"}},
+		{"value.", 6, []string{}},
+		{"unknown.", 8, []string{}},
+		// 空の単語、文字列の中は補完しない
+		{"let a = ", 8, []string{}},
+		{`puts("val`, 9, []string{}},
+		// replのコマンド
+		{":t", 0, []string{":time", ":tokens", ":type"}},
+		{":type val", 6, []string{"value", "values"}},
+	}
+
+	for _, tt := range tests {
+		start, candidates := s.complete(tt.input)
+		if start != tt.start || !reflect.DeepEqual(candidates, tt.candidates) {
+			t.Errorf("wrong completion of %q. expected=(%d, %q), got=(%d, %q)",
+				tt.input, tt.start, tt.candidates, start, candidates)
+		}
+	}
+}
+
+func TestLineEditorCompletion(t *testing.T) {
+	complete := func(prefix string) (int, []string) {
+		start := strings.LastIndex(prefix, " ") + 1
+		word := prefix[start:]
+		if word == "" {
+			return start, []string{}
+		}
+		return start, filterPrefix([]string{"print", "println", "puts", "push", "len"}, word)
+	}
+
+	tests := []struct {
+		keys     string
+		expected string
+		output   string
+	}{
+		{"l\t(x)\r", "len(x)", ""},
+		{"pu\t\r", "pu", "\nputs  push\n"},
+		// 共通の部分まで補完する
+		{"pr\t\r", "print", ""},
+		{"pr\tl\t\r", "println", ""},
+		{"x\t\r", "x", ""},
+		{"\tl\t\r", "  len", ""},
+		// カーソルの後ろは残す
+		{"le(x)\x1b[D\x1b[D\x1b[D\t\r", "len(x)", ""},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		e := newLineEditor(strings.NewReader(tt.keys), &out, &history{}, complete)
+
+		actual, err := e.readLine(PROMPT)
+		if err != nil || actual != tt.expected {
+			t.Errorf("wrong result of %q. expected=%q, got=(%q, %v)",
+				tt.keys, tt.expected, actual, err)
+		}
+		if !strings.Contains(out.String(), tt.output) {
+			t.Errorf("candidates of %q are not shown. expected=%q, got=%q",
+				tt.keys, tt.output, out.String())
+		}
+	}
+}
+
+func TestFormatCandidates(t *testing.T) {
+	candidates := []string{"a", "bb", "ccc", "d", "e"}
+	expected := "a    bb   ccc\nd    e\n"
+	if actual := formatCandidates(candidates, 15); actual != expected {
+		t.Errorf("wrong output.\nexpected=%q\ngot=%q", expected, actual)
+	}
+}
+
+func TestLineEditorOutput(t *testing.T) {
+	var out bytes.Buffer
+	e := newLineEditor(strings.NewReader("ab\x1b[D\r"), &out, &history{}, nil)
+	e.readLine(PROMPT)
+
+	expected := "\r>> \x1b[K" + "\r>> a\x1b[K" + "\r>> ab\x1b[K" +
+		"\r>> ab\x1b[K\x1b[1D" + "\r>> ab\x1b[K\n"
+	if out.String() != expected {
+		t.Errorf("wrong output.\nexpected=%q\ngot=%q", expected, out.String())
+	}
+}
+
+func TestHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "monkey-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, HISTORY_FILE_NAME)
+
+	h := loadHistory(fileName)
+	for _, line := range []string{"let a = 1;", "", "a", "a", "  ", "a + 1"} {
+		h.add(line)
+	}
+
+	expected := []string{"let a = 1;", "a", "a + 1"}
+	if loaded := loadHistory(fileName); !reflect.DeepEqual(loaded.entries, expected) {
+		t.Errorf("wrong history. expected=%q, got=%q", expected, loaded.entries)
+	}
+
+	// 古い行は消す
+	lines := []string{}
+	for i := 0; i < MAX_HISTORY+10; i++ {
+		lines = append(lines, strings.Repeat("a", i+1))
+	}
+	ioutil.WriteFile(fileName, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+	loadHistory(fileName)
+
+	loaded := loadHistory(fileName)
+	if len(loaded.entries) != MAX_HISTORY || loaded.entries[0] != lines[10] {
+		t.Errorf("history is not truncated. got %d lines", len(loaded.entries))
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !linux && !darwin
+
+package repl
+
+import "errors"
+
+// NOTE: linux, darwin以外では行編集を使わず、1行ずつそのまま読む
+
+func isTerminal(fd int) bool {
+	return false
+}
+
+func terminalWidth(fd int) int {
+	return 0
+}
+
+func makeRaw(fd int) (func(), error) {
+	return nil, errors.New("raw mode is not supported")
+}
@@ -0,0 +1,146 @@
+package resolver
+
+import (
+	"../ast"
+)
+
+// NOTE: 変数の参照(ast.Identifier)を、評価時の環境の位置(何個外側の環境の、何番目のスロットか)に
+// 静的に解決する
+// 関数、namespace、catchの本体がそれぞれ1つの環境を作る(if, tryのブロックは作らない)
+//
+// 以下は静的に解決せず、評価時に名前で探す
+//   - トップレベルの変数 (REPLの入力、importしたスクリプトの環境は名前で参照される)
+//   - `ns.x`の右辺 (nsの環境で評価される)
+//
+// 評価時、以下の場合は解決した位置より名前での検索を優先する(object.Environment.GetSlot)
+//   - self(), outer()で得たnamespaceに代入され、途中の環境に束縛された変数
+//   - namespace経由で参照され、外側の環境が変わった関数(`ns.f`)の外側の変数
+//   - 解決した位置の変数がまだ束縛されていない(ifの中のlet等)
+
+// programの変数の参照を解決する(programの各nodeを書き換える)
+// NOTE: パース時(parser.ParseProgram)とASTを書き換えた後(optimizer)に呼ぶ
+// (評価時に呼ぶと、同じprogramを同時に評価する他のgoroutineと競合する)
+func Resolve(program *ast.Program) {
+	for _, stmt := range program.Statements {
+		resolve(stmt, nil)
+	}
+}
+
+// 静的に解決できる変数の環境(トップレベルはnil)
+type scope struct {
+	vars  *ast.Scope
+	outer *scope
+}
+
+func resolve(node ast.Node, s *scope) {
+	ast.Walk(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.Identifier:
+			resolveIdentifier(node, s)
+		case *ast.FunctionLiteral:
+			node.Scope = declare(node.Body.Statements, node.Parameters)
+			inner := &scope{vars: node.Scope, outer: s}
+			for _, param := range node.Parameters {
+				resolveIdentifier(param, inner)
+			}
+			resolve(node.Body, inner)
+			return false
+		case *ast.NameSpaceLiteral:
+			node.Scope = declare(node.Body.Statements, nil)
+			resolve(node.Body, &scope{vars: node.Scope, outer: s})
+			return false
+		case *ast.TryExpression:
+			resolve(node.Block, s)
+			if node.Catch != nil {
+				node.CatchScope = declare(node.Catch.Statements,
+					[]*ast.Identifier{node.Parameter})
+				inner := &scope{vars: node.CatchScope, outer: s}
+				resolveIdentifier(node.Parameter, inner)
+				resolve(node.Catch, inner)
+			}
+			if node.Finally != nil {
+				resolve(node.Finally, s)
+			}
+			return false
+		case *ast.InfixExpression:
+			if isDot(node) {
+				resolve(node.Left, s)
+				unresolve(node.Right)
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func resolveIdentifier(ident *ast.Identifier, s *scope) {
+	ident.Resolved = false
+
+	depth := 0
+	for ; s != nil; s = s.outer {
+		if slot, ok := s.vars.Slots[ident.Value]; ok {
+			ident.Resolved = true
+			ident.Depth = depth
+			ident.Slot = slot
+			return
+		}
+		depth++
+	}
+}
+
+// `ns.x`の右辺は全て名前で探す
+func unresolve(node ast.Node) {
+	ast.Walk(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.Identifier:
+			node.Resolved = false
+		case *ast.FunctionLiteral:
+			node.Scope = nil
+		case *ast.NameSpaceLiteral:
+			node.Scope = nil
+		case *ast.TryExpression:
+			node.CatchScope = nil
+		}
+		return true
+	})
+}
+
+// 本体(と引数)で宣言される変数
+func declare(stmts []ast.Statement, params []*ast.Identifier) *ast.Scope {
+	vars := ast.NewScope()
+	for _, param := range params {
+		vars.Declare(param.Value)
+	}
+	for _, stmt := range stmts {
+		collect(vars, stmt)
+	}
+	return vars
+}
+
+func collect(vars *ast.Scope, node ast.Node) {
+	ast.Walk(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			vars.Declare(node.Name.Value)
+		case *ast.FunctionLiteral, *ast.NameSpaceLiteral:
+			return false
+		case *ast.TryExpression:
+			// catchの本体は内側の環境
+			collect(vars, node.Block)
+			if node.Finally != nil {
+				collect(vars, node.Finally)
+			}
+			return false
+		case *ast.InfixExpression:
+			if isDot(node) {
+				collect(vars, node.Left)
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func isDot(node *ast.InfixExpression) bool {
+	return node.Operator == "." || node.Operator == "?."
+}
@@ -0,0 +1,75 @@
+package resolver_test
+
+import (
+	"../ast"
+	"../lexer"
+	"../parser"
+	"../resolver"
+	"fmt"
+	"testing"
+)
+
+// 解決した変数の参照を"name@depth:slot"、解決しなかった参照を"name"で列挙
+func resolved(program *ast.Program) []string {
+	idents := []string{}
+	ast.Walk(program, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok {
+			if ident.Resolved {
+				idents = append(idents,
+					fmt.Sprintf("%s@%d:%d", ident.Value, ident.Depth, ident.Slot))
+			} else {
+				idents = append(idents, ident.Value)
+			}
+		}
+		return true
+	})
+	return idents
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		// トップレベルは名前で探す
+		{"let a = 1; a", []string{"a", "a"}},
+		// 引数、ローカル変数
+		{"fn(x, y) { let z = x; y }", []string{"x@0:0", "y@0:1", "z@0:2", "x@0:0", "y@0:1"}},
+		// 外側の関数の変数
+		{"fn(x) { fn(y) { x + y } }", []string{"x@0:0", "y@0:0", "x@1:0", "y@0:0"}},
+		// 宣言されていない変数(組み込み関数等)
+		{"fn(x) { len(x) }", []string{"x@0:0", "len", "x@0:0"}},
+		// 宣言前の参照も同じスロット(束縛前は評価時に外側を探す)
+		{"fn() { x; let x = 1; }", []string{"x@0:0", "x@0:0"}},
+		// ifのブロックは環境を作らない
+		{"fn(c) { if (c) { let v = 1; }; v }", []string{"c@0:0", "c@0:0", "v@0:1", "v@0:1"}},
+		// namespace
+		{"fn(x) { namespace { let y = x; } }", []string{"x@0:0", "y@0:0", "x@1:0"}},
+		// "."の右辺は左辺のnamespaceで名前で探す(呼び出しの引数は呼び出し側の環境)
+		{"fn(ns, x) { ns.x; ns.f(x) }", []string{"ns@0:0", "x@0:1", "ns@0:0", "x", "ns@0:0", "f", "x@0:1"}},
+		// catchの変数は内側の環境
+		{"fn(x) { try { let t = 1; } catch (e) { e; x } }",
+			[]string{"x@0:0", "t@0:1", "e@0:0", "e@0:0", "x@1:0"}},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		resolver.Resolve(program)
+
+		actual := resolved(program)
+		if fmt.Sprint(actual) != fmt.Sprint(tt.expected) {
+			t.Errorf("wrong resolution of %q. expected=%v, got=%v",
+				tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestResolveScope(t *testing.T) {
+	program := parser.New(lexer.New("fn(a, b) { let c = 1; let a = 2; fn(d) { let e = 3; } }")).ParseProgram()
+	resolver.Resolve(program)
+
+	function := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if fmt.Sprint(function.Scope.Names) != "[a b c]" {
+		t.Errorf("wrong scope. got=%v", function.Scope.Names)
+	}
+}
@@ -6,9 +6,15 @@ import (
 	"io"
 )
 
+// スクリプトファイルを実行する関数(実行エンジンを切り替える場合は差し替える)
+var EvalScriptFile = evaluator.EvalScriptFile
+
 func RunScript(fileName string, out io.Writer) {
-	_, err := evaluator.EvalScriptFile(fileName)
+	_, err := EvalScriptFile(fileName)
 	if err != nil {
 		io.WriteString(out, fmt.Sprintf("%s", err))
+		if evalErr, ok := err.(*evaluator.EvalError); ok {
+			io.WriteString(out, "\n"+evalErr.Object.Traceback())
+		}
 	}
 }
@@ -0,0 +1,161 @@
+package testrunner
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// 失敗したテスト(verboseなら成功したテストも)と、ファイルごとの結果
+func WriteText(w io.Writer, results []*FileResult, verbose bool) error {
+	var out strings.Builder
+	for _, f := range results {
+		for _, r := range f.Results {
+			if r.Passed {
+				if verbose {
+					fmt.Fprintf(&out, "--- PASS: %s\n", r.Name)
+				}
+				continue
+			}
+			fmt.Fprintf(&out, "--- FAIL: %s\n%s\n", r.Name, indent(r.Message, "    "))
+		}
+
+		switch {
+		case f.Error != "":
+			fmt.Fprintf(&out, "FAIL\t%s\n%s\n", f.File, indent(f.Error, "    "))
+		case f.Failed() > 0:
+			fmt.Fprintf(&out, "FAIL\t%s\t(%d passed, %d failed)\n", f.File,
+				f.Passed(), f.Failed())
+		default:
+			fmt.Fprintf(&out, "ok  \t%s\t(%d passed)\n", f.File, f.Passed())
+		}
+	}
+
+	passed, failed := Count(results)
+	result := "PASS"
+	if failed > 0 {
+		result = "FAIL"
+	}
+	fmt.Fprintf(&out, "%s: %d passed, %d failed\n", result, passed, failed)
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// TAP(Test Anything Protocol) version 13
+// 失敗の理由はYAMLブロックのmessageに書く
+func WriteTAP(w io.Writer, results []*FileResult) error {
+	type point struct {
+		ok          bool
+		description string
+		message     string
+	}
+	points := []point{}
+	for _, f := range results {
+		for _, r := range f.Results {
+			points = append(points, point{r.Passed, f.File + " " + r.Name, r.Message})
+		}
+		if f.Error != "" {
+			points = append(points, point{false, f.File, f.Error})
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "TAP version 13\n1..%d\n", len(points))
+	for i, p := range points {
+		if p.ok {
+			fmt.Fprintf(&out, "ok %d - %s\n", i+1, p.description)
+			continue
+		}
+		fmt.Fprintf(&out, "not ok %d - %s\n", i+1, p.description)
+		fmt.Fprintf(&out, "  ---\n  message: |\n%s\n  ...\n", indent(p.message, "    "))
+	}
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name          `xml:"testsuites"`
+	Tests    int               `xml:"tests,attr"`
+	Failures int               `xml:"failures,attr"`
+	Errors   int               `xml:"errors,attr"`
+	Suites   []*junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string           `xml:"name,attr"`
+	Tests     int              `xml:"tests,attr"`
+	Failures  int              `xml:"failures,attr"`
+	Errors    int              `xml:"errors,attr"`
+	Time      string           `xml:"time,attr"`
+	TestCases []*junitTestCase `xml:"testcase"`
+	// テストを実行できなかった理由
+	SystemErr *junitText `xml:"system-err,omitempty"`
+}
+
+type junitText struct {
+	Text string `xml:",cdata"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",cdata"`
+}
+
+// JUnit XML(テストファイルごとにtestsuite、時間は秒)
+// 実行できなかったファイルはtestsuiteのerrorsとsystem-errに書く
+func WriteJUnit(w io.Writer, results []*FileResult) error {
+	suites := &junitTestSuites{}
+	for _, f := range results {
+		suite := &junitTestSuite{Name: f.File, Tests: len(f.Results),
+			Failures: f.Failed(), TestCases: []*junitTestCase{}}
+
+		seconds := 0.0
+		for _, r := range f.Results {
+			seconds += r.Duration.Seconds()
+			testCase := &junitTestCase{Name: r.Name, ClassName: f.File,
+				Time: fmt.Sprintf("%.6f", r.Duration.Seconds())}
+			if !r.Passed {
+				// NOTE: messageには1行目(エラーメッセージ)のみ書く
+				testCase.Failure = &junitFailure{
+					Message: strings.SplitN(r.Message, "\n", 2)[0], Text: r.Message}
+			}
+			suite.TestCases = append(suite.TestCases, testCase)
+		}
+		suite.Time = fmt.Sprintf("%.6f", seconds)
+
+		if f.Error != "" {
+			suite.Errors = 1
+			suite.SystemErr = &junitText{Text: f.Error}
+		}
+
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Errors += suite.Errors
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	output, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, xml.Header+string(output)+"\n")
+	return err
+}
+
+func indent(text string, prefix string) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = prefix + line
+	}
+	return strings.Join(lines, "\n")
+}
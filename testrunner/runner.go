@@ -0,0 +1,177 @@
+package testrunner
+
+import (
+	"../ast"
+	"../evaluator"
+	"../lexer"
+	"../object"
+	"../parser"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// NOTE: テストファイル(*_test.monkey)のトップレベルで`let test_xxx = fn() {...}`と
+// 定義した関数を、定義順に1つずつ呼び出す
+// テストごとにファイルを新しい環境で評価し直すため、テスト間で変数は共有されない
+
+const (
+	TEST_FILE_SUFFIX = "_test.monkey"
+	TEST_PREFIX      = "test_"
+)
+
+// テスト関数1つの結果
+type Result struct {
+	Name   string
+	Passed bool
+	// 失敗した理由(エラーメッセージとトレースバック)
+	Message  string
+	Duration time.Duration
+}
+
+// テストファイル1つの結果
+type FileResult struct {
+	File    string
+	Results []*Result
+	// テストを実行できなかった理由(構文エラー、トップレベルのエラー等)
+	Error string
+}
+
+func (f *FileResult) Passed() int {
+	passed := 0
+	for _, r := range f.Results {
+		if r.Passed {
+			passed++
+		}
+	}
+	return passed
+}
+
+func (f *FileResult) Failed() int {
+	return len(f.Results) - f.Passed()
+}
+
+// 成功したテストの数と失敗したテストの数
+// (実行できなかったファイルは1つの失敗として数える)
+func Count(results []*FileResult) (passed int, failed int) {
+	for _, f := range results {
+		passed += f.Passed()
+		failed += f.Failed()
+		if f.Error != "" {
+			failed++
+		}
+	}
+	return passed, failed
+}
+
+// 引数のファイル(ディレクトリの場合は中の*_test.monkey)
+// 引数が無ければカレントディレクトリを探す
+func Discover(paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	fileNames := []string{}
+	for _, path := range paths {
+		err := filepath.Walk(path, func(fileName string, info os.FileInfo,
+			err error) error {
+
+			if err != nil {
+				return err
+			}
+			// NOTE: 引数で直接指定されたファイルは名前によらず含める
+			if !info.IsDir() &&
+				(fileName == path || strings.HasSuffix(fileName, TEST_FILE_SUFFIX)) {
+				fileNames = append(fileNames, fileName)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fileNames, nil
+}
+
+func Run(fileNames []string) []*FileResult {
+	results := []*FileResult{}
+	for _, fileName := range fileNames {
+		results = append(results, RunFile(fileName))
+	}
+	return results
+}
+
+// テストファイルの全てのテスト関数を実行する
+func RunFile(fileName string) *FileResult {
+	fileName = filepath.Clean(fileName)
+	result := &FileResult{File: fileName, Results: []*Result{}}
+
+	source, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		result.Error = fmt.Sprintf("file could not open: %s", fileName)
+		return result
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		result.Error = "parser errors:\n" + strings.Join(p.Errors(), "\n")
+		return result
+	}
+
+	for _, name := range TestNames(program) {
+		r, err := runTest(fileName, program, name)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		result.Results = append(result.Results, r)
+	}
+	return result
+}
+
+// トップレベルで定義されたテスト関数の名前(定義順)
+func TestNames(program *ast.Program) []string {
+	names := []string{}
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok || !strings.HasPrefix(let.Name.Value, TEST_PREFIX) {
+			continue
+		}
+		if _, ok := let.Value.(*ast.FunctionLiteral); ok {
+			names = append(names, let.Name.Value)
+		}
+	}
+	return names
+}
+
+// 新しい環境でファイルを評価し、テスト関数を呼び出す
+// ファイルの評価に失敗した場合はerrorを返す
+func runTest(fileName string, program *ast.Program, name string) (*Result, error) {
+	env := evaluator.NewScriptEnvironment(fileName)
+	if errObj, ok := evaluator.Eval(program, env).(*object.Error); ok {
+		return nil, fmt.Errorf("%s", errorMessage(errObj))
+	}
+
+	fn, _ := env.Get(name)
+	start := time.Now()
+	evaluated := evaluator.ApplyFunction(fn, []object.Object{}, env)
+	result := &Result{Name: name, Passed: true, Duration: time.Since(start)}
+
+	if errObj, ok := evaluated.(*object.Error); ok {
+		result.Passed = false
+		result.Message = errorMessage(errObj)
+	}
+	return result, nil
+}
+
+func errorMessage(errObj *object.Error) string {
+	message := errObj.Message
+	if traceback := errObj.Traceback(); traceback != "" {
+		message += "\n" + strings.TrimRight(traceback, "\n")
+	}
+	return message
+}
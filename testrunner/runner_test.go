@@ -0,0 +1,226 @@
+package testrunner
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const MATH_TEST = `let log = [];
+let test_add = fn() {
+  push(log, 1);
+  assert_eq(1 + 2, 3);
+};
+let test_fresh = fn() {
+  assert_eq(len(log), 0, "log");
+};
+let helper = fn() { assert(false) };
+let test_fail = fn() {
+  assert_eq([1, 2], [1, 3]);
+};
+`
+
+const BROKEN_TEST = `let test_x = fn() { 1 };
+let y = z;
+`
+
+func writeTests(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "monkey-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, script := range map[string]string{
+		"math_test.monkey":       MATH_TEST,
+		"sub/broken_test.monkey": BROKEN_TEST,
+		"lib.monkey":             "let test_not_run = fn() { assert(false) };",
+	} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(script), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestDiscover(t *testing.T) {
+	dir, remove := writeTests(t)
+	defer remove()
+
+	tests := []struct {
+		paths    []string
+		expected []string
+	}{
+		{[]string{dir}, []string{"math_test.monkey", "sub/broken_test.monkey"}},
+		// 直接指定されたファイルは名前によらず含める
+		{[]string{filepath.Join(dir, "lib.monkey")}, []string{"lib.monkey"}},
+	}
+
+	for _, tt := range tests {
+		fileNames, err := Discover(tt.paths)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		actual := []string{}
+		for _, fileName := range fileNames {
+			rel, _ := filepath.Rel(dir, fileName)
+			actual = append(actual, filepath.ToSlash(rel))
+		}
+		if !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("wrong files. expected=%v, got=%v", tt.expected, actual)
+		}
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	dir, remove := writeTests(t)
+	defer remove()
+
+	result := RunFile(filepath.Join(dir, "math_test.monkey"))
+	if result.Error != "" {
+		t.Fatalf("unexpected error: %s", result.Error)
+	}
+
+	expected := []struct {
+		name    string
+		passed  bool
+		message string
+	}{
+		{"test_add", true, ""},
+		// テストごとに新しい環境で評価する
+		{"test_fresh", true, ""},
+		{"test_fail", false, "assert_eq failed: [1]: expected 3, got 2\n" +
+			"traceback (most recent call last):\n" +
+			"    at test_fail (" + filepath.Join(dir, "math_test.monkey") + ":11)"},
+	}
+
+	if len(result.Results) != len(expected) {
+		t.Fatalf("wrong number of results. expected=%d, got=%d",
+			len(expected), len(result.Results))
+	}
+	for i, e := range expected {
+		r := result.Results[i]
+		if r.Name != e.name || r.Passed != e.passed || r.Message != e.message {
+			t.Errorf("wrong result %d. expected=%+v, got=%+v", i, e, r)
+		}
+	}
+
+	broken := RunFile(filepath.Join(dir, "sub", "broken_test.monkey"))
+	if len(broken.Results) != 0 ||
+		!strings.HasPrefix(broken.Error, "identifier not found: z") {
+		t.Errorf("wrong result of broken file. got=%+v", broken)
+	}
+}
+
+func testResults() []*FileResult {
+	return []*FileResult{
+		{File: "math_test.monkey", Results: []*Result{
+			{Name: "test_add", Passed: true, Duration: time.Millisecond},
+			{Name: "test_fail", Message: "assert failed: got false\n  at line 2",
+				Duration: 2 * time.Millisecond},
+		}},
+		{File: "broken_test.monkey", Results: []*Result{},
+			Error: "identifier not found: z"},
+		{File: "ok_test.monkey", Results: []*Result{
+			{Name: "test_ok", Passed: true},
+		}},
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	tests := []struct {
+		verbose  bool
+		expected string
+	}{
+		{false, `--- FAIL: test_fail
+    assert failed: got false
+      at line 2
+FAIL	math_test.monkey	(1 passed, 1 failed)
+FAIL	broken_test.monkey
+    identifier not found: z
+ok  	ok_test.monkey	(1 passed)
+FAIL: 2 passed, 2 failed
+`},
+		{true, `--- PASS: test_add
+--- FAIL: test_fail
+    assert failed: got false
+      at line 2
+FAIL	math_test.monkey	(1 passed, 1 failed)
+FAIL	broken_test.monkey
+    identifier not found: z
+--- PASS: test_ok
+ok  	ok_test.monkey	(1 passed)
+FAIL: 2 passed, 2 failed
+`},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := WriteText(&out, testResults(), tt.verbose); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if out.String() != tt.expected {
+			t.Errorf("wrong output.\nexpected=\n%s\ngot=\n%s", tt.expected, out.String())
+		}
+	}
+}
+
+func TestWriteTAP(t *testing.T) {
+	expected := `TAP version 13
+1..4
+ok 1 - math_test.monkey test_add
+not ok 2 - math_test.monkey test_fail
+  ---
+  message: |
+    assert failed: got false
+      at line 2
+  ...
+not ok 3 - broken_test.monkey
+  ---
+  message: |
+    identifier not found: z
+  ...
+ok 4 - ok_test.monkey test_ok
+`
+
+	var out bytes.Buffer
+	if err := WriteTAP(&out, testResults()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out.String() != expected {
+		t.Errorf("wrong output.\nexpected=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites tests="3" failures="1" errors="1">
+  <testsuite name="math_test.monkey" tests="2" failures="1" errors="0" time="0.003000">
+    <testcase name="test_add" classname="math_test.monkey" time="0.001000"></testcase>
+    <testcase name="test_fail" classname="math_test.monkey" time="0.002000">
+      <failure message="assert failed: got false"><![CDATA[assert failed: got false
+  at line 2]]></failure>
+    </testcase>
+  </testsuite>
+  <testsuite name="broken_test.monkey" tests="0" failures="0" errors="1" time="0.000000">
+    <system-err><![CDATA[identifier not found: z]]></system-err>
+  </testsuite>
+  <testsuite name="ok_test.monkey" tests="1" failures="0" errors="0" time="0.000000">
+    <testcase name="test_ok" classname="ok_test.monkey" time="0.000000"></testcase>
+  </testsuite>
+</testsuites>
+`
+
+	var out bytes.Buffer
+	if err := WriteJUnit(&out, testResults()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out.String() != expected {
+		t.Errorf("wrong output.\nexpected=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
@@ -1,10 +1,15 @@
 package token
 
+import "sort"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	// tokenの先頭文字の位置(1始まり)
+	Line   int
+	Column int
 }
 
 const (
@@ -23,6 +28,7 @@ const (
 	ASTERISK = "*"
 	SLASH    = "/"
 	DOT      = "."
+	SPREAD   = "..."
 
 	LT = "<"
 	GT = ">"
@@ -34,6 +40,14 @@ const (
 	AND    = "&&"
 	OR     = "||"
 
+	// 型注釈
+	ARROW = "->"
+	PIPE  = "|"
+
+	NULLISH           = "??"
+	OPTIONAL_DOT      = "?."
+	OPTIONAL_LBRACKET = "?["
+
 	// デリミタ
 	COMMA     = ","
 	SEMICOLON = ";"
@@ -48,12 +62,18 @@ const (
 
 	FUNCTION  = "FUNCTION"
 	LET       = "LET"
+	CONST     = "CONST"
 	TRUE      = "TRUE"
 	FALSE     = "FALSE"
 	IF        = "IF"
 	ELSE      = "ELSE"
 	RETURN    = "RETURN"
 	NAMESPACE = "NAMESPACE"
+	NULL      = "NULL"
+	THROW     = "THROW"
+	TRY       = "TRY"
+	CATCH     = "CATCH"
+	FINALLY   = "FINALLY"
 
 	STRING = "STRING"
 )
@@ -61,12 +81,38 @@ const (
 var keywords = map[string]TokenType{
 	"fn":        "FUNCTION",
 	"let":       "LET",
+	"const":     "CONST",
 	"true":      "TRUE",
 	"false":     "FALSE",
 	"if":        "IF",
 	"else":      "ELSE",
 	"return":    "RETURN",
 	"namespace": "NAMESPACE",
+	"null":      "NULL",
+	"throw":     "THROW",
+	"try":       "TRY",
+	"catch":     "CATCH",
+	"finally":   "FINALLY",
+}
+
+// 末尾に'!'を付けられる識別子(破壊的な組み込み関数、'!'を除いた名前)
+// NOTE: それ以外の識別子の直後の'!'は前置演算子として扱う("x! = 1"は"x ! = 1")
+var bangIdentifiers = map[string]bool{
+	"append": true,
+}
+
+func IsBangIdentifier(ident string) bool {
+	return bangIdentifiers[ident]
+}
+
+// キーワード(辞書順)
+func Keywords() []string {
+	names := make([]string, 0, len(keywords))
+	for name := range keywords {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 func LookupIdent(ident string) TokenType {
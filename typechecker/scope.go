@@ -0,0 +1,172 @@
+package typechecker
+
+import (
+	"../ast"
+	"../token"
+)
+
+// 関数、namespace、catchの本体の環境(if, tryのブロックは環境を作らない)
+type scope struct {
+	types map[string]Type
+	// 本体で宣言される変数と、その宣言の数
+	declarations map[string]int
+	outer        *scope
+	// 関数の本体(外側の変数は、関数が呼ばれた時点の値を参照する)
+	function bool
+	// ifのブロックの中(letが評価されるとは限らない)
+	blockDepth int
+}
+
+func newScope(outer *scope, stmts []ast.Statement, params []*ast.Identifier) *scope {
+	s := &scope{
+		types:        make(map[string]Type),
+		declarations: make(map[string]int),
+		outer:        outer,
+	}
+
+	for _, param := range params {
+		s.declarations[param.Value]++
+	}
+	for _, stmt := range stmts {
+		s.collect(stmt)
+	}
+	return s
+}
+
+// 本体で宣言される変数(内側の関数、namespace、catchの本体は別の環境)
+func (s *scope) collect(node ast.Node) {
+	ast.Walk(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			s.declarations[node.Name.Value]++
+		case *ast.FunctionLiteral, *ast.NameSpaceLiteral:
+			return false
+		case *ast.TryExpression:
+			s.collect(node.Block)
+			if node.Finally != nil {
+				s.collect(node.Finally)
+			}
+			return false
+		case *ast.InfixExpression:
+			if node.Operator == "." || node.Operator == "?." {
+				s.collect(node.Left)
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// 引数等、必ず束縛される変数
+func (s *scope) bind(name string, t Type) {
+	if _, ok := s.declarations[name]; !ok {
+		s.declarations[name] = 1
+	}
+	s.types[name] = t
+}
+
+// letで束縛される変数
+func (s *scope) assign(name string, t Type) {
+	if s.blockDepth == 0 {
+		s.types[name] = t
+		return
+	}
+
+	// NOTE: ブロック内のletは評価されない場合があるため、前の型との和にする
+	if old, ok := s.types[name]; ok {
+		s.types[name] = join(old, t)
+	} else {
+		s.types[name] = ANY
+	}
+}
+
+// `ns.x = v`で代入されたフィールド名
+func assignedFields(program *ast.Program) map[string]bool {
+	fields := make(map[string]bool)
+	ast.Walk(program, func(node ast.Node) bool {
+		if assign, ok := node.(*ast.AssignExpression); ok {
+			if infix, ok := assign.Target.(*ast.InfixExpression); ok {
+				if ident, ok := infix.Right.(*ast.Identifier); ok {
+					fields[ident.Value] = true
+				}
+			}
+		}
+		return true
+	})
+	return fields
+}
+
+// 式の最初のtoken(エラーの位置)
+func expressionToken(exp ast.Expression) token.Token {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		return exp.Token
+	case *ast.IntegerLiteral:
+		return exp.Token
+	case *ast.StringLiteral:
+		return exp.Token
+	case *ast.Boolean:
+		return exp.Token
+	case *ast.Null:
+		return exp.Token
+	case *ast.PrefixExpression:
+		return exp.Token
+	case *ast.InfixExpression:
+		return expressionToken(exp.Left)
+	case *ast.IfExpression:
+		return exp.Token
+	case *ast.TryExpression:
+		return exp.Token
+	case *ast.FunctionLiteral:
+		return exp.Token
+	case *ast.CallExpression:
+		return expressionToken(exp.Function)
+	case *ast.ArrayLiteral:
+		return exp.Token
+	case *ast.IndexExpression:
+		return expressionToken(exp.Left)
+	case *ast.HashLiteral:
+		return exp.Token
+	case *ast.SpreadExpression:
+		return exp.Token
+	case *ast.NameSpaceLiteral:
+		return exp.Token
+	case *ast.AssignExpression:
+		return expressionToken(exp.Target)
+	default:
+		return token.Token{}
+	}
+}
+
+// ブロックの最後の文のtoken(空のブロックは'{')
+func lastToken(block *ast.BlockStatement) token.Token {
+	if len(block.Statements) == 0 {
+		return block.Token
+	}
+
+	switch stmt := block.Statements[len(block.Statements)-1].(type) {
+	case *ast.LetStatement:
+		return stmt.Token
+	case *ast.ReturnStatement:
+		return stmt.Token
+	case *ast.ThrowStatement:
+		return stmt.Token
+	case *ast.ExpressionStatement:
+		return stmt.Token
+	default:
+		return block.Token
+	}
+}
+
+func annotationToken(annotation ast.TypeExpression) token.Token {
+	switch annotation := annotation.(type) {
+	case *ast.NamedType:
+		return annotation.Token
+	case *ast.FunctionType:
+		return annotation.Token
+	case *ast.UnionType:
+		return annotation.Token
+	default:
+		return token.Token{}
+	}
+}
@@ -0,0 +1,742 @@
+package typechecker
+
+import (
+	"../ast"
+	"../evaluator"
+	"../lexer"
+	"../lint"
+	"../parser"
+	"../token"
+	"fmt"
+	"io/ioutil"
+	"sort"
+)
+
+// NOTE: 型注釈と、注釈の無いコードから推論した型を使って、評価前に型の誤りを見つける
+// (段階的型付け: 型が分からない値はanyとし、確実に評価時エラーになる場合のみ報告する)
+//   - 演算子のオペランドの型(`"a" - 1`)
+//   - 関数、組み込み関数の引数の数と型(`len(5)`)
+//   - 型注釈付きのlet、関数の戻り値
+//   - 関数でない値の呼び出し、添字演算子、ハッシュのkey
+//
+// 注釈の無い引数の型は、本体で必ず評価される使い方(`x + 1`, `len(x)`等)から推論する
+// 配列、ハッシュのリテラルの要素の型は推論するが、書き換えられるため、
+// 変数に束縛した値の要素の型は型注釈からのみ分かる
+
+const TYPE_ERROR = "type-error"
+
+func CheckFile(fileName string) ([]*lint.Diagnostic, error) {
+	source, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return CheckSource(string(source), fileName), nil
+}
+
+func CheckSource(source string, fileName string) []*lint.Diagnostic {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		diagnostics := []*lint.Diagnostic{}
+		for _, e := range p.ParseErrors() {
+			diagnostics = append(diagnostics, &lint.Diagnostic{File: fileName,
+				Line: e.Line, Column: e.Column, Rule: lint.SYNTAX_ERROR, Message: e.Msg})
+		}
+		return diagnostics
+	}
+
+	return Check(program, fileName)
+}
+
+// programの型の誤り(ソース上の順)
+func Check(program *ast.Program, fileName string) []*lint.Diagnostic {
+	c := newChecker(program, fileName)
+
+	s := newScope(nil, program.Statements, nil)
+	// スクリプトファイルの環境に束縛される変数
+	s.bind("THIS_DIR", STRING)
+	s.bind("THIS_FILE", STRING)
+	c.statements(program.Statements, s)
+
+	sort.SliceStable(c.diagnostics, func(i, j int) bool {
+		a, b := c.diagnostics[i], c.diagnostics[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return c.diagnostics
+}
+
+func newChecker(program *ast.Program, fileName string) *checker {
+	return &checker{
+		fileName:    fileName,
+		diagnostics: []*lint.Diagnostic{},
+		fields:      assignedFields(program),
+		signatures:  make(map[*ast.FunctionLiteral]*Function),
+	}
+}
+
+type checker struct {
+	fileName    string
+	diagnostics []*lint.Diagnostic
+	// `ns.x = v`で代入されたフィールド名(self(), outer()で得た環境の変数を書き換えうる)
+	fields     map[string]bool
+	signatures map[*ast.FunctionLiteral]*Function
+	// 型検査中の関数(内側が末尾)
+	functions []*functionContext
+}
+
+type functionContext struct {
+	// 戻り値の型注釈(無ければnil)
+	returnType Type
+	// return文の値の型
+	returns []Type
+	// 注釈の無い引数の型(引数ごとのanyのインスタンス)と、その使い方から分かる型
+	uses map[Type][]Type
+	// 評価されるとは限らない式(ifのブロック、`&&`の右辺等)の中
+	conditional int
+	// return, throwより後(以降の文は評価されるとは限らない)
+	exited bool
+}
+
+func (c *checker) report(tok token.Token, format string, a ...interface{}) {
+	c.diagnostics = append(c.diagnostics, &lint.Diagnostic{
+		File:    c.fileName,
+		Line:    tok.Line,
+		Column:  tok.Column,
+		Rule:    TYPE_ERROR,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+func (c *checker) annotation(annotation ast.TypeExpression) Type {
+	t, err := fromAnnotation(annotation)
+	if err != nil {
+		c.report(annotationToken(annotation), "%s", err)
+		return ANY
+	}
+	return t
+}
+
+// 文の列の値(最後の文の値)の型
+func (c *checker) statements(stmts []ast.Statement, s *scope) Type {
+	var t Type = NULL
+	for _, stmt := range stmts {
+		t = c.statement(stmt, s)
+	}
+	return t
+}
+
+// ifのブロック(環境は作らないが、letが評価されるとは限らない)
+func (c *checker) block(block *ast.BlockStatement, s *scope) Type {
+	s.blockDepth++
+	defer func() { s.blockDepth-- }()
+	return c.conditionally(func() Type { return c.statements(block.Statements, s) })
+}
+
+// 評価されるとは限らない式の型(引数の型の推論に使わない)
+func (c *checker) conditionally(check func() Type) Type {
+	if len(c.functions) == 0 {
+		return check()
+	}
+	fn := c.functions[len(c.functions)-1]
+	fn.conditional++
+	defer func() { fn.conditional-- }()
+	return check()
+}
+
+// 型tの値が、expectedとして使われた(tが注釈の無い引数なら、その型の推論に使う)
+func (c *checker) use(t Type, expected Type) {
+	if len(c.functions) == 0 || isAny(expected) {
+		return
+	}
+	fn := c.functions[len(c.functions)-1]
+	if _, ok := fn.uses[t]; !ok || fn.conditional > 0 || fn.exited {
+		return
+	}
+	fn.uses[t] = append(fn.uses[t], expected)
+}
+
+func (c *checker) statement(stmt ast.Statement, s *scope) Type {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		c.letStatement(stmt, s)
+		// NOTE: letで終わるブロックはnullを返す
+		return NULL
+	case *ast.ReturnStatement:
+		t := c.expression(stmt.ReturnValue, s)
+		if len(c.functions) > 0 {
+			fn := c.functions[len(c.functions)-1]
+			fn.returns = append(fn.returns, t)
+			c.checkReturn(stmt.Token, t, fn)
+			fn.exited = true
+		}
+		return NEVER
+	case *ast.ThrowStatement:
+		c.expression(stmt.Value, s)
+		if len(c.functions) > 0 {
+			c.functions[len(c.functions)-1].exited = true
+		}
+		return NEVER
+	case *ast.ExpressionStatement:
+		return c.expression(stmt.Expression, s)
+	case *ast.BlockStatement:
+		return c.block(stmt, s)
+	default:
+		return ANY
+	}
+}
+
+func (c *checker) letStatement(stmt *ast.LetStatement, s *scope) {
+	name := stmt.Name.Value
+
+	var declared Type
+	if stmt.Name.Type != nil {
+		declared = c.annotation(stmt.Name.Type)
+	}
+
+	// NOTE: 再帰呼び出しを検査できるよう、本体より先に関数のシグネチャを束縛
+	if fn, ok := stmt.Value.(*ast.FunctionLiteral); ok && declared == nil {
+		s.assign(name, c.signature(fn))
+	}
+
+	t := c.expression(stmt.Value, s)
+	if declared != nil {
+		if !assignable(t, declared) {
+			c.report(stmt.Name.Token, "wrong type of %s. got=%s, want=%s",
+				name, t, declared)
+		}
+		t = declared
+	} else {
+		t = withoutElements(t)
+	}
+	s.assign(name, t)
+}
+
+func (c *checker) checkReturn(tok token.Token, t Type, fn *functionContext) {
+	if fn.returnType != nil && !assignable(t, fn.returnType) {
+		c.report(tok, "wrong return type. got=%s, want=%s", t, fn.returnType)
+	}
+}
+
+func (c *checker) expression(exp ast.Expression, s *scope) Type {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		return INT
+	case *ast.StringLiteral:
+		return STRING
+	case *ast.Boolean:
+		return BOOL
+	case *ast.Null:
+		return NULL
+	case *ast.Identifier:
+		return c.lookup(exp.Value, s)
+	case *ast.PrefixExpression:
+		return c.prefixExpression(exp, s)
+	case *ast.InfixExpression:
+		return c.infixExpression(exp, s)
+	case *ast.IfExpression:
+		c.expression(exp.Condition, s)
+		consequence := c.block(exp.Consequence, s)
+		if exp.Alternative == nil {
+			return join(consequence, NULL)
+		}
+		return join(consequence, c.block(exp.Alternative, s))
+	case *ast.TryExpression:
+		c.block(exp.Block, s)
+		if exp.Catch != nil {
+			inner := newScope(s, exp.Catch.Statements, []*ast.Identifier{exp.Parameter})
+			// catchの変数はエラーのハッシュ(`e["type"]`等)
+			inner.bind(exp.Parameter.Value, &Hash{Key: STRING, Value: ANY})
+			c.conditionally(func() Type { return c.statements(exp.Catch.Statements, inner) })
+		}
+		if exp.Finally != nil {
+			c.block(exp.Finally, s)
+		}
+		return ANY
+	case *ast.FunctionLiteral:
+		return c.functionLiteral(exp, s)
+	case *ast.CallExpression:
+		return c.callExpression(exp, s)
+	case *ast.ArrayLiteral:
+		return c.arrayLiteral(exp, s)
+	case *ast.IndexExpression:
+		return c.indexExpression(exp, s)
+	case *ast.HashLiteral:
+		return c.hashLiteral(exp, s)
+	case *ast.SpreadExpression:
+		c.expression(exp.Value, s)
+		return ANY
+	case *ast.NameSpaceLiteral:
+		inner := newScope(s, exp.Body.Statements, nil)
+		c.statements(exp.Body.Statements, inner)
+		return c.nameSpace(inner)
+	case *ast.AssignExpression:
+		switch target := exp.Target.(type) {
+		case *ast.IndexExpression:
+			c.expression(target.Left, s)
+			c.expression(target.Index, s)
+		case *ast.InfixExpression:
+			c.expression(target.Left, s)
+		}
+		return c.expression(exp.Value, s)
+	default:
+		return ANY
+	}
+}
+
+func (c *checker) prefixExpression(exp *ast.PrefixExpression, s *scope) Type {
+	right := c.expression(exp.Right, s)
+
+	switch exp.Operator {
+	case "!":
+		return BOOL
+	case "-":
+		c.use(right, INT)
+		if kind := kindOf(right); kind != "" && kind != "int" {
+			c.report(exp.Token, "unknown operator: -%s", right)
+			return ANY
+		}
+		return INT
+	default:
+		return ANY
+	}
+}
+
+func (c *checker) infixExpression(exp *ast.InfixExpression, s *scope) Type {
+	left := c.expression(exp.Left, s)
+
+	switch exp.Operator {
+	case ".", "?.":
+		return c.dotExpression(exp, left, s)
+	case "&&", "||", "??":
+		right := c.conditionally(func() Type { return c.expression(exp.Right, s) })
+		if exp.Operator == "??" {
+			left = withoutNull(left)
+		}
+		return join(left, right)
+	}
+
+	right := c.expression(exp.Right, s)
+	c.use(left, operandType(exp.Operator, right))
+	c.use(right, operandType(exp.Operator, left))
+	t, err := binaryOperation(exp.Operator, left, right)
+	if err != nil {
+		c.report(exp.Token, "%s", err)
+	}
+	return t
+}
+
+var (
+	arithmeticOperators = map[string]bool{"+": true, "-": true, "*": true, "/": true}
+	comparisonOperators = map[string]bool{"<": true, ">": true, "<=": true, ">=": true,
+		"==": true, "!=": true}
+)
+
+// もう一方のオペランドの型がotherの時、演算が成功するオペランドの型(分からなければany)
+func operandType(operator string, other Type) Type {
+	switch kindOf(other) {
+	case "int":
+		if arithmeticOperators[operator] ||
+			(comparisonOperators[operator] && operator != "==" && operator != "!=") {
+			return INT
+		}
+	case "string":
+		if operator == "+" {
+			return STRING
+		}
+	}
+	return ANY
+}
+
+// 二項演算の結果の型(evaluator.EvalInfixOperationと同じ規則)
+func binaryOperation(operator string, left, right Type) (Type, error) {
+	leftKind, rightKind := kindOf(left), kindOf(right)
+
+	if leftKind == "" || rightKind == "" {
+		switch {
+		case comparisonOperators[operator]:
+			return BOOL, nil
+		// NOTE: 成功するのは整数どうしか文字列どうしの場合のみ
+		case operator == "+" && (leftKind == "string" || rightKind == "string"):
+			return STRING, nil
+		case arithmeticOperators[operator] && (leftKind == "int" || rightKind == "int"):
+			return INT, nil
+		default:
+			return ANY, nil
+		}
+	}
+
+	switch {
+	case leftKind == "int" && rightKind == "int" && arithmeticOperators[operator]:
+		return INT, nil
+	case leftKind == "int" && rightKind == "int" && comparisonOperators[operator]:
+		return BOOL, nil
+	case leftKind == "string" && rightKind == "string" && operator == "+":
+		return STRING, nil
+	case operator == "==" || operator == "!=":
+		return BOOL, nil
+	case leftKind != rightKind:
+		return ANY, fmt.Errorf("type mismatch: %s %s %s", left, operator, right)
+	default:
+		return ANY, fmt.Errorf("unknown operator: %s %s %s", left, operator, right)
+	}
+}
+
+func (c *checker) dotExpression(exp *ast.InfixExpression, left Type,
+	s *scope) Type {
+
+	optional := exp.Operator == "?."
+	if optional {
+		if kindOf(left) == "null" {
+			return NULL
+		}
+		left = withoutNull(left)
+	}
+
+	switch kindOf(left) {
+	case "":
+		return ANY
+	case "namespace":
+		var t Type = ANY
+		nameSpace, ok := left.(*NameSpace)
+		ident, isIdent := exp.Right.(*ast.Identifier)
+		if ok && isIdent && nameSpace.Members != nil && !c.fields[ident.Value] {
+			if member, ok := nameSpace.Members[ident.Value]; ok {
+				t = member
+			}
+		}
+		if optional {
+			return join(t, NULL)
+		}
+		return t
+	default:
+		// NOTE: namespace以外の"."は、右辺を今の環境で評価した二項演算(エラー)
+		right := c.expression(exp.Right, s)
+		t, err := binaryOperation(exp.Operator, left, right)
+		if err != nil {
+			c.report(exp.Token, "%s", err)
+		}
+		return t
+	}
+}
+
+func (c *checker) indexExpression(exp *ast.IndexExpression, s *scope) Type {
+	left := c.expression(exp.Left, s)
+	var index Type
+	if exp.Optional {
+		index = c.conditionally(func() Type { return c.expression(exp.Index, s) })
+	} else {
+		index = c.expression(exp.Index, s)
+	}
+
+	if exp.Optional {
+		if kindOf(left) == "null" {
+			return NULL
+		}
+		left = withoutNull(left)
+	}
+
+	switch kindOf(left) {
+	case "":
+		return ANY
+	case "array":
+		if kind := kindOf(index); kind != "" && kind != "int" {
+			c.report(exp.Token, "index operator not supported: %s", left)
+			return ANY
+		}
+		if array, ok := left.(*Array); ok {
+			return array.Element
+		}
+		return ANY
+	case "hash":
+		c.checkHashKey(exp.Index, index)
+		if hash, ok := left.(*Hash); ok {
+			return hash.Value
+		}
+		return ANY
+	default:
+		c.report(exp.Token, "index operator not supported: %s", left)
+		return ANY
+	}
+}
+
+// 要素の型の和を要素の型とする(空の配列の要素はany)
+func (c *checker) arrayLiteral(exp *ast.ArrayLiteral, s *scope) Type {
+	elements := []Type{}
+	for _, el := range exp.Elements {
+		spread, ok := el.(*ast.SpreadExpression)
+		if !ok {
+			elements = append(elements, c.expression(el, s))
+			continue
+		}
+		if array, ok := c.expression(spread.Value, s).(*Array); ok {
+			elements = append(elements, array.Element)
+		} else {
+			elements = append(elements, ANY)
+		}
+	}
+
+	if len(elements) == 0 {
+		return ARRAY
+	}
+	return &Array{Element: join(elements...)}
+}
+
+func (c *checker) hashLiteral(exp *ast.HashLiteral, s *scope) Type {
+	keys, values := []Type{}, []Type{}
+	for _, key := range exp.Keys {
+		if spread, ok := key.(*ast.SpreadExpression); ok {
+			if hash, ok := c.expression(spread.Value, s).(*Hash); ok {
+				keys, values = append(keys, hash.Key), append(values, hash.Value)
+			} else {
+				keys, values = append(keys, ANY), append(values, ANY)
+			}
+			continue
+		}
+		t := c.expression(key, s)
+		c.checkHashKey(key, t)
+		keys, values = append(keys, t), append(values, c.expression(exp.Pairs[key], s))
+	}
+
+	if len(keys) == 0 {
+		return HASH
+	}
+	return &Hash{Key: join(keys...), Value: join(values...)}
+}
+
+func (c *checker) checkHashKey(node ast.Expression, t Type) {
+	switch kindOf(t) {
+	case "", "int", "string", "bool":
+		return
+	default:
+		c.report(expressionToken(node), "unusable as hash key: %s", t)
+	}
+}
+
+// 関数リテラルの引数、戻り値の型注釈から分かる型
+func (c *checker) signature(fn *ast.FunctionLiteral) *Function {
+	if signature, ok := c.signatures[fn]; ok {
+		return signature
+	}
+
+	signature := &Function{Parameters: []Type{}, Return: ANY}
+	for _, param := range fn.Parameters {
+		var t Type = ANY
+		if param.Type != nil {
+			t = c.annotation(param.Type)
+		}
+		signature.Parameters = append(signature.Parameters, t)
+	}
+	if fn.ReturnType != nil {
+		signature.Return = c.annotation(fn.ReturnType)
+	}
+
+	c.signatures[fn] = signature
+	return signature
+}
+
+func (c *checker) functionLiteral(fn *ast.FunctionLiteral, s *scope) Type {
+	signature := c.signature(fn)
+
+	inner := newScope(s, fn.Body.Statements, fn.Parameters)
+	inner.function = true
+	context := &functionContext{uses: make(map[Type][]Type)}
+	// NOTE: 注釈の無い引数は、使い方を記録できるよう引数ごとに別のanyとする
+	params := make([]Type, len(fn.Parameters))
+	for i, param := range fn.Parameters {
+		params[i] = signature.Parameters[i]
+		if param.Type == nil {
+			params[i] = &Any{parameter: param.Value}
+			context.uses[params[i]] = nil
+		}
+		inner.bind(param.Value, params[i])
+	}
+	if fn.ReturnType != nil {
+		context.returnType = signature.Return
+	}
+
+	c.functions = append(c.functions, context)
+	last := c.statements(fn.Body.Statements, inner)
+	c.functions = c.functions[:len(c.functions)-1]
+
+	// 注釈の無い引数の型を推論
+	for i, param := range params {
+		if uses, ok := context.uses[param]; ok {
+			params[i] = inferParameter(uses)
+		}
+	}
+
+	if context.returnType != nil {
+		c.checkReturn(lastToken(fn.Body), last, context)
+		return &Function{Parameters: params, Return: signature.Return}
+	}
+
+	// 戻り値の型を推論
+	returnType := join(append(context.returns, last)...)
+	if returnType == NEVER {
+		returnType = ANY
+	}
+	return &Function{Parameters: params, Return: returnType}
+}
+
+// 引数の使い方から分かる型(使い方によって型が異なる場合はany)
+func inferParameter(uses []Type) Type {
+	if len(uses) == 0 {
+		return ANY
+	}
+	for _, t := range uses[1:] {
+		if t.String() != uses[0].String() {
+			return ANY
+		}
+	}
+	return uses[0]
+}
+
+func (c *checker) callExpression(exp *ast.CallExpression, s *scope) Type {
+	callee := c.expression(exp.Function, s)
+
+	args := []Type{}
+	spread := false
+	for _, arg := range exp.Arguments {
+		if _, ok := arg.(*ast.SpreadExpression); ok {
+			spread = true
+		}
+		args = append(args, c.expression(arg, s))
+	}
+
+	// NOTE: `ns?.f()`は関数がnullなら呼び出さずnullを返す
+	if infix, ok := exp.Function.(*ast.InfixExpression); ok && infix.Operator == "?." {
+		if kindOf(callee) == "null" {
+			return NULL
+		}
+		callee = withoutNull(callee)
+	}
+
+	switch kindOf(callee) {
+	case "":
+		return ANY
+	case "fn":
+	default:
+		c.report(exp.Token, "not a function: %s", callee)
+		return ANY
+	}
+
+	fn, ok := callee.(*Function)
+	if !ok {
+		return ANY
+	}
+
+	name := calleeName(exp.Function)
+
+	if !spread {
+		if len(args) < len(fn.Parameters) ||
+			(fn.Variadic == nil && len(args) > len(fn.Parameters)) {
+
+			want := fmt.Sprintf("%d", len(fn.Parameters))
+			if fn.Variadic != nil {
+				want = ">=" + want
+			}
+			c.report(exp.Token, "wrong number of arguments to %s. got=%d, want=%s",
+				name, len(args), want)
+			return fn.Return
+		}
+	}
+
+	for i, arg := range args {
+		// NOTE: スプレッド以降の引数の位置は分からない
+		if _, ok := exp.Arguments[i].(*ast.SpreadExpression); ok {
+			break
+		}
+
+		var param Type
+		switch {
+		case i < len(fn.Parameters):
+			param = fn.Parameters[i]
+		case fn.Variadic != nil:
+			param = fn.Variadic
+		default:
+			continue
+		}
+
+		c.use(arg, param)
+		if !assignable(arg, param) {
+			c.report(expressionToken(exp.Arguments[i]),
+				"wrong type of argument %d to %s. got=%s, want=%s",
+				i+1, name, arg, param)
+		}
+	}
+
+	return fn.Return
+}
+
+// 変数の型
+func (c *checker) lookup(name string, s *scope) Type {
+	if c.fields[name] {
+		return ANY
+	}
+
+	crossed := false
+	for ; s != nil; s = s.outer {
+		if declarations, ok := s.declarations[name]; ok {
+			t, ok := s.types[name]
+			// NOTE: 内側の関数は後で呼ばれるため、再宣言された変数の型は分からない
+			if !ok || (crossed && declarations > 1) {
+				return ANY
+			}
+			return t
+		}
+		if s.function {
+			crossed = true
+		}
+	}
+
+	return builtinType(name)
+}
+
+func (c *checker) nameSpace(s *scope) Type {
+	members := make(map[string]Type)
+	for name := range s.declarations {
+		members[name] = c.lookup(name, s)
+	}
+	return &NameSpace{Members: members}
+}
+
+// 組み込み関数の型(組み込み関数でなければany)
+func builtinType(name string) Type {
+	builtin, ok := evaluator.LookupBuiltin(name)
+	if !ok {
+		return ANY
+	}
+	t, err := parseSignature(builtin.Signature)
+	if err != nil {
+		return FUNCTION
+	}
+	return t
+}
+
+func parseSignature(signature string) (Type, error) {
+	p := parser.New(lexer.New(signature))
+	annotation := p.ParseType()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("invalid signature %q: %s", signature, p.Errors()[0])
+	}
+	return fromAnnotation(annotation)
+}
+
+// エラーメッセージ中の関数名(`f`, `ns.f`)
+func calleeName(exp ast.Expression) string {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		return "`" + exp.Value + "`"
+	case *ast.InfixExpression:
+		left, isLeftIdent := exp.Left.(*ast.Identifier)
+		right, isRightIdent := exp.Right.(*ast.Identifier)
+		if isLeftIdent && isRightIdent {
+			return "`" + left.Value + exp.Operator + right.Value + "`"
+		}
+	}
+	return "function"
+}
@@ -0,0 +1,190 @@
+package typechecker
+
+import (
+	"../ast"
+	"../evaluator"
+	"../lexer"
+	"../object"
+	"../parser"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func parse(input string) *ast.Program {
+	return parser.New(lexer.New(input)).ParseProgram()
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		// 問題無し
+		{"let add = fn(x: int, y: int) -> int { x + y }; add(1, 2);", []string{}},
+		{"let n: string = \"a\"; len(n) + 1;", []string{}},
+		{"let a: array[int] = [1, 2]; a[0] * 2;", []string{}},
+		{"let h: hash[string, int] = {\"a\": 1}; h[\"a\"] + 1;", []string{}},
+		{"let v: int | null = null; v ?? 1;", []string{}},
+		{"let ns = null; ns?.f(1);", []string{}},
+		{"puts(1, \"a\", [2]);", []string{}},
+		{"let f: fn(int) -> int = fn(x: int) -> int { x };", []string{}},
+		{"let fib = fn(n: int) -> int { if (n < 2) { return n; }; fib(n - 1) + fib(n - 2) };", []string{}},
+		{"let xs: array[int] = []; let ys: array[int] = [1, ...xs];", []string{}},
+		{"let h: hash[string, int] = {\"a\": 1, ...{}};", []string{}},
+		// 変数に束縛した配列は書き換えられるため、要素の型は分からない
+		{"let xs = [1]; xs[0] = \"a\"; xs[0] + \"b\";", []string{}},
+		// 評価されるとは限らない使い方からは、引数の型を推論しない
+		{"let f = fn(x) { if (type(x) == \"INTEGER\") { x + 1 } else { len(x) } }; f(\"a\");", []string{}},
+		{"let f = fn(x) { if (x == null) { return 0; }; x + 1 }; f(null);", []string{}},
+		{"let f = fn(x) { x != null && x + 1 > 0 }; f(null);", []string{}},
+		{"let f = fn(x) { fn() { x + 1 } }; f(\"a\");", []string{}},
+		{"let f = fn(x) { x + 1; len(x) }; f(\"a\");", []string{}},
+		// 演算子
+		{"\"a\" - 1", []string{"1:5: type mismatch: string - int"}},
+		{"\"a\" * \"b\"", []string{"1:5: unknown operator: string * string"}},
+		{"-true", []string{"1:1: unknown operator: -bool"}},
+		{"1 == \"a\"", []string{}},
+		{"let f = fn() { 1 }; f() + \"a\";", []string{"1:25: type mismatch: int + string"}},
+		// 組み込み関数
+		{"len(5)", []string{"1:5: wrong type of argument 1 to `len`. got=int, want=string | array"}},
+		{"len(\"a\", \"b\")", []string{"1:4: wrong number of arguments to `len`. got=2, want=1"}},
+		{"push([], 1, 2)", []string{"1:5: wrong number of arguments to `push`. got=3, want=2"}},
+		{"append!()", []string{"1:8: wrong number of arguments to `append!`. got=0, want=>=1"}},
+		{"len(...[1])", []string{}},
+		// 型注釈
+		{"let n: string = 3;", []string{"1:5: wrong type of n. got=int, want=string"}},
+		{"let n: foo = 3;", []string{"1:8: unknown type: foo"}},
+		{"let a: array[int, int] = [];", []string{"1:8: wrong number of type arguments to array. got=2, want=1"}},
+		{"let f = fn(x: int) { x }; f(\"a\");", []string{"1:29: wrong type of argument 1 to `f`. got=string, want=int"}},
+		{"let xs: array[int] = [\"s\"];", []string{"1:5: wrong type of xs. got=array[string], want=array[int]"}},
+		{"let h: hash[string, int] = {\"a\": \"b\"};", []string{"1:5: wrong type of h. got=hash[string, string], want=hash[string, int]"}},
+		{"let f = fn() -> array[string] { [1, ...[2]] };", []string{"1:33: wrong return type. got=array[int], want=array[string]"}},
+		// 注釈の無い引数の型は使い方から推論
+		{"let f = fn(x) { x + 1 }; f(\"a\");", []string{"1:28: wrong type of argument 1 to `f`. got=string, want=int"}},
+		{"let f = fn(s) { len(s) }; f(1);", []string{"1:29: wrong type of argument 1 to `f`. got=int, want=string | array"}},
+		{"let f: fn(string) -> int = fn(n) { -n };", []string{"1:5: wrong type of f. got=fn(int) -> int, want=fn(string) -> int"}},
+		{"let f = fn() -> int { \"a\" };", []string{"1:23: wrong return type. got=string, want=int"}},
+		{"let f = fn(c) -> int { if (c) { return \"a\"; }; 1 };", []string{"1:33: wrong return type. got=string, want=int"}},
+		{"let f = fn() -> int { let x = 1; };", []string{"1:23: wrong return type. got=null, want=int"}},
+		{"let ns = namespace { let f = fn(s: string) { s }; }; ns.f(1);", []string{"1:59: wrong type of argument 1 to `ns.f`. got=int, want=string"}},
+		// 呼び出し、添字、ハッシュのkey
+		{"5()", []string{"1:2: not a function: int"}},
+		{"[1][\"a\"]", []string{"1:4: index operator not supported: array[int]"}},
+		{"1[0]", []string{"1:2: index operator not supported: int"}},
+		{"{[1]: 2}", []string{"1:2: unusable as hash key: array[int]"}},
+		// 束縛が評価時に変わる場合は型を推論しない
+		{"let x = 1; let f = fn() { x - \"a\" }; let x = \"b\";", []string{}},
+		{"let f = fn(c) { let x = \"a\"; if (c) { let x = 1; }; x - 1 };", []string{}},
+		{"let f = fn() { let x = \"a\"; let s = self(); s.x = 1; x - 1 };", []string{}},
+		// 構文エラー
+		{"fn(x: 1) { x }", []string{"1:7: expected type, got INT instead"}},
+	}
+
+	for _, tt := range tests {
+		diagnostics := CheckSource(tt.input, "test.monkey")
+
+		if len(diagnostics) != len(tt.expected) {
+			t.Errorf("wrong number of diagnostics for %q. expected=%d, got=%v",
+				tt.input, len(tt.expected), diagnostics)
+			continue
+		}
+
+		for i, d := range diagnostics {
+			actual := strings.TrimPrefix(d.String(), "test.monkey:")
+			actual = strings.TrimPrefix(actual, " ")
+			actual = strings.TrimSuffix(actual, " ("+d.Rule+")")
+			if actual != tt.expected[i] {
+				t.Errorf("wrong diagnostic for %q. expected=%q, got=%q",
+					tt.input, tt.expected[i], actual)
+			}
+		}
+	}
+}
+
+func TestInferredTypes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2", "int"},
+		{"\"a\" + x", "string"},
+		{"1 < x", "bool"},
+		{"if (x) { 1 } else { \"a\" }", "int | string"},
+		{"if (x) { 1 }", "int | null"},
+		{"fn(x: int) { x * 2 }", "fn(int) -> int"},
+		{"fn(x) { if (x) { return \"a\"; }; 1 }", "fn(any) -> string | int"},
+		{"len", "fn(string | array) -> int"},
+		{"namespace { let a = 1; }.a", "int"},
+		{"[1, 2]", "array[int]"},
+		{"[1, \"a\", ...[true]]", "array[int | string | bool]"},
+		{"[1, ...x]", "array"},
+		{"[]", "array"},
+		{"{\"a\": 1, \"b\": null}", "hash[string, int | null]"},
+		{"let xs = [1]; xs", "array"},
+		{"fn(x) { x * 2 }", "fn(int) -> int"},
+		{"fn(x, y) { let s = \"a\" + x; y }", "fn(string, any) -> any"},
+		{"x", "any"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		c := &checker{fields: map[string]bool{},
+			signatures: make(map[*ast.FunctionLiteral]*Function)}
+		s := newScope(nil, program.Statements, nil)
+
+		actual := c.statements(program.Statements, s).String()
+		if actual != tt.expected {
+			t.Errorf("wrong type of %q. expected=%q, got=%q",
+				tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestTypeOf(t *testing.T) {
+	env := object.NewEnvironment()
+	evaluator.Eval(parse(`let n = 1;
+let s = "a";
+let f = fn(x: int) { x * 2 };
+let ns = namespace { let v = "x"; let inner = self(); };`), env)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"n + 1", "int"},
+		{"f", "fn(int) -> int"},
+		{"f(n)", "int"},
+		{"ns.v", "string"},
+		{"ns.inner", "namespace"},
+		// namespace内のnamespaceのメンバーは調べない
+		{"ns.inner.v", "any"},
+		{"puts", "fn(...any) -> null"},
+		// 入力で宣言した変数が優先
+		{"let n = \"b\"; n", "string"},
+		{"let x = 1;", "null"},
+		{"s - 1", "1:3: type mismatch: string - int"},
+	}
+
+	for _, tt := range tests {
+		typ, diagnostics := TypeOf(parse(tt.input), env)
+		actual := typ.String()
+		if len(diagnostics) != 0 {
+			d := diagnostics[0]
+			actual = fmt.Sprintf("%d:%d: %s", d.Line, d.Column, d.Message)
+		}
+		if actual != tt.expected {
+			t.Errorf("wrong type of %q. expected=%q, got=%q",
+				tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestBuiltinSignatures(t *testing.T) {
+	for _, name := range evaluator.BuiltinNames() {
+		builtin, _ := evaluator.LookupBuiltin(name)
+		if _, err := parseSignature(builtin.Signature); err != nil {
+			t.Errorf("builtin %s has invalid signature: %s", name, err)
+		}
+	}
+}
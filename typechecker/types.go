@@ -0,0 +1,363 @@
+package typechecker
+
+import (
+	"../ast"
+	"fmt"
+	"strings"
+)
+
+// 静的に推論した値の型
+type Type interface {
+	String() string
+}
+
+// 型が分からない値(注釈の無い引数等)、どの型とも互換
+type Any struct {
+	// 型を推論中の引数の名前(引数ごとに別のインスタンスにする)
+	parameter string
+}
+
+func (a *Any) String() string { return "any" }
+
+// 値を返さない文(return, throw)の型、joinで無視される
+type never struct{}
+
+func (n *never) String() string { return "never" }
+
+// int, string, bool, null
+type Basic struct {
+	Name string
+}
+
+func (b *Basic) String() string { return b.Name }
+
+type Array struct {
+	Element Type
+}
+
+func (a *Array) String() string {
+	if isAny(a.Element) {
+		return "array"
+	}
+	return fmt.Sprintf("array[%s]", a.Element)
+}
+
+type Hash struct {
+	Key   Type
+	Value Type
+}
+
+func (h *Hash) String() string {
+	if isAny(h.Key) && isAny(h.Value) {
+		return "hash"
+	}
+	return fmt.Sprintf("hash[%s, %s]", h.Key, h.Value)
+}
+
+// 関数、組み込み関数
+type Function struct {
+	Parameters []Type
+	// 残りの引数全ての型(無ければnil)
+	Variadic Type
+	Return   Type
+}
+
+func (f *Function) String() string {
+	params := []string{}
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+	if f.Variadic != nil {
+		params = append(params, "..."+f.Variadic.String())
+	}
+	return fmt.Sprintf("fn(%s) -> %s", strings.Join(params, ", "), f.Return)
+}
+
+type NameSpace struct {
+	// 変数の型(import等で分からない場合はnil)
+	Members map[string]Type
+}
+
+func (ns *NameSpace) String() string { return "namespace" }
+
+// いずれかの型
+type Union struct {
+	Types []Type
+}
+
+func (u *Union) String() string {
+	types := []string{}
+	for _, t := range u.Types {
+		types = append(types, t.String())
+	}
+	return strings.Join(types, " | ")
+}
+
+var (
+	ANY       = &Any{}
+	INT       = &Basic{Name: "int"}
+	STRING    = &Basic{Name: "string"}
+	BOOL      = &Basic{Name: "bool"}
+	NULL      = &Basic{Name: "null"}
+	ARRAY     = &Array{Element: ANY}
+	HASH      = &Hash{Key: ANY, Value: ANY}
+	FUNCTION  = &Function{Variadic: ANY, Return: ANY}
+	NAMESPACE = &NameSpace{}
+	NEVER     = &never{}
+)
+
+var basicTypes = map[string]Type{
+	"int":    INT,
+	"string": STRING,
+	"bool":   BOOL,
+	"null":   NULL,
+}
+
+func isAny(t Type) bool {
+	_, ok := t.(*Any)
+	return ok
+}
+
+// 値の種類(int, string, array, fn等)、型が確定しなければ空文字
+func kindOf(t Type) string {
+	switch t := t.(type) {
+	case *Basic:
+		return t.Name
+	case *Array:
+		return "array"
+	case *Hash:
+		return "hash"
+	case *Function:
+		return "fn"
+	case *NameSpace:
+		return "namespace"
+	case *Union:
+		kind := kindOf(t.Types[0])
+		for _, member := range t.Types[1:] {
+			if kindOf(member) != kind {
+				return ""
+			}
+		}
+		return kind
+	default:
+		return ""
+	}
+}
+
+// actualの値がexpectedとして使える可能性があるか
+// NOTE: 段階的型付けのため、確実に誤りである場合のみfalse
+func assignable(actual, expected Type) bool {
+	if isAny(actual) || isAny(expected) || actual == NEVER {
+		return true
+	}
+
+	if union, ok := actual.(*Union); ok {
+		for _, member := range union.Types {
+			if assignable(member, expected) {
+				return true
+			}
+		}
+		return false
+	}
+	if union, ok := expected.(*Union); ok {
+		for _, member := range union.Types {
+			if assignable(actual, member) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch expected := expected.(type) {
+	case *Basic:
+		actual, ok := actual.(*Basic)
+		return ok && actual.Name == expected.Name
+	case *Array:
+		actual, ok := actual.(*Array)
+		return ok && assignable(actual.Element, expected.Element)
+	case *Hash:
+		actual, ok := actual.(*Hash)
+		return ok && assignable(actual.Key, expected.Key) &&
+			assignable(actual.Value, expected.Value)
+	case *Function:
+		actual, ok := actual.(*Function)
+		return ok && compatibleFunctions(actual, expected)
+	case *NameSpace:
+		_, ok := actual.(*NameSpace)
+		return ok
+	default:
+		return false
+	}
+}
+
+func compatibleFunctions(actual, expected *Function) bool {
+	// 引数の数が確定している場合のみ比べる
+	if actual.Variadic == nil && expected.Variadic == nil &&
+		len(actual.Parameters) != len(expected.Parameters) {
+		return false
+	}
+	for i := 0; i < len(actual.Parameters) && i < len(expected.Parameters); i++ {
+		if !assignable(expected.Parameters[i], actual.Parameters[i]) {
+			return false
+		}
+	}
+	return assignable(actual.Return, expected.Return)
+}
+
+// いずれかの型(同じ型はまとめる、順序は最初に現れた順)
+func join(types ...Type) Type {
+	members := []Type{}
+	seen := make(map[string]bool)
+
+	var add func(t Type)
+	add = func(t Type) {
+		if union, ok := t.(*Union); ok {
+			for _, member := range union.Types {
+				add(member)
+			}
+			return
+		}
+		if t == NEVER {
+			return
+		}
+		if !seen[t.String()] {
+			seen[t.String()] = true
+			members = append(members, t)
+		}
+	}
+
+	for _, t := range types {
+		if isAny(t) {
+			return ANY
+		}
+		add(t)
+	}
+
+	switch len(members) {
+	case 0:
+		return NEVER
+	case 1:
+		return members[0]
+	default:
+		return &Union{Types: members}
+	}
+}
+
+// 変数に束縛した値の型(配列、ハッシュは書き換えられるため、要素の型は分からない)
+func withoutElements(t Type) Type {
+	switch t := t.(type) {
+	case *Array:
+		return ARRAY
+	case *Hash:
+		return HASH
+	case *Union:
+		types := []Type{}
+		for _, member := range t.Types {
+			types = append(types, withoutElements(member))
+		}
+		return join(types...)
+	default:
+		return t
+	}
+}
+
+// nullを除いた型(`??`の左辺)
+func withoutNull(t Type) Type {
+	union, ok := t.(*Union)
+	if !ok {
+		return t
+	}
+	members := []Type{}
+	for _, member := range union.Types {
+		if kindOf(member) != "null" {
+			members = append(members, member)
+		}
+	}
+	return join(members...)
+}
+
+// 型注釈を型に変換する(未知の型名はエラー)
+func fromAnnotation(annotation ast.TypeExpression) (Type, error) {
+	switch annotation := annotation.(type) {
+	case *ast.NamedType:
+		return fromNamedType(annotation)
+	case *ast.FunctionType:
+		fn := &Function{Return: ANY}
+		for _, param := range annotation.Parameters {
+			t, err := fromAnnotation(param)
+			if err != nil {
+				return nil, err
+			}
+			fn.Parameters = append(fn.Parameters, t)
+		}
+		if annotation.Variadic != nil {
+			t, err := fromAnnotation(annotation.Variadic)
+			if err != nil {
+				return nil, err
+			}
+			fn.Variadic = t
+		}
+		if annotation.Return != nil {
+			t, err := fromAnnotation(annotation.Return)
+			if err != nil {
+				return nil, err
+			}
+			fn.Return = t
+		}
+		return fn, nil
+	case *ast.UnionType:
+		types := []Type{}
+		for _, member := range annotation.Types {
+			t, err := fromAnnotation(member)
+			if err != nil {
+				return nil, err
+			}
+			types = append(types, t)
+		}
+		return join(types...), nil
+	default:
+		return ANY, nil
+	}
+}
+
+func fromNamedType(annotation *ast.NamedType) (Type, error) {
+	args := []Type{}
+	for _, arg := range annotation.Arguments {
+		t, err := fromAnnotation(arg)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, t)
+	}
+
+	wantArgs := 0
+	var t Type
+	switch annotation.Name {
+	case "any":
+		t = ANY
+	case "int", "string", "bool", "null":
+		t = basicTypes[annotation.Name]
+	case "namespace":
+		t = NAMESPACE
+	case "array":
+		wantArgs = 1
+		t = ARRAY
+		if len(args) == 1 {
+			t = &Array{Element: args[0]}
+		}
+	case "hash":
+		wantArgs = 2
+		t = HASH
+		if len(args) == 2 {
+			t = &Hash{Key: args[0], Value: args[1]}
+		}
+	default:
+		return nil, fmt.Errorf("unknown type: %s", annotation.Name)
+	}
+
+	if len(args) != 0 && len(args) != wantArgs {
+		return nil, fmt.Errorf("wrong number of type arguments to %s. got=%d, want=%d",
+			annotation.Name, len(args), wantArgs)
+	}
+	return t, nil
+}
@@ -0,0 +1,89 @@
+package typechecker
+
+import (
+	"../ast"
+	"../lint"
+	"../object"
+)
+
+// NOTE: replの`:type`用に、環境に束縛された値の型を使って式の型を推論する(評価はしない)
+
+// programの値(最後の文の値)の型と、型の誤り
+// env(とその外側)の変数の型は、束縛された値から決める
+func TypeOf(program *ast.Program, env *object.Environment) (Type, []*lint.Diagnostic) {
+	c := newChecker(program, "")
+
+	s := newScope(nil, program.Statements, nil)
+	for e := env; e != nil; e = e.Outer() {
+		for _, name := range e.Names() {
+			// NOTE: programで宣言される変数と、内側の環境の変数を優先
+			if _, ok := s.declarations[name]; ok {
+				continue
+			}
+			value, _ := e.Get(name)
+			s.bind(name, ValueType(value))
+		}
+	}
+
+	t := c.statements(program.Statements, s)
+	if t == NEVER {
+		t = ANY
+	}
+	return t, c.diagnostics
+}
+
+// 値の型
+// 配列、ハッシュは書き換えられるため、要素の型は分からない(any)
+func ValueType(obj object.Object) Type {
+	return valueType(obj, true)
+}
+
+func valueType(obj object.Object, members bool) Type {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return INT
+	case *object.String:
+		return STRING
+	case *object.Boolean:
+		return BOOL
+	case *object.Null:
+		return NULL
+	case *object.Array:
+		return ARRAY
+	case *object.Hash:
+		return HASH
+	case *object.Builtin:
+		t, err := parseSignature(obj.Signature)
+		if err != nil {
+			return FUNCTION
+		}
+		return t
+	case *object.Function:
+		return functionType(obj)
+	case *object.NameSpace:
+		// NOTE: namespace内のnamespace(`self()`等で自身を含みうる)のメンバーは調べない
+		if !members {
+			return NAMESPACE
+		}
+		types := make(map[string]Type)
+		for _, name := range obj.Env.Names() {
+			value, _ := obj.Env.Get(name)
+			types[name] = valueType(value, false)
+		}
+		return &NameSpace{Members: types}
+	}
+
+	if obj != nil && obj.Type() == object.FUNCTION_OBJ {
+		// vmのクロージャ等
+		return FUNCTION
+	}
+	return ANY
+}
+
+// 関数の引数の型注釈と、本体から推論した戻り値の型
+// NOTE: 外側の変数の型は分からない(any)とする
+func functionType(fn *object.Function) Type {
+	literal := &ast.FunctionLiteral{Parameters: fn.Parameters, Body: fn.Body}
+	c := newChecker(&ast.Program{Statements: fn.Body.Statements}, "")
+	return c.functionLiteral(literal, newScope(nil, nil, nil))
+}
@@ -0,0 +1,99 @@
+package vm
+
+import (
+	"../object"
+)
+
+type frameKind int
+
+const (
+	mainFrame      frameKind = iota // トップレベル
+	functionFrame                   // 関数呼び出し
+	nameSpaceFrame                  // namespaceリテラルの本体
+)
+
+type Frame struct {
+	kind frameKind
+	fn   *object.CompiledFunction
+	cl   *object.Closure // 関数呼び出しのみ
+	ip   int
+	// 局所変数(関数呼び出しは引数から)の位置
+	basePointer int
+
+	// 名前で参照する変数の環境
+	// (namespaceの右辺、catchの評価中は一時的に切り替わる)
+	env      *object.Environment
+	rootEnv  *object.Environment
+	envStack []*object.Environment
+
+	// 評価中のfinallyの前に中断したエラー、return
+	pendings []pending
+	// 呼び出し中の関数の呼び出し命令の位置と環境(トレースバック用)
+	callIP  int
+	callEnv *object.Environment
+}
+
+func newFrame(kind frameKind, fn *object.CompiledFunction,
+	env *object.Environment, basePointer int) *Frame {
+
+	return &Frame{
+		kind:        kind,
+		fn:          fn,
+		ip:          -1,
+		basePointer: basePointer,
+		env:         env,
+		rootEnv:     env,
+	}
+}
+
+func (f *Frame) Instructions() []byte {
+	return f.fn.Instructions
+}
+
+func (f *Frame) pushEnv(env *object.Environment) {
+	f.envStack = append(f.envStack, f.env)
+	f.env = env
+}
+
+func (f *Frame) popEnv() {
+	f.env = f.envStack[len(f.envStack)-1]
+	f.envStack = f.envStack[:len(f.envStack)-1]
+}
+
+type handlerKind int
+
+const (
+	catchHandler handlerKind = iota
+	finallyHandler
+	// `ns.x`の右辺の評価中(エラーにnamespace名を付ける)
+	nameSpaceHandler
+)
+
+// try, namespaceの右辺の評価中に積まれ、エラー(とreturn)を捕捉する
+type handler struct {
+	kind       handlerKind
+	frameIndex int
+	target     int // ジャンプ先
+
+	// 評価開始時の状態(捕捉したら戻す)
+	sp           int
+	envDepth     int
+	env          *object.Environment
+	pendingDepth int
+
+	nameSpaceIdent string
+	mode           int
+}
+
+type pendingKind int
+
+const (
+	noPending pendingKind = iota
+	errorPending
+	returnPending
+)
+
+type pending struct {
+	kind  pendingKind
+	value object.Object
+}
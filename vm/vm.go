@@ -0,0 +1,825 @@
+package vm
+
+import (
+	"../ast"
+	"../code"
+	"../compiler"
+	"../evaluator"
+	"../object"
+	"fmt"
+)
+
+// NOTE: 評価器と共通の値を使う(同一性で比較するため)
+var (
+	TRUE  = evaluator.TRUE
+	FALSE = evaluator.FALSE
+	NULL  = evaluator.NULL
+)
+
+const StackSize = 2048
+
+type VM struct {
+	stack []object.Object
+	sp    int // 次に値を積む位置(スタックトップはstack[sp-1])
+
+	frames   []*Frame
+	handlers []handler
+	// 関数呼び出しの深さ
+	depth int
+
+	halted bool
+	result object.Object
+}
+
+func New(bytecode *compiler.Bytecode, env *object.Environment) *VM {
+	return &VM{
+		stack:  make([]object.Object, StackSize),
+		frames: []*Frame{newFrame(mainFrame, bytecode.Main, env, 0)},
+	}
+}
+
+// nodeをコンパイルし、envをトップレベルの環境として実行
+// (評価器のEvalと同じ値を返す)
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	comp := compiler.New()
+	if err := comp.Compile(node); err != nil {
+		return evaluator.NewError("compile error: %s", err)
+	}
+
+	return New(comp.Bytecode(), env).Run()
+}
+
+// スクリプトファイルを実行し、その環境を返す
+func RunScriptFile(fileName string) (*object.Environment, error) {
+	return evaluator.EvalScriptFileWith(fileName, Eval)
+}
+
+// NOTE: importしたファイルもvmで実行する
+// assert_errorに渡された関数もvmで呼び出す
+// (initで代入するのは初期化の循環を避けるため)
+var vmBuiltins map[string]*object.Builtin
+
+func init() {
+	vmBuiltins = map[string]*object.Builtin{
+		"import": &object.Builtin{
+			Name: "import",
+			Fn: func(env *object.Environment, args ...object.Object) object.Object {
+				return evaluator.ImportScript(args, RunScriptFile)
+			},
+		},
+		"assert_error": &object.Builtin{
+			Name: "assert_error",
+			Fn: func(env *object.Environment, args ...object.Object) object.Object {
+				return evaluator.AssertError(args, env, applyFunction)
+			},
+		},
+	}
+}
+
+func lookupBuiltin(name string) (*object.Builtin, bool) {
+	if builtin, ok := vmBuiltins[name]; ok {
+		return builtin, true
+	}
+	return evaluator.LookupBuiltin(name)
+}
+
+// 組み込み関数から関数を呼び出す
+// (呼び出し命令だけのトップレベルを別のvmで実行する)
+func applyFunction(fn object.Object, args []object.Object,
+	env *object.Environment) object.Object {
+
+	main := &object.CompiledFunction{
+		Instructions: append(code.Make(code.OpCall, len(args)),
+			code.Make(code.OpReturnValue)...),
+	}
+	vm := &VM{
+		stack:  make([]object.Object, StackSize),
+		frames: []*Frame{newFrame(mainFrame, main, env, 0)},
+	}
+	vm.push(fn)
+	for _, arg := range args {
+		vm.push(arg)
+	}
+	return vm.Run()
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[len(vm.frames)-1]
+}
+
+// 最後の文がletの場合はnil
+func (vm *VM) Run() object.Object {
+	for !vm.halted {
+		frame := vm.currentFrame()
+		frame.ip++
+		ip := frame.ip
+		ins := frame.fn.Instructions
+		op := code.Opcode(ins[ip])
+
+		switch op {
+		case code.OpConstant:
+			idx := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			vm.push(frame.fn.Constants[idx])
+
+		case code.OpPop:
+			vm.sp--
+
+		case code.OpTrue:
+			vm.push(TRUE)
+		case code.OpFalse:
+			vm.push(FALSE)
+		case code.OpNull:
+			vm.push(NULL)
+
+		case code.OpInfix:
+			operator := code.InfixOperators[code.ReadUint8(ins[ip+1:])]
+			frame.ip++
+			right := vm.pop()
+			left := vm.pop()
+			vm.pushResult(executeInfixOperation(operator, left, right))
+
+		case code.OpPrefix:
+			operator := code.PrefixOperators[code.ReadUint8(ins[ip+1:])]
+			frame.ip++
+			right := vm.pop()
+			if integer, ok := right.(*object.Integer); ok && operator == "-" {
+				vm.push(&object.Integer{Value: -integer.Value})
+				continue
+			}
+			vm.pushResult(evaluator.EvalPrefixOperation(operator, right))
+
+		case code.OpJump:
+			frame.ip = int(code.ReadUint16(ins[ip+1:])) - 1
+
+		case code.OpJumpNotTruthy:
+			target := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			if !evaluator.IsTruthy(vm.pop()) {
+				frame.ip = target - 1
+			}
+
+		case code.OpJumpShortCut:
+			operator := code.ShortCutOperators[code.ReadUint8(ins[ip+1:])]
+			target := int(code.ReadUint16(ins[ip+2:]))
+			frame.ip += 3
+			// 左辺で値が決まるなら左辺を残す
+			if evaluator.CanShortCut(operator, vm.stack[vm.sp-1]) {
+				frame.ip = target - 1
+				continue
+			}
+			// NOTE: `?.`, `?[`の左辺は続く命令で使う
+			if operator != "?." && operator != "?[" {
+				vm.sp--
+			}
+
+		case code.OpJumpNotNameSpace:
+			target := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			if _, ok := vm.stack[vm.sp-1].(*object.NameSpace); !ok {
+				frame.ip = target - 1
+			}
+
+		case code.OpEnterNameSpace:
+			nameSpaceIdent := vm.constantName(frame, code.ReadUint16(ins[ip+1:]))
+			mode := int(code.ReadUint8(ins[ip+3:]))
+			frame.ip += 3
+
+			left := vm.pop()
+			nameSpace, ok := left.(*object.NameSpace)
+			if !ok {
+				vm.throw(evaluator.NewError("field assignment not supported: %s",
+					left.Type()))
+				continue
+			}
+
+			vm.handlers = append(vm.handlers, handler{
+				kind:           nameSpaceHandler,
+				frameIndex:     len(vm.frames) - 1,
+				sp:             vm.sp,
+				envDepth:       len(frame.envStack),
+				env:            frame.env,
+				pendingDepth:   len(frame.pendings),
+				nameSpaceIdent: nameSpaceIdent,
+				mode:           mode,
+			})
+			frame.pushEnv(nameSpace.Env)
+
+		case code.OpLeaveNameSpace:
+			h := vm.handlers[len(vm.handlers)-1]
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+			nameSpaceEnv := frame.env
+			frame.popEnv()
+
+			// NOTE: メソッド呼び出し可能にするため、関数のスコープをnamespaceのものに変更
+			// (評価器のevalNameSpaceCallと同様)
+			if cl, ok := vm.stack[vm.sp-1].(*object.Closure); ok &&
+				h.mode == code.NameSpaceAccess {
+				cl.Env = nameSpaceEnv
+			}
+
+		case code.OpGetName:
+			name := vm.constantName(frame, code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			if val, ok := frame.env.Get(name); ok {
+				vm.push(val)
+				continue
+			}
+			if builtin, ok := lookupBuiltin(name); ok {
+				vm.push(builtin)
+				continue
+			}
+			vm.throw(evaluator.NewError("identifier not found: %s", name))
+
+		case code.OpDefine:
+			name := vm.constantName(frame, code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			frame.env.Set(name, vm.pop())
+
+		case code.OpDefineConst:
+			name := vm.constantName(frame, code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			frame.env.SetConst(name, vm.pop())
+
+		case code.OpCheckConst:
+			name := vm.constantName(frame, code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			if frame.env.IsConst(name) {
+				vm.throw(evaluator.NewError("cannot redeclare const: %s", name))
+			}
+
+		case code.OpGetLocal:
+			slot := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			val := vm.stack[frame.basePointer+slot]
+			if val == nil {
+				vm.throw(evaluator.NewError("identifier not found: %s",
+					frame.fn.LocalNames[slot]))
+				continue
+			}
+			vm.push(val)
+
+		case code.OpSetLocal:
+			slot := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			vm.stack[frame.basePointer+slot] = vm.pop()
+
+		case code.OpGetCell:
+			slot := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			cell := vm.stack[frame.basePointer+slot].(*object.Cell)
+			if cell.Value == nil {
+				vm.throw(evaluator.NewError("identifier not found: %s",
+					frame.fn.LocalNames[slot]))
+				continue
+			}
+			vm.push(cell.Value)
+
+		case code.OpSetCell:
+			slot := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			cell := vm.stack[frame.basePointer+slot].(*object.Cell)
+			cell.Value = vm.pop()
+
+		case code.OpGetFree:
+			idx := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			cell := frame.cl.Free[idx]
+			if cell.Value == nil {
+				vm.throw(evaluator.NewError("identifier not found: %s",
+					frame.fn.FreeSources[idx].Name))
+				continue
+			}
+			vm.push(cell.Value)
+
+		case code.OpNameFunction:
+			name := vm.constantName(frame, code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			if cl, ok := vm.stack[vm.sp-1].(*object.Closure); ok && cl.Name == "" {
+				cl.Name = name
+			}
+
+		case code.OpClosure:
+			idx := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			vm.push(vm.newClosure(frame, frame.fn.Constants[idx].(*object.CompiledFunction)))
+
+		case code.OpNameSpace:
+			idx := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			fn := frame.fn.Constants[idx].(*object.CompiledFunction)
+			env := object.NewEnclosedEnvironment(frame.env)
+			vm.frames = append(vm.frames, newFrame(nameSpaceFrame, fn, env, vm.sp))
+
+		case code.OpCall, code.OpTailCall:
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip++
+			vm.callFunction(numArgs, op == code.OpTailCall)
+
+		case code.OpCallSpread:
+			tail := code.ReadUint8(ins[ip+1:]) == 1
+			frame.ip++
+			args := vm.pop().(*object.Array)
+			for _, arg := range args.Elements {
+				vm.push(arg)
+			}
+			vm.callFunction(len(args.Elements), tail)
+
+		case code.OpReturnValue:
+			vm.returnValue(vm.pop())
+
+		case code.OpHalt:
+			vm.halted = true
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp -= numElements
+			vm.push(&object.Array{Elements: elements})
+
+		case code.OpArrayAppend:
+			val := vm.pop()
+			array := vm.stack[vm.sp-1].(*object.Array)
+			array.Elements = append(array.Elements, val)
+
+		case code.OpArrayExtend:
+			val := vm.pop()
+			spread, ok := val.(*object.Array)
+			if !ok {
+				vm.throw(evaluator.NewError("spread operator not supported: %s",
+					val.Type()))
+				continue
+			}
+			array := vm.stack[vm.sp-1].(*object.Array)
+			array.Elements = append(array.Elements, spread.Elements...)
+
+		case code.OpHash:
+			vm.push(&object.Hash{Pairs: make(map[object.HashKey]object.HashPair)})
+
+		case code.OpHashKey:
+			key := vm.stack[vm.sp-1]
+			if _, ok := key.(object.Hashable); !ok {
+				vm.throw(evaluator.NewError("unusable as hash key: %s", key.Type()))
+			}
+
+		case code.OpHashSet:
+			val := vm.pop()
+			key := vm.pop()
+			hash := vm.stack[vm.sp-1].(*object.Hash)
+			hash.Pairs[key.(object.Hashable).HashKey()] = object.HashPair{Key: key, Value: val}
+
+		case code.OpHashMerge:
+			val := vm.pop()
+			spread, ok := val.(*object.Hash)
+			if !ok {
+				vm.throw(evaluator.NewError("spread operator not supported: %s",
+					val.Type()))
+				continue
+			}
+			hash := vm.stack[vm.sp-1].(*object.Hash)
+			for hashed, pair := range spread.Pairs {
+				hash.Pairs[hashed] = pair
+			}
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			vm.pushResult(evaluator.EvalIndexOperation(left, index))
+
+		case code.OpSetIndex:
+			index := vm.pop()
+			left := vm.pop()
+			val := vm.pop()
+			vm.pushResult(evaluator.EvalIndexAssignment(left, index, val))
+
+		case code.OpSetField:
+			name := vm.constantName(frame, code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			left := vm.pop()
+			val := vm.pop()
+			vm.pushResult(setField(left, name, val))
+
+		case code.OpThrow:
+			vm.throw(evaluator.NewThrownError(vm.pop()))
+
+		case code.OpSetupCatch, code.OpSetupFinally:
+			target := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+			kind := catchHandler
+			if op == code.OpSetupFinally {
+				kind = finallyHandler
+			}
+			vm.handlers = append(vm.handlers, handler{
+				kind:         kind,
+				frameIndex:   len(vm.frames) - 1,
+				target:       target,
+				sp:           vm.sp,
+				envDepth:     len(frame.envStack),
+				env:          frame.env,
+				pendingDepth: len(frame.pendings),
+			})
+
+		case code.OpPopHandler:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+		case code.OpBeginFinally:
+			frame.pendings = append(frame.pendings, pending{kind: noPending})
+
+		case code.OpEndFinally:
+			p := frame.pendings[len(frame.pendings)-1]
+			frame.pendings = frame.pendings[:len(frame.pendings)-1]
+			switch p.kind {
+			case errorPending:
+				vm.throw(p.value.(*object.Error))
+			case returnPending:
+				vm.returnValue(p.value)
+			}
+
+		case code.OpPushScope:
+			frame.pushEnv(object.NewEnclosedEnvironment(frame.env))
+
+		case code.OpPopScope:
+			frame.popEnv()
+
+		default:
+			vm.halted = true
+			vm.result = evaluator.NewError("unknown opcode: %d", op)
+		}
+	}
+
+	return vm.result
+}
+
+func (vm *VM) push(obj object.Object) {
+	if vm.sp >= len(vm.stack) {
+		vm.growStack(vm.sp + 1)
+	}
+
+	vm.stack[vm.sp] = obj
+	vm.sp++
+}
+
+func (vm *VM) pop() object.Object {
+	vm.sp--
+	return vm.stack[vm.sp]
+}
+
+// 評価結果がエラーなら送出
+func (vm *VM) pushResult(obj object.Object) {
+	if errObj, ok := obj.(*object.Error); ok {
+		vm.throw(errObj)
+		return
+	}
+
+	vm.push(obj)
+}
+
+func (vm *VM) growStack(size int) {
+	newSize := len(vm.stack) * 2
+	for newSize < size {
+		newSize *= 2
+	}
+
+	stack := make([]object.Object, newSize)
+	copy(stack, vm.stack)
+	vm.stack = stack
+}
+
+func (vm *VM) constantName(frame *Frame, idx uint16) string {
+	return frame.fn.Constants[idx].(*object.String).Value
+}
+
+func (vm *VM) newClosure(frame *Frame, fn *object.CompiledFunction) *object.Closure {
+	free := make([]*object.Cell, len(fn.FreeSources))
+	for i, source := range fn.FreeSources {
+		if source.IsFree {
+			free[i] = frame.cl.Free[source.Index]
+		} else {
+			free[i] = vm.stack[frame.basePointer+source.Index].(*object.Cell)
+		}
+	}
+
+	return &object.Closure{Fn: fn, Free: free, Env: frame.env}
+}
+
+func executeInfixOperation(operator string, left, right object.Object) object.Object {
+	leftInt, ok := left.(*object.Integer)
+	if !ok {
+		return evaluator.EvalInfixOperation(operator, left, right)
+	}
+	rightInt, ok := right.(*object.Integer)
+	if !ok {
+		return evaluator.EvalInfixOperation(operator, left, right)
+	}
+
+	leftVal, rightVal := leftInt.Value, rightInt.Value
+	switch operator {
+	case "+":
+		return &object.Integer{Value: leftVal + rightVal}
+	case "-":
+		return &object.Integer{Value: leftVal - rightVal}
+	case "*":
+		return &object.Integer{Value: leftVal * rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return evaluator.EvalInfixOperation(operator, left, right)
+	}
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return TRUE
+	}
+	return FALSE
+}
+
+func setField(left object.Object, name string, val object.Object) object.Object {
+	nameSpace, ok := left.(*object.NameSpace)
+	if !ok {
+		return evaluator.NewError("field assignment not supported: %s", left.Type())
+	}
+
+	if nameSpace.Env.IsConst(name) {
+		return evaluator.NewError("cannot assign to const: %s", name)
+	}
+	// NOTE: 外側の環境ではなく、namespace自身の環境に束縛する
+	return nameSpace.Env.Set(name, val)
+}
+
+func (vm *VM) callFunction(numArgs int, tail bool) {
+	callee := vm.stack[vm.sp-1-numArgs]
+	frame := vm.currentFrame()
+
+	switch callee := callee.(type) {
+	case *object.Closure:
+		// 末尾呼び出しは呼び出し元のフレームを再利用
+		if tail && frame.kind == functionFrame {
+			vm.tailCall(callee, numArgs)
+			return
+		}
+
+		if evaluator.MaxCallDepth > 0 && vm.depth+1 > evaluator.MaxCallDepth {
+			vm.throw(evaluator.NewError(
+				"maximum recursion depth exceeded: depth=%d, function=%s",
+				vm.depth+1, callee.DisplayName()))
+			return
+		}
+		if numArgs != callee.Fn.NumParameters {
+			vm.throw(evaluator.NewError("wrong number of arguments. got=%d, want=%d",
+				numArgs, callee.Fn.NumParameters))
+			return
+		}
+
+		frame.callIP = frame.ip
+		frame.callEnv = frame.env
+		vm.pushFunctionFrame(callee, vm.sp-numArgs)
+
+	case *object.Builtin:
+		args := make([]object.Object, numArgs)
+		copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+		vm.sp -= numArgs + 1
+
+		result := callee.Fn(frame.env, args...)
+		if result == nil {
+			result = NULL
+		}
+		vm.pushResult(result)
+
+	default:
+		vm.throw(evaluator.NewError("not a function: %s", callee.Type()))
+	}
+}
+
+// 引数はstack[basePointer:]に積まれている
+func (vm *VM) pushFunctionFrame(cl *object.Closure, basePointer int) {
+	fn := cl.Fn
+
+	if fn.Dynamic {
+		env := object.NewEnclosedEnvironment(cl.Env)
+		for i, name := range fn.ParameterNames {
+			env.Set(name, vm.stack[basePointer+i])
+		}
+		vm.sp = basePointer
+		vm.frames = append(vm.frames, newFunctionFrame(cl, env, basePointer))
+		vm.depth++
+		return
+	}
+
+	sp := basePointer + fn.NumLocals
+	if sp > len(vm.stack) {
+		vm.growStack(sp)
+	}
+	for i := basePointer + fn.NumParameters; i < sp; i++ {
+		vm.stack[i] = nil
+	}
+	for _, slot := range fn.CellSlots {
+		vm.stack[basePointer+slot] = &object.Cell{Value: vm.stack[basePointer+slot]}
+	}
+	vm.sp = sp
+
+	vm.frames = append(vm.frames, newFunctionFrame(cl, cl.Env, basePointer))
+	vm.depth++
+}
+
+func newFunctionFrame(cl *object.Closure, env *object.Environment,
+	basePointer int) *Frame {
+
+	frame := newFrame(functionFrame, cl.Fn, env, basePointer)
+	frame.cl = cl
+	return frame
+}
+
+func (vm *VM) tailCall(cl *object.Closure, numArgs int) {
+	if numArgs != cl.Fn.NumParameters {
+		// NOTE: 評価器と同様、末尾呼び出しした関数の呼び出し元で発生したものとして扱う
+		vm.popFrame()
+		vm.throw(evaluator.NewError("wrong number of arguments. got=%d, want=%d",
+			numArgs, cl.Fn.NumParameters))
+		return
+	}
+
+	frame := vm.currentFrame()
+	// 関数と引数を呼び出し元の位置に移動
+	start := vm.sp - 1 - numArgs
+	copy(vm.stack[frame.basePointer-1:], vm.stack[start:vm.sp])
+	vm.sp = frame.basePointer + numArgs
+
+	vm.frames = vm.frames[:len(vm.frames)-1]
+	vm.depth--
+	vm.pushFunctionFrame(cl, frame.basePointer)
+}
+
+func (vm *VM) popFrame() *Frame {
+	frame := vm.currentFrame()
+	vm.frames = vm.frames[:len(vm.frames)-1]
+
+	switch frame.kind {
+	case functionFrame:
+		vm.depth--
+		// 呼び出した関数も取り除く
+		vm.sp = frame.basePointer - 1
+	case nameSpaceFrame:
+		vm.sp = frame.basePointer
+	}
+	return frame
+}
+
+func (vm *VM) returnValue(val object.Object) {
+	frameIndex := len(vm.frames) - 1
+	frame := vm.frames[frameIndex]
+
+	// returnより先にfinallyを評価
+	for len(vm.handlers) > 0 {
+		h := vm.handlers[len(vm.handlers)-1]
+		if h.frameIndex != frameIndex {
+			break
+		}
+		vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+		if h.kind == finallyHandler {
+			vm.restoreHandlerState(frame, h)
+			frame.pendings = append(frame.pendings, pending{kind: returnPending, value: val})
+			frame.ip = h.target - 1
+			return
+		}
+	}
+
+	switch frame.kind {
+	case mainFrame:
+		vm.halted = true
+		vm.result = val
+	case functionFrame:
+		vm.popFrame()
+		vm.push(val)
+	case nameSpaceFrame:
+		// NOTE: namespaceの本体の値は捨てる(評価器と同様)
+		vm.popFrame()
+		vm.push(&object.NameSpace{Env: frame.rootEnv})
+	}
+}
+
+func (vm *VM) restoreHandlerState(frame *Frame, h handler) {
+	vm.sp = h.sp
+	frame.env = h.env
+	frame.envStack = frame.envStack[:h.envDepth]
+	frame.pendings = frame.pendings[:h.pendingDepth]
+}
+
+// エラーを送出し、捕捉したハンドラ(またはフレームの外)へ移動
+func (vm *VM) throw(errObj *object.Error) {
+	vm.setErrorLocation(errObj)
+
+	for {
+		frameIndex := len(vm.frames) - 1
+		frame := vm.frames[frameIndex]
+
+		if len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].frameIndex == frameIndex {
+			h := vm.handlers[len(vm.handlers)-1]
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+			vm.restoreHandlerState(frame, h)
+
+			switch h.kind {
+			case nameSpaceHandler:
+				if h.mode == code.NameSpaceAccess {
+					// namespaceの変数名をメッセージに追加
+					// (catchできるよう、投げられた値や位置はそのまま)
+					wrapped := *errObj
+					wrapped.Message = fmt.Sprintf(`In namespace "%s": %s`,
+						h.nameSpaceIdent, errObj.Message)
+					errObj = &wrapped
+				}
+			case catchHandler:
+				vm.push(evaluator.ErrorToHash(errObj))
+				frame.ip = h.target - 1
+				return
+			case finallyHandler:
+				frame.pendings = append(frame.pendings, pending{kind: errorPending, value: errObj})
+				frame.ip = h.target - 1
+				return
+			}
+			continue
+		}
+
+		switch frame.kind {
+		case mainFrame:
+			vm.halted = true
+			vm.result = errObj
+			return
+		case nameSpaceFrame:
+			// NOTE: namespaceの本体のエラーは無視する(評価器と同様)
+			vm.popFrame()
+			vm.push(&object.NameSpace{Env: frame.rootEnv})
+			return
+		case functionFrame:
+			// NOTE: 位置が未設定のエラー(引数の数の誤り等)は呼び出し元で発生したものとして扱う
+			if errObj.Trace == nil && errObj.Line != 0 {
+				errObj.Trace = vm.captureTraceback(errObj)
+			}
+			vm.popFrame()
+			vm.setErrorLocation(errObj)
+		}
+	}
+}
+
+// エラーが起きた文の位置を記録(既に記録されている場合は何もしない)
+func (vm *VM) setErrorLocation(errObj *object.Error) {
+	if errObj.Line != 0 {
+		return
+	}
+
+	frame := vm.currentFrame()
+	r := object.FindSourceRange(frame.fn.Statements, frame.ip)
+	if r == nil {
+		return
+	}
+
+	errObj.Line = r.Line
+	errObj.Column = r.Column
+	errObj.File = evaluator.FileNameOf(frame.rootEnv)
+}
+
+// 呼び出し中の関数のトレースバック(評価器のcaptureTracebackと同じ形式)
+func (vm *VM) captureTraceback(errObj *object.Error) []object.TraceFrame {
+	trace := []object.TraceFrame{}
+	caller := object.TOPLEVEL_FUNCTION_NAME
+
+	for i := 1; i < len(vm.frames); i++ {
+		frame := vm.frames[i]
+		if frame.kind != functionFrame {
+			continue
+		}
+
+		callerFrame := vm.frames[i-1]
+		line := 0
+		if r := object.FindSourceRange(callerFrame.fn.Calls, callerFrame.callIP); r != nil {
+			line = r.Line
+		}
+
+		trace = append(trace, object.TraceFrame{
+			Function: caller,
+			File:     evaluator.FileNameOf(callerFrame.callEnv),
+			Line:     line,
+		})
+		caller = frame.cl.DisplayName()
+	}
+
+	return append(trace, object.TraceFrame{
+		Function: caller,
+		File:     errObj.File,
+		Line:     errObj.Line,
+	})
+}
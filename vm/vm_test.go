@@ -0,0 +1,277 @@
+package vm
+
+import (
+	"../evaluator"
+	"../lexer"
+	"../object"
+	"../parser"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testRun(input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	// 各テストごとに新しい(=独立した)環境
+	env := object.NewEnvironment()
+
+	return Eval(program, env)
+}
+
+func testInspect(t *testing.T, input string, obj object.Object, expected string) {
+	if obj == nil {
+		t.Errorf("result of %q is nil. want=%s", input, expected)
+		return
+	}
+	if obj.Inspect() != expected {
+		t.Errorf("wrong result of %q.\nwant=%s\ngot=%s", input, expected, obj.Inspect())
+	}
+}
+
+func TestRunExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", "50"},
+		{"1 < 2 == true", "true"},
+		{`"foo" + "bar"`, "foobar"},
+		{"!null", "true"},
+		{"if (1 > 2) { 10 } else { 20 }", "20"},
+		{"if (false) { 10 }", "null"},
+		{"true && 2 || 3", "2"},
+		{"null ?? 3", "3"},
+		{"[1, 2 * 2, ...[3, 4]]", "[1, 4, 3, 4]"},
+		{`{"a": 1, ...{"b": 2}}["b"]`, "2"},
+		{"[1, 2, 3][1]", "2"},
+		{"let a = null; [a?[0], a?.x, a?.f()]", "[null, null, null]"},
+		{"let h = {}; h[\"k\"] = 5; h[\"k\"]", "5"},
+		{"len([1, 2]) + len(\"abc\")", "5"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, testRun(tt.input), tt.expected)
+	}
+}
+
+func TestRunLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = 5; let b = a * 2; b", "10"},
+		{"const c = 1; c", "1"},
+		{"let f = fn(x) { let x = x * 2; x }; f(3)", "6"},
+		{"let x = 10; let f = fn() { let x = x + 1; x }; [f(), x]", "[11, 10]"},
+		// 束縛前に参照した変数は外側のものが見える(評価器と同様)
+		{"let y = 5; let f = fn() { let g = fn() { y }; let a = g(); let y = 10; [a, g()] }; f()",
+			"[5, 10]"},
+		{"let f = fn(n) { if (n > 0) { let m = n; m } else { m } }; f(1)", "1"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, testRun(tt.input), tt.expected)
+	}
+}
+
+func TestRunFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let add = fn(a, b) { a + b }; add(1, 2)", "3"},
+		{"let f = fn(x) { return x; 5 }; f(1)", "1"},
+		{"let f = fn() { if (true) { return 1 }; 2 }; f()", "1"},
+		{"let f = fn() { }; f()", "null"},
+		{"let f = fn(a, b) { [a, b] }; f(...[1], ...[2])", "[1, 2]"},
+		{"let f = fn(x) { fn(y) { fn(z) { x + y + z } } }; f(1)(2)(3)", "6"},
+		{"let mk = fn() { let n = 0; let get = fn() { n }; let n = 5; get }; mk()()", "5"},
+		{"let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)", "610"},
+		{"let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };" +
+			"let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; even(100001)",
+			"false"},
+		{"let arr = [1]; let f = fn() { append!(arr, 2) }; f(); arr", "[1, 2]"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, testRun(tt.input), tt.expected)
+	}
+}
+
+func TestRunNameSpaces(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let ns = namespace { let v = 3; let get = fn() { v }; }; [ns.get(), ns.v]", "[3, 3]"},
+		{"let ns = namespace { let arr = [1, 2]; }; ns.arr[0] = 5; ns.arr", "[5, 2]"},
+		{"let ns = namespace { let c = 1; }; ns.d = 2; ns.d", "2"},
+		{"let f = fn(n) { let m = 1; let ns = namespace { let k = m; }; ns.k + n }; f(2)", "3"},
+		{"let a = 1; let f = fn() { self().a }; f()", "1"},
+		{"let f = fn(n) { outer() }; type(f(3))", "NAMESPACE"},
+		// メソッド呼び出しではnamespace内の変数が見える
+		{"let ns = namespace { let v = 1; }; let g = fn() { v }; ns.g = g; ns.g()", "1"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, testRun(tt.input), tt.expected)
+	}
+}
+
+func TestRunTryExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { throw "x" } catch (e) { e["message"] }`, "x"},
+		{`try { 1 } finally { 2 }`, "1"},
+		{`let f = fn() { try { return 1 } finally { return 3 }; 2 }; f()`, "3"},
+		{`let f = fn() { try { throw "x" } catch (e) { return e["message"] } }; f()`, "x"},
+		{`try { try { throw "a" } finally { 1 } } catch (e) { e["message"] }`, "a"},
+		{`let f = fn() { throw {"message": "m", "code": 3} };` +
+			`try { f() } catch (e) { [e["code"], e["line"], e["type"]] }`, "[3, 1, Error]"},
+		{`let f = fn(n) { try { if (n == 0) { throw "z" } else { f(n - 1) } } catch (e) { n } }; f(3)`,
+			"0"},
+		{`try { undefined } catch (e) { e["type"] }`, "RuntimeError"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, testRun(tt.input), tt.expected)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		input     string
+		expected  string
+		traceback string
+	}{
+		{
+			"5 + true;",
+			"type mismatch: INTEGER + BOOLEAN",
+			"traceback (most recent call last):\n    at <main> (line 1)\n",
+		},
+		{
+			"const x = 1; let x = 2",
+			"cannot redeclare const: x",
+			"traceback (most recent call last):\n    at <main> (line 1)\n",
+		},
+		{
+			"let f = fn(a, b) { a + b };\nlet g = fn() { f(1) + 1 };\ng()",
+			"wrong number of arguments. got=1, want=2",
+			"traceback (most recent call last):\n    at <main> (line 3)\n    at g (line 2)\n",
+		},
+		{
+			"let f = fn() {\n  g() + 1\n};\nlet g = fn() {\n  unknown\n};\nf()",
+			"identifier not found: unknown",
+			"traceback (most recent call last):\n" +
+				"    at <main> (line 7)\n    at f (line 2)\n    at g (line 5)\n",
+		},
+		{
+			"let ns = namespace { let f = fn() { undefinedVar }; };\nns.f()",
+			"identifier not found: undefinedVar",
+			"traceback (most recent call last):\n    at <main> (line 2)\n    at f (line 1)\n",
+		},
+		{
+			"let ns = namespace { const c = 1; }; ns.c = 2",
+			"cannot assign to const: c",
+			"traceback (most recent call last):\n    at <main> (line 1)\n",
+		},
+		{
+			"let r = fn(n) { if (n == 0) { 0 } else { 1 + r(n - 1) } }; r(20000)",
+			"maximum recursion depth exceeded: depth=10001, function=r",
+			"",
+		},
+		{"let ns = namespace { };\nns.missing", `In namespace "ns": identifier not found: missing`,
+			"traceback (most recent call last):\n    at <main> (line 2)\n"},
+		{"[...1]", "spread operator not supported: INTEGER", ""},
+		{"{fn(){}: 1}", "unusable as hash key: FUNCTION", ""},
+		{"1(2)", "not a function: INTEGER", ""},
+	}
+
+	for _, tt := range tests {
+		evaluated := testRun(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)",
+				tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message for %q. expected=%q, got=%q",
+				tt.input, tt.expected, errObj.Message)
+		}
+		if tt.traceback != "" && errObj.Traceback() != tt.traceback {
+			t.Errorf("wrong traceback for %q.\nwant=%q\ngot=%q",
+				tt.input, tt.traceback, errObj.Traceback())
+		}
+	}
+}
+
+func TestRunTailCalls(t *testing.T) {
+	input := "let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } };" +
+		"count(100000, 0)"
+	testInspect(t, input, testRun(input), "100000")
+
+	// スプレッドを含む呼び出しも末尾呼び出し
+	input = "let count = fn(n, acc) { if (n == 0) { acc } else { count(...[n - 1, acc + 1]) } };" +
+		"count(100000, 0)"
+	testInspect(t, input, testRun(input), "100000")
+}
+
+func TestRunImport(t *testing.T) {
+	// NOTE: importのファイル探索システムはmain.goを基準に作られているので、
+	// ファイルは絶対参照する
+	curDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("fail to get current dir: %s", err)
+	}
+	path := filepath.Join(filepath.Dir(curDir), "scripts")
+
+	input := fmt.Sprintf(
+		`let std = import("%s/std"); std.map([1, 2, 3], fn(x) { x * x; });`, path)
+	testInspect(t, input, testRun(input), "[1, 4, 9]")
+}
+
+// 評価器と同じ結果になるか
+func TestRunSameAsEvaluator(t *testing.T) {
+	inputs := []string{
+		`let f = fn(x) { try { x + y } catch (e) { [e["line"], e["column"]] } }; f(1)`,
+		"let g = fn(n) { if (n == 0) { d(1) } else { g(n - 1) } }; let d = fn(a, b) { a }; g(3)",
+		"let f = fn() { let ns = namespace { let a = 1; }; ns.a = 5; ns.a }; f()",
+		"let a = [1, 2]; a[5] = 1",
+		"let f = fn(a, b) { a }; let g = fn() { f(...[1, 2, 3]) }; g()",
+		"1 . 2",
+		"let n = 5; n?.x",
+		`"a" + 1`,
+		"let x = 1;",
+		"fn(x) { x }",
+		// assert_errorに渡した関数もvmで呼び出す
+		`assert_error(fn() { x })["message"]`,
+		"assert_error(fn() { 1 })",
+		`let f = fn(n) { if (n == 0) { throw "e" } else { f(n - 1) } }; assert_error(fn() { f(3) }, "e")["value"]`,
+		"assert_eq([1, {}], [1, {\"a\": 2}])",
+	}
+
+	for _, input := range inputs {
+		l := lexer.New(input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		expected := evaluator.Eval(program, object.NewEnvironment())
+		actual := Eval(program, object.NewEnvironment())
+
+		if expected == nil || actual == nil {
+			if expected != actual {
+				t.Errorf("wrong result of %q. want=%v, got=%v", input, expected, actual)
+			}
+			continue
+		}
+		testInspect(t, input, actual, expected.Inspect())
+	}
+}